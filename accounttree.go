@@ -0,0 +1,172 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"sort"
+	"strings"
+)
+
+// AccountNode is a single account in an AccountTree. Parent accounts that are never declared or used on their own
+// (like Expenses in Expenses:Food) are still nodes, with both Declared and Used false.
+type AccountNode struct {
+	Name     string // The last part of the account name, "Food" for Expenses:Food.
+	Account  string // The full account name. Empty for the root of the tree.
+	Parent   *AccountNode
+	Children []*AccountNode // Sorted by name.
+
+	Declared bool // There is an account directive for this account.
+	Used     bool // There are postings to this account.
+
+	// From the account directive, if there is one.
+	Note    string
+	Aliases []string
+	Payees  []string
+	Default bool
+
+	Balance int64 // The balance attached to this account itself, see AccountTree.SetBalances.
+	Total   int64 // Balance plus the totals of all the children.
+}
+
+// Depth returns how deeply the account is nested, 1 for top level accounts and 0 for the root.
+func (n *AccountNode) Depth() int {
+	if n.Account == "" {
+		return 0
+	}
+	return strings.Count(n.Account, ":") + 1
+}
+
+// AccountTree is the hierarchy of accounts in a file, built from both the account directives and the accounts used
+// by postings.
+type AccountTree struct {
+	Root *AccountNode
+
+	byName map[string]*AccountNode
+}
+
+// NewAccountTree returns an empty tree.
+func NewAccountTree() *AccountTree {
+	root := &AccountNode{}
+	return &AccountTree{Root: root, byName: map[string]*AccountNode{"": root}}
+}
+
+// AccountTree returns the tree of every account that is declared or used by a posting in the file. The balances are
+// all zero, see AccountTree.SetBalances. If any account directives fail to parse an error is returned, same as
+// File.Accounts.
+func (f *File) AccountTree() (*AccountTree, error) {
+	accounts, err := f.Accounts()
+	if err != nil {
+		return nil, err
+	}
+
+	tree := NewAccountTree()
+	for _, a := range accounts {
+		n := tree.Add(a.Name)
+		n.Declared = true
+		n.Note = a.Note
+		n.Aliases = append(n.Aliases, a.Aliases...)
+		n.Payees = append(n.Payees, a.Payees...)
+		n.Default = n.Default || a.Default
+	}
+	for _, tr := range f.T {
+		for _, p := range tr.Postings {
+			tree.Add(p.Account).Used = true
+		}
+	}
+	return tree, nil
+}
+
+// Add returns the node for the account, adding it and any missing parents if needed.
+func (t *AccountTree) Add(account string) *AccountNode {
+	if n, ok := t.byName[account]; ok {
+		return n
+	}
+
+	parent, name := "", account
+	if i := strings.LastIndex(account, ":"); i != -1 {
+		parent, name = account[:i], account[i+1:]
+	}
+	p := t.Add(parent)
+	n := &AccountNode{Name: name, Account: account, Parent: p}
+
+	i := sort.Search(len(p.Children), func(i int) bool { return p.Children[i].Name >= name })
+	p.Children = append(p.Children, nil)
+	copy(p.Children[i+1:], p.Children[i:])
+	p.Children[i] = n
+
+	t.byName[account] = n
+	return n
+}
+
+// Find returns the node for the account, or nil if it isn't in the tree. Aliases are also checked.
+func (t *AccountTree) Find(account string) *AccountNode {
+	if n, ok := t.byName[account]; ok {
+		return n
+	}
+	for _, n := range t.byName {
+		for _, alias := range n.Aliases {
+			if alias == account {
+				return n
+			}
+		}
+	}
+	return nil
+}
+
+// Walk calls fn for every account in the tree (but not the root) in depth first order, parents before their
+// children, which is the order they are listed in a balance report.
+func (t *AccountTree) Walk(fn func(n *AccountNode)) {
+	for _, c := range t.Root.Children {
+		walkNode(c, fn)
+	}
+}
+
+// walkNode calls fn for n and then everything under it.
+func walkNode(n *AccountNode, fn func(n *AccountNode)) {
+	fn(n)
+	for _, c := range n.Children {
+		walkNode(c, fn)
+	}
+}
+
+// SetBalances attaches balances to the accounts, such as the ones returned by File.BalanceReport, replacing any
+// that were there before. Accounts that aren't in the tree yet are added. The totals of every node are updated
+// to include their children.
+func (t *AccountTree) SetBalances(balances map[string]int64) {
+	for _, n := range t.byName {
+		n.Balance, n.Total = 0, 0
+	}
+	for account, v := range balances {
+		t.Add(account).Balance = v
+	}
+
+	var total func(n *AccountNode) int64
+	total = func(n *AccountNode) int64 {
+		n.Total = n.Balance
+		for _, c := range n.Children {
+			n.Total += total(c)
+		}
+		return n.Total
+	}
+	total(t.Root)
+}
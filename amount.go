@@ -0,0 +1,275 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"math"
+	"math/big"
+	"math/bits"
+	"strings"
+)
+
+// ValueScale is the number of decimal places in posting values, which are in ten thousandths of a dollar.
+const ValueScale = 4
+
+// Amount is an exact decimal number of any size, stored as an integer and a scale (the number of decimal places),
+// so 12.345 is 12345 with a scale of 3. Posting values fit in an int64, but share quantities, high precision crypto
+// currencies, or hyperinflated currencies may not. Amounts that fit in an int64 are stored as one, so the common case
+// doesn't need to allocate. The zero value is zero.
+type Amount struct {
+	small int64
+	large *big.Int // Set only if the value doesn't fit in small.
+	scale int
+}
+
+// NewAmount returns the amount unscaled / 10^scale.
+func NewAmount(unscaled int64, scale int) Amount {
+	return Amount{small: unscaled, scale: scale}
+}
+
+// ValueAmount returns a posting value as an Amount.
+func ValueAmount(v int64) Amount {
+	return NewAmount(v, ValueScale)
+}
+
+// NewBigAmount returns the amount unscaled / 10^scale. The big.Int is copied.
+func NewBigAmount(unscaled *big.Int, scale int) Amount {
+	return Amount{large: new(big.Int).Set(unscaled), scale: scale}.normalize()
+}
+
+// normalize switches back to the int64 representation if the value fits.
+func (a Amount) normalize() Amount {
+	if a.large != nil && a.large.IsInt64() {
+		return Amount{small: a.large.Int64(), scale: a.scale}
+	}
+	return a
+}
+
+func (a Amount) bigInt() *big.Int {
+	if a.large != nil {
+		return a.large
+	}
+	return big.NewInt(a.small)
+}
+
+// ParseAmount parses a plain decimal number such as "-1234.5678", with an optional sign. The scale is the number of
+// digits after the decimal point, so no precision is lost.
+func ParseAmount(s string) (Amount, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	digits := whole + frac
+	if digits == "" || strings.TrimLeft(digits, "0123456789") != "" {
+		return Amount{}, ErrMalformedAmount{orig}
+	}
+
+	a := Amount{scale: len(frac)}
+	if len(digits) <= 18 {
+		for _, c := range digits {
+			a.small = a.small*10 + int64(c-'0')
+		}
+	} else {
+		a.large, _ = new(big.Int).SetString(digits, 10)
+	}
+	if neg {
+		a = a.Neg()
+	}
+	return a.normalize(), nil
+}
+
+// Scale returns the number of decimal places of the amount.
+func (a Amount) Scale() int {
+	return a.scale
+}
+
+// Unscaled returns the amount times 10^Scale as a new big.Int.
+func (a Amount) Unscaled() *big.Int {
+	return new(big.Int).Set(a.bigInt())
+}
+
+// Sign returns -1, 0, or 1.
+func (a Amount) Sign() int {
+	if a.large != nil {
+		return a.large.Sign()
+	}
+	switch {
+	case a.small < 0:
+		return -1
+	case a.small > 0:
+		return 1
+	}
+	return 0
+}
+
+// Neg returns -a.
+func (a Amount) Neg() Amount {
+	if a.large == nil && a.small != math.MinInt64 {
+		return Amount{small: -a.small, scale: a.scale}
+	}
+	return Amount{large: new(big.Int).Neg(a.bigInt()), scale: a.scale}.normalize()
+}
+
+// Rescale returns the amount with a different number of decimal places. Extra digits are rounded off, ties go to
+// even.
+func (a Amount) Rescale(scale int) Amount {
+	if scale == a.scale {
+		return a
+	}
+
+	if scale > a.scale {
+		if a.large == nil && scale-a.scale < len(pow10) {
+			hi, lo := bits.Mul64(uint64(abs(a.small)), uint64(pow10[scale-a.scale]))
+			if hi == 0 && lo <= math.MaxInt64 && a.small != math.MinInt64 {
+				v := int64(lo)
+				if a.small < 0 {
+					v = -v
+				}
+				return Amount{small: v, scale: scale}
+			}
+		}
+		m := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale-a.scale)), nil)
+		return Amount{large: m.Mul(m, a.bigInt()), scale: scale}.normalize()
+	}
+
+	if a.large == nil && a.scale-scale < len(pow10) {
+		d := pow10[a.scale-scale]
+		q, r := a.small/d, a.small%d
+		if half := abs(r) * 2; half > d || (half == d && q%2 != 0) {
+			if a.small < 0 {
+				q--
+			} else {
+				q++
+			}
+		}
+		return Amount{small: q, scale: scale}
+	}
+	d := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(a.scale-scale)), nil)
+	q, r := new(big.Int).QuoRem(a.bigInt(), d, new(big.Int))
+	half := new(big.Int).Abs(r)
+	half.Lsh(half, 1)
+	if c := half.Cmp(d); c > 0 || (c == 0 && q.Bit(0) != 0) {
+		q.Add(q, big.NewInt(int64(a.Sign())))
+	}
+	return Amount{large: q, scale: scale}.normalize()
+}
+
+// pow10 holds the powers of ten that fit in an int64.
+var pow10 = func() []int64 {
+	p := []int64{1}
+	for i := 1; i <= 18; i++ {
+		p = append(p, p[i-1]*10)
+	}
+	return p
+}()
+
+// align returns both amounts at the larger of their scales.
+func align(a, b Amount) (Amount, Amount) {
+	if a.scale < b.scale {
+		return a.Rescale(b.scale), b
+	}
+	return a, b.Rescale(a.scale)
+}
+
+// Add returns a + b, at the larger of their scales.
+func (a Amount) Add(b Amount) Amount {
+	a, b = align(a, b)
+	if a.large == nil && b.large == nil {
+		sum := a.small + b.small
+		// Overflow happens only if both have the same sign and the sum has the other one.
+		if (a.small >= 0) != (b.small >= 0) || (sum >= 0) == (a.small >= 0) {
+			return Amount{small: sum, scale: a.scale}
+		}
+	}
+	return Amount{large: new(big.Int).Add(a.bigInt(), b.bigInt()), scale: a.scale}.normalize()
+}
+
+// Sub returns a - b, at the larger of their scales.
+func (a Amount) Sub(b Amount) Amount {
+	return a.Add(b.Neg())
+}
+
+// Mul returns a * b. The scale of the result is the sum of their scales, so nothing is lost.
+func (a Amount) Mul(b Amount) Amount {
+	if a.large == nil && b.large == nil {
+		hi, lo := bits.Mul64(uint64(abs(a.small)), uint64(abs(b.small)))
+		if hi == 0 && lo <= math.MaxInt64 && a.small != math.MinInt64 && b.small != math.MinInt64 {
+			v := int64(lo)
+			if (a.small < 0) != (b.small < 0) {
+				v = -v
+			}
+			return Amount{small: v, scale: a.scale + b.scale}
+		}
+	}
+	return Amount{large: new(big.Int).Mul(a.bigInt(), b.bigInt()), scale: a.scale + b.scale}.normalize()
+}
+
+// Cmp returns -1 if a < b, 0 if they are equal, and 1 if a > b.
+func (a Amount) Cmp(b Amount) int {
+	return a.Sub(b).Sign()
+}
+
+// Value returns the amount as a posting value (rounded to ten thousandths), or false if it doesn't fit in an int64.
+func (a Amount) Value() (int64, bool) {
+	r := a.Rescale(ValueScale)
+	return r.small, r.large == nil
+}
+
+// String returns the amount as a plain decimal number with all of its decimal places, such as "-12.3400".
+func (a Amount) String() string {
+	digits := new(big.Int).Abs(a.bigInt()).String()
+	if a.large == nil {
+		digits = big.NewInt(abs(a.small)).String()
+		if a.small == math.MinInt64 {
+			digits = strings.TrimPrefix(big.NewInt(a.small).String(), "-")
+		}
+	}
+
+	if a.scale > 0 {
+		if len(digits) <= a.scale {
+			digits = strings.Repeat("0", a.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-a.scale] + "." + digits[len(digits)-a.scale:]
+	}
+	if a.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// GobEncode implements gob.GobEncoder, so amounts can be cached. The amount is written the same as String.
+func (a Amount) GobEncode() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// GobDecode implements gob.GobDecoder, reading an amount written by GobEncode.
+func (a *Amount) GobDecode(data []byte) error {
+	v, err := ParseAmount(string(data))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+func TestAmount(t *testing.T) {
+	parse := func(s string) ledger.Amount {
+		a, err := ledger.ParseAmount(s)
+		if err != nil {
+			t.Fatalf("Parsing %q: %v", s, err)
+		}
+		return a
+	}
+
+	cases := []struct {
+		got, want string
+	}{
+		{parse("-12.34").String(), "-12.34"},
+		{parse(".5").String(), "0.5"},
+		{parse("0.00000001").Add(parse("1")).String(), "1.00000001"},
+		{parse("9223372036854775807").Add(parse("1")).String(), "9223372036854775808"},
+		{parse("-9223372036854775808").Neg().String(), "9223372036854775808"},
+		{parse("123456789012345678901234567890.5").Sub(parse("0.5")).String(), "123456789012345678901234567890.0"},
+		{parse("99999999999.99999999").Mul(parse("1000000000")).String(), "99999999999999999990.00000000"},
+		{parse("2.345").Rescale(2).String(), "2.34"},
+		{parse("2.355").Rescale(2).String(), "2.36"},
+		{parse("-2.355").Rescale(2).String(), "-2.36"},
+		{parse("12345678901234567890.125").Rescale(2).String(), "12345678901234567890.12"},
+		{parse("1").Rescale(30).Rescale(0).String(), "1"},
+		{ledger.ValueAmount(123400).String(), "12.3400"},
+	}
+	for i, c := range cases {
+		if c.got != c.want {
+			t.Errorf("Case %v: Got %v, expected %v", i, c.got, c.want)
+		}
+	}
+
+	if parse("1.10").Cmp(parse("1.1")) != 0 || parse("1").Cmp(parse("100000000000000000000")) != -1 {
+		t.Errorf("Compare is wrong.")
+	}
+	if _, ok := parse("922337203685477.5808").Value(); ok {
+		t.Errorf("Value didn't report overflow.")
+	}
+	if v, ok := parse("1.23456").Value(); !ok || v != 12346 {
+		t.Errorf("Value is %v, expected 12346.", v)
+	}
+	for _, s := range []string{"", "-", "1.2.3", "1e5", "$5"} {
+		if _, err := ledger.ParseAmount(s); err == nil {
+			t.Errorf("Parsing %q didn't fail.", s)
+		}
+	}
+
+	btc := &ledger.Directive{Type: "commodity", Argument: "BTC", Lines: []string{"format 1,000.00 BTC", "precision 8"}}
+	afs := ledger.NewAmountFormats(ledger.DefaultAmountFormat)
+	if err := afs.AddDirective(btc); err != nil {
+		t.Fatal(err)
+	}
+	a, symbol, err := afs.ParseAmount("-1,234.12345678 BTC")
+	if err != nil || symbol != "BTC" || a.String() != "-1234.12345678" {
+		t.Errorf("Got %v %v %v, expected -1234.12345678 BTC.", a, symbol, err)
+	}
+	if _, _, err := afs.ParseAmount("1.123456789 BTC"); err == nil {
+		t.Errorf("Too many decimal places didn't fail.")
+	}
+	if a, _, _ := afs.ParseAmount("$1.5"); a.String() != "1.5000" {
+		t.Errorf("Got %v, expected 1.5000.", a)
+	}
+}
+
+func TestParseHighPrecision(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+commodity BTC
+	format 1,000.00 BTC
+	precision 8
+
+2022/01/02 * Exchange
+	Assets:Wallet                                                  0.12345678 BTC
+	Assets:Exchange                                                -0.12345678 BTC
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := f.T[0].Postings[0]
+	if p.Value != 1235 || p.Amount.String() != "0.12345678" || p.Commodity != "BTC" {
+		t.Errorf("Got %v %v %v, expected 1235 0.12345678 BTC.", p.Value, p.Amount, p.Commodity)
+	}
+	if _, err := f.Register(ledger.ReportQuery{}); err != nil {
+		t.Errorf("Transaction doesn't balance: %v", err)
+	}
+
+	// Formatting keeps every decimal place, even without the source text.
+	f.T[0].Raw = ""
+	buf := new(bytes.Buffer)
+	if err := f.Format(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), " -0.12345678 BTC\n") {
+		t.Errorf("Exact amount lost when formatting:\n%v", buf)
+	}
+	nf, err := parse.ParseLedgerString(buf.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := nf.T[0].Postings[1].Amount; a.String() != "-0.12345678" {
+		t.Errorf("Got %v after formatting, expected -0.12345678.", a)
+	}
+
+	// Dollars still only have four places.
+	_, err = parse.ParseLedgerString("2022/01/02 Test\n\tAssets:Wallet  $0.12345678\n\tAssets:Exchange\n")
+	if err == nil {
+		t.Errorf("Too many decimal places in dollars didn't fail.")
+	}
+}
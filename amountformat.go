@@ -0,0 +1,395 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// AmountFormat describes how amounts are written, such as "$1234.56" or "1.234,56 €". Only the way the amount is
+// written changes, amounts are still all in one currency.
+type AmountFormat struct {
+	Symbol    string // The commodity symbol, such as "$" or "€". May be empty.
+	After     bool   // The symbol goes after the number instead of before it.
+	Space     bool   // There is a space between the symbol and the number.
+	Decimal   rune   // The decimal separator, '.' or ','.
+	Thousands rune   // The thousands separator, or 0 for none.
+
+	// The most decimal places an amount in this commodity may have when parsed with ParseAmount, for commodities
+	// that need more than posting values have (such as share quantities or crypto currencies). Set with a
+	// precision line in the commodity directive. 0 means ValueScale.
+	Precision int
+}
+
+// DefaultAmountFormat is the format used when a file doesn't declare one: "$1234.56".
+var DefaultAmountFormat = AmountFormat{Symbol: "$", Decimal: '.'}
+
+// ErrMalformedAmount is returned when an amount or an example amount format can't be parsed.
+type ErrMalformedAmount struct {
+	Amount string
+}
+
+func (err ErrMalformedAmount) Error() string {
+	return fmt.Sprintf("Malformed amount: %q", err.Amount)
+}
+
+// ParseAmountFormat works out the format of an example amount, as used by the format line of a ledger commodity
+// directive. For example "1.000,00 €" gives a '.' thousands separator, a ',' decimal separator, and a "€" symbol
+// after the number with a space between. A lone separator followed by exactly three digits is taken to be a
+// thousands separator.
+func ParseAmountFormat(example string) (AmountFormat, error) {
+	example = strings.TrimSpace(example)
+	first := strings.IndexFunc(example, unicode.IsDigit)
+	last := strings.LastIndexFunc(example, unicode.IsDigit)
+	if first == -1 {
+		return AmountFormat{}, ErrMalformedAmount{example}
+	}
+
+	af := AmountFormat{Decimal: '.'}
+	prefix := strings.TrimSpace(strings.Trim(example[:first], "-"))
+	suffix := strings.TrimSpace(strings.Trim(example[last+1:], "-"))
+	switch {
+	case prefix != "" && suffix != "":
+		return AmountFormat{}, ErrMalformedAmount{example}
+	case prefix != "":
+		af.Symbol = prefix
+		af.Space = strings.HasSuffix(strings.TrimRight(example[:first], "-"), " ")
+	case suffix != "":
+		af.Symbol, af.After = suffix, true
+		af.Space = strings.HasPrefix(example[last+1:], " ")
+	}
+
+	// Find the separators in the number, and how many digits follow the last one.
+	seps := []rune{}
+	digits := 0
+	for _, c := range example[first : last+1] {
+		if unicode.IsDigit(c) {
+			digits++
+			continue
+		}
+		if !isSeparator(c) {
+			return AmountFormat{}, ErrMalformedAmount{example}
+		}
+		seps = append(seps, c)
+		digits = 0
+	}
+
+	switch {
+	case len(seps) == 0:
+	case seps[len(seps)-1] != seps[0]:
+		af.Thousands, af.Decimal = seps[0], seps[len(seps)-1]
+	case len(seps) > 1 || digits == 3:
+		af.Thousands = seps[0]
+		if af.Thousands == '.' {
+			af.Decimal = ','
+		}
+	default:
+		af.Decimal = seps[0]
+	}
+	if af.Decimal != '.' && af.Decimal != ',' {
+		return AmountFormat{}, ErrMalformedAmount{example}
+	}
+	return af, nil
+}
+
+func isSeparator(c rune) bool {
+	return c == '.' || c == ',' || c == '\'' || c == ' ' || c == '\u00a0' || c == '\u202f'
+}
+
+// Format writes the value in this format, rounded to the nearest cent.
+func (af AmountFormat) Format(v int64) string {
+	return af.withSymbol(af.FormatNumber(v))
+}
+
+// FormatAmount is like Format, but writes the amount with all of its decimal places instead of rounding to cents.
+func (af AmountFormat) FormatAmount(a Amount) string {
+	return af.withSymbol(af.group(a.String()))
+}
+
+func (af AmountFormat) withSymbol(number string) string {
+	if af.Symbol == "" {
+		return number
+	}
+
+	space := ""
+	if af.Space {
+		space = " "
+	}
+	if af.After {
+		return number + space + af.Symbol
+	}
+	// Negative signs go in front of the symbol, except for dollars where ledger has always put them after.
+	if strings.HasPrefix(number, "-") && af.Symbol != "$" {
+		return "-" + af.Symbol + space + number[1:]
+	}
+	return af.Symbol + space + number
+}
+
+// FormatNumber is exactly the same as Format, but it does not add the symbol.
+func (af AmountFormat) FormatNumber(v int64) string {
+	return af.group(FormatValueNumber(v))
+}
+
+// group takes a plain decimal number such as "-1234.56" and writes it with the separators of this format.
+func (af AmountFormat) group(s string) string {
+	if af.Decimal == '.' && af.Thousands == 0 {
+		return s
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if af.Thousands != 0 {
+		grouped := []rune{}
+		for i, c := range whole {
+			if i > 0 && (len(whole)-i)%3 == 0 {
+				grouped = append(grouped, af.Thousands)
+			}
+			grouped = append(grouped, c)
+		}
+		whole = string(grouped)
+	}
+
+	s = whole
+	if hasFrac {
+		s += string(af.Decimal) + frac
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// ParseNumber parses a number (without a symbol) written in this format. Thousands separators may be left out, and
+// the other usual separators (spaces, apostrophes, and whichever of ',' and '.' isn't the decimal separator) are
+// also allowed between digits. A leading minus makes the number negative. At most four decimal places are allowed.
+func (af AmountFormat) ParseNumber(s string) (int64, error) {
+	a, err := af.parseDecimal(s, ValueScale)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := a.Value()
+	if !ok {
+		return 0, ErrMalformedAmount{s}
+	}
+	return v, nil
+}
+
+// ParseAmount is like ParseNumber, but the number may be any size and have up to Precision decimal places. The
+// result always has Precision decimal places.
+func (af AmountFormat) ParseAmount(s string) (Amount, error) {
+	precision := af.Precision
+	if precision == 0 {
+		precision = ValueScale
+	}
+	return af.parseDecimal(s, precision)
+}
+
+func (af AmountFormat) parseDecimal(s string, precision int) (Amount, error) {
+	decimal := af.Decimal
+	if decimal == 0 {
+		decimal = '.'
+	}
+
+	orig := s
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac := []rune{}, []rune{}
+	cur := &whole
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			*cur = append(*cur, c)
+		case c == decimal && cur == &whole && len(whole) > 0:
+			cur = &frac
+		case (c == af.Thousands || isSeparator(c)) && cur == &whole && len(whole) > 0:
+		default:
+			return Amount{}, ErrMalformedAmount{orig}
+		}
+	}
+	if len(whole)+len(frac) == 0 || len(frac) > precision {
+		return Amount{}, ErrMalformedAmount{orig}
+	}
+
+	a, err := ParseAmount(string(whole) + "." + string(frac))
+	if err != nil {
+		return Amount{}, ErrMalformedAmount{orig}
+	}
+	a = a.Rescale(precision)
+	if neg {
+		a = a.Neg()
+	}
+	return a, nil
+}
+
+// AmountFormats holds the amount formats declared in a file, see File.AmountFormats.
+type AmountFormats struct {
+	Default     AmountFormat            // The format used for writing amounts, and for amounts without a symbol.
+	Commodities map[string]AmountFormat // The declared formats by symbol.
+}
+
+// NewAmountFormats returns a set of formats with nothing declared, using def as the default.
+func NewAmountFormats(def AmountFormat) *AmountFormats {
+	return &AmountFormats{Default: def, Commodities: map[string]AmountFormat{}}
+}
+
+// AddDirective adds the format declared by a directive, if it declares one. These are commodity directives with a
+// format line (or an example amount instead of a symbol), and D directives, which set the default format:
+//
+//	commodity €
+//		format 1.000,00 €
+//		default
+//	commodity BTC
+//		format 1,000.00 BTC
+//		precision 8
+//	D 1.000,00 €
+//
+// The first format declared becomes the default unless a later one is marked default or set with D. Other
+// directives are ignored.
+func (afs *AmountFormats) AddDirective(d *Directive) error {
+	example, def, precision := "", d.Type == "D", 0
+	switch d.Type {
+	case "D":
+		example = d.Argument
+	case "commodity":
+		v, err := d.Parse()
+		if err != nil {
+			return err
+		}
+		c := v.(*CommodityDirective)
+		example, def, precision = c.Format, c.Default, c.Precision
+	}
+	if example == "" {
+		return nil
+	}
+
+	af, err := ParseAmountFormat(example)
+	if err != nil {
+		return err
+	}
+	if d.Type == "commodity" && af.Symbol == "" {
+		af.Symbol = strings.TrimSpace(d.Argument)
+	}
+	af.Precision = precision
+	if def || len(afs.Commodities) == 0 {
+		afs.Default = af
+	}
+	afs.Commodities[af.Symbol] = af
+	return nil
+}
+
+// Parse parses an amount with an optional symbol before or after the number, using the format declared for that
+// symbol. Amounts without a symbol use the default format, and "$" amounts are always accepted even if dollars
+// weren't declared.
+func (afs *AmountFormats) Parse(s string) (int64, error) {
+	af, number, neg, err := afs.split(s)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := af.ParseNumber(number)
+	if err != nil {
+		return 0, ErrMalformedAmount{s}
+	}
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+// ParseAmount is like Parse, but uses the precision declared for the commodity and returns an Amount, along with
+// the symbol.
+func (afs *AmountFormats) ParseAmount(s string) (Amount, string, error) {
+	af, number, neg, err := afs.split(s)
+	if err != nil {
+		return Amount{}, "", err
+	}
+
+	a, err := af.ParseAmount(number)
+	if err != nil {
+		return Amount{}, "", ErrMalformedAmount{s}
+	}
+	if neg {
+		a = a.Neg()
+	}
+	return a, af.Symbol, nil
+}
+
+// split finds the format for the symbol of an amount, and returns the number part of the amount along with whether
+// there was a minus before the symbol.
+func (afs *AmountFormats) split(s string) (AmountFormat, string, bool, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	rest := strings.TrimSpace(strings.TrimPrefix(s, "-"))
+
+	start := strings.IndexFunc(rest, func(c rune) bool { return unicode.IsDigit(c) || c == '-' })
+	end := strings.LastIndexFunc(rest, unicode.IsDigit)
+	if start == -1 || end == -1 {
+		return AmountFormat{}, "", false, ErrMalformedAmount{s}
+	}
+	symbol := strings.TrimSpace(rest[:start])
+	if after := strings.TrimSpace(rest[end+1:]); after != "" {
+		if symbol != "" {
+			return AmountFormat{}, "", false, ErrMalformedAmount{s}
+		}
+		symbol = after
+	}
+
+	af, ok := afs.Commodities[symbol]
+	switch {
+	case ok:
+	case symbol == "" || symbol == afs.Default.Symbol:
+		af = afs.Default
+	case symbol == "$":
+		af = DefaultAmountFormat
+	default:
+		return AmountFormat{}, "", false, ErrUnknownCommodity{symbol}
+	}
+	return af, rest[start : end+1], neg, nil
+}
+
+// ErrUnknownCommodity is returned by AmountFormats.Parse for amounts with a symbol that wasn't declared.
+type ErrUnknownCommodity struct {
+	Symbol string
+}
+
+func (err ErrUnknownCommodity) Error() string {
+	return fmt.Sprintf("Unknown commodity %q, only one currency is supported.", err.Symbol)
+}
+
+// AmountFormats returns the amount formats declared by the commodity and D directives in the file, see
+// AmountFormats.AddDirective. If none are declared the default is DefaultAmountFormat.
+func (f *File) AmountFormats() (*AmountFormats, error) {
+	afs := NewAmountFormats(DefaultAmountFormat)
+	for i := range f.D {
+		err := afs.AddDirective(&f.D[i])
+		if err != nil {
+			return nil, DirectiveError{i, f.D[i].Location, f.D[i].Type, err}
+		}
+	}
+	return afs, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+func TestAmountFormats(t *testing.T) {
+	cases := []struct {
+		example string
+		format  ledger.AmountFormat
+		value   string // How -1234567.8 is written.
+	}{
+		{"$1000.00", ledger.DefaultAmountFormat, "$-1234567.80"},
+		{"$1,000.00", ledger.AmountFormat{Symbol: "$", Decimal: '.', Thousands: ','}, "$-1,234,567.80"},
+		{"1.000,00 €", ledger.AmountFormat{Symbol: "€", After: true, Space: true, Decimal: ',', Thousands: '.'}, "-1.234.567,80 €"},
+		{"EUR 1 000,00", ledger.AmountFormat{Symbol: "EUR", Space: true, Decimal: ',', Thousands: ' '}, "-EUR 1 234 567,80"},
+		{"1'000", ledger.AmountFormat{Decimal: '.', Thousands: '\''}, "-1'234'567.80"},
+		{"10,5kr", ledger.AmountFormat{Symbol: "kr", After: true, Decimal: ','}, "-1234567,80kr"},
+	}
+	for _, c := range cases {
+		af, err := ledger.ParseAmountFormat(c.example)
+		if err != nil {
+			t.Errorf("%q: %v", c.example, err)
+			continue
+		}
+		if af != c.format {
+			t.Errorf("%q: incorrect format %#v", c.example, af)
+		}
+		if s := af.Format(-12345678000); s != c.value {
+			t.Errorf("%q: incorrect formatted value %q", c.example, s)
+		}
+
+		afs := ledger.NewAmountFormats(af)
+		v, err := afs.Parse(c.value)
+		if err != nil || v != -12345678000 {
+			t.Errorf("%q: %q parsed as %v, %v", c.example, c.value, v, err)
+		}
+	}
+}
+
+func TestAmountFormatFile(t *testing.T) {
+	input := `commodity €
+	format 1.000,00 €
+
+2022/01/05 * Rent
+	Expenses:Rent                                              1.234,56 €
+	Assets:Checking                                           -1.234,56 € = -234,56 €
+
+2022/01/06 * Snack
+	Expenses:Food                                                  5,00 €
+	Assets:Checking
+`
+	f, err := parse.ParseLedgerString(input + "\n2022/01/07 * Dollars\n\tExpenses:Food  $1,000.50\n\tAssets:Checking\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.T[0].Postings[0].Value != 12345600 || f.T[0].Postings[1].Assert != -2345600 || f.T[2].Postings[0].Value != 10005000 {
+		t.Errorf("Incorrect amounts: %#v", f.T)
+	}
+
+	f.T = f.T[:2]
+	buf := &bytes.Buffer{}
+	err = f.Format(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "\n"+input {
+		t.Errorf("Incorrect output:\n%v", buf.String())
+	}
+
+	_, err = parse.ParseLedgerString("2022/01/07 * Pounds\n\tExpenses:Food  £10.00\n\tAssets:Checking\n")
+	if _, ok := err.(parse.ErrUnknownCommodity); !ok {
+		t.Errorf("Undeclared commodity accepted: %v", err)
+	}
+}
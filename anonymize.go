@@ -0,0 +1,239 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// AnonymizeOptions controls how File.Anonymize scrambles a file.
+type AnonymizeOptions struct {
+	Seed int64 // The random seed used for amounts. The same seed always gives the same result.
+
+	// Amounts scrambles amounts as well as names. Every transaction is scaled by its own random factor, so it still
+	// balances, and balance assertions are recalculated so they still hold.
+	Amounts bool
+
+	// KeepMagnitude limits the random factor to between 0.75 and 1.25, so amounts keep roughly the same size.
+	// Otherwise the factor is anywhere between 0.1 and 10.
+	KeepMagnitude bool
+}
+
+// Anonymize replaces everything in the file that could identify the owner, so it can be shared in a bug report.
+// Descriptions and payees become "Payee 1", "Payee 2", and so on. Every part of an account name except the top level
+// becomes "Account 1", "Account 2", and so on, so the shape of the account tree is kept. The same name is always
+// replaced by the same thing. Comments, notes, codes, and KV pairs are removed, except ID and RID, FITID (renumbered),
+// and the Account KV pair from imports (replaced like any other account). Directives other than account, payee,
+// and commodity directives are removed.
+// Dates, statuses, and tags are not changed, and neither are amounts unless asked.
+func (f *File) Anonymize(opts AnonymizeOptions) {
+	a := &anonymizer{
+		payees:   map[string]string{},
+		accounts: map[string]string{},
+		fitids:   map[string]string{},
+	}
+
+	for i := range f.T {
+		tr := &f.T[i]
+		tr.Description = a.payee(tr.Description)
+		tr.Code = ""
+		tr.Comments = nil
+		// The source text may have things the parser threw away, such as comments between postings.
+		tr.SetRaw("")
+
+		kvs := map[string]string{}
+		for k, v := range tr.KVPairs {
+			switch k {
+			case "ID", "RID":
+				kvs[k] = v
+			case "FITID":
+				kvs[k] = a.fitid(v)
+			case "Account":
+				kvs[k] = a.account(v)
+			}
+		}
+		tr.KVPairs = kvs
+
+		for j := range tr.Postings {
+			tr.Postings[j].Account = a.account(tr.Postings[j].Account)
+			tr.Postings[j].Note = ""
+		}
+	}
+
+	if opts.Amounts {
+		f.scrambleAmounts(opts)
+	}
+
+	ds := []Directive{}
+	for _, d := range f.D {
+		switch d.Type {
+		case "account":
+			d.Argument = a.account(d.Argument)
+		case "payee":
+			d.Argument = a.payee(d.Argument)
+		case "commodity":
+		default:
+			continue
+		}
+		d.Lines = nil
+		d.SetRaw("")
+		ds = append(ds, d)
+	}
+	f.D = ds
+}
+
+type anonymizer struct {
+	payees   map[string]string
+	accounts map[string]string // Full account names (and their parents) to their replacements.
+	renamed  int               // The number of account name parts replaced so far.
+	fitids   map[string]string
+}
+
+func (a *anonymizer) payee(name string) string {
+	if name == "" {
+		return ""
+	}
+	if r, ok := a.payees[name]; ok {
+		return r
+	}
+	r := fmt.Sprintf("Payee %v", len(a.payees)+1)
+	a.payees[name] = r
+	return r
+}
+
+func (a *anonymizer) account(name string) string {
+	if r, ok := a.accounts[name]; ok {
+		return r
+	}
+
+	i := strings.LastIndexByte(name, ':')
+	if i == -1 {
+		// Top level accounts keep their names.
+		a.accounts[name] = name
+		return name
+	}
+	parent := a.account(name[:i])
+	a.renamed++
+	r := parent + fmt.Sprintf(":Account %v", a.renamed)
+	a.accounts[name] = r
+	return r
+}
+
+func (a *anonymizer) fitid(id string) string {
+	if r, ok := a.fitids[id]; ok {
+		return r
+	}
+	r := fmt.Sprint(len(a.fitids) + 1)
+	a.fitids[id] = r
+	return r
+}
+
+// scrambleAmounts scales every transaction by a random factor. All revisions of a transaction use the same factor.
+// Balance assertions and assignments are set to the new running balances, so they hold as long as they did before.
+func (f *File) scrambleAmounts(opts AnonymizeOptions) {
+	rng := rand.New(rand.NewSource(opts.Seed))
+	lo, hi := math.Log(0.1), math.Log(10)
+	if opts.KeepMagnitude {
+		lo, hi = math.Log(0.75), math.Log(1.25)
+	}
+	factors := map[string]float64{}
+	factor := func(tr *Transaction) float64 {
+		x := math.Exp(lo + rng.Float64()*(hi-lo))
+		id := tr.KVPairs["ID"]
+		if id == "" {
+			return x
+		}
+		if _, ok := factors[id]; !ok {
+			factors[id] = x
+		}
+		return factors[id]
+	}
+
+	ixs := make([]int, len(f.T))
+	for i := range ixs {
+		ixs[i] = i
+	}
+	sort.SliceStable(ixs, func(i, j int) bool {
+		return f.T[ixs[i]].Date.Before(f.T[ixs[j]].Date)
+	})
+
+	scale := func(v int64, x float64) int64 {
+		return int64(math.Round(float64(v) * x))
+	}
+
+	oldBal, newBal := map[string]int64{}, map[string]int64{}
+	for _, i := range ixs {
+		tr := &f.T[i]
+		x := factor(tr)
+
+		values, err := assignedValues(i, tr, oldBal)
+		if err != nil {
+			// No way to keep this one balanced, so just scale it.
+			for j := range tr.Postings {
+				tr.Postings[j].Value = scale(tr.Postings[j].Value, x)
+				tr.Postings[j].Assert = scale(tr.Postings[j].Assert, x)
+			}
+			continue
+		}
+
+		// Rounding can leave the transaction a little off, so the null posting (or the largest posting if there
+		// isn't one) takes up the difference.
+		sum, adjust := int64(0), -1
+		scaled := make([]int64, len(values))
+		for j, v := range values {
+			p := &tr.Postings[j]
+			oldBal[p.Account] += v
+			scaled[j] = scale(v, x)
+			sum += scaled[j]
+			if p.Null && !p.HasAssert {
+				adjust = j
+			}
+		}
+		if adjust == -1 {
+			adjust = 0
+			for j, v := range values {
+				if abs(v) > abs(values[adjust]) {
+					adjust = j
+				}
+			}
+		}
+		if len(scaled) > 0 {
+			scaled[adjust] -= sum
+		}
+
+		for j := range tr.Postings {
+			p := &tr.Postings[j]
+			newBal[p.Account] += scaled[j]
+			if !p.Null {
+				p.Value = scaled[j]
+			}
+			if p.HasAssert {
+				p.Assert = newBal[p.Account]
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"sort"
+)
+
+// AssertionError is returned by File.CheckAssertions for each balance assertion that does not hold.
+type AssertionError struct {
+	T        int
+	ID       string // The ID of the transaction, if it has one.
+	L        Position
+	PL       Position // The position of the posting with the assertion.
+	Account  string
+	Expected int64 // The asserted balance.
+	Actual   int64 // The balance the account really had.
+}
+
+func (err AssertionError) Error() string {
+	return fmt.Sprintf("Transaction %v (defined at %v) asserts a balance of %v for %v, but the balance is %v.",
+		err.T, err.L, FormatValue(err.Expected), err.Account, FormatValue(err.Actual))
+}
+
+// CheckAssertions walks the transactions in chronological order (file order for transactions on the same date)
+// keeping a running balance for every account, and returns an error for every balance assertion that does not
+// match. A null posting with an assertion is a balance assignment (the posting gets whatever value makes the
+// assertion true), same as ledger, so those never fail.
+// Transactions that do not balance are reported as well, since the running balances can't be trusted after one.
+func (f *File) CheckAssertions() []error {
+	ixs := make([]int, len(f.T))
+	for i := range ixs {
+		ixs[i] = i
+	}
+	sort.SliceStable(ixs, func(i, j int) bool {
+		return f.T[ixs[i]].Date.Before(f.T[ixs[j]].Date)
+	})
+
+	errs := []error{}
+	balances := map[string]int64{}
+	for _, i := range ixs {
+		tr := &f.T[i]
+
+		values, err := assignedValues(i, tr, balances)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for j, p := range tr.Postings {
+			balances[p.Account] += values[j]
+
+			if p.HasAssert && balances[p.Account] != p.Assert {
+				errs = append(errs, AssertionError{
+					T:        i,
+					ID:       tr.KVPairs["ID"],
+					L:        tr.Location,
+					PL:       p.Location,
+					Account:  p.Account,
+					Expected: p.Assert,
+					Actual:   balances[p.Account],
+				})
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// assignedValues returns the value of each posting in the transaction, with balance assignments resolved against
+// the given running balances and the remaining null posting (if any) set to balance the transaction.
+func assignedValues(ix int, tr *Transaction, balances map[string]int64) ([]int64, error) {
+	values := make([]int64, len(tr.Postings))
+	local := map[string]int64{} // Changes made by earlier postings in this transaction.
+	null := -1
+	sum := int64(0)
+	for i, p := range tr.Postings {
+		switch {
+		case !p.Null:
+			values[i] = p.Value
+		case p.HasAssert:
+			values[i] = p.Assert - balances[p.Account] - local[p.Account]
+		case null != -1:
+			return nil, MultipleNullError{ix, tr.Location, tr.KVPairs["ID"]}
+		default:
+			null = i
+			continue
+		}
+		local[p.Account] += values[i]
+		sum += values[i]
+	}
+
+	if null != -1 {
+		values[null] = -sum
+	} else if sum != 0 {
+		return nil, BalanceError{ix, tr.Location, tr.KVPairs["ID"]}
+	}
+	return values, nil
+}
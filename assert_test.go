@@ -0,0 +1,158 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+func TestCheckAssertions(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  []string // See describe below.
+	}{
+		{"passing", `
+2022/01/01 Opening
+	Assets:Checking                $100.00 = $100.00
+	Equity:Opening
+
+2022/01/02 Groceries
+	Expenses:Food                   $25.00
+	Assets:Checking                $-25.00 = $75.00
+`, nil},
+		{"failing", `
+2022/01/01 Opening
+	Assets:Checking                $100.00
+	Equity:Opening
+
+2022/01/02 Groceries
+	Expenses:Food                   $25.00 = $20.00
+	Assets:Checking                $-25.00 = $80.00
+`, []string{
+			"assert 1 Expenses:Food $20.00 $25.00",
+			"assert 1 Assets:Checking $80.00 $75.00",
+		}},
+		{"chronological", `
+2022/01/05 Groceries
+	Expenses:Food                   $25.00
+	Assets:Checking                $-25.00 = $75.00
+
+2022/01/01 Opening
+	Assets:Checking                $100.00 = $100.00
+	Equity:Opening
+`, nil},
+		// Transactions on the same date go in file order.
+		{"same date", `
+2022/01/01 Opening
+	Assets:Checking                $100.00 = $100.00
+	Equity:Opening
+
+2022/01/01 Groceries
+	Expenses:Food                   $25.00
+	Assets:Checking                $-25.00 = $100.00
+`, []string{
+			"assert 1 Assets:Checking $100.00 $75.00",
+		}},
+		{"assignment", `
+2022/01/01 Opening
+	Assets:Checking                $100.00
+	Equity:Opening
+
+2022/01/31 Reconcile
+	Assets:Checking                        = $90.00
+	Expenses:Fees
+
+2022/02/01 Check
+	Expenses:Fees                    $0.00 = $10.00
+	Assets:Checking                  $0.00 = $90.00
+`, nil},
+		// Earlier postings in the same transaction count towards an assignment.
+		{"assignment after posting", `
+2022/01/01 Opening
+	Assets:Checking                $100.00
+	Assets:Checking                        = $150.00
+	Equity:Opening                 $-150.00
+`, nil},
+		// A transaction that doesn't balance is reported, and left out of the running balances.
+		{"unbalanced", `
+2022/01/01 Opening
+	Assets:Checking                $100.00
+	Equity:Opening
+
+2022/01/02 Groceries
+	Expenses:Food                   $25.00
+	Assets:Checking                $-20.00
+
+2022/01/03 Check
+	Assets:Checking                  $0.00 = $100.00
+	Equity:Opening                   $0.00
+`, []string{
+			"balance 1",
+		}},
+		{"multiple nulls", `
+2022/01/01 Opening
+	Assets:Checking                $100.00
+	Assets:Savings
+	Equity:Opening
+`, []string{
+			"nulls 0",
+		}},
+	}
+
+	// describe gives a short description of an error that leaves out where things were found.
+	describe := func(err error) string {
+		switch err := err.(type) {
+		case ledger.AssertionError:
+			return fmt.Sprintf("assert %v %v %v %v", err.T, err.Account, ledger.FormatValue(err.Expected), ledger.FormatValue(err.Actual))
+		case ledger.BalanceError:
+			return fmt.Sprintf("balance %v", err.T)
+		case ledger.MultipleNullError:
+			return fmt.Sprintf("nulls %v", err.T)
+		}
+		return err.Error()
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			f, err := parse.ParseLedgerString(c.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, err := range f.CheckAssertions() {
+				got = append(got, describe(err))
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Expected errors:\n%q\ngot:\n%q", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Beancount is stricter than ledger about names, so some things have to be changed on the way out:
+//
+//   - Accounts must start with Assets, Liabilities, Equity, Income, or Expenses. Common alternatives (Asset,
+//     Expense, Revenue, ...) are renamed, and anything else is moved under Equity. Every part of the name must
+//     start with a capital letter or digit and may only hold letters, digits, and dashes. Renamed accounts keep
+//     their ledger name in a "ledger-name" metadata entry on their open directive, so importing the file again
+//     gives back the original names.
+//   - Metadata keys must start with a lower case letter. K/V pairs have the first letter of their key lowered,
+//     except all capital keys (ID, RID, FITID) which are lowered completely.
+//   - Tags may only hold letters, digits, and "-_/.".
+//
+// The transaction code and clear date are written as "code" and "clear-date" metadata, posting notes as "note"
+// metadata, and the "Narration" and "Links" k/v pairs become the beancount narration and links.
+
+// beancountRoots maps the lower case name of a top level ledger account to the beancount root it goes under.
+var beancountRoots = map[string]string{
+	"assets":      "Assets",
+	"asset":       "Assets",
+	"liabilities": "Liabilities",
+	"liability":   "Liabilities",
+	"equity":      "Equity",
+	"income":      "Income",
+	"revenue":     "Income",
+	"revenues":    "Income",
+	"expenses":    "Expenses",
+	"expense":     "Expenses",
+}
+
+// beancountAccount converts a ledger account name to a valid beancount account name.
+func beancountAccount(name string) string {
+	parts := strings.Split(name, ":")
+	if root, ok := beancountRoots[strings.ToLower(parts[0])]; ok {
+		parts[0] = root
+	} else {
+		parts = append([]string{"Equity"}, parts...)
+	}
+
+	for i, part := range parts {
+		rs := []rune(part)
+		for j, r := range rs {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' {
+				rs[j] = '-'
+			}
+		}
+		if len(rs) == 0 || !unicode.IsLetter(rs[0]) && !unicode.IsDigit(rs[0]) {
+			rs = append([]rune{'X'}, rs...)
+		}
+		rs[0] = unicode.ToUpper(rs[0])
+		parts[i] = string(rs)
+	}
+	return strings.Join(parts, ":")
+}
+
+// beancountKey converts a ledger k/v pair key to a beancount metadata key.
+func beancountKey(key string) string {
+	rs := []rune(key)
+	for i, r := range rs {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			rs[i] = '-'
+		}
+	}
+	if len(rs) == 0 || !unicode.IsLetter(rs[0]) {
+		rs = append([]rune{'x'}, rs...)
+	}
+	if strings.ToUpper(key) == key {
+		return strings.ToLower(string(rs))
+	}
+	rs[0] = unicode.ToLower(rs[0])
+	return string(rs)
+}
+
+// ledgerKey is the reverse of beancountKey, for keys beancountKey could have made. The first letter is
+// capitalized, except for a few well known all capital keys.
+func ledgerKey(key string) string {
+	switch key {
+	case "id", "rid", "fitid":
+		return strings.ToUpper(key)
+	}
+	rs := []rune(key)
+	if len(rs) == 0 {
+		return key
+	}
+	rs[0] = unicode.ToUpper(rs[0])
+	return string(rs)
+}
+
+// beancountTag converts a ledger tag to a valid beancount tag.
+func beancountTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_/.", r) {
+			return r
+		}
+		return '-'
+	}, tag)
+}
+
+// beancountNumber formats an amount the way beancount wants it: no currency symbol, and as many decimal places as
+// needed (at least two) so no precision is lost.
+func beancountNumber(v int64) string {
+	neg := v < 0
+	if neg {
+		v = -v
+	}
+	s := fmt.Sprintf("%d.%04d", v/10000, v%10000)
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "0"), "0")
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// ExportBeancount writes out the file in beancount syntax, for use with fava and the rest of the beancount
+// ecosystem. Only the latest revision of each transaction is written and voided transactions are left out.
+// Every account gets an open directive dated with its first use, null postings are left empty unless they are
+// balance assignments, and balance assertions become balance directives on the following day (beancount checks
+// them at the start of the day). Price and commodity directives are converted, comments are kept, and any other
+// directives are written out as comments.
+// Returns an error if any transaction does not balance.
+func (f *File) ExportBeancount(w io.Writer) error {
+	trs, _, err := f.reportTransactions(&ReportQuery{})
+	if err != nil {
+		return err
+	}
+
+	// Pick names for all the accounts, making sure no two ledger accounts end up with the same beancount name.
+	names := map[string]string{}
+	used := map[string]bool{}
+	opened := map[string]time.Time{}
+	for _, tr := range trs {
+		for _, p := range tr.Postings {
+			if _, ok := names[p.Account]; ok {
+				continue
+			}
+			name := beancountAccount(p.Account)
+			for i := 2; used[name]; i++ {
+				name = fmt.Sprintf("%v-%v", beancountAccount(p.Account), i)
+			}
+			names[p.Account] = name
+			used[name] = true
+			opened[p.Account] = tr.Date
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "option \"operating_currency\" \"USD\"\n\n")
+
+	accounts := maps.Keys(names)
+	sort.Slice(accounts, func(i, j int) bool {
+		return names[accounts[i]] < names[accounts[j]]
+	})
+	for _, acct := range accounts {
+		fmt.Fprintf(bw, "%v open %v\n", opened[acct].Format("2006-01-02"), names[acct])
+		if names[acct] != acct {
+			fmt.Fprintf(bw, "  ledger-name: %v\n", strconv.Quote(acct))
+		}
+	}
+
+	first := time.Time{}
+	if len(trs) > 0 {
+		first = trs[0].Date
+	}
+	for _, d := range f.D {
+		exportBeancountDirective(bw, &d, first)
+	}
+
+	// Assertions are written after the last transaction of the day, adjusted for any later postings to the same
+	// account that day.
+	type assertion struct {
+		account string
+		value   int64
+	}
+	asserts := []assertion{}
+	day := time.Time{}
+	flush := func() {
+		for _, a := range asserts {
+			fmt.Fprintf(bw, "\n%v balance %v %v USD\n", day.AddDate(0, 0, 1).Format("2006-01-02"), names[a.account], beancountNumber(a.value))
+		}
+		asserts = asserts[:0]
+	}
+	for _, tr := range trs {
+		if !tr.Date.Equal(day) {
+			flush()
+			day = tr.Date
+		}
+
+		for _, p := range tr.Postings {
+			ix := slices.IndexFunc(asserts, func(a assertion) bool { return a.account == p.Account })
+			switch {
+			case p.HasAssert && ix != -1:
+				asserts[ix].value = p.Assert
+			case p.HasAssert:
+				asserts = append(asserts, assertion{p.Account, p.Assert})
+			case ix != -1:
+				asserts[ix].value += p.Value
+			}
+		}
+
+		if beancountAssertionOnly(&tr) {
+			continue
+		}
+		exportBeancountTransaction(bw, &tr, names)
+	}
+	flush()
+
+	return bw.Flush()
+}
+
+// beancountAssertionOnly returns true if the transaction does nothing but assert balances, so it can be written
+// as just balance directives.
+func beancountAssertionOnly(tr *Transaction) bool {
+	for _, p := range tr.Postings {
+		if p.Null || p.Value != 0 || !p.HasAssert {
+			return false
+		}
+	}
+	return len(tr.Postings) > 0
+}
+
+func exportBeancountTransaction(w io.Writer, tr *Transaction, names map[string]string) {
+	flag := "txn"
+	switch tr.Status {
+	case StatusClear:
+		flag = "*"
+	case StatusPending:
+		flag = "!"
+	}
+
+	fmt.Fprintf(w, "\n%v %v %v", tr.Date.Format("2006-01-02"), flag, strconv.Quote(tr.Description))
+	if narration, ok := tr.KVPairs["Narration"]; ok {
+		fmt.Fprintf(w, " %v", strconv.Quote(narration))
+	}
+	tags := maps.Keys(tr.Tags)
+	slices.Sort(tags)
+	for _, tag := range tags {
+		fmt.Fprintf(w, " #%v", beancountTag(tag))
+	}
+	for _, link := range strings.Fields(tr.KVPairs["Links"]) {
+		fmt.Fprintf(w, " ^%v", beancountTag(link))
+	}
+	fmt.Fprintln(w)
+
+	if tr.Code != "" {
+		fmt.Fprintf(w, "  code: %v\n", strconv.Quote(tr.Code))
+	}
+	if !tr.ClearDate.IsZero() {
+		fmt.Fprintf(w, "  clear-date: %v\n", tr.ClearDate.Format("2006-01-02"))
+	}
+	keys := maps.Keys(tr.KVPairs)
+	slices.Sort(keys)
+	for _, k := range keys {
+		if k == "Narration" || k == "Links" {
+			continue
+		}
+		fmt.Fprintf(w, "  %v: %v\n", beancountKey(k), strconv.Quote(tr.KVPairs[k]))
+	}
+	for _, line := range tr.Comments {
+		fmt.Fprintf(w, "  ; %v\n", line)
+	}
+
+	for _, p := range tr.Postings {
+		fmt.Fprint(w, "  ")
+		switch p.Status {
+		case StatusClear:
+			fmt.Fprint(w, "* ")
+		case StatusPending:
+			fmt.Fprint(w, "! ")
+		}
+		fmt.Fprint(w, names[p.Account])
+		if !p.Null || p.HasAssert {
+			fmt.Fprintf(w, "  %v USD", beancountNumber(p.Value))
+		}
+		fmt.Fprintln(w)
+		if p.Note != "" {
+			fmt.Fprintf(w, "    note: %v\n", strconv.Quote(p.Note))
+		}
+	}
+}
+
+// exportBeancountDirective writes out a ledger directive as the closest beancount equivalent, or as a comment if
+// there isn't one. Dates are needed for commodity directives, which don't have one in ledger, so they get the date
+// of the first transaction.
+func exportBeancountDirective(w io.Writer, d *Directive, first time.Time) {
+	switch d.Type {
+	case ";":
+		fmt.Fprintln(w)
+		for _, line := range d.Lines {
+			fmt.Fprintf(w, ";%v\n", line)
+		}
+		return
+	case "account":
+		// Accounts that are used get an open directive anyway.
+		return
+	case "commodity":
+		if sym := strings.TrimSpace(d.Argument); sym != "" && sym != "$" && beancountCommodity(sym) {
+			fmt.Fprintf(w, "\n%v commodity %v\n", first.Format("2006-01-02"), sym)
+			return
+		}
+	case "P":
+		// P 2026/01/02 AAPL $150.00
+		fields := strings.Fields(d.Argument)
+		if len(fields) == 3 && beancountCommodity(fields[1]) && strings.HasPrefix(fields[2], "$") {
+			date, derr := time.Parse("2006/01/02", fields[0])
+			v, verr := ParseValueNumber(strings.ReplaceAll(fields[2][1:], ",", ""))
+			if derr == nil && verr == nil {
+				fmt.Fprintf(w, "\n%v price %v %v USD\n", date.Format("2006-01-02"), fields[1], beancountNumber(v))
+				return
+			}
+		}
+	}
+
+	fmt.Fprintln(w)
+	for _, line := range strings.Split(strings.TrimRight(d.String(), "\n"), "\n") {
+		fmt.Fprintf(w, "; %v\n", line)
+	}
+}
+
+// beancountCommodity returns true if the symbol is a valid beancount currency name.
+func beancountCommodity(sym string) bool {
+	if len(sym) == 0 || len(sym) > 24 {
+		return false
+	}
+	for i, r := range sym {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9' && i > 0, strings.ContainsRune("'._-", r) && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
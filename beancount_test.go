@@ -0,0 +1,97 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+func TestBeancountRoundTrip(t *testing.T) {
+	input := `
+2022/01/02=2022/01/04 * (101) Coffee Shop
+	; :food:
+	; ID: a1
+	; Narration: Breakfast
+	Expenses:Dining Out                                           $4.5025 ; large
+	Assets:Checking                                                = $95.4975
+
+2022/01/03 ! Unknown
+	; ID: a2
+	Unknown:Account                                               $10.00
+	! Assets:Checking
+`
+	f, err := parse.ParseLedgerString(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Start with $100 so the assignment in the first transaction works.
+	f.T = append([]ledger.Transaction{{
+		Date:        f.T[0].Date,
+		Description: "Opening Balance",
+		KVPairs:     map[string]string{"ID": "a0"},
+		Postings:    []ledger.Posting{{Account: "Assets:Checking", Value: 1000000}, {Account: "Equity:Opening", Null: true}},
+	}}, f.T...)
+
+	buf := new(bytes.Buffer)
+	err = f.ExportBeancount(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"2022-01-02 * \"Coffee Shop\" \"Breakfast\" #food",
+		"  clear-date: 2022-01-04",
+		"  Expenses:Dining-Out  4.5025 USD",
+		"2022-01-03 balance Assets:Checking 95.4975 USD",
+		"  ledger-name: \"Unknown:Account\"",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Export is missing %q:\n%v", want, buf.String())
+		}
+	}
+
+	nf := &ledger.File{}
+	err = nf.ImportBeancount(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The assignment came out as a plain amount and an assertion, so compare that separately.
+	if len(nf.T) != 4 || nf.T[2].Postings[0].Assert != 954975 {
+		t.Fatalf("Expected the assertion as a separate transaction:\n%v", nf.T)
+	}
+	nf.T = append(nf.T[:2], nf.T[3])
+	f.T[1].Postings[1] = ledger.Posting{Account: "Assets:Checking", Value: -45025}
+
+	for i := range f.T {
+		want, got := f.T[i], nf.T[i]
+		want.Location, got.Location = ledger.Position{}, ledger.Position{}
+		if got.String() != want.String() {
+			t.Errorf("Transaction %v changed:\n%v\n%v", i, want.String(), got.String())
+		}
+	}
+}
@@ -0,0 +1,614 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samuellwn/ledger/parse/lex"
+)
+
+// bcEntry is a transaction from a beancount file, waiting to be sorted. Beancount files don't have to be in any
+// order, and balance directives are checked at the start of their day, so they are imported as assertions at the
+// end of the day before.
+type bcEntry struct {
+	tr   Transaction
+	late bool // Sorts after everything else on the same day.
+	line int
+	pad  *bcPad
+}
+
+// bcPad is a pad directive, filled in by the next balance directive for its account.
+type bcPad struct {
+	account string
+	entry   int // The index of the balance assertion entry, -1 until one is found.
+	value   int64
+}
+
+// ImportBeancount imports a beancount file into this file. Transactions keep their flag, payee (as the
+// description), narration (as a "Narration" k/v pair, if there is a payee), tags, links (as a "Links" k/v pair),
+// and metadata (as k/v pairs, see ExportBeancount for how keys are converted). Open directives become account
+// directives, commodity and USD price directives become commodity and P directives, balance directives become
+// balance assertions, and pad directives become balance assignments. Anything else, including options, is kept as
+// a comment. All the directives go before the imported transactions, which are sorted by date.
+//
+// Only USD amounts are supported. Postings in other currencies are converted using their cost, or failing that
+// their price, with the units and price kept in the posting note (as "10 AAPL @ $150.00"). Beancount balance
+// assertions include sub accounts, ledger assertions do not, so assertions on parent accounts may fail.
+//
+// Transactions without an "id" are given IDs by the file's ID generator.
+func (f *File) ImportBeancount(r io.Reader) error {
+	lines := []string{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1024*1024)
+	for sc.Scan() {
+		lines = append(lines, strings.TrimRight(sc.Text(), " \t\r"))
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	entries := []bcEntry{}
+	dirs := []Directive{}
+	names := map[string]string{} // Beancount account names to ledger names, from ledger-name metadata.
+	pads := map[string]*bcPad{}
+	tags := map[string]bool{}
+	meta := map[string]string{}
+	comment := func(line int, text string) {
+		if n := len(dirs); n > 0 && dirs[n-1].Type == ";" && dirs[n-1].Location.Line() == uint64(line-len(dirs[n-1].Lines)) {
+			dirs[n-1].Lines = append(dirs[n-1].Lines, text)
+			return
+		}
+		dirs = append(dirs, Directive{Type: ";", Lines: []string{text}, FoundBefore: len(f.T), Location: bcLocation(line)})
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		lnum := i + 1
+
+		// The indented lines that belong to this entry.
+		body := []int{}
+		for i+1 < len(lines) && lines[i+1] != "" && (lines[i+1][0] == ' ' || lines[i+1][0] == '\t') {
+			i++
+			body = append(body, i)
+		}
+
+		switch {
+		case line == "":
+			continue
+		case line[0] == ';':
+			comment(lnum, line[1:])
+			continue
+		case line[0] == '*' || line[0] == '#' || line[0] == ' ' || line[0] == '\t':
+			// Org mode headings, and stray indented lines.
+			continue
+		}
+
+		text, _ := bcSplitComment(line)
+		fields, err := bcFields(text)
+		if err != nil || len(fields) == 0 {
+			return fmt.Errorf("Malformed beancount entry on line %v: %q", lnum, line)
+		}
+
+		switch fields[0] {
+		case "pushtag", "poptag":
+			if len(fields) != 2 || !strings.HasPrefix(fields[1], "#") {
+				return fmt.Errorf("Malformed %v on line %v: %q", fields[0], lnum, line)
+			}
+			if fields[0] == "pushtag" {
+				tags[fields[1][1:]] = true
+			} else {
+				delete(tags, fields[1][1:])
+			}
+			continue
+		case "pushmeta", "popmeta":
+			key, value, ok := bcMeta(text[len(fields[0]):])
+			if !ok {
+				return fmt.Errorf("Malformed %v on line %v: %q", fields[0], lnum, line)
+			}
+			if fields[0] == "pushmeta" {
+				meta[key] = value
+			} else {
+				delete(meta, key)
+			}
+			continue
+		case "option", "plugin", "include":
+			comment(lnum, " "+line)
+			continue
+		}
+
+		date, err := bcDate(fields[0])
+		if err != nil || len(fields) < 2 {
+			return fmt.Errorf("Malformed beancount entry on line %v: %q", lnum, line)
+		}
+
+		switch fields[1] {
+		case "open":
+			if len(fields) < 3 {
+				return fmt.Errorf("Malformed open directive on line %v: %q", lnum, line)
+			}
+			dirs = append(dirs, Directive{Type: "account", Argument: fields[2], FoundBefore: len(f.T), Location: bcLocation(lnum)})
+			for _, j := range body {
+				if key, value, ok := bcMeta(lines[j]); ok && key == "ledger-name" {
+					names[fields[2]] = value
+				}
+			}
+
+		case "commodity":
+			if len(fields) < 3 {
+				return fmt.Errorf("Malformed commodity directive on line %v: %q", lnum, line)
+			}
+			dirs = append(dirs, Directive{Type: "commodity", Argument: fields[2], FoundBefore: len(f.T), Location: bcLocation(lnum)})
+
+		case "price":
+			if len(fields) == 5 && fields[4] == "USD" {
+				v, err := bcNumber(fields[3])
+				if err != nil {
+					return fmt.Errorf("Malformed price on line %v: %q", lnum, line)
+				}
+				dirs = append(dirs, Directive{
+					Type:        "P",
+					Argument:    fmt.Sprintf("%v %v %v", date.Format("2006/01/02"), fields[2], FormatValue(ratValue(v))),
+					FoundBefore: len(f.T),
+					Location:    bcLocation(lnum),
+				})
+			} else {
+				comment(lnum, " "+line)
+			}
+
+		case "balance":
+			// Drop the tolerance if there is one.
+			if len(fields) == 7 && fields[4] == "~" {
+				fields = append(fields[:4], fields[6])
+			}
+			if len(fields) != 5 {
+				return fmt.Errorf("Malformed balance directive on line %v: %q", lnum, line)
+			}
+			if fields[4] != "USD" {
+				return fmt.Errorf("Balance in %v on line %v: only USD is supported.", fields[4], lnum)
+			}
+			n, err := bcNumber(fields[3])
+			if err != nil {
+				return fmt.Errorf("Malformed balance directive on line %v: %q", lnum, line)
+			}
+			v := ratValue(n)
+			entries = append(entries, bcEntry{
+				tr: Transaction{
+					Date:        date.AddDate(0, 0, -1),
+					Description: "Balance assertion",
+					Tags:        map[string]bool{},
+					KVPairs:     map[string]string{},
+					Location:    bcLocation(lnum),
+					Postings:    []Posting{{Account: fields[2], Assert: v, HasAssert: true}},
+				},
+				late: true,
+				line: lnum,
+			})
+			if pad, ok := pads[fields[2]]; ok {
+				pad.entry = len(entries) - 1
+				pad.value = v
+				delete(pads, fields[2])
+			}
+
+		case "pad":
+			if len(fields) != 4 {
+				return fmt.Errorf("Malformed pad directive on line %v: %q", lnum, line)
+			}
+			pad := &bcPad{account: fields[2], entry: -1}
+			pads[fields[2]] = pad
+			entries = append(entries, bcEntry{
+				tr: Transaction{
+					Date:        date,
+					Description: "Padding inserted for balance assertion",
+					Tags:        map[string]bool{},
+					KVPairs:     map[string]string{},
+					Location:    bcLocation(lnum),
+					Postings:    []Posting{{Account: fields[2], Null: true, HasAssert: true}, {Account: fields[3], Null: true}},
+				},
+				line: lnum,
+				pad:  pad,
+			})
+
+		case "close", "note", "document", "event", "query", "custom":
+			comment(lnum, " "+line)
+			for _, j := range body {
+				comment(j+1, " "+lines[j])
+			}
+
+		default:
+			tr, err := bcTransaction(date, fields[1:], lines, lnum, body)
+			if err != nil {
+				return err
+			}
+			for tag := range tags {
+				tr.Tags[tag] = true
+			}
+			for k, v := range meta {
+				if _, ok := tr.KVPairs[ledgerKey(k)]; !ok {
+					tr.KVPairs[ledgerKey(k)] = v
+				}
+			}
+			entries = append(entries, bcEntry{tr: *tr, line: lnum})
+		}
+	}
+
+	// Sort everything into date order, keeping file order for entries on the same day. This has to be done before
+	// the pads can be filled in, and sorting moves the entries so the pads need to know where theirs went.
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := &entries[order[i]], &entries[order[j]]
+		if !a.tr.Date.Equal(b.tr.Date) {
+			return a.tr.Date.Before(b.tr.Date)
+		}
+		return !a.late && b.late
+	})
+	moved := make([]int, len(entries))
+	sorted := make([]bcEntry, len(entries))
+	for to, from := range order {
+		sorted[to] = entries[from]
+		moved[from] = to
+	}
+
+	// A pad is a balance assignment to whatever the balance needs to be before any later postings to the account
+	// bring it to the asserted balance.
+	for i := range sorted {
+		pad := sorted[i].pad
+		if pad == nil {
+			continue
+		}
+		if pad.entry == -1 {
+			return fmt.Errorf("Pad directive on line %v has no balance directive after it.", sorted[i].line)
+		}
+		end := moved[pad.entry]
+		later := int64(0)
+		for j := i + 1; j < end; j++ {
+			ok, bals := sorted[j].tr.Balance()
+			if !ok {
+				return fmt.Errorf("Transaction on line %v does not balance.", sorted[j].line)
+			}
+			later += bals[pad.account]
+		}
+		sorted[i].tr.Postings[0].Assert = pad.value - later
+	}
+
+	for i := range dirs {
+		if dirs[i].Type == "account" {
+			if name, ok := names[dirs[i].Argument]; ok {
+				dirs[i].Argument = name
+			}
+		}
+	}
+	f.D = append(f.D, dirs...)
+	for _, e := range sorted {
+		tr := e.tr
+		for j := range tr.Postings {
+			if name, ok := names[tr.Postings[j].Account]; ok {
+				tr.Postings[j].Account = name
+			}
+		}
+		if tr.KVPairs["ID"] == "" {
+			AssignIDs(f.ids(), &tr)
+		}
+		f.T = append(f.T, tr)
+	}
+	return nil
+}
+
+// bcTransaction parses a beancount transaction. The fields are from the first line, starting at the flag.
+func bcTransaction(date time.Time, fields []string, lines []string, lnum int, body []int) (*Transaction, error) {
+	tr := &Transaction{
+		Date:     date,
+		Tags:     map[string]bool{},
+		KVPairs:  map[string]string{},
+		Location: bcLocation(lnum),
+	}
+
+	switch fields[0] {
+	case "*":
+		tr.Status = StatusClear
+	case "!":
+		tr.Status = StatusPending
+	case "txn":
+	default:
+		if len(fields[0]) != 1 {
+			return nil, fmt.Errorf("Unknown beancount directive on line %v: %q", lnum, fields[0])
+		}
+	}
+
+	strs := []string{}
+	links := []string{}
+	for _, field := range fields[1:] {
+		switch {
+		case strings.HasPrefix(field, "\""):
+			s, err := strconv.Unquote(field)
+			if err != nil {
+				return nil, fmt.Errorf("Malformed string on line %v: %v", lnum, field)
+			}
+			strs = append(strs, s)
+		case strings.HasPrefix(field, "#"):
+			tr.Tags[field[1:]] = true
+		case strings.HasPrefix(field, "^"):
+			links = append(links, field[1:])
+		default:
+			return nil, fmt.Errorf("Malformed transaction on line %v: unexpected %q", lnum, field)
+		}
+	}
+	switch len(strs) {
+	case 0:
+	case 1:
+		tr.Description = strs[0]
+	case 2:
+		tr.Description = strs[0]
+		if strs[0] == "" {
+			tr.Description = strs[1]
+		} else if strs[1] != "" {
+			tr.KVPairs["Narration"] = strs[1]
+		}
+	default:
+		return nil, fmt.Errorf("Malformed transaction on line %v: too many strings.", lnum)
+	}
+	if len(links) > 0 {
+		tr.KVPairs["Links"] = strings.Join(links, " ")
+	}
+
+	postingIndent := -1
+	for _, j := range body {
+		raw := lines[j]
+		indent := len(raw) - len(strings.TrimLeft(raw, " \t"))
+		text, note := bcSplitComment(strings.TrimSpace(raw))
+		if text == "" {
+			tr.Comments = append(tr.Comments, strings.TrimSpace(note))
+			continue
+		}
+
+		if key, value, ok := bcMeta(text); ok {
+			if postingIndent != -1 && indent > postingIndent {
+				p := &tr.Postings[len(tr.Postings)-1]
+				if key != "note" {
+					value = ledgerKey(key) + ": " + value
+				}
+				if p.Note != "" {
+					value = p.Note + ", " + value
+				}
+				p.Note = value
+				continue
+			}
+
+			switch key {
+			case "code":
+				tr.Code = value
+			case "clear-date":
+				d, err := bcDate(value)
+				if err != nil {
+					return nil, fmt.Errorf("Malformed clear-date on line %v: %q", j+1, value)
+				}
+				tr.ClearDate = d
+			default:
+				tr.KVPairs[ledgerKey(key)] = value
+			}
+			continue
+		}
+
+		p, err := bcPosting(text, j+1)
+		if err != nil {
+			return nil, err
+		}
+		if note := strings.TrimSpace(note); note != "" {
+			if p.Note != "" {
+				note = p.Note + ", " + note
+			}
+			p.Note = note
+		}
+		tr.Postings = append(tr.Postings, *p)
+		postingIndent = indent
+	}
+	return tr, nil
+}
+
+// bcPosting parses a beancount posting, without any comment.
+func bcPosting(text string, lnum int) (*Posting, error) {
+	p := &Posting{}
+	if len(text) > 1 && strings.ContainsRune("*!", rune(text[0])) && (text[1] == ' ' || text[1] == '\t') {
+		if text[0] == '*' {
+			p.Status = StatusClear
+		} else {
+			p.Status = StatusPending
+		}
+		text = strings.TrimSpace(text[1:])
+	}
+
+	account, rest, _ := strings.Cut(text, " ")
+	p.Account = account
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		p.Null = true
+		return p, nil
+	}
+
+	// Split off the price and cost, if there are any.
+	price, total := "", false
+	if at := strings.Index(rest, "@"); at != -1 {
+		price = rest[at+1:]
+		if strings.HasPrefix(price, "@") {
+			price, total = price[1:], true
+		}
+		rest = strings.TrimSpace(rest[:at])
+	}
+	cost, costTotal := "", false
+	if open := strings.Index(rest, "{"); open != -1 {
+		cost = strings.TrimSpace(strings.Trim(rest[open:], "{}"))
+		costTotal = strings.HasPrefix(rest[open:], "{{")
+		rest = strings.TrimSpace(rest[:open])
+		if i := strings.Index(cost, ","); i != -1 {
+			cost = strings.TrimSpace(cost[:i])
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("Malformed posting amount on line %v: %q", lnum, rest)
+	}
+	units, err := bcNumber(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("Malformed posting amount on line %v: %q", lnum, rest)
+	}
+	if len(fields) == 1 || fields[1] == "USD" {
+		p.Value = ratValue(units)
+		return p, nil
+	}
+	commodity := fields[1]
+
+	// Not USD, so the value comes from the cost or the price.
+	each, eachTotal := cost, costTotal
+	if each == "" {
+		each, eachTotal = price, total
+	}
+	ef := strings.Fields(each)
+	if len(ef) != 2 || ef[1] != "USD" {
+		return nil, fmt.Errorf("Amount in %v on line %v has no USD cost or price: only USD is supported.", commodity, lnum)
+	}
+	per, err := bcNumber(ef[0])
+	if err != nil {
+		return nil, fmt.Errorf("Malformed cost or price on line %v: %q", lnum, each)
+	}
+	value := new(big.Rat).Mul(units, per)
+	if eachTotal {
+		value = new(big.Rat).Set(per)
+		if units.Sign() < 0 {
+			value.Neg(value)
+		}
+		if units.Sign() != 0 {
+			per = new(big.Rat).Quo(value, units)
+		}
+	}
+	p.Value = ratValue(value)
+	p.Note = strings.TrimRight(strings.TrimRight(units.FloatString(6), "0"), ".") + " " + commodity + " @ " + FormatValue(ratValue(per))
+	return p, nil
+}
+
+// bcSplitComment splits a line at the first semicolon that isn't in a string.
+func bcSplitComment(line string) (string, string) {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return strings.TrimSpace(line[:i]), line[i+1:]
+			}
+		}
+	}
+	return strings.TrimSpace(line), ""
+}
+
+// bcFields splits a line into fields at white space, keeping quoted strings (with their quotes) together.
+func bcFields(line string) ([]string, error) {
+	fields := []string{}
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case ' ', '\t':
+			i++
+			continue
+		case '"':
+			j := i + 1
+			for ; j < len(line) && line[j] != '"'; j++ {
+				if line[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(line) {
+				return nil, fmt.Errorf("Unterminated string: %v", line[i:])
+			}
+			fields = append(fields, line[i:j+1])
+			i = j + 1
+		default:
+			j := strings.IndexAny(line[i:], " \t")
+			if j == -1 {
+				j = len(line) - i
+			}
+			fields = append(fields, line[i:i+j])
+			i += j
+		}
+	}
+	return fields, nil
+}
+
+// bcMeta parses a metadata line, "key: value". Strings are unquoted, anything else is kept as written.
+func bcMeta(text string) (string, string, bool) {
+	text, _ = bcSplitComment(strings.TrimSpace(text))
+	key, value, ok := strings.Cut(text, ":")
+	if !ok || key == "" || key[0] < 'a' || key[0] > 'z' {
+		return "", "", false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return "", "", false
+		}
+	}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "\"") {
+		if s, err := strconv.Unquote(value); err == nil {
+			value = s
+		}
+	}
+	return key, value, true
+}
+
+// bcDate parses a beancount date, which may use dashes or slashes.
+func bcDate(s string) (time.Time, error) {
+	return time.Parse("2006-01-02", strings.ReplaceAll(s, "/", "-"))
+}
+
+// bcNumber parses a beancount number. Arithmetic is not supported.
+func bcNumber(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.ReplaceAll(s, ",", ""))
+	if !ok {
+		return nil, fmt.Errorf("Malformed number: %q", s)
+	}
+	return r, nil
+}
+
+// ratValue converts a number to a value, rounding to the nearest ten thousandth.
+func ratValue(r *big.Rat) int64 {
+	v, _ := strconv.ParseInt(new(big.Rat).Mul(r, big.NewRat(10000, 1)).FloatString(0), 10, 64)
+	return v
+}
+
+func bcLocation(line int) Position {
+	return Position{Location: lex.Location(0).L(uint64(line))}
+}
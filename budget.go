@@ -0,0 +1,278 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// String returns the name of the interval, as used in periodic transactions.
+func (iv Interval) String() string {
+	switch iv {
+	case IntervalWeekly:
+		return "Weekly"
+	case IntervalMonthly:
+		return "Monthly"
+	case IntervalQuarterly:
+		return "Quarterly"
+	default:
+		return "Yearly"
+	}
+}
+
+// ParseInterval parses an interval name such as "monthly" or "every month". Case is ignored. Returns false if the
+// name isn't one of the supported intervals.
+func ParseInterval(s string) (Interval, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "weekly", "every week":
+		return IntervalWeekly, true
+	case "monthly", "every month":
+		return IntervalMonthly, true
+	case "quarterly", "every quarter":
+		return IntervalQuarterly, true
+	case "yearly", "annually", "every year":
+		return IntervalYearly, true
+	}
+	return IntervalMonthly, false
+}
+
+// months returns the rough length of the interval in months, for converting budgets between intervals.
+func (iv Interval) months() float64 {
+	switch iv {
+	case IntervalWeekly:
+		return 12.0 / 52
+	case IntervalMonthly:
+		return 1
+	case IntervalQuarterly:
+		return 3
+	default:
+		return 12
+	}
+}
+
+// Budget is the amount budgeted for an account for each period of an interval. Budgets are stored as periodic
+// transactions, the same way ledger does it:
+//
+//	~ Monthly
+//		Expenses:Food  $300.00
+//		Assets
+//
+// A budget with a :rollover: tag in its comment carries whatever is left over (or overspent) in each period forward
+// into the next one.
+type Budget struct {
+	Account  string
+	Interval Interval
+	Amount   int64
+	Rollover bool
+}
+
+// budgetOffset is the account that balances the periodic transactions written for budgets.
+const budgetOffset = "Assets"
+
+// ErrMalformedBudget is returned by File.Budgets when a line of a periodic transaction can't be parsed.
+type ErrMalformedBudget struct {
+	Line     string
+	Location Position
+}
+
+func (err ErrMalformedBudget) Error() string {
+	return fmt.Sprintf("Malformed budget line (%s) at %s", err.Line, err.Location)
+}
+
+// Budgets returns the budgets defined by the periodic transaction directives in D, sorted by account and then
+// interval. Every posting with an amount is a budget, postings without one only balance the transaction. If an
+// account is budgeted more than once for the same interval the last one wins, and a budget of zero removes it.
+// Periodic transactions with periods other than the supported intervals are ignored.
+func (f *File) Budgets() ([]Budget, error) {
+	type key struct {
+		account  string
+		interval Interval
+	}
+	formats, err := f.AmountFormats()
+	if err != nil {
+		return nil, err
+	}
+
+	budgets := map[key]Budget{}
+	for _, d := range f.D {
+		if d.Type != "~" {
+			continue
+		}
+		iv, ok := ParseInterval(d.Argument)
+		if !ok {
+			continue
+		}
+
+		for i, line := range d.Lines {
+			rollover := false
+			if c := strings.IndexRune(line, ';'); c != -1 {
+				rollover = strings.Contains(line[c:], ":rollover:")
+				line = line[:c]
+			}
+			line = strings.TrimSpace(line)
+			sep := strings.Index(line, "  ")
+			if tab := strings.IndexRune(line, '\t'); tab != -1 && (sep == -1 || tab < sep) {
+				sep = tab
+			}
+			if line == "" || sep == -1 {
+				continue
+			}
+
+			account := strings.TrimSpace(line[:sep])
+			amount, err := formats.Parse(line[sep:])
+			if err != nil {
+				return nil, ErrMalformedBudget{line, d.Location.At(d.Location.L(d.Location.Line() + uint64(i) + 1))}
+			}
+			budgets[key{account, iv}] = Budget{Account: account, Interval: iv, Amount: amount, Rollover: rollover}
+		}
+	}
+
+	result := []Budget{}
+	for _, b := range budgets {
+		if b.Amount != 0 {
+			result = append(result, b)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Account != result[j].Account {
+			return result[i].Account < result[j].Account
+		}
+		return result[i].Interval < result[j].Interval
+	})
+	return result, nil
+}
+
+// Directive returns a periodic transaction directive that defines this budget.
+func (b Budget) Directive() Directive {
+	line := fmt.Sprintf("%v  %v", b.Account, FormatValue(b.Amount))
+	if b.Rollover {
+		line += "  ; :rollover:"
+	}
+	return Directive{
+		Type:     "~",
+		Argument: b.Interval.String(),
+		Lines:    []string{line, budgetOffset},
+	}
+}
+
+// BudgetRow is a single account in a budget report.
+type BudgetRow struct {
+	Account   string
+	Budgeted  int64 // The budget for the period.
+	Rollover  int64 // The amount left over from earlier periods, for rollover budgets. Negative if overspent.
+	Actual    int64 // The total of the postings to the account and its sub accounts in the period.
+	Remaining int64 // Budgeted + Rollover - Actual.
+}
+
+// BudgetReport compares the budgets to the actual postings for the period of the given interval that contains date,
+// with a row for each budgeted account in account order. Budgets for other intervals are converted to the report's
+// interval (so a yearly budget of $1200 is $100 in a monthly report), and an account budgeted for several intervals
+// gets the sum of them. If any of an account's budgets roll over, whatever was left in each earlier period since the
+// first posting to the account is carried into the report's period. Returns an error if any of the transactions do
+// not balance.
+func (f *File) BudgetReport(date time.Time, interval Interval) ([]BudgetRow, error) {
+	budgets, err := f.Budgets()
+	if err != nil {
+		return nil, err
+	}
+
+	begin := interval.Start(date)
+	sums, err := f.BalanceReport(ReportQuery{Begin: begin, End: interval.Next(begin)}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []BudgetRow{}
+	rollover := map[string]bool{}
+	for _, b := range budgets {
+		budgeted := int64(math.Round(float64(b.Amount) * interval.months() / b.Interval.months()))
+		if b.Rollover {
+			rollover[b.Account] = true
+		}
+		if len(rows) > 0 && rows[len(rows)-1].Account == b.Account {
+			rows[len(rows)-1].Budgeted += budgeted
+			continue
+		}
+
+		actual := int64(0)
+		for account, v := range sums {
+			if account == b.Account || strings.HasPrefix(account, b.Account+":") {
+				actual += v
+			}
+		}
+		rows = append(rows, BudgetRow{Account: b.Account, Budgeted: budgeted, Actual: actual})
+	}
+
+	if len(rollover) != 0 {
+		err := f.budgetRollover(rows, rollover, begin, interval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range rows {
+		rows[i].Remaining = rows[i].Budgeted + rows[i].Rollover - rows[i].Actual
+	}
+	return rows, nil
+}
+
+// budgetRollover fills in the rollover amounts of the selected budget rows, by adding up the budget less the
+// actual amount for each period before begin. The budget for each earlier period is taken to be the same as for the
+// report's period, since budgets don't have start dates. Counting starts at the first posting to the account.
+func (f *File) budgetRollover(rows []BudgetRow, rollover map[string]bool, begin time.Time, interval Interval) error {
+	report, err := f.PeriodicReport(ReportQuery{End: begin}, interval, 0)
+	if err != nil {
+		return err
+	}
+
+	for i, row := range rows {
+		if !rollover[row.Account] {
+			continue
+		}
+
+		actuals := make([]int64, len(report.Periods))
+		used := make([]bool, len(report.Periods))
+		for account, sums := range report.Sums {
+			if account != row.Account && !strings.HasPrefix(account, row.Account+":") {
+				continue
+			}
+			for j, v := range sums {
+				actuals[j] += v
+				used[j] = used[j] || v != 0
+			}
+		}
+
+		started := false
+		for j := range report.Periods {
+			started = started || used[j]
+			if started {
+				rows[i].Rollover += row.Budgeted - actuals[j]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samuellwn/ledger/parse"
+)
+
+func TestCache(t *testing.T) {
+	input := `; Groceries
+alias Food=Expenses:Food
+
+2024/01/02 * Coffee
+	; :work:
+	; ID: abc
+	Food  $5.00
+	Assets:Checking
+`
+	path := filepath.Join(t.TempDir(), "test.ledger")
+	err := os.WriteFile(path, []byte(input), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	err = os.Chtimes(path, mtime, mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := parse.Cache{Dir: t.TempDir()}
+	opts := parse.Options{KeepRaw: true, KeepComments: true, ExpandAliases: true}
+	want, err := cache.Load(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(cache.Dir); len(files) != 1 {
+		t.Fatalf("Expected one cache file, got %v", files)
+	}
+
+	// Change the file without changing its size or modification time, so only the cached copy has the old
+	// contents.
+	err = os.WriteFile(path, bytes.Replace([]byte(input), []byte("$5.00"), []byte("$6.00"), 1), 0644)
+	if err == nil {
+		err = os.Chtimes(path, mtime, mtime)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := cache.Load(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wbuf, gbuf := &bytes.Buffer{}, &bytes.Buffer{}
+	if want.Format(wbuf) != nil || got.Format(gbuf) != nil || wbuf.String() != gbuf.String() {
+		t.Fatalf("Cached copy wasn't used:\n%v", gbuf.String())
+	}
+	tr := &got.T[0]
+	if !tr.Unmodified() || !tr.Tags["work"] || tr.KVPairs["ID"] != "abc" || tr.Location != want.T[0].Location {
+		t.Errorf("Cached transaction is different: %#v", *tr)
+	}
+	if v, err := got.D[1].Parse(); err != nil || v == nil || !got.D[1].Unmodified() {
+		t.Errorf("Cached directive is different: %#v", got.D[1])
+	}
+	tr.Tags["home"] = true // The maps must be usable.
+
+	// Any other modification time means the file is read again, and the cached copy replaced.
+	later := mtime.Add(time.Hour)
+	err = os.Chtimes(path, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = cache.Load(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.T[0].Postings[0].Value != 60000 {
+		t.Errorf("Changed file wasn't parsed again: %v", got.T[0].String())
+	}
+
+	// Files with the same contents are found by hash.
+	data, _ := os.ReadFile(path)
+	got, err = cache.Parse(data, path, nil, opts)
+	if err != nil || got.T[0].Postings[0].Value != 60000 {
+		t.Errorf("Incorrect result parsing the same contents: %v", err)
+	}
+
+	// Other options get their own cache file.
+	_, err = cache.Load(path, parse.Options{})
+	if files, _ := os.ReadDir(cache.Dir); err != nil || len(files) != 2 {
+		t.Errorf("Expected two cache files, got %v (%v)", files, err)
+	}
+}
@@ -0,0 +1,284 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Just enough of the camt.053 (ISO 20022 BankToCustomerStatement) schema to import transactions. Namespaces are
+// ignored so all the versions of the format in use work.
+
+type camtDocument struct {
+	Stmts []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	ID      string        `xml:"Id"`
+	Balance []camtBalance `xml:"Bal"`
+	Entries []camtEntry   `xml:"Ntry"`
+}
+
+type camtAmount struct {
+	Value string `xml:",chardata"`
+	Ccy   string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Dt   string `xml:"Dt"`
+	DtTm string `xml:"DtTm"`
+}
+
+func (d camtDate) time() (time.Time, error) {
+	s := d.Dt
+	if s == "" && len(d.DtTm) >= 10 {
+		s = d.DtTm[:10]
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// camtStatus is either the code itself (older versions) or wrapped in a Cd element (newer versions).
+type camtStatus struct {
+	Text string `xml:",chardata"`
+	Cd   string `xml:"Cd"`
+}
+
+func (s camtStatus) code() string {
+	if s.Cd != "" {
+		return strings.TrimSpace(s.Cd)
+	}
+	return strings.TrimSpace(s.Text)
+}
+
+type camtBalance struct {
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	Date      camtDate   `xml:"Dt"`
+}
+
+type camtEntry struct {
+	Ref         string       `xml:"NtryRef"`
+	Amount      camtAmount   `xml:"Amt"`
+	CdtDbtInd   string       `xml:"CdtDbtInd"`
+	Status      camtStatus   `xml:"Sts"`
+	BookingDate camtDate     `xml:"BookgDt"`
+	SvcrRef     string       `xml:"AcctSvcrRef"`
+	Details     []camtDetail `xml:"NtryDtls>TxDtls"`
+	Info        string       `xml:"AddtlNtryInf"`
+}
+
+type camtDetail struct {
+	SvcrRef  string   `xml:"Refs>AcctSvcrRef"`
+	TxID     string   `xml:"Refs>TxId"`
+	Debtor   string   `xml:"RltdPties>Dbtr>Nm"`
+	Creditor string   `xml:"RltdPties>Cdtr>Nm"`
+	Remit    []string `xml:"RmtInf>Ustrd"`
+}
+
+// camtValue parses an amount, negating it for debits.
+func camtValue(amt camtAmount, ind string) (int64, error) {
+	v, err := ParseValueNumber(strings.TrimSpace(amt.Value))
+	if err != nil {
+		return 0, err
+	}
+	if ind == "DBIT" {
+		v = -v
+	}
+	return v, nil
+}
+
+// ImportCAMT053 imports a camt.053 (ISO 20022) bank statement into this file. This works exactly like ImportOFX:
+// already imported transactions (by FITID) are skipped, and if an equity account is given, statement opening and
+// closing balance assertions are added. Importing a statement again adds nothing, not even the balances.
+//
+// The FITID is the bank's reference for the entry. The description is the other party's name, falling back to the
+// remittance information and then the additional entry information. Only the amount is imported, the currency is
+// ignored. Pending entries are imported with the pending status and a "Pending" KV pair, and are updated when
+// their booked versions are imported (see Transaction.Pending).
+func (f *File) ImportCAMT053(camtFile io.Reader, bankAcct, defaultAcct, equityAcct string) error {
+	doc := camtDocument{}
+	err := xml.NewDecoder(camtFile).Decode(&doc)
+	if err != nil {
+		return err
+	}
+
+	if len(doc.Stmts) == 0 {
+		return errors.New("No statements found.")
+	}
+
+	seenIds := f.SeenFITIDs(bankAcct)
+
+	ltrns := []Transaction{}
+	found := false
+	for _, stmt := range doc.Stmts {
+		if len(stmt.Entries) == 0 {
+			continue
+		}
+		found = true
+
+		var sum int64
+		strns := []Transaction{}
+		for _, entry := range stmt.Entries {
+			v, err := camtValue(entry.Amount, entry.CdtDbtInd)
+			if err != nil {
+				return err
+			}
+
+			date, err := entry.BookingDate.time()
+			if err != nil {
+				return err
+			}
+
+			status := entry.Status.code()
+
+			// Pending entries don't count towards the booked balance.
+			if status != "PDNG" {
+				sum += v
+			}
+
+			detail := camtDetail{}
+			if len(entry.Details) > 0 {
+				detail = entry.Details[0]
+			}
+
+			fitid := firstNonEmpty(entry.SvcrRef, detail.SvcrRef, entry.Ref, detail.TxID)
+			if fitid != "" && seenIds[fitid] {
+				continue
+			}
+
+			name := detail.Creditor
+			if entry.CdtDbtInd == "CRDT" {
+				name = detail.Debtor
+			}
+			memo := strings.TrimSpace(strings.Join(detail.Remit, " "))
+
+			tr := Transaction{
+				Description: firstNonEmpty(name, memo, strings.TrimSpace(entry.Info), "Unknown"),
+				Date:        date,
+				Status:      StatusUndefined,
+				KVPairs: map[string]string{
+					"Memo":    memo,
+					"Name":    name,
+					"Account": bankAcct,
+				},
+				Postings: []Posting{
+					{
+						Account: bankAcct,
+						Value:   v,
+					},
+					{
+						Account: defaultAcct,
+						Null:    true,
+					},
+				},
+			}
+			if fitid != "" {
+				tr.KVPairs["FITID"] = fitid
+			}
+			if status == "PDNG" {
+				tr.Status = StatusPending
+				tr.KVPairs["Pending"] = "true"
+			}
+			AssignIDs(f.ids(), &tr)
+
+			strns = append(strns, tr)
+		}
+
+		if equityAcct != "" {
+			open, close, ok, err := camtBalances(&stmt, sum)
+			if err != nil {
+				return err
+			}
+			if ok {
+				// The entries were already checked for bad dates above.
+				first, _ := stmt.Entries[0].BookingDate.time()
+				last := first
+				for _, entry := range stmt.Entries {
+					date, _ := entry.BookingDate.time()
+					if date.Before(first) {
+						first = date
+					}
+					if date.After(last) {
+						last = date
+					}
+				}
+
+				strns = f.addStatementBalances(strns, bankAcct, equityAcct, first, open, last, close)
+			}
+		}
+
+		ltrns = append(ltrns, strns...)
+	}
+
+	if !found {
+		return errors.New("No transactions found.")
+	}
+
+	n := len(f.T)
+	f.T = append(f.T, ltrns...)
+	f.resolvePending(n)
+	return nil
+}
+
+// camtBalances finds the opening and closing booked balances of a statement. If only one of them is present the
+// other one is calculated from the sum of the entries. Returns false if neither is present.
+func camtBalances(stmt *camtStatement, sum int64) (open, close int64, ok bool, err error) {
+	hasOpen, hasClose := false, false
+	for _, bal := range stmt.Balance {
+		switch bal.Code {
+		case "OPBD", "PRCD":
+			open, err = camtValue(bal.Amount, bal.CdtDbtInd)
+			hasOpen = true
+		case "CLBD":
+			close, err = camtValue(bal.Amount, bal.CdtDbtInd)
+			hasClose = true
+		}
+		if err != nil {
+			return 0, 0, false, err
+		}
+	}
+
+	switch {
+	case hasOpen && !hasClose:
+		close = open + sum
+	case !hasOpen && hasClose:
+		open = close - sum
+	case !hasOpen && !hasClose:
+		return 0, 0, false, nil
+	}
+	return open, close, true, nil
+}
+
+func firstNonEmpty(strs ...string) string {
+	for _, s := range strs {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package client
+
+import (
+	"time"
+
+	"github.com/samuellwn/ledger"
+)
+
+// GetBudgets returns all the budgets defined in the journal, see ledger.File.Budgets.
+func (client *Client) GetBudgets() ([]ledger.Budget, error) {
+	// Grab the read lock.
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+
+	f := &ledger.File{D: client.directives}
+	return f.Budgets()
+}
+
+// SetBudget sets the budget for an account for each period of an interval, replacing any earlier budget for the same
+// account and interval. A budget of zero removes it. The budget is written to the log as a periodic transaction.
+func (client *Client) SetBudget(b ledger.Budget) error {
+	if client.config.ReadOnly {
+		return ReadOnlyError
+	}
+
+	// Grab the write lock.
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	d := b.Directive()
+	err := client.append("\n" + d.String())
+	if err != nil {
+		return err
+	}
+
+	d.FoundBefore = len(client.raw)
+	client.directives = append(client.directives, d)
+	client.emit(&Event{Typ: EvntTypBudgetUpdate})
+	return nil
+}
+
+// GetBudgetReport returns budgeted vs actual amounts for each budgeted account, for the period of the interval that
+// contains date. See ledger.File.BudgetReport.
+func (client *Client) GetBudgetReport(date time.Time, interval ledger.Interval) ([]ledger.BudgetRow, error) {
+	// Grab the read lock.
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+
+	f := &ledger.File{T: client.simple, D: client.directives}
+	return f.BudgetReport(date, interval)
+}
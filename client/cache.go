@@ -0,0 +1,231 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package client
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuellwn/ledger"
+)
+
+// month identifies a calendar month, as the year times 12 plus the zero based month.
+type month int
+
+func monthOf(t time.Time) month {
+	return month(t.Year()*12 + int(t.Month()) - 1)
+}
+
+// start returns midnight UTC on the first day of the month.
+func (m month) start() time.Time {
+	return time.Date(int(m)/12, time.Month(int(m)%12+1), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// accountSum is the cached sum for a single account.
+type accountSum struct {
+	value int64
+	count int // How many transactions went into the value, so an account whose postings cancel out still shows up.
+}
+
+// cachedTr is what a single transaction contributes to the cached sums.
+type cachedTr struct {
+	month    month
+	accounts map[string]int64 // Nil if the transaction doesn't balance.
+}
+
+// filterKey identifies the result of a GetTransactions call.
+type filterKey struct {
+	dfilter, sfilter int
+	tags             string
+	today            time.Time // The date filters are relative to today, so yesterday's results are no good.
+}
+
+// reportCache keeps per account sums for every month and for all time, so balances don't need every transaction
+// summed again each time they are asked for. It is updated one transaction at a time as they change. The results of
+// GetTransactions are also kept until anything changes.
+type reportCache struct {
+	trs        map[string]cachedTr
+	months     map[month]map[string]*accountSum
+	total      map[string]*accountSum
+	unbalanced map[month]int // How many transactions in each month don't balance.
+
+	// GetTransactions is called with only the read lock held, so the filter results need a lock of their own.
+	lock     sync.Mutex
+	filtered map[filterKey][]ledger.Transaction
+}
+
+// newReportCache returns a cache filled out with the given transactions.
+func newReportCache(trs []ledger.Transaction) *reportCache {
+	cache := &reportCache{
+		trs:        map[string]cachedTr{},
+		months:     map[month]map[string]*accountSum{},
+		total:      map[string]*accountSum{},
+		unbalanced: map[month]int{},
+		filtered:   map[filterKey][]ledger.Transaction{},
+	}
+	for i := range trs {
+		cache.add(&trs[i])
+	}
+	return cache
+}
+
+// update replaces whatever the transaction with the given ID contributed with the given revision. If tr is nil the
+// transaction is just removed (it was voided, or went away in a reload).
+func (cache *reportCache) update(id string, tr *ledger.Transaction) {
+	cache.remove(id)
+	if tr != nil {
+		cache.add(tr)
+	}
+
+	cache.lock.Lock()
+	cache.filtered = map[filterKey][]ledger.Transaction{}
+	cache.lock.Unlock()
+}
+
+func (cache *reportCache) add(tr *ledger.Transaction) {
+	ok, accounts := tr.Balance()
+	ctr := cachedTr{month: monthOf(tr.Date)}
+	if !ok {
+		cache.unbalanced[ctr.month]++
+		cache.trs[tr.KVPairs["ID"]] = ctr
+		return
+	}
+	ctr.accounts = accounts
+	cache.trs[tr.KVPairs["ID"]] = ctr
+
+	sums, ok := cache.months[ctr.month]
+	if !ok {
+		sums = map[string]*accountSum{}
+		cache.months[ctr.month] = sums
+	}
+	for account, v := range accounts {
+		addSum(sums, account, v, 1)
+		addSum(cache.total, account, v, 1)
+	}
+}
+
+func (cache *reportCache) remove(id string) {
+	ctr, ok := cache.trs[id]
+	if !ok {
+		return
+	}
+	delete(cache.trs, id)
+
+	if ctr.accounts == nil {
+		cache.unbalanced[ctr.month]--
+		if cache.unbalanced[ctr.month] == 0 {
+			delete(cache.unbalanced, ctr.month)
+		}
+		return
+	}
+
+	sums := cache.months[ctr.month]
+	for account, v := range ctr.accounts {
+		addSum(sums, account, -v, -1)
+		addSum(cache.total, account, -v, -1)
+	}
+	if len(sums) == 0 {
+		delete(cache.months, ctr.month)
+	}
+}
+
+func addSum(sums map[string]*accountSum, account string, v int64, count int) {
+	sum, ok := sums[account]
+	if !ok {
+		sum = &accountSum{}
+		sums[account] = sum
+	}
+	sum.value += v
+	sum.count += count
+	if sum.count == 0 {
+		delete(sums, account)
+	}
+}
+
+// balances returns the account sums for the given months, or for all time if months is nil. Returns false if any of
+// the transactions in those months don't balance.
+func (cache *reportCache) balances(months []month) (map[string]int64, bool) {
+	accounts := map[string]int64{}
+	if months == nil {
+		if len(cache.unbalanced) > 0 {
+			return nil, false
+		}
+		for account, sum := range cache.total {
+			accounts[account] = sum.value
+		}
+		return accounts, true
+	}
+
+	for _, m := range months {
+		if cache.unbalanced[m] > 0 {
+			return nil, false
+		}
+		for account, sum := range cache.months[m] {
+			accounts[account] += sum.value
+		}
+	}
+	return accounts, true
+}
+
+// filterMonths returns the months covered by one of the date filters, or nil for all of them.
+func filterMonths(dfilter int, today time.Time) []month {
+	switch dfilter {
+	case FilterThisMonth:
+		return []month{monthOf(today)}
+	case FilterLastMonth:
+		return []month{monthOf(today.AddDate(0, -1, 0))}
+	case FilterThisYear, FilterLastYear:
+		year := today.Year()
+		if dfilter == FilterLastYear {
+			year = today.AddDate(-1, 0, 0).Year()
+		}
+		months := make([]month, 12)
+		for i := range months {
+			months[i] = month(year*12 + i)
+		}
+		return months
+	default:
+		return nil
+	}
+}
+
+// makeFilterKey returns the key for the results of a GetTransactions call.
+func makeFilterKey(dfilter int, sfilter int, tfilter map[string]bool, today time.Time) filterKey {
+	tags := []string{}
+	for tag, ok := range tfilter {
+		if ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	y, m, d := today.Date()
+	return filterKey{
+		dfilter: dfilter,
+		sfilter: sfilter,
+		tags:    strings.Join(tags, ":"),
+		today:   time.Date(y, m, d, 0, 0, 0, 0, time.UTC),
+	}
+}
@@ -23,19 +23,21 @@ misrepresented as being the original software.
 package client
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/samuellwn/ledger"
 	"github.com/samuellwn/ledger/parse"
-	"github.com/teris-io/shortid"
 )
 
 // Client does all the work of keeping a clear consistent view of the underlying transaction log for the UI.
@@ -43,10 +45,30 @@ import (
 // calculating/transforming that may be needed.
 type Client struct {
 	ledger *os.File // The current ledger file, open for appending.
+	config Config
 
-	// All the transactions in the ledger file, exactly as they appear and in source order.
+	// If the journal is encrypted, the method it was encrypted with and its decrypted text. Encrypted journals
+	// can't be appended to, so every change rewrites the whole file from this.
+	encrypted string
+	plain     []byte
+
+	// Plain text journals are parsed incrementally, so when something is appended to the journal only the new
+	// transactions are parsed. info is the journal as of the last load, to make sure it is still the same file.
+	incremental *parse.Incremental
+	info        os.FileInfo
+
+	// The absolute paths of the journal and all the files it includes. New transactions are only ever added to the
+	// journal itself.
+	files map[string]bool
+	globs bool // Some of the includes are globs, so new files may need to be included.
+
+	// All the transactions in the ledger file (with included files spliced in), exactly as they appear and in
+	// source order.
 	raw []ledger.Transaction
 
+	// All the directives in the ledger file, in source order.
+	directives []ledger.Directive
+
 	// The simplified transactions, all edits and such removed, in chronological order then source order
 	// for same-date transactions.
 	simple   []ledger.Transaction
@@ -58,8 +80,14 @@ type Client struct {
 
 	lock sync.RWMutex
 
-	// Events are sent on this channel.
-	Events chan *Event
+	cache *reportCache // Balances and filtered transaction lists, kept up to date as transactions change.
+
+	watcher *fsnotify.Watcher // Only set if the journal is being watched.
+	closed  bool
+
+	// Everyone listening for events, see Subscribe.
+	subscribers map[*subscriber]bool
+	subLock     sync.Mutex
 }
 
 // Returned by GetClient if, during loading, a transaction is found that does not have an ID.
@@ -68,90 +96,334 @@ type Client struct {
 // Also used by AddTransactionEdit.
 var MissingIDError = errors.New("Transaction missing ID.")
 
-const (
-	EvntTypTrUpdate = iota // The transaction list has changed, refresh.
-)
+// Returned by any method that would change the journal if the client is read only.
+var ReadOnlyError = errors.New("Client is read only.")
+
+// Config controls where a Client keeps its data and what it may do with it.
+type Config struct {
+	Journal     string // Path to the ledger file. Defaults to "transactions.ledger". May include other files.
+	Attachments string // Directory attachments are copied into. Defaults to "./attachments/".
+
+	Create   bool // Create the journal (and attachment directory) if they don't exist.
+	ReadOnly bool // Never write to the journal or attachment directory.
+
+	// Watch the journal, and reload it when it is changed by something else (a text editor, the sync tool, etc).
+	Watch bool
+
+	IDs ledger.IDGenerator // Makes IDs for new transactions, revisions, and attachments. Defaults to ledger.DefaultIDs.
 
-type Event struct {
-	Typ int
+	// Keep the journal in a git repository, and commit every change the client makes to it (along with the
+	// attachment directory, if it is in the same repository). The commit messages record the IDs of the
+	// transactions that changed, see GitMessage. If the journal isn't in a repository one is made in its directory
+	// when Create is set.
+	Git bool
+
+	// How the journal is encrypted. Encrypted journals are detected and decrypted when they are loaded no matter
+	// what this says, but new and plain text journals are only encrypted if a method is set. Files included by
+	// the journal are never decrypted. See ledger.Encryption.
+	Encryption *ledger.Encryption
+
+	// Keep a parsed copy of the journal in this directory, so the client starts faster when the journal hasn't
+	// changed. Empty disables the cache. Encrypted journals are never cached. See parse.Cache.
+	Cache string
+}
+
+// DefaultConfig is the configuration used by NewClient.
+var DefaultConfig = Config{
+	Journal:     "transactions.ledger",
+	Attachments: "./attachments/",
+	Create:      true,
+	Watch:       true,
 }
 
-// NewClient returns a client object or an error if the client was not able to initialize.
-// Do not make multiple Clients! Each Client has associated, non-releasable resources!
+// NewClient returns a client object or an error if the client was not able to initialize. The client uses the
+// DefaultConfig, so it works with "transactions.ledger" in the current directory.
+// Do not make multiple Clients for the same journal! Call Close when you are done with the client.
 func NewClient() (*Client, error) {
+	return NewClientWithConfig(DefaultConfig)
+}
+
+// NewClientWithConfig is exactly like NewClient, but uses the given configuration. Empty paths in the
+// configuration are replaced with the defaults.
+func NewClientWithConfig(config Config) (*Client, error) {
+	if config.Journal == "" {
+		config.Journal = DefaultConfig.Journal
+	}
+	if config.Attachments == "" {
+		config.Attachments = DefaultConfig.Attachments
+	}
+
 	client := &Client{
-		Events: make(chan *Event),
+		config:      config,
+		subscribers: map[*subscriber]bool{},
 	}
-	var err error
 
-	// First get use the current transactions log from the disk.
-	client.ledger, err = os.OpenFile("transactions.ledger", os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	_, err := client.load()
 	if err != nil {
 		return nil, err
 	}
 
-	// Now, since my parser is a little dumb, slurp the whole file
-	data, err := ioutil.ReadAll(client.ledger)
+	if config.Git && !config.ReadOnly {
+		err = client.gitInit()
+		if err != nil {
+			client.ledger.Close()
+			return nil, err
+		}
+	}
+
+	if config.Watch {
+		err = client.watch()
+		if err != nil {
+			client.ledger.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// load opens the journal and builds all the internal lists from it, replacing whatever was there before. Returns
+// the events describing how the journal differs from what was already loaded. If anything goes wrong the current
+// state is left as it was. The caller must hold the write lock (or be NewClientWithConfig).
+func (client *Client) load() ([]*Event, error) {
+	// If we crashed in the middle of writing to the journal last time, finish the job.
+	if !client.config.ReadOnly {
+		err := recoverAppend(client.config.Journal)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// First get use the current transactions log from the disk.
+	flags := os.O_APPEND | os.O_RDWR
+	if client.config.ReadOnly {
+		flags = os.O_RDONLY
+	} else if client.config.Create {
+		flags |= os.O_CREATE
+	}
+	file, err := os.OpenFile(client.config.Journal, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
 
-	// and parse it into the raw transaction list.
-	f, err := parse.ParseLedgerString(string(data))
-	client.raw = f.T
+	// Then parse it into the raw transaction list, along with any files (such as archives from past years) it
+	// includes. If the journal was only appended to since the last time, just the new part needs to be parsed.
+	var f *ledger.File
+	var plain []byte
+	encrypted := ledger.EncryptNone
+	opts := parse.Options{}
+	if inc := client.incremental; inc != nil && os.SameFile(info, client.info) && inc.Appended(file, info.Size()) {
+		f, err = inc.Load(file, info.Size())
+	} else {
+		var data []byte
+		data, err = io.ReadAll(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		plain, encrypted, err = client.encryption().Decrypt(data)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		client.incremental = nil
+		switch {
+		case encrypted != ledger.EncryptNone:
+			f, err = parse.Read(bytes.NewReader(plain), file.Name(), opts)
+		case client.config.Cache != "" && client.raw == nil:
+			// The cache only helps the first time, after that the incremental parser is faster.
+			f, err = parse.Cache{Dir: client.config.Cache}.Parse(plain, file.Name(), info, opts)
+		default:
+			opts.Name = file.Name()
+			inc := parse.NewIncremental(opts)
+			f, err = inc.Load(bytes.NewReader(plain), int64(len(plain)))
+			if err == nil && client.encryption().Method == ledger.EncryptNone {
+				client.incremental = inc
+			}
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	included, err := parse.ResolveIncludes(f, client.config.Journal, parse.Options{})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	path, err := filepath.Abs(client.config.Journal)
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
+	files := map[string]bool{path: true}
+	for _, inc := range included {
+		files[inc] = true
+	}
+	globs := false
+	for _, d := range f.D {
+		globs = globs || d.Type == "include" && strings.ContainsAny(d.Argument, "*?[")
+	}
 
 	// Now we need to transform the raw transaction list into the various filtered lists.
-	client.byid = map[string][]ledger.Transaction{}
-	client.simpleid = map[string]int{}
-	for _, tr := range client.raw {
-		id, ok := tr.KVPairs["ID"]
-		if !ok || id == "" {
-			return nil, MissingIDError
+	// The last transaction with a given ID is the authoritative version of that transaction. However, "source
+	// order" of the transaction list is defined by the first version of that transaction.
+	byid := map[string][]ledger.Transaction{}
+	simple := []ledger.Transaction{}
+	for _, h := range f.History() {
+		if h.ID == "" {
+			file.Close()
+			return nil, &TransactionError{L: f.T[h.Revisions[0]].Location, Err: MissingIDError}
 		}
 
-		client.byid[id] = append(client.byid[id], tr)
-
-		// The last transaction with a given ID is the authoritative version of that transaction.
-		// However, "source order" of the transaction list is defined by the first version of that
-		// transaction. This makes things really simple (not intended, it just worked out that way).
-		if idx, ok := client.simpleid[id]; ok {
-			client.simple[idx] = tr
-			continue
+		for _, i := range h.Revisions {
+			byid[h.ID] = append(byid[h.ID], f.T[i])
 		}
-		client.simpleid[id] = len(client.simple)
-		client.simple = append(client.simple, tr)
+		simple = append(simple, f.T[h.Latest()])
 	}
 
+	events := diffJournal(client.byid, byid, client.directives, f.D)
+
+	if client.ledger != nil {
+		client.ledger.Close()
+	}
+	client.ledger = file
+	client.info = info
+	client.encrypted = encrypted
+	client.plain = nil
+	if client.writeMethod() != "" {
+		client.plain = plain
+	}
+	client.files = files
+	client.globs = globs
+	client.raw = f.T
+	client.directives = f.D
+	client.byid = byid
+	client.simple = simple
+
 	// Ok, we have the lists filled, but the simple list is in the source order of the original version of
-	// each transaction. We want chronological first and then source so we need to do a stable sort by date.
-	sort.Stable(ledger.TransactionDateSorter(client.simple))
+	// each transaction, and still has voided transactions in it.
+	client.rebuildSimple()
 
-	return client, nil
+	// Only the transactions that changed need to go through the report cache again.
+	if client.cache == nil {
+		client.cache = newReportCache(client.simple)
+		return events, nil
+	}
+	for _, ev := range events {
+		for _, id := range ev.IDs {
+			client.updateCache(id)
+		}
+	}
+	return events, nil
+}
+
+// diffJournal compares the old and new contents of the journal, and returns the events needed to tell subscribers
+// about any differences. Transactions are compared by their latest revision, so a transaction that only moved in the
+// file doesn't count as changed.
+func diffJournal(oldid, newid map[string][]ledger.Transaction, oldd, newd []ledger.Directive) []*Event {
+	ids := []string{}
+	for id, trs := range newid {
+		old, ok := oldid[id]
+		if !ok || len(old) != len(trs) || old[len(old)-1].String() != trs[len(trs)-1].String() {
+			ids = append(ids, id)
+		}
+	}
+	for id := range oldid {
+		if _, ok := newid[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	events := []*Event{}
+	if len(ids) > 0 {
+		events = append(events, &Event{Typ: EvntTypTrUpdate, IDs: ids})
+	}
+
+	same := len(oldd) == len(newd)
+	for i := 0; same && i < len(oldd); i++ {
+		same = oldd[i].String() == newd[i].String()
+	}
+	if !same {
+		events = append(events, &Event{Typ: EvntTypBudgetUpdate})
+	}
+	return events
+}
+
+// rebuildSimple removes voided transactions from the simplified list, sorts it chronologically and then by source
+// order, and rebuilds the index.
+func (client *Client) rebuildSimple() {
+	simple := client.simple[:0]
+	for _, tr := range client.simple {
+		if !tr.Voided() {
+			simple = append(simple, tr)
+		}
+	}
+	client.simple = simple
+	ledger.SortTransactions(client.simple, ledger.SortDate)
+
+	client.simpleid = map[string]int{}
+	for i, tr := range client.simple {
+		client.simpleid[tr.KVPairs["ID"]] = i
+	}
+}
+
+// updateCache brings the report cache up to date with the current version of the transaction with the given ID.
+// The caller must hold the write lock.
+func (client *Client) updateCache(id string) {
+	if idx, ok := client.simpleid[id]; ok {
+		client.cache.update(id, &client.simple[idx])
+		return
+	}
+	client.cache.update(id, nil)
+}
+
+// ids returns the generator for new IDs, from the config or ledger.DefaultIDs.
+func (client *Client) ids() ledger.IDGenerator {
+	if client.config.IDs == nil {
+		return ledger.DefaultIDs
+	}
+	return client.config.IDs
 }
 
 // Returned by AddTransactionEdit if there is not a parent transaction for the edit.
 var MissingParentError = errors.New("Transaction edit does not have a parent.")
 
-var transactionIDService <-chan string
+// Returned by methods that act on an existing transaction if there isn't one with the given ID (or it was voided).
+var TransactionNotFoundError = errors.New("Transaction not found.")
 
-func init() {
-	go func() {
-		c := make(chan string)
-		transactionIDService = c
+// TransactionError wraps the errors above with the transaction they are about, so use errors.Is to check which
+// one it is.
+type TransactionError struct {
+	ID  string          // Empty if the transaction doesn't have an ID.
+	L   ledger.Position // Zero if the transaction wasn't read from the journal.
+	Err error
+}
 
-		idsource := shortid.MustNew(16, shortid.DefaultABC, uint64(time.Now().UnixNano()))
+func (err *TransactionError) Error() string {
+	msg := strings.TrimSuffix(err.Err.Error(), ".")
+	if err.ID != "" {
+		msg += fmt.Sprintf(" (ID: %q)", err.ID)
+	}
+	if err.L.Line() != 0 {
+		msg += fmt.Sprintf(" (defined at %v)", err.L)
+	}
+	return msg + "."
+}
 
-		for {
-			c <- idsource.MustGenerate()
-		}
-	}()
+func (err *TransactionError) Unwrap() error {
+	return err.Err
 }
 
 // AddTransaction writes a transaction to the log and adds it to the internal lists.
-// The transaction object passed in will be modified to have an ID in the "ID" KV pair.
+// The transaction object passed in will be modified to have an ID in the "ID" KV pair and a revision ID in the
+// "RID" KV pair, same as transactions imported by the tools, so the journal can be synced and zippered.
 func (client *Client) AddTransaction(tr ledger.Transaction) error {
 	// Before we do anything, make sure the transaction is well formed.
 	err := tr.Canonicalize()
@@ -159,20 +431,32 @@ func (client *Client) AddTransaction(tr ledger.Transaction) error {
 		return err
 	}
 
+	if client.config.ReadOnly {
+		return ReadOnlyError
+	}
+
 	// Grab the write lock.
 	client.lock.Lock()
 	defer client.lock.Unlock()
 
 	// Now that we have ruled out a malformed transaction, give the transaction an ID.
-	// We should never ever need it, but just in case we make sure there are no collisions.
-	id := <-transactionIDService
-	for _, ok := client.simpleid[id]; ok; {
-		id = <-transactionIDService
+	// Random IDs should never collide, but content hashes will if the same transaction is added twice. The hash
+	// generator adds a counter to repeats, so asking again gets a new ID.
+	gen := client.ids()
+	if tr.KVPairs == nil {
+		tr.KVPairs = map[string]string{}
+	}
+	delete(tr.KVPairs, "ID")
+	delete(tr.KVPairs, "RID")
+	id := gen.NewID(&tr)
+	for client.byid[id] != nil {
+		id = gen.NewID(&tr)
 	}
 	tr.KVPairs["ID"] = id
+	tr.KVPairs["RID"] = gen.NewRID(&tr)
 
 	// Next, write the new transaction to the log file. This is the most likely step to fail somehow.
-	_, err = fmt.Fprintf(client.ledger, "\n%v", tr)
+	err = client.append("\n" + tr.String())
 	if err != nil {
 		return err
 	}
@@ -180,13 +464,16 @@ func (client *Client) AddTransaction(tr ledger.Transaction) error {
 	// Ok, the error conditions are out of the way, pollute our internal state.
 	client.simpleid[id] = len(client.simple)
 	client.simple = append(client.simple, tr)
+	client.raw = append(client.raw, tr)
 	client.byid[id] = []ledger.Transaction{tr}
-	client.Events <- &Event{Typ: EvntTypTrUpdate}
+	client.updateCache(id)
+	client.emit(&Event{Typ: EvntTypTrAdd, IDs: []string{id}})
 	return nil
 }
 
 // AddTransactionEdit does the same basic thing as AddTransaction, except it ensures that the transaction
-// being added replaces an existing one.
+// being added replaces an existing one. The edit keeps the ID of the transaction it replaces and is given a new
+// revision ID.
 func (client *Client) AddTransactionEdit(tr ledger.Transaction) error {
 	// Before we do anything, make sure the transaction is well formed.
 	err := tr.Canonicalize()
@@ -199,6 +486,10 @@ func (client *Client) AddTransactionEdit(tr ledger.Transaction) error {
 		return MissingIDError
 	}
 
+	if client.config.ReadOnly {
+		return ReadOnlyError
+	}
+
 	// Grab the write lock.
 	client.lock.Lock()
 	defer client.lock.Unlock()
@@ -206,22 +497,60 @@ func (client *Client) AddTransactionEdit(tr ledger.Transaction) error {
 	// And make sure it has at least one parent.
 	_, ok = client.simpleid[id]
 	if !ok {
-		return MissingParentError
+		return &TransactionError{ID: id, Err: MissingParentError}
 	}
 
 	// Generate a revision ID.
-	tr.KVPairs["RID"] = <-transactionIDService
+	ledger.AssignIDs(client.ids(), &tr)
 
 	// Next, write the new transaction to the log file.
-	_, err = fmt.Fprintf(client.ledger, "\n%v", tr)
+	err = client.append("\n" + tr.String())
 	if err != nil {
 		return err
 	}
 
 	// Adding an edit to the internal structures is simpler than adding a new transaction.
 	client.simple[client.simpleid[id]] = tr
+	client.raw = append(client.raw, tr)
+	client.byid[id] = append(client.byid[id], tr)
+	client.updateCache(id)
+	client.emit(&Event{Typ: EvntTypTrEdit, IDs: []string{id}})
+	return nil
+}
+
+// VoidTransaction deletes a transaction by adding a void revision (a copy of the current revision with a "Void" KV
+// pair) to the log. The transaction is removed from the simplified list, but its history is kept, and the void
+// is synced like any other edit.
+func (client *Client) VoidTransaction(id string) error {
+	if client.config.ReadOnly {
+		return ReadOnlyError
+	}
+
+	// Grab the write lock.
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	// Voided transactions are not in the simplified list, so they can't be voided twice.
+	idx, ok := client.simpleid[id]
+	if !ok {
+		return &TransactionError{ID: id, Err: TransactionNotFoundError}
+	}
+
+	tr := *client.simple[idx].CleanCopy()
+	tr.KVPairs["Void"] = "true"
+	ledger.AssignIDs(client.ids(), &tr)
+
+	err := client.append("\n" + tr.String())
+	if err != nil {
+		return err
+	}
+
+	client.raw = append(client.raw, tr)
 	client.byid[id] = append(client.byid[id], tr)
-	client.Events <- &Event{Typ: EvntTypTrUpdate}
+	client.simple = append(client.simple[:idx], client.simple[idx+1:]...)
+	client.rebuildSimple()
+	client.updateCache(id)
+	client.emit(&Event{Typ: EvntTypTrVoid, IDs: []string{id}})
 	return nil
 }
 
@@ -246,6 +575,16 @@ func (client *Client) GetAccountList() []string {
 	return accountsList
 }
 
+// SuggestAccount returns accounts used on transactions with similar descriptions, best first. Accounts in exclude
+// (such as the account the new transaction is coming out of) are never suggested.
+func (client *Client) SuggestAccount(desc string, exclude ...string) []ledger.AccountSuggestion {
+	// Grab the read lock.
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+
+	return ledger.NewAccountModel(client.simple).SuggestAccount(desc, exclude...)
+}
+
 // Filter enum for dates.
 const (
 	FilterAllDates = iota - 1
@@ -266,17 +605,72 @@ const (
 // Each element in the slice is a display row consisting of two items, the name of the row with pre-applied
 // indentation as needed and the pre-formatted value for the row.
 func (client *Client) GetBalances(dfilter int) ([][]string, error) {
+	// Grab the read lock.
+	client.lock.RLock()
+	accounts, ok := client.cache.balances(filterMonths(dfilter, time.Now()))
+	client.lock.RUnlock()
+
+	if !ok {
+		// Something doesn't balance, so do it the slow way to get the right error.
+		var err error
+		accounts, err = ledger.SumTransactions(client.GetTransactions(dfilter, FilterAllStatus, nil))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ledger.FormatSums(accounts, "    "), nil
+}
+
+// GetExchangeBalances is the same as GetBalances, but values everything in the exchange commodity using the prices
+// from the P directives in the journal, see ledger.ReportQuery.Exchange. Prices are taken on the date of each
+// transaction, or the latest prices if latest is true.
+func (client *Client) GetExchangeBalances(dfilter int, exchange string, latest bool) ([][]string, error) {
 	// Grab the read lock.
 	client.lock.RLock()
 	defer client.lock.RUnlock()
 
-	trs := client.GetTransactions(dfilter, FilterAllStatus, nil)
+	q := ledger.ReportQuery{Exchange: exchange, ExchangeLatest: latest}
+	if months := filterMonths(dfilter, time.Now()); months != nil {
+		q.Begin = months[0].start()
+		q.End = (months[len(months)-1] + 1).start()
+	}
 
-	accounts, err := ledger.SumTransactions(trs)
+	f := &ledger.File{T: client.simple, D: client.directives}
+	accounts, err := f.BalanceReport(q, 0)
 	if err != nil {
 		return nil, err
 	}
-	return ledger.FormatSums(accounts, "    "), nil
+	af, err := f.ExchangeFormat(q)
+	if err != nil {
+		return nil, err
+	}
+	return ledger.FormatSumsWith(accounts, "    ", af), nil
+}
+
+// RegisterRow is a row of a register report, along with the ID of the transaction it came from.
+type RegisterRow struct {
+	ledger.RegisterRow
+	ID string
+}
+
+// GetRegister returns a register report for the postings in the simplified transaction list selected by the query,
+// see ledger.File.Register.
+func (client *Client) GetRegister(q ledger.ReportQuery) ([]RegisterRow, error) {
+	// Grab the read lock.
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+
+	f := &ledger.File{T: client.simple}
+	rows, err := f.Register(q)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]RegisterRow, len(rows))
+	for i, row := range rows {
+		res[i] = RegisterRow{RegisterRow: row, ID: client.simple[row.T].KVPairs["ID"]}
+	}
+	return res, nil
 }
 
 // GetTransactions returns the simplified transaction list (all edits resolved, etc), sorted by date and
@@ -286,8 +680,17 @@ func (client *Client) GetTransactions(dfilter int, sfilter int, tfilter map[stri
 	client.lock.RLock()
 	defer client.lock.RUnlock()
 
+	// The results are cached until something changes. Copy them so callers can't mess up the cache.
 	today := time.Now()
-	trs := []ledger.Transaction{}
+	key := makeFilterKey(dfilter, sfilter, tfilter, today)
+	client.cache.lock.Lock()
+	trs, ok := client.cache.filtered[key]
+	client.cache.lock.Unlock()
+	if ok {
+		return append([]ledger.Transaction{}, trs...)
+	}
+
+	trs = []ledger.Transaction{}
 	for _, tr := range client.simple {
 		switch dfilter {
 		case FilterThisMonth:
@@ -310,7 +713,11 @@ func (client *Client) GetTransactions(dfilter int, sfilter int, tfilter map[stri
 			trs = stateFilterNode(trs, tr, sfilter, tfilter)
 		}
 	}
-	return trs
+
+	client.cache.lock.Lock()
+	client.cache.filtered[key] = trs
+	client.cache.lock.Unlock()
+	return append([]ledger.Transaction{}, trs...)
 }
 
 func stateFilterNode(trs []ledger.Transaction, tr ledger.Transaction, sfilter int, tfilter map[string]bool) []ledger.Transaction {
@@ -358,25 +765,29 @@ func (client *Client) GetTransactionWithHistory(id string) []ledger.Transaction
 	return trs
 }
 
-var attachmentIDService <-chan string
-
-func init() {
-	go func() {
-		c := make(chan string)
-		attachmentIDService = c
-
-		idsource := shortid.MustNew(16, shortid.DefaultABC, uint64(time.Now().UnixNano()))
+// GetTransactionDiffs returns what each edit of a transaction changed, oldest first, so there is one less diff than
+// there are versions of the transaction. In case of a non-existent ID, nil is returned.
+func (client *Client) GetTransactionDiffs(id string) []*ledger.TransactionDiff {
+	trs := client.GetTransactionWithHistory(id)
+	if len(trs) == 0 {
+		return nil
+	}
 
-		for {
-			c <- idsource.MustGenerate()
-		}
-	}()
+	diffs := []*ledger.TransactionDiff{}
+	for i := 1; i < len(trs); i++ {
+		diffs = append(diffs, ledger.DiffTransactions(&trs[i-1], &trs[i]))
+	}
+	return diffs
 }
 
 // AddAttachment adds a attachments to a transaction, specified by an id.
 func (client *Client) AddAttachment(id string, path string) error {
+	if client.config.ReadOnly {
+		return ReadOnlyError
+	}
+
 	// Grab an id for this attachment
-	aid := <-attachmentIDService
+	aid := client.ids().NewID(nil)
 
 	client.lock.RLock()
 
@@ -384,7 +795,7 @@ func (client *Client) AddAttachment(id string, path string) error {
 	trs, ok := client.byid[id]
 	if !ok {
 		client.lock.RUnlock()
-		return errors.New("Transaction not found.")
+		return &TransactionError{ID: id, Err: TransactionNotFoundError}
 	}
 
 	// Get a clean copy of the transaction, ready to edit.
@@ -408,7 +819,13 @@ func (client *Client) AddAttachment(id string, path string) error {
 	}
 
 	// Open a location to write a copy of the file to our own storage location.
-	nfile, err := os.Create("./attachments/" + aid + "." + ext)
+	if client.config.Create {
+		err = os.MkdirAll(client.config.Attachments, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	nfile, err := os.Create(filepath.Join(client.config.Attachments, aid+"."+ext))
 	if err != nil {
 		return err
 	}
@@ -437,6 +854,25 @@ func (client *Client) AddAttachment(id string, path string) error {
 	tr.KVPairs["Attachments"] = string(rawats)
 
 	// Submit the transaction as an edit.
-	client.AddTransactionEdit(tr)
-	return nil
+	return client.AddTransactionEdit(tr)
+}
+
+// Returned by GetAttachment if there isn't an attachment with the given ID.
+var AttachmentNotFoundError = errors.New("Attachment not found.")
+
+// GetAttachment returns the path to the stored copy of an attachment, given the ID from a transaction's
+// "Attachments" KV pair.
+func (client *Client) GetAttachment(aid string) (string, error) {
+	if aid == "" || strings.ContainsAny(aid, "/\\.*?[") {
+		return "", AttachmentNotFoundError
+	}
+
+	paths, err := filepath.Glob(filepath.Join(client.config.Attachments, aid+".*"))
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 {
+		return "", AttachmentNotFoundError
+	}
+	return paths[0], nil
 }
@@ -0,0 +1,193 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package client_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/client"
+)
+
+// testConfig returns a configuration for a new journal in a temporary directory.
+func testConfig(t *testing.T, watch bool) client.Config {
+	dir := t.TempDir()
+	config := client.DefaultConfig
+	config.Journal = filepath.Join(dir, "transactions.ledger")
+	config.Attachments = filepath.Join(dir, "attachments")
+	config.Watch = watch
+	return config
+}
+
+// nextEvent waits a little while for the next event, failing the test if none comes.
+func nextEvent(t *testing.T, events <-chan *client.Event) *client.Event {
+	t.Helper()
+
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for an event.")
+		return nil
+	}
+}
+
+func TestClientChanges(t *testing.T) {
+	config := testConfig(t, false)
+	cl, err := client.NewClientWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, unsubscribe := cl.Subscribe()
+	defer unsubscribe()
+
+	tr := ledger.Transaction{
+		Date:        time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Description: "Coffee",
+		Postings: []ledger.Posting{
+			{Account: "Expenses:Food", Value: 50000},
+			{Account: "Assets:Checking", Null: true},
+		},
+	}
+	err = cl.AddTransaction(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := nextEvent(t, events)
+	if ev.Typ != client.EvntTypTrAdd || len(ev.IDs) != 1 {
+		t.Fatalf("Expected an add event with one ID, got %+v", ev)
+	}
+	id := ev.IDs[0]
+
+	trs := cl.GetTransactionWithHistory(id)
+	if len(trs) != 1 || trs[0].KVPairs["RID"] == "" {
+		t.Fatalf("Expected one revision with a revision ID, got %v", trs)
+	}
+
+	tr = trs[0]
+	tr.Description = "Tea"
+	err = cl.AddTransactionEdit(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev = nextEvent(t, events)
+	if ev.Typ != client.EvntTypTrEdit || len(ev.IDs) != 1 || ev.IDs[0] != id {
+		t.Fatalf("Expected an edit event for %v, got %+v", id, ev)
+	}
+
+	err = cl.VoidTransaction(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev = nextEvent(t, events)
+	if ev.Typ != client.EvntTypTrVoid || len(ev.IDs) != 1 || ev.IDs[0] != id {
+		t.Fatalf("Expected a void event for %v, got %+v", id, ev)
+	}
+
+	err = cl.VoidTransaction(id)
+	if !errors.Is(err, client.TransactionNotFoundError) {
+		t.Errorf("Voiding twice: expected %v, got %v", client.TransactionNotFoundError, err)
+	}
+
+	tr.KVPairs["ID"] = "missing"
+	err = cl.AddTransactionEdit(tr)
+	if !errors.Is(err, client.MissingParentError) {
+		t.Errorf("Editing a missing transaction: expected %v, got %v", client.MissingParentError, err)
+	}
+	cl.Close()
+
+	// Everything should have been written to the journal.
+	cl, err = client.NewClientWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	trs = cl.GetTransactionWithHistory(id)
+	if len(trs) != 3 {
+		t.Fatalf("Expected three revisions after reopening, got %v", len(trs))
+	}
+	if trs[1].Description != "Tea" || trs[2].KVPairs["Void"] != "true" {
+		t.Errorf("Revisions not read back correctly:\n%v", trs)
+	}
+	if rids := map[string]bool{trs[0].KVPairs["RID"]: true, trs[1].KVPairs["RID"]: true, trs[2].KVPairs["RID"]: true}; len(rids) != 3 {
+		t.Errorf("Expected every revision to have its own revision ID, got %v", rids)
+	}
+}
+
+func TestClientReadOnly(t *testing.T) {
+	config := testConfig(t, false)
+	config.ReadOnly = true
+	config.Create = false
+	err := os.WriteFile(config.Journal, []byte("2024/01/01 Rent\n\t; ID: a\n\tExpenses:Rent  $500.00\n\tAssets:Checking\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cl, err := client.NewClientWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	if err := cl.VoidTransaction("a"); !errors.Is(err, client.ReadOnlyError) {
+		t.Errorf("Expected %v, got %v", client.ReadOnlyError, err)
+	}
+	if len(cl.GetTransactionWithHistory("a")) != 1 {
+		t.Errorf("Expected the journal to be loaded anyway.")
+	}
+}
+
+func TestClientWatch(t *testing.T) {
+	config := testConfig(t, true)
+	cl, err := client.NewClientWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	events, unsubscribe := cl.Subscribe()
+	defer unsubscribe()
+
+	// Something else adds a transaction.
+	f, err := os.OpenFile(config.Journal, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString("\n2024/01/01 Rent\n\t; ID: a\n\tExpenses:Rent  $500.00\n\tAssets:Checking\n")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := nextEvent(t, events)
+	if ev.Typ != client.EvntTypTrUpdate || len(ev.IDs) != 1 || ev.IDs[0] != "a" {
+		t.Fatalf("Expected an update event for a, got %+v", ev)
+	}
+	if len(cl.GetTransactionWithHistory("a")) != 1 {
+		t.Errorf("Expected the new transaction to be loaded.")
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package client
+
+// EventType says what kind of change an Event is about.
+type EventType int
+
+const (
+	// The journal was changed by something else. Refresh the transactions in IDs, or everything if IDs is nil.
+	EvntTypTrUpdate EventType = iota
+
+	EvntTypTrAdd        // A new transaction was added.
+	EvntTypTrEdit       // A transaction was edited.
+	EvntTypTrVoid       // A transaction was voided, and is no longer in the simplified list.
+	EvntTypBudgetUpdate // The budgets changed.
+)
+
+// Event describes a change to the client's data.
+type Event struct {
+	Typ EventType
+	IDs []string // The IDs of the transactions that changed, in no particular order.
+}
+
+// eventBuffer is how many events a subscriber can fall behind by before events start being dropped.
+const eventBuffer = 64
+
+type subscriber struct {
+	ch     chan *Event
+	missed bool // Events were dropped since the last one this subscriber got.
+}
+
+// Subscribe returns a channel that receives every event from now on, and a function that unsubscribes and closes the
+// channel. Sending events never blocks, if a subscriber falls too far behind events are dropped, and the next event
+// it gets is an EvntTypTrUpdate with nil IDs to tell it to refresh everything.
+func (client *Client) Subscribe() (<-chan *Event, func()) {
+	sub := &subscriber{ch: make(chan *Event, eventBuffer)}
+
+	client.subLock.Lock()
+	client.subscribers[sub] = true
+	client.subLock.Unlock()
+
+	return sub.ch, func() {
+		client.subLock.Lock()
+		defer client.subLock.Unlock()
+
+		if client.subscribers[sub] {
+			delete(client.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// emit sends an event to all the subscribers without waiting on any of them.
+func (client *Client) emit(ev *Event) {
+	client.subLock.Lock()
+	defer client.subLock.Unlock()
+
+	for sub := range client.subscribers {
+		if sub.missed {
+			select {
+			case sub.ch <- &Event{Typ: EvntTypTrUpdate}:
+				sub.missed = false
+			default:
+				continue
+			}
+		}
+
+		select {
+		case sub.ch <- ev:
+		default:
+			sub.missed = true
+		}
+	}
+}
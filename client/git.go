@@ -0,0 +1,353 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+// Kinds of change recorded in the commits made when Config.Git is set.
+const (
+	GitOpAdd       = "add"       // A new transaction.
+	GitOpEdit      = "edit"      // A new revision of a transaction.
+	GitOpVoid      = "void"      // A transaction was voided.
+	GitOpDirective = "directive" // A directive was added.
+	GitOpUpdate    = "update"    // The journal was changed by something else, such as a text editor.
+	GitOpMerge     = "merge"     // Changes from another copy of the journal were merged in.
+)
+
+// GitCommit is a commit that changed the journal.
+type GitCommit struct {
+	Hash    string
+	Date    time.Time
+	Subject string
+
+	// From the commit message, if the commit was made by a client or ghistory. Commits made some other way have an
+	// empty Op and no IDs.
+	Op  string
+	IDs []string
+}
+
+// GitError is returned when a git command run for the journal fails.
+type GitError struct {
+	Command string // The git subcommand, such as "commit".
+	Msg     string // Whatever git printed to stderr, or the error running it if it didn't print anything.
+}
+
+func (err *GitError) Error() string {
+	return fmt.Sprintf("git %v failed: %v", err.Command, err.Msg)
+}
+
+// git runs git in dir and returns what it printed. Errors are a *GitError with whatever git printed to stderr.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", &GitError{args[0], msg}
+	}
+	return string(out), nil
+}
+
+// GitMessage returns the commit message for a change to the journal. The subject says what happened, and "Ledger-Op"
+// and "Ledger-ID" trailers record it in a form ParseGitMessage can read back:
+//
+//	ledger: edit 1 transaction
+//
+//	Ledger-Op: edit
+//	Ledger-ID: 6d8a0b2f
+func GitMessage(op string, ids []string) string {
+	subject := "ledger: " + op
+	switch len(ids) {
+	case 0:
+	case 1:
+		subject += " 1 transaction"
+	default:
+		subject += fmt.Sprintf(" %v transactions", len(ids))
+	}
+
+	lines := []string{subject, "", "Ledger-Op: " + op}
+	for _, id := range ids {
+		lines = append(lines, "Ledger-ID: "+id)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ParseGitMessage reads the trailers written by GitMessage. The op is empty if the message doesn't have them.
+func ParseGitMessage(msg string) (op string, ids []string) {
+	for _, line := range strings.Split(msg, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Ledger-Op":
+			op = strings.TrimSpace(value)
+		case "Ledger-ID":
+			ids = append(ids, strings.TrimSpace(value))
+		}
+	}
+	return op, ids
+}
+
+// GitCommitChanges commits the journal (and any other paths given) to the git repository it is in, if it changed.
+func GitCommitChanges(journal, op string, ids []string, paths ...string) error {
+	dir, name := filepath.Split(journal)
+	if dir == "" {
+		dir = "."
+	}
+	paths = append([]string{name}, paths...)
+
+	status, err := git(dir, append([]string{"status", "--porcelain", "--"}, paths...)...)
+	if err != nil || status == "" {
+		return err
+	}
+	_, err = git(dir, append([]string{"add", "--"}, paths...)...)
+	if err != nil {
+		return err
+	}
+	// Only commit the given paths, not whatever else happens to be staged.
+	_, err = git(dir, append([]string{"commit", "--quiet", "-m", GitMessage(op, ids), "--"}, paths...)...)
+	return err
+}
+
+// GitHistory returns the commits that changed the journal, newest first.
+func GitHistory(journal string) ([]GitCommit, error) {
+	dir, name := filepath.Split(journal)
+	if dir == "" {
+		dir = "."
+	}
+	out, err := git(dir, "log", "--format=%H%x1f%aI%x1f%s%x1f%B%x1e", "--", name)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []GitCommit{}
+	for _, entry := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimSpace(entry), "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return nil, err
+		}
+		op, ids := ParseGitMessage(fields[3])
+		commits = append(commits, GitCommit{Hash: fields[0], Date: date, Subject: fields[2], Op: op, IDs: ids})
+	}
+	return commits, nil
+}
+
+// GitShow returns the journal as it was at a revision (anything git understands, such as a commit hash or
+// "HEAD~2"). Includes are not resolved. The source text and comments are kept, so anything built from it (such as
+// the merge in GitSync) writes unchanged transactions out exactly as they were.
+func GitShow(journal, rev string) (*ledger.File, error) {
+	dir, name := filepath.Split(journal)
+	if dir == "" {
+		dir = "."
+	}
+	text, err := git(dir, "show", rev+":./"+name)
+	if err != nil {
+		return nil, err
+	}
+	return parse.Read(strings.NewReader(text), journal+"@"+rev, parse.Options{KeepRaw: true, KeepComments: true})
+}
+
+// gitInit makes sure the journal is in a git repository, creating one in the journal's directory if it isn't and
+// the config allows creating things, and commits any changes made while the client wasn't running.
+func (client *Client) gitInit() error {
+	dir := filepath.Dir(client.config.Journal)
+	_, err := git(dir, "rev-parse", "--is-inside-work-tree")
+	if err != nil && client.config.Create {
+		_, err = git(dir, "init", "--quiet")
+	}
+	if err != nil {
+		return err
+	}
+	return client.gitCommit(GitOpUpdate, nil)
+}
+
+// gitCommit commits the journal and attachments if the config asks for it. The caller must hold the write lock.
+func (client *Client) gitCommit(op string, ids []string) error {
+	if !client.config.Git || client.config.ReadOnly {
+		return nil
+	}
+
+	paths := []string{}
+	if info, err := os.Stat(client.config.Attachments); err == nil && info.IsDir() {
+		rel, err := filepath.Rel(filepath.Dir(client.config.Journal), client.config.Attachments)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			paths = append(paths, rel)
+		}
+	}
+	return GitCommitChanges(client.config.Journal, op, ids, paths...)
+}
+
+// GitSync fetches a branch of a remote repository and merges its copy of the journal into this one. Any uncommitted
+// changes to the journal are committed first. If the remote branch is simply ahead it is fast forwarded to,
+// otherwise merge is called with the journal as it was at the last common commit (empty if there isn't one), this
+// copy, and the remote copy, and its result is committed as a merge commit so the next sync has the right base.
+// An empty branch means the current branch. Returns the IDs of the transactions the merge changed.
+//
+// The merge function is usually tools.MergeWithBase, which knows how to combine the edit histories of both sides.
+func GitSync(journal, remote, branch string, merge func(base, ours, theirs *ledger.File) (*ledger.File, error)) ([]string, error) {
+	dir, name := filepath.Split(journal)
+	if dir == "" {
+		dir = "."
+	}
+	gitRev := func(args ...string) (string, error) {
+		out, err := git(dir, args...)
+		return strings.TrimSpace(out), err
+	}
+
+	err := GitCommitChanges(journal, GitOpUpdate, nil)
+	if err != nil {
+		return nil, err
+	}
+	if branch == "" {
+		branch, err = gitRev("rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = git(dir, "fetch", "--quiet", remote, branch)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := gitRev("rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	theirsRev, err := gitRev("rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return nil, err
+	}
+	baseRev, err := gitRev("merge-base", "HEAD", "FETCH_HEAD")
+	switch {
+	case err == nil && baseRev == theirsRev:
+		return nil, nil
+	case err == nil && baseRev == head:
+		before, err := GitShow(journal, head)
+		if err != nil {
+			return nil, err
+		}
+		after, err := GitShow(journal, theirsRev)
+		if err != nil {
+			return nil, err
+		}
+		_, err = git(dir, "merge", "--quiet", "--ff-only", theirsRev)
+		return changedIDs(before, after), err
+	}
+
+	base := &ledger.File{}
+	if err == nil {
+		base, err = GitShow(journal, baseRev)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ours, err := GitShow(journal, head)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := GitShow(journal, theirsRev)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := merge(base, ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record the merge with our tree, then replace the journal with the merged one.
+	_, err = git(dir, "merge", "--quiet", "--no-commit", "--no-ff", "--allow-unrelated-histories", "-s", "ours", theirsRev)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(journal)
+	if err != nil {
+		return nil, err
+	}
+	err = merged.Format(file)
+	cerr := file.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		git(dir, "merge", "--abort")
+		return nil, err
+	}
+
+	ids := changedIDs(ours, merged)
+	_, err = git(dir, "add", "--", name)
+	if err == nil {
+		_, err = git(dir, "commit", "--quiet", "-m", GitMessage(GitOpMerge, ids))
+	}
+	return ids, err
+}
+
+// changedIDs returns the IDs of the transactions with revisions in after that aren't in before.
+func changedIDs(before, after *ledger.File) []string {
+	seen := map[[2]string]bool{}
+	for _, tr := range before.T {
+		seen[[2]string{tr.KVPairs["ID"], tr.KVPairs["RID"]}] = true
+	}
+
+	ids := []string{}
+	added := map[string]bool{}
+	for _, tr := range after.T {
+		id := tr.KVPairs["ID"]
+		if id != "" && !added[id] && !seen[[2]string{id, tr.KVPairs["RID"]}] {
+			added[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// GitPush pushes the current branch to a branch of a remote repository. An empty branch means the current branch.
+func GitPush(journal, remote, branch string) error {
+	dir := filepath.Dir(journal)
+	if branch == "" {
+		_, err := git(dir, "push", "--quiet", remote, "HEAD")
+		return err
+	}
+	_, err := git(dir, "push", "--quiet", remote, "HEAD:"+branch)
+	return err
+}
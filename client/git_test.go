@@ -0,0 +1,59 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package client_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/samuellwn/ledger/client"
+	"golang.org/x/exp/slices"
+)
+
+func TestGitMessage(t *testing.T) {
+	cases := []struct {
+		op      string
+		ids     []string
+		subject string
+	}{
+		{"sync", nil, "ledger: sync"},
+		{"edit", []string{"6d8a0b2f"}, "ledger: edit 1 transaction"},
+		{"import", []string{"a", "b", "c"}, "ledger: import 3 transactions"},
+	}
+	for _, c := range cases {
+		msg := client.GitMessage(c.op, c.ids)
+		if subject, _, _ := strings.Cut(msg, "\n"); subject != c.subject {
+			t.Errorf("%v: expected subject %q, got %q", c.op, c.subject, subject)
+		}
+
+		op, ids := client.ParseGitMessage(msg)
+		if op != c.op || !slices.Equal(ids, c.ids) {
+			t.Errorf("%v: read back %v %v", c.op, op, ids)
+		}
+	}
+
+	// Messages written by hand don't have an op.
+	if op, ids := client.ParseGitMessage("Fix a typo: rent was wrong\n"); op != "" || ids != nil {
+		t.Errorf("Expected nothing from a plain message, got %v %v", op, ids)
+	}
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+// Returned by any method called after Close.
+var ClosedError = errors.New("Client is closed.")
+
+// Returned if the text the client is about to append to the journal can't be read back. This is always a bug.
+var BadAppendError = errors.New("Refusing to write a transaction that can't be read back.")
+
+// Returned when loading the journal if an append was interrupted, but the journal was changed by something else
+// before it could be finished. The journal is left alone, and the text that was being appended is still in the
+// journal's .pending file. Add it by hand if it is missing, then remove the .pending file.
+var PendingAppendError = errors.New("Journal changed after an interrupted append, see the .pending file.")
+
+// Close stops watching the journal, closes all the event subscriptions, and flushes and closes the journal. The client
+// can't be used after it is closed.
+func (client *Client) Close() error {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	if client.closed {
+		return ClosedError
+	}
+	client.closed = true
+
+	if client.watcher != nil {
+		client.watcher.Close()
+	}
+
+	client.subLock.Lock()
+	for sub := range client.subscribers {
+		close(sub.ch)
+	}
+	client.subscribers = map[*subscriber]bool{}
+	client.subLock.Unlock()
+
+	err := client.ledger.Sync()
+	if client.config.ReadOnly {
+		err = nil
+	}
+	cerr := client.ledger.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// pendingPath returns the path of the file used to record an append to the journal while it is being written.
+func pendingPath(journal string) string {
+	return journal + ".pending"
+}
+
+// append adds text (a single transaction or directive) to the end of the journal, such that if the program or machine
+// dies while it is being written the journal can be repaired the next time it is loaded.
+// The text and the size of the journal are written to a pending file first, then the text is appended to the journal
+// and synced to disk, then the pending file is removed. If the pending file is still there when the journal is next
+// loaded recoverAppend truncates the journal back to the old size and does the append again. Encrypted journals are
+// rewritten instead, see rewrite.
+// The caller must hold the write lock.
+func (client *Client) append(text string) error {
+	if client.closed {
+		return ClosedError
+	}
+
+	// Make sure we can read back what we write, a journal the client refuses to load is no good to anyone.
+	f, err := parse.Read(strings.NewReader(text), "", parse.Options{})
+	if err != nil || len(f.T)+len(f.D) != 1 {
+		return BadAppendError
+	}
+
+	if method := client.writeMethod(); method != ledger.EncryptNone {
+		err = client.rewrite(method, text)
+	} else {
+		err = client.appendPlain(text)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The change is already safe in the journal, so a failed commit isn't an error. Whatever wasn't committed is
+	// picked up by the next commit.
+	op, ids := GitOpDirective, []string(nil)
+	if len(f.T) == 1 {
+		id := f.T[0].KVPairs["ID"]
+		op, ids = GitOpAdd, []string{id}
+		if f.T[0].Voided() {
+			op = GitOpVoid
+		} else if _, ok := client.byid[id]; ok {
+			op = GitOpEdit
+		}
+	}
+	client.gitCommit(op, ids)
+	return nil
+}
+
+// appendPlain appends text to a plain text journal, see append.
+func (client *Client) appendPlain(text string) error {
+	info, err := client.ledger.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	pending := fmt.Sprintf("%d %d\n%s", size, len(text), text)
+	err = writeSynced(pendingPath(client.config.Journal), pending, os.O_CREATE|os.O_TRUNC|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.ledger.WriteString(text)
+	if err == nil {
+		err = client.ledger.Sync()
+	}
+	if err != nil {
+		// Try to put things back the way they were. If this doesn't work either the pending file is still there to
+		// sort things out later.
+		if client.ledger.Truncate(size) == nil && client.ledger.Sync() == nil {
+			os.Remove(pendingPath(client.config.Journal))
+		}
+		return err
+	}
+	return os.Remove(pendingPath(client.config.Journal))
+}
+
+// rewrite adds text to the end of an encrypted journal. The whole journal is encrypted again and written to a
+// temporary file, which is then renamed over the journal, so if the program or machine dies part way through the
+// journal is either changed or it isn't.
+func (client *Client) rewrite(method, text string) error {
+	plain := append(append([]byte{}, client.plain...), text...)
+
+	e := *client.encryption()
+	e.Method = method
+	data, err := e.Encrypt(plain)
+	if err != nil {
+		return err
+	}
+
+	tmp := client.config.Journal + ".tmp"
+	err = writeSynced(tmp, string(data), os.O_CREATE|os.O_TRUNC|os.O_WRONLY)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	err = os.Rename(tmp, client.config.Journal)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// The old file is gone, so the journal needs to be opened again.
+	file, err := os.OpenFile(client.config.Journal, os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	client.ledger.Close()
+	client.ledger = file
+	client.encrypted = method
+	client.plain = plain
+	return nil
+}
+
+// encryption returns the encryption settings for the journal, which are never nil.
+func (client *Client) encryption() *ledger.Encryption {
+	if client.config.Encryption == nil {
+		return &ledger.Encryption{}
+	}
+	return client.config.Encryption
+}
+
+// writeMethod returns the method changes to the journal should be encrypted with, or ledger.EncryptNone if they
+// should be appended as plain text. A journal that is already encrypted stays encrypted the same way unless the
+// configuration asks for a different method.
+func (client *Client) writeMethod() string {
+	if method := client.encryption().Method; method != ledger.EncryptNone {
+		return method
+	}
+	return client.encrypted
+}
+
+// recoverAppend finishes an append that was interrupted, if there was one. Returns PendingAppendError if the journal
+// changed since.
+func recoverAppend(journal string) error {
+	data, err := os.ReadFile(pendingPath(journal))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var size, length int64
+	header, text, ok := strings.Cut(string(data), "\n")
+	_, err = fmt.Sscanf(header, "%d %d", &size, &length)
+	if !ok || err != nil || int64(len(text)) != length {
+		// The pending file itself wasn't finished, so the journal was never touched.
+		return os.Remove(pendingPath(journal))
+	}
+
+	// Only finish the append if the journal is still the way we left it: the old contents followed by some of the
+	// text. Anything else means the journal was rewritten since, and truncating it would throw away real data.
+	file, err := os.OpenFile(journal, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	written := info.Size() - size
+	if written < 0 || written > length {
+		return PendingAppendError
+	}
+	tail := make([]byte, written)
+	_, err = file.ReadAt(tail, size)
+	if err != nil {
+		return err
+	}
+	if string(tail) != text[:written] {
+		return PendingAppendError
+	}
+
+	err = file.Truncate(size)
+	if err != nil {
+		return err
+	}
+	err = writeSynced(journal, text, os.O_APPEND|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	return os.Remove(pendingPath(journal))
+}
+
+// writeSynced writes the text to the file at path, and makes sure it is on the disk before returning.
+func writeSynced(path string, text string, flags int) error {
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(text)
+	if err == nil {
+		err = file.Sync()
+	}
+	cerr := file.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package client_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samuellwn/ledger/client"
+)
+
+func TestRecoverAppend(t *testing.T) {
+	old := "2024/01/01 Rent\n\t; ID: a\n\tExpenses:Rent  $500.00\n\tAssets:Checking\n"
+	text := "\n2024/01/02 Coffee\n\t; ID: b\n\tExpenses:Food  $5.00\n\tAssets:Checking\n"
+	pending := fmt.Sprintf("%d %d\n%s", len(old), len(text), text)
+
+	// Each case is the journal and pending file as they would be if the client died at some point during an append,
+	// or if something else changed the journal before it was loaded again.
+	cases := []struct {
+		name    string
+		journal string
+		pending string
+		want    string // The journal after loading.
+		err     error
+		kept    bool // The pending file is still there afterwards.
+	}{
+		{"pending file cut short", old, pending[:len(pending)-10], old, nil, false},
+		{"before appending", old, pending, old + text, nil, false},
+		{"part way through appending", old + text[:20], pending, old + text, nil, false},
+		{"after appending", old + text, pending, old + text, nil, false},
+		{"journal rewritten", "; Formatted\n" + old, pending, "; Formatted\n" + old, client.PendingAppendError, true},
+		{"journal truncated", old[:10], pending, old[:10], client.PendingAppendError, true},
+		{"more added after", old + text + text, pending, old + text + text, client.PendingAppendError, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			config := client.DefaultConfig
+			config.Journal = filepath.Join(dir, "transactions.ledger")
+			config.Attachments = filepath.Join(dir, "attachments")
+			config.Watch = false
+
+			if os.WriteFile(config.Journal, []byte(c.journal), 0644) != nil ||
+				os.WriteFile(config.Journal+".pending", []byte(c.pending), 0644) != nil {
+				t.Fatal("Failed to write the test files.")
+			}
+
+			cl, err := client.NewClientWithConfig(config)
+			if err == nil {
+				cl.Close()
+			}
+			if !errors.Is(err, c.err) {
+				t.Errorf("Expected error %v, got %v", c.err, err)
+			}
+
+			data, err := os.ReadFile(config.Journal)
+			if err != nil || string(data) != c.want {
+				t.Errorf("Incorrect journal (%v):\n%v", err, string(data))
+			}
+			if _, err := os.Stat(config.Journal + ".pending"); (err == nil) != c.kept {
+				t.Errorf("Pending file kept: %v", err == nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package client
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/samuellwn/ledger"
+)
+
+// Returned by Reconciliation.Commit if the cleared balance does not match the statement.
+var ReconcileDifferenceError = errors.New("Cleared balance does not match the statement.")
+
+// Returned by Reconciliation.Commit if a transaction was edited by something else during the reconciliation.
+var ReconcileChangedError = errors.New("Transaction changed during reconciliation.")
+
+// Reconciliation is a reconciliation session for a single account, see Client.StartReconciliation. Postings are
+// marked cleared in the session and nothing is written until Commit is called. Not safe for concurrent use.
+type Reconciliation struct {
+	client *Client
+
+	Account   string
+	Statement int64     // The ending balance on the statement.
+	End       time.Time // The statement date. If not zero, postings after this date are left out.
+
+	cleared  int64                 // The balance of the account's postings that were already cleared.
+	postings []ReconcilePosting    // The postings that were not cleared when the session started.
+	toggled  map[reconcileRef]bool // Postings marked cleared in this session.
+	rids     map[string]string     // The revision of each transaction when the session started.
+}
+
+// ReconcilePosting is a single posting to the reconciled account that was not cleared when the session started.
+type ReconcilePosting struct {
+	ID      string // The ID of the transaction.
+	P       int    // The index of the posting in the transaction.
+	Date    time.Time
+	Payee   string
+	Amount  int64
+	Cleared bool // True if the posting has been marked cleared in this session.
+}
+
+type reconcileRef struct {
+	id string
+	p  int
+}
+
+// StartReconciliation starts reconciling an account against a statement with the given ending balance and date (which
+// may be zero to include everything).
+func (client *Client) StartReconciliation(account string, statement int64, end time.Time) *Reconciliation {
+	// Grab the read lock.
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+
+	r := &Reconciliation{
+		client:    client,
+		Account:   account,
+		Statement: statement,
+		End:       end,
+		postings:  []ReconcilePosting{},
+		toggled:   map[reconcileRef]bool{},
+		rids:      map[string]string{},
+	}
+	for _, tr := range client.simple {
+		if !end.IsZero() && tr.Date.After(end) {
+			continue
+		}
+		ctr := tr.CleanCopy()
+		// Fill in null postings so they have amounts.
+		_ = ctr.Canonicalize()
+
+		for i, p := range ctr.Postings {
+			if p.Account != account {
+				continue
+			}
+			if p.EffectiveStatus(ctr) == ledger.StatusClear {
+				r.cleared += p.Value
+				continue
+			}
+			id := ctr.KVPairs["ID"]
+			r.rids[id] = ctr.KVPairs["RID"]
+			r.postings = append(r.postings, ReconcilePosting{
+				ID:     id,
+				P:      i,
+				Date:   ctr.Date,
+				Payee:  ctr.Description,
+				Amount: p.Value,
+			})
+		}
+	}
+	return r
+}
+
+// Postings returns the postings that were not cleared when the session started, in chronological order, with the
+// ones marked cleared in this session flagged.
+func (r *Reconciliation) Postings() []ReconcilePosting {
+	ps := make([]ReconcilePosting, len(r.postings))
+	for i, p := range r.postings {
+		p.Cleared = r.toggled[reconcileRef{p.ID, p.P}]
+		ps[i] = p
+	}
+	return ps
+}
+
+// Toggle marks a posting cleared, or not cleared if it already was. Returns a *TransactionError wrapping
+// TransactionNotFoundError if the posting isn't one of the postings returned by Postings.
+func (r *Reconciliation) Toggle(id string, p int) error {
+	ref := reconcileRef{id, p}
+	for _, rp := range r.postings {
+		if rp.ID == id && rp.P == p {
+			if r.toggled[ref] {
+				delete(r.toggled, ref)
+			} else {
+				r.toggled[ref] = true
+			}
+			return nil
+		}
+	}
+	return &TransactionError{ID: id, Err: TransactionNotFoundError}
+}
+
+// Cleared returns the balance of all cleared postings to the account, including the ones marked cleared in this
+// session.
+func (r *Reconciliation) Cleared() int64 {
+	total := r.cleared
+	for _, rp := range r.postings {
+		if r.toggled[reconcileRef{rp.ID, rp.P}] {
+			total += rp.Amount
+		}
+	}
+	return total
+}
+
+// Difference returns how far the cleared balance is from the statement balance. The reconciliation is done when
+// this is zero.
+func (r *Reconciliation) Difference() int64 {
+	return r.Statement - r.Cleared()
+}
+
+// Commit writes an edit revision for each transaction with postings marked cleared, with those postings set to
+// cleared. Returns ReconcileDifferenceError (without writing anything) if the difference is not zero, and a
+// *TransactionError wrapping ReconcileChangedError if any of the transactions were edited since the session
+// started. The session can be used again afterwards, with the committed postings counted as cleared.
+func (r *Reconciliation) Commit() error {
+	if r.Difference() != 0 {
+		return ReconcileDifferenceError
+	}
+
+	byID := map[string][]int{}
+	for ref := range r.toggled {
+		byID[ref.id] = append(byID[ref.id], ref.p)
+	}
+	ids := make([]string, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// Check everything first, so we don't write some of the edits and then fail.
+	edits := []ledger.Transaction{}
+	r.client.lock.RLock()
+	for _, id := range ids {
+		idx, ok := r.client.simpleid[id]
+		if !ok || r.client.simple[idx].KVPairs["RID"] != r.rids[id] {
+			r.client.lock.RUnlock()
+			return &TransactionError{ID: id, Err: ReconcileChangedError}
+		}
+		tr := *r.client.simple[idx].CleanCopy()
+		for _, p := range byID[id] {
+			tr.Postings[p].Status = ledger.StatusClear
+		}
+		edits = append(edits, tr)
+	}
+	r.client.lock.RUnlock()
+
+	for _, tr := range edits {
+		err := r.client.AddTransactionEdit(tr)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The committed postings are cleared now. Edits get a new RID, which AddTransactionEdit set in the shared map.
+	for _, tr := range edits {
+		r.rids[tr.KVPairs["ID"]] = tr.KVPairs["RID"]
+	}
+	postings := []ReconcilePosting{}
+	for _, rp := range r.postings {
+		if r.toggled[reconcileRef{rp.ID, rp.P}] {
+			r.cleared += rp.Amount
+			continue
+		}
+		postings = append(postings, rp)
+	}
+	r.postings = postings
+	r.toggled = map[reconcileRef]bool{}
+	return nil
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package client
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/samuellwn/ledger"
+)
+
+// SearchQuery is a search for Client.Search. Every field is optional, and only transactions that match all of the
+// fields that are set are found.
+type SearchQuery struct {
+	// Words that must all appear somewhere in the transaction: the description, code, comments, tags, KV values,
+	// or the accounts and notes of the postings. Case is ignored. A word that is an amount (such as "12.50") also
+	// matches a posting of that amount.
+	Text string
+
+	Description *regexp.Regexp // The description must match this.
+	Account     *regexp.Regexp // At least one posting must be to an account matching this.
+
+	// Limits on the absolute value of the postings, inclusive. At least one posting must be in range, and if Account
+	// is set it must be one of the postings to a matching account.
+	MinAmount    int64
+	HasMinAmount bool
+	MaxAmount    int64
+	HasMaxAmount bool
+
+	Begin time.Time // If not zero, only transactions on or after this date match.
+	End   time.Time // If not zero, only transactions before this date match.
+
+	Tags    []string          // The transaction must have all of these tags.
+	KVPairs map[string]string // The transaction must have all of these KV pairs. An empty value matches any value.
+
+	// Order the results by how well they match Text, best first, instead of chronologically. Transactions that
+	// match equally well stay in chronological order.
+	Ranked bool
+}
+
+// Search returns copies of the transactions in the simplified list that match the query, chronologically or ranked
+// by relevance.
+func (client *Client) Search(q SearchQuery) []ledger.Transaction {
+	// Grab the read lock.
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+
+	words := strings.Fields(strings.ToLower(q.Text))
+
+	trs := []ledger.Transaction{}
+	scores := []int{}
+	for _, tr := range client.simple {
+		ctr := tr.CleanCopy()
+		// Fill in null postings so they have amounts to check.
+		_ = ctr.Canonicalize()
+
+		if !q.matches(ctr) {
+			continue
+		}
+		score, ok := textScore(ctr, words)
+		if !ok {
+			continue
+		}
+		trs = append(trs, *ctr)
+		scores = append(scores, score)
+	}
+
+	if q.Ranked {
+		order := make([]int, len(trs))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return scores[order[i]] > scores[order[j]]
+		})
+		ranked := make([]ledger.Transaction, len(trs))
+		for i, j := range order {
+			ranked[i] = trs[j]
+		}
+		trs = ranked
+	}
+	return trs
+}
+
+// matches checks everything in the query except the text.
+func (q *SearchQuery) matches(tr *ledger.Transaction) bool {
+	if !q.Begin.IsZero() && tr.Date.Before(q.Begin) {
+		return false
+	}
+	if !q.End.IsZero() && !tr.Date.Before(q.End) {
+		return false
+	}
+	if q.Description != nil && !q.Description.MatchString(tr.Description) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !tr.Tags[tag] {
+			return false
+		}
+	}
+	for k, v := range q.KVPairs {
+		tv, ok := tr.KVPairs[k]
+		if !ok || v != "" && tv != v {
+			return false
+		}
+	}
+
+	if q.Account == nil && !q.HasMinAmount && !q.HasMaxAmount {
+		return true
+	}
+	for _, p := range tr.Postings {
+		if q.Account != nil && !q.Account.MatchString(p.Account) {
+			continue
+		}
+		v := p.Value
+		if v < 0 {
+			v = -v
+		}
+		if q.HasMinAmount && v < q.MinAmount || q.HasMaxAmount && v > q.MaxAmount {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// textScore checks that every word appears somewhere in the transaction, and returns a score for how well they
+// match. Words in the description count the most, especially whole words.
+func textScore(tr *ledger.Transaction, words []string) (int, bool) {
+	if len(words) == 0 {
+		return 0, true
+	}
+
+	desc := strings.ToLower(tr.Description)
+	descWords := strings.FieldsFunc(desc, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	other := []string{strings.ToLower(tr.Code)}
+	other = append(other, tr.Comments...)
+	for tag := range tr.Tags {
+		other = append(other, tag)
+	}
+	for _, v := range tr.KVPairs {
+		other = append(other, v)
+	}
+	for _, p := range tr.Postings {
+		other = append(other, p.Account, p.Note)
+	}
+	rest := strings.ToLower(strings.Join(other, "\n"))
+
+	score := 0
+	for _, w := range words {
+		switch {
+		case containsWord(descWords, w):
+			score += 4
+		case strings.Contains(desc, w):
+			score += 2
+		case strings.Contains(rest, w), matchesAmount(tr, w):
+			score++
+		default:
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+func containsWord(words []string, w string) bool {
+	for _, dw := range words {
+		if dw == w {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAmount returns true if the word is an amount and one of the postings has that value (either sign).
+func matchesAmount(tr *ledger.Transaction, w string) bool {
+	v, err := ledger.ParseValueNumber(strings.TrimPrefix(w, "$"))
+	if err != nil {
+		return false
+	}
+	for _, p := range tr.Postings {
+		if p.Value == v || p.Value == -v {
+			return true
+		}
+	}
+	return false
+}
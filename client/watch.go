@@ -0,0 +1,121 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package client
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// settle is how long the journal has to go without changing before it is reloaded, so it isn't read halfway through
+// an editor saving it.
+const settle = 200 * time.Millisecond
+
+// watch starts watching the journal (and any files it includes) for changes made by anything other than this client.
+// When one changes the journal is reloaded, and events are sent for anything that no longer matches what the client
+// has.
+func (client *Client) watch() error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	client.watcher = w
+
+	err = client.watchDirs()
+	if err != nil {
+		w.Close()
+		client.watcher = nil
+		return err
+	}
+
+	go func() {
+		var changed <-chan time.Time
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 && client.isJournalFile(ev) {
+					changed = time.After(settle)
+				}
+			case _, ok := <-w.Errors:
+				// There isn't anyone to report these to, and missing an event just means the next one does the
+				// reload instead.
+				if !ok {
+					return
+				}
+			case <-changed:
+				changed = nil
+				client.reload()
+			}
+		}
+	}()
+	return nil
+}
+
+// watchDirs makes sure the directories of all the journal files are being watched. Editors often save by writing a
+// new file and renaming it over the old one, so the directories are watched instead of the files themselves.
+// The caller must hold the write lock (or be NewClientWithConfig).
+func (client *Client) watchDirs() error {
+	for path := range client.files {
+		err := client.watcher.Add(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isJournalFile returns true if the event is for the journal or one of the files it includes, or if it is for a new
+// file that an include glob might pick up.
+func (client *Client) isJournalFile(ev fsnotify.Event) bool {
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+
+	return client.files[filepath.Clean(ev.Name)] || client.globs && ev.Op&fsnotify.Create != 0
+}
+
+// reload reloads the journal, and sends events for anything that changed. Our own writes also end up here, but they
+// are already in the internal lists so they don't count as a change. If the journal can't be loaded (say it
+// was deleted or is only half written) the current state is kept until the next change.
+func (client *Client) reload() {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	if client.closed {
+		return
+	}
+	events, err := client.load()
+	if err != nil {
+		return
+	}
+	for _, ev := range events {
+		client.emit(ev)
+	}
+
+	// The journal may include a new file now.
+	client.watchDirs()
+}
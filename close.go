@@ -0,0 +1,155 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// CloseOptions controls how CloseBooks splits a file.
+type CloseOptions struct {
+	Date   time.Time // Everything before this date is archived.
+	Equity string    // The account opening balances are taken from, such as "Equity:Opening Balances".
+
+	// Only accounts matching this get an opening balance (optional). The balances of the rest are left in the
+	// equity account, so for example income and expense accounts can be rolled into it.
+	Carry *regexp.Regexp
+}
+
+// closeDeclarations are the directive types that declare things used by the rest of the file. CloseBooks copies
+// these into the active file as well, so it can still be checked on its own.
+var closeDeclarations = map[string]bool{
+	"account":   true,
+	"alias":     true,
+	"commodity": true,
+	"payee":     true,
+	"tag":       true,
+}
+
+// CloseBooks splits the file at a date, returning an archive of everything before it and a new active file with
+// everything on or after it. The active file starts with an opening balance transaction for each account with a
+// balance at the date, so its balances are the same as the original's.
+//
+// Transactions are never split from their other revisions: a transaction is archived only if its latest revision
+// is before the date, and then all of its revisions go with it. The IDs of every transaction are kept, and the
+// opening balances get IDs based on the date and account, so closing the books on several copies of a file gives
+// the same result and they can still be synced. Directives go with the transaction that follows them, and
+// declarations (accounts, payees, and so on) from the archived part are also copied to the top of the active file.
+//
+// Returns an error if any transaction before the date doesn't balance.
+func (f *File) CloseBooks(opts CloseOptions) (*File, *File, error) {
+	sums, err := f.BalanceReport(ReportQuery{End: opts.Date}, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Work out which transactions are archived, by the date of the latest revision.
+	latest := map[string]time.Time{}
+	for _, i := range f.latestRevisions() {
+		if id := f.T[i].KVPairs["ID"]; id != "" {
+			latest[id] = f.T[i].Date
+		}
+	}
+	archived := make([]bool, len(f.T))
+	for i, tr := range f.T {
+		date := tr.Date
+		if id := tr.KVPairs["ID"]; id != "" {
+			date = latest[id]
+		}
+		archived[i] = date.Before(opts.Date)
+	}
+
+	archive := &File{T: []Transaction{}, D: []Directive{}}
+	active := &File{T: openingBalances(sums, opts), D: []Directive{}}
+
+	// Where each transaction of the original file ends up in its new file, for the directives.
+	moved := make([]int, len(f.T)+1)
+	for i, tr := range f.T {
+		if archived[i] {
+			moved[i] = len(archive.T)
+			archive.T = append(archive.T, tr)
+		} else {
+			moved[i] = len(active.T)
+			active.T = append(active.T, tr)
+		}
+	}
+	moved[len(f.T)] = len(active.T)
+
+	for _, d := range f.D {
+		if d.FoundBefore < len(f.T) && archived[d.FoundBefore] {
+			if closeDeclarations[d.Type] {
+				decl := d
+				decl.FoundBefore = 0
+				active.D = append(active.D, decl)
+			}
+			d.FoundBefore = moved[d.FoundBefore]
+			archive.D = append(archive.D, d)
+			continue
+		}
+		d.FoundBefore = moved[d.FoundBefore]
+		active.D = append(active.D, d)
+	}
+	return archive, active, nil
+}
+
+// openingBalances returns an opening balance transaction for each account with a balance, in account order.
+func openingBalances(sums map[string]int64, opts CloseOptions) []Transaction {
+	accounts := []string{}
+	for account, v := range sums {
+		if v == 0 || account == opts.Equity || opts.Carry != nil && !opts.Carry.MatchString(account) {
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+
+	trs := []Transaction{}
+	for _, account := range accounts {
+		h := fnv.New32a()
+		h.Write([]byte(account))
+		id := fmt.Sprintf("open-%v-%08x", opts.Date.Format("20060102"), h.Sum32())
+
+		trs = append(trs, Transaction{
+			Description: "Opening Balances",
+			Date:        opts.Date,
+			Status:      StatusClear,
+			KVPairs: map[string]string{
+				"ID":             id,
+				"RID":            id,
+				"OpeningBalance": account,
+			},
+			Postings: []Posting{{
+				Account: account,
+				Value:   sums[account],
+			}, {
+				Account: opts.Equity,
+				Null:    true,
+			}},
+		})
+	}
+	return trs
+}
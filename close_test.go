@@ -0,0 +1,99 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+var TestCloseBooksInput = `
+account Assets:Checking
+
+2022/01/05 * Groceries
+	; ID: a
+	; RID: a1
+	Expenses:Food                  $50.00
+	Assets:Checking
+
+2022/12/30 Rent
+	; ID: b
+	; RID: b1
+	Expenses:Rent                 $500.00
+	Assets:Checking
+
+2023/01/02 Rent
+	; ID: b
+	; RID: b2
+	Expenses:Rent                 $400.00
+	Assets:Checking
+
+2023/01/03 * Coffee
+	; ID: c
+	; RID: c1
+	Expenses:Food                   $3.00
+	Assets:Checking
+`
+
+func TestCloseBooks(t *testing.T) {
+	f, err := parse.ParseLedgerString(TestCloseBooksInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, active, err := f.CloseBooks(ledger.CloseOptions{
+		Date:   time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		Equity: "Equity:Opening Balances",
+		Carry:  regexp.MustCompile("^Assets:"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second revision of b is after the date, so both revisions stay active.
+	if len(archive.T) != 1 || archive.T[0].KVPairs["ID"] != "a" {
+		t.Errorf("Incorrect archive: %v", archive.T)
+	}
+	if len(active.T) != 4 || active.T[0].KVPairs["OpeningBalance"] != "Assets:Checking" || active.T[0].Postings[0].Value != -500000 {
+		t.Fatalf("Incorrect active file: %v", active.T)
+	}
+	if len(archive.D) != 1 || len(active.D) != 1 || active.D[0].FoundBefore != 0 {
+		t.Errorf("Declarations not copied: %v %v", archive.D, active.D)
+	}
+
+	before, err := f.BalanceReport(ledger.ReportQuery{Account: regexp.MustCompile("^Assets:")}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := active.BalanceReport(ledger.ReportQuery{Account: regexp.MustCompile("^Assets:")}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before["Assets:Checking"] != after["Assets:Checking"] {
+		t.Errorf("Balances changed: %v, %v", before, after)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// CSVOptions controls the output of File.ExportCSV.
+type CSVOptions struct {
+	Query    ReportQuery // Only postings selected by this query are exported.
+	Comma    rune        // The field separator, defaults to a comma.
+	NoHeader bool        // Leave out the header row.
+	Total    bool        // Add a running total column, like a register report.
+}
+
+// ExportCSV writes one CSV row for each posting selected by the query, in chronological order. The columns are
+// date, status, code, description, account, amount, commodity, tags, and k/v pairs (plus the running total if
+// requested). Tags are separated by colons and k/v pairs are written as "Key: Value" separated by semicolons, the
+// same as in a ledger file. Amounts for null postings are filled in.
+// Returns an error if any of the selected transactions do not balance.
+func (f *File) ExportCSV(w io.Writer, opts CSVOptions) error {
+	rows, err := f.Register(opts.Query)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		cw.Comma = opts.Comma
+	}
+
+	if !opts.NoHeader {
+		header := []string{"date", "status", "code", "description", "account", "amount", "commodity", "tags", "kv"}
+		if opts.Total {
+			header = append(header, "total")
+		}
+		err := cw.Write(header)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, row := range rows {
+		tr := &f.T[row.T]
+
+		tags := maps.Keys(tr.Tags)
+		slices.Sort(tags)
+
+		keys := maps.Keys(tr.KVPairs)
+		slices.Sort(keys)
+		kvs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			kvs = append(kvs, k+": "+tr.KVPairs[k])
+		}
+
+		record := []string{
+			row.Date.Format("2006-01-02"),
+			tr.Postings[row.P].EffectiveStatus(tr).String(),
+			tr.Code,
+			tr.Description,
+			row.Account,
+			FormatValueNumber(row.Amount),
+			"$",
+			strings.Join(tags, ":"),
+			strings.Join(kvs, "; "),
+		}
+		if opts.Total {
+			record = append(record, FormatValueNumber(row.Total))
+		}
+		err := cw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,570 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	xenc "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// CSVProfile describes the layout of a bank's CSV export.
+//
+// Columns are given by their name in the header row, or by their (zero based) index if the file has no header. If
+// both Amount and Debit/Credit are given, Amount is used.
+type CSVProfile struct {
+	Name string // A short name for the profile, such as "chase".
+
+	Comma      rune   // The field separator, defaults to a comma.
+	LazyQuotes bool   // Allow quotes in unquoted fields and unescaped quotes in quoted fields.
+	SkipRows   int    // Lines to skip before the header (or the first record if NoHeader is set).
+	SkipFooter int    // Lines to skip at the end of the file, not counting trailing blank lines.
+	NoHeader   bool   // The file has no header row.
+	Encoding   string // The character encoding, see DecodeCSV.
+
+	Date        string   // The date column.
+	DateFormat  string   // A time package layout for dates. Defaults to "01/02/2006".
+	Description []string // The description columns. If there is more than one they are joined with spaces.
+	Amount      string   // A single column of signed amounts.
+	Debit       string   // A column of amounts taken from the account. The sign is ignored.
+	Credit      string   // A column of amounts added to the account. The sign is ignored.
+	Negate      bool     // Negate all amounts, for banks that list charges as positive amounts.
+	Decimal     rune     // The decimal separator, '.' or ','. Defaults to '.'. With ',' periods separate thousands.
+	FITID       string   // An optional column with a unique transaction ID, used to skip already imported rows.
+	Memo        string   // An optional column stored in the Memo KV pair.
+	Balance     string   // An optional running balance column, see ImportCSV.
+	Pending     string   // An optional column, rows where it says "pending", "true", "yes", or "y" are pending.
+
+	Status         status // The status given to imported transactions.
+	AssertBalances bool   // Add a balance assertion from the balance column to every imported row.
+}
+
+// CSVProfiles is a set of profiles for common banks, by name. These are accurate as of the time of writing, but
+// banks like to change their export formats, so check the results.
+var CSVProfiles = map[string]CSVProfile{
+	"chase": {
+		Name:        "chase",
+		Date:        "Posting Date",
+		Description: []string{"Description"},
+		Amount:      "Amount",
+		Memo:        "Type",
+		Balance:     "Balance",
+	},
+	"chase-credit": {
+		Name:        "chase-credit",
+		Date:        "Post Date",
+		Description: []string{"Description"},
+		Amount:      "Amount",
+		Memo:        "Memo",
+	},
+	"bofa": {
+		Name:        "bofa",
+		SkipRows:    6,
+		Date:        "Date",
+		Description: []string{"Description"},
+		Amount:      "Amount",
+		Balance:     "Running Bal.",
+	},
+	"amex": {
+		Name:        "amex",
+		Date:        "Date",
+		Description: []string{"Description"},
+		Amount:      "Amount",
+		Negate:      true,
+	},
+	"capitalone": {
+		Name:        "capitalone",
+		Date:        "Posted Date",
+		DateFormat:  "2006-01-02",
+		Description: []string{"Description"},
+		Debit:       "Debit",
+		Credit:      "Credit",
+	},
+	"discover": {
+		Name:        "discover",
+		Date:        "Post Date",
+		Description: []string{"Description"},
+		Amount:      "Amount",
+		Negate:      true,
+	},
+	"wellsfargo": {
+		Name:        "wellsfargo",
+		NoHeader:    true,
+		Date:        "0",
+		Description: []string{"4"},
+		Amount:      "1",
+	},
+}
+
+// csvColumns holds the resolved column indexes for a profile, -1 for unused columns.
+type csvColumns struct {
+	date, amount, debit, credit, fitid, memo, balance, pending int
+	desc                                                       []int
+	min                                                        int
+}
+
+func (p *CSVProfile) columns(header []string) (*csvColumns, error) {
+	find := func(name string, what string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		if header == nil {
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 {
+				return -1, fmt.Errorf("The %v column must be a column number if there is no header: %q", what, name)
+			}
+			return i, nil
+		}
+		for i, field := range header {
+			if strings.TrimSpace(field) == name {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("The %v column %q was not found in the header.", what, name)
+	}
+
+	cols := &csvColumns{}
+	var err error
+	resolve := func(dst *int, name, what string) {
+		if err != nil {
+			return
+		}
+		*dst, err = find(name, what)
+		if *dst >= cols.min {
+			cols.min = *dst + 1
+		}
+	}
+	resolve(&cols.date, p.Date, "date")
+	resolve(&cols.amount, p.Amount, "amount")
+	resolve(&cols.debit, p.Debit, "debit")
+	resolve(&cols.credit, p.Credit, "credit")
+	resolve(&cols.fitid, p.FITID, "FITID")
+	resolve(&cols.memo, p.Memo, "memo")
+	resolve(&cols.balance, p.Balance, "balance")
+	resolve(&cols.pending, p.Pending, "pending")
+	for _, name := range p.Description {
+		var i int
+		resolve(&i, name, "description")
+		cols.desc = append(cols.desc, i)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cols.date == -1:
+		return nil, errors.New("No date column given.")
+	case cols.amount == -1 && cols.debit == -1 && cols.credit == -1:
+		return nil, errors.New("No amount column given.")
+	case len(cols.desc) == 0:
+		return nil, errors.New("No description column given.")
+	}
+	return cols, nil
+}
+
+// ParseCSVAmount parses an amount as commonly found in CSV files. Currency symbols and thousands separators are
+// ignored, and amounts in parentheses are negative. Empty amounts are zero.
+func ParseCSVAmount(s string) (int64, error) {
+	clean := strings.Builder{}
+	negate := false
+	for _, chr := range strings.TrimSpace(s) {
+		switch chr {
+		case '$', '€', '£', ')', ',', ' ', '\u00a0':
+			// eat all of these
+		case '(':
+			negate = true
+		default:
+			clean.WriteRune(chr)
+		}
+	}
+	if clean.Len() == 0 {
+		return 0, nil
+	}
+
+	v, err := ParseValueNumber(clean.String())
+	if err != nil {
+		return 0, err
+	}
+	if negate {
+		v = -v
+	}
+	return v, nil
+}
+
+// parseAmount is ParseCSVAmount, but with the profile's decimal separator.
+func (p *CSVProfile) parseAmount(s string) (int64, error) {
+	if p.Decimal == ',' {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.ReplaceAll(s, ",", ".")
+	}
+	return ParseCSVAmount(s)
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// DecodeCSV converts a CSV file to UTF-8. The encoding may be any of the usual names, such as "utf-8",
+// "latin1", "windows-1252", "utf-16le", or "utf-16be". If the encoding is empty it is guessed: a byte order mark
+// selects UTF-8 or UTF-16, otherwise text that is not valid UTF-8 is assumed to be Windows-1252 (a superset of
+// Latin-1). Any byte order mark is removed.
+func DecodeCSV(data []byte, encoding string) ([]byte, error) {
+	var enc xenc.Encoding
+	switch {
+	case encoding != "":
+		var err error
+		enc, err = htmlindex.Get(encoding)
+		if err != nil {
+			return nil, fmt.Errorf("Unknown encoding: %q", encoding)
+		}
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		enc = unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	case !utf8.Valid(data):
+		enc = charmap.Windows1252
+	}
+
+	if enc != nil {
+		// A byte order mark overrides the given encoding.
+		decoded, _, err := transform.Bytes(unicode.BOMOverride(enc.NewDecoder()), data)
+		if err != nil {
+			return nil, err
+		}
+		data = decoded
+	}
+	return bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), nil
+}
+
+// skipLines drops lines from the start and end of the data. Trailing blank lines don't count towards the footer.
+func skipLines(data []byte, head, foot int) ([]byte, error) {
+	for i := 0; i < head; i++ {
+		nl := bytes.IndexByte(data, '\n')
+		if nl == -1 {
+			return nil, fmt.Errorf("Failed to skip line %v: not enough lines.", i+1)
+		}
+		data = data[nl+1:]
+	}
+
+	if foot > 0 {
+		data = bytes.TrimRight(data, "\r\n\t ")
+		for i := 0; i < foot; i++ {
+			nl := bytes.LastIndexByte(data, '\n')
+			if nl == -1 {
+				return nil, fmt.Errorf("Failed to skip footer line %v: not enough lines.", i+1)
+			}
+			data = data[:nl]
+		}
+		data = append(data, '\n')
+	}
+	return data, nil
+}
+
+type csvRow struct {
+	tr         Transaction
+	amount     int64
+	balance    int64
+	hasBalance bool
+	seen       bool
+}
+
+// ImportCSV imports a bank CSV export into this file, using the profile to find the columns. Each row becomes a
+// transaction with the amount posted to the bank account and a null posting to the default account, rows without an
+// amount are skipped. If the profile has a FITID column, already imported rows are skipped. If it has a pending
+// column, pending rows are imported as pending and updated when their posted versions are imported (see
+// Transaction.Pending).
+//
+// If the profile has a balance column and an equity account is given, statement opening and closing balance
+// assertions are added like ImportOFX does, so missing or duplicated rows show up as a balance error. Rows are
+// imported in chronological order when there is a balance column, even if the bank lists the newest first.
+func (f *File) ImportCSV(csvFile io.Reader, profile CSVProfile, bankAcct, defaultAcct, equityAcct string) error {
+	data, err := io.ReadAll(csvFile)
+	if err != nil {
+		return err
+	}
+	data, err = DecodeCSV(data, profile.Encoding)
+	if err != nil {
+		return err
+	}
+	data, err = skipLines(data, profile.SkipRows, profile.SkipFooter)
+	if err != nil {
+		return err
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	if profile.Comma != 0 {
+		reader.Comma = profile.Comma
+	}
+	reader.LazyQuotes = profile.LazyQuotes
+	// Summary rows and the like rarely have the same number of fields as the transactions.
+	reader.FieldsPerRecord = -1
+
+	var header []string
+	if !profile.NoHeader {
+		header, err = reader.Read()
+		if err != nil {
+			return fmt.Errorf("Failed to read header: %w", err)
+		}
+	}
+
+	cols, err := profile.columns(header)
+	if err != nil {
+		return err
+	}
+
+	dateFmt := profile.DateFormat
+	if dateFmt == "" {
+		dateFmt = "01/02/2006"
+	}
+
+	seenIds := f.SeenFITIDs(bankAcct)
+
+	rows := []csvRow{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+		line += profile.SkipRows
+
+		if len(record) < cols.min {
+			return fmt.Errorf("Record on line %v has too few fields.", line)
+		}
+
+		date, err := time.Parse(dateFmt, strings.TrimSpace(record[cols.date]))
+		if err != nil {
+			return fmt.Errorf("Failed to parse date on line %v: %q", line, record[cols.date])
+		}
+
+		// Rows without an amount aren't transactions, such as the beginning balance row Bank of America adds.
+		if csvBlank(record, cols.amount, cols.debit, cols.credit) {
+			continue
+		}
+
+		var amount int64
+		if cols.amount != -1 {
+			amount, err = profile.parseAmount(record[cols.amount])
+			if err != nil {
+				return fmt.Errorf("Failed to parse amount on line %v: %q", line, record[cols.amount])
+			}
+		} else {
+			if cols.debit != -1 {
+				v, err := profile.parseAmount(record[cols.debit])
+				if err != nil {
+					return fmt.Errorf("Failed to parse debit on line %v: %q", line, record[cols.debit])
+				}
+				amount -= abs(v)
+			}
+			if cols.credit != -1 {
+				v, err := profile.parseAmount(record[cols.credit])
+				if err != nil {
+					return fmt.Errorf("Failed to parse credit on line %v: %q", line, record[cols.credit])
+				}
+				amount += abs(v)
+			}
+		}
+		if profile.Negate {
+			amount = -amount
+		}
+
+		desc := make([]string, 0, len(cols.desc))
+		for _, ix := range cols.desc {
+			if d := strings.TrimSpace(record[ix]); d != "" {
+				desc = append(desc, d)
+			}
+		}
+
+		tr := Transaction{
+			Description: strings.Join(desc, " "),
+			Date:        date,
+			Status:      profile.Status,
+			KVPairs:     map[string]string{},
+			Postings: []Posting{
+				{
+					Account: bankAcct,
+					Value:   amount,
+				},
+				{
+					Account: defaultAcct,
+					Null:    true,
+				},
+			},
+		}
+
+		row := csvRow{amount: amount}
+		if cols.balance != -1 && strings.TrimSpace(record[cols.balance]) != "" {
+			row.balance, err = profile.parseAmount(record[cols.balance])
+			if err != nil {
+				return fmt.Errorf("Failed to parse balance on line %v: %q", line, record[cols.balance])
+			}
+			row.hasBalance = true
+		}
+
+		if cols.fitid != -1 {
+			fitid := strings.TrimSpace(record[cols.fitid])
+			row.seen = seenIds[fitid]
+			tr.KVPairs["FITID"] = fitid
+			tr.KVPairs["Account"] = bankAcct
+		}
+		if cols.memo != -1 {
+			tr.KVPairs["Memo"] = strings.TrimSpace(record[cols.memo])
+		}
+		if cols.pending != -1 {
+			// Pending transactions are matched with their posted versions by account.
+			tr.KVPairs["Account"] = bankAcct
+			switch strings.ToLower(strings.TrimSpace(record[cols.pending])) {
+			case "pending", "true", "yes", "y":
+				tr.Status = StatusPending
+				tr.KVPairs["Pending"] = "true"
+			}
+		}
+
+		row.tr = tr
+		rows = append(rows, row)
+	}
+
+	var opening, closing *Transaction
+	if cols.balance != -1 {
+		if csvDescending(rows) {
+			for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+				rows[i], rows[j] = rows[j], rows[i]
+			}
+		}
+
+		if profile.AssertBalances {
+			for i := range rows {
+				if rows[i].hasBalance {
+					rows[i].tr.Postings[0].Assert = rows[i].balance
+					rows[i].tr.Postings[0].HasAssert = true
+				}
+			}
+		}
+
+		if equityAcct != "" {
+			opening, closing = csvBalances(f.ids(), rows, bankAcct, equityAcct)
+		}
+	}
+
+	trs := []Transaction{}
+	if opening != nil {
+		trs = append(trs, *opening)
+	}
+	for _, row := range rows {
+		if !row.seen {
+			AssignIDs(f.ids(), &row.tr)
+			trs = append(trs, row.tr)
+		}
+	}
+	if closing != nil {
+		trs = append(trs, *closing)
+	}
+
+	n := len(f.T)
+	f.T = append(f.T, trs...)
+	f.resolvePending(n)
+	return nil
+}
+
+// csvBlank returns true if all of the given columns are empty in the record. Unused columns (-1) are skipped.
+func csvBlank(record []string, cols ...int) bool {
+	for _, ix := range cols {
+		if ix != -1 && strings.TrimSpace(record[ix]) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// csvDescending guesses if the rows are in reverse chronological order, first by checking which order the running
+// balance agrees with, and failing that by the dates.
+func csvDescending(rows []csvRow) bool {
+	if len(rows) < 2 {
+		return false
+	}
+
+	asc, desc := 0, 0
+	for i := 1; i < len(rows); i++ {
+		a, b := rows[i-1], rows[i]
+		if !a.hasBalance || !b.hasBalance {
+			continue
+		}
+		if b.balance == a.balance+b.amount {
+			asc++
+		}
+		if a.balance == b.balance+a.amount {
+			desc++
+		}
+	}
+	if asc != desc {
+		return desc > asc
+	}
+	return rows[0].tr.Date.After(rows[len(rows)-1].tr.Date)
+}
+
+// csvBalances returns the opening and closing balance transactions for a set of rows in chronological order, or
+// nils if none of the rows has a balance. Rows without a balance (often pending transactions) still count.
+func csvBalances(gen IDGenerator, rows []csvRow, bankAcct, equityAcct string) (*Transaction, *Transaction) {
+	first, last := -1, -1
+	for i, row := range rows {
+		if row.hasBalance {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first == -1 {
+		return nil, nil
+	}
+
+	open := rows[first].balance
+	for _, row := range rows[:first+1] {
+		open -= row.amount
+	}
+	close := rows[last].balance
+	for _, row := range rows[last+1:] {
+		close += row.amount
+	}
+
+	opening, closing := statementBalances(gen, bankAcct, equityAcct, rows[0].tr.Date, open, rows[len(rows)-1].tr.Date, close)
+	return &opening, &closing
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+func TestShortDates(t *testing.T) {
+	f, err := parse.Read(strings.NewReader(`
+03/15 Coffee
+	Expenses:Food  $5.00
+	Assets:Checking
+
+Y2024
+
+3/5=3/7 Tea
+	Expenses:Food  $3.00
+	Assets:Checking
+
+year 2025
+
+2023/12/31 Rent
+	Expenses:Rent  $500.00
+	Assets:Checking
+
+12/31 Rent
+	Expenses:Rent  $500.00
+	Assets:Checking
+`), "", parse.Options{Year: 2022})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"2022/03/15", "2024/03/05", "2023/12/31", "2025/12/31"}
+	for i, tr := range f.T {
+		if got := tr.Date.Format("2006/01/02"); got != want[i] {
+			t.Errorf("Transaction %v has date %v, want %v", i, got, want[i])
+		}
+	}
+	if f.T[1].ClearDate.Format("2006/01/02") != "2024/03/07" {
+		t.Errorf("Incorrect clear date: %v", f.T[1].ClearDate)
+	}
+
+	for _, bad := range []string{"02/30 Nope\n\tA  $1.00\n\tB\n", "2024/3/05 Nope\n\tA  $1.00\n\tB\n", "123/05 Nope\n\tA  $1.00\n\tB\n"} {
+		if _, err := parse.ParseLedgerString(bad); err == nil {
+			t.Errorf("Bad date %q didn't fail.", bad)
+		}
+	}
+}
+
+func TestTimeOfDay(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+2024/01/02 13:45:30 * Sell BTC
+	Assets:Exchange  $10.00
+	Assets:Crypto
+
+2024/01/02 9:05 Buy BTC
+	Assets:Crypto  $10.00
+	Assets:Exchange
+
+2024/01/02 7 Eleven
+	Expenses:Food  $3.00
+	Assets:Checking
+
+2024/01/02 12:00pm lunch
+	Expenses:Food  $3.00
+	Assets:Checking
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !f.T[0].HasTime || f.T[0].Date.Format("15:04:05") != "13:45:30" || f.T[0].Status != ledger.StatusClear {
+		t.Errorf("Incorrect time: %v", f.T[0].Date)
+	}
+	if f.T[2].HasTime || f.T[2].Description != "7 Eleven" || f.T[3].Description != "12:00pm lunch" {
+		t.Errorf("Descriptions read as times: %q, %q", f.T[2].Description, f.T[3].Description)
+	}
+	if s := f.T[1].String(); !strings.HasPrefix(s, "2024/01/02 09:05   Buy BTC\n") {
+		t.Errorf("Incorrect format: %q", s)
+	}
+
+	f.Sort()
+	if f.T[2].Description != "Buy BTC" || f.T[3].Description != "Sell BTC" {
+		t.Errorf("Incorrect order: %v", f.T)
+	}
+}
+
+func TestPostingDates(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+2024/01/30 * Rent
+	Expenses:Rent  $500.00 ; [=2024/02/01] February
+	Assets:Checking
+
+2024/01/31=2024/02/02 * Paycheck
+	Assets:Checking  $1000.00 ; [2024/02/01]
+	Income:Salary  ; [nope]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &f.T[0].Postings[0]
+	if !p.Date.IsZero() || p.AuxDate.Format("2006/01/02") != "2024/02/01" || p.Note != "February" {
+		t.Errorf("Incorrect posting dates: %v, %v, %q", p.Date, p.AuxDate, p.Note)
+	}
+	if f.T[1].Postings[1].Note != "[nope]" {
+		t.Errorf("Note without dates changed: %q", f.T[1].Postings[1].Note)
+	}
+	if s := p.String(); !strings.HasSuffix(s, " ; [=2024/02/01] February") {
+		t.Errorf("Incorrect format: %q", s)
+	}
+
+	q := ledger.ReportQuery{Begin: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}
+	rows, err := f.Register(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Account != "Assets:Checking" {
+		t.Errorf("Incorrect register: %v", rows)
+	}
+
+	q.Effective = true
+	report, err := f.PeriodicReport(q, ledger.IntervalMonthly, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Periods) != 1 || report.Sums["Expenses:Rent"][0] != 5000000 || report.Sums["Income:Salary"][0] != -10000000 {
+		t.Errorf("Incorrect periodic report: %v", report)
+	}
+}
@@ -0,0 +1,313 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reasons a transaction can be a Duplicate.
+const (
+	DuplicateID    = "id"    // Same ID and RID.
+	DuplicateFITID = "fitid" // Same FITID and bank account.
+	DuplicateFuzzy = "fuzzy" // Same amount and a similar description on nearby dates.
+)
+
+// DedupeOptions controls how File.Duplicates finds duplicate transactions.
+type DedupeOptions struct {
+	ID    bool // Find transactions with the same ID and RID, which are copies of the same revision.
+	FITID bool // Find transactions imported from the same bank account with the same FITID.
+	Fuzzy bool // Find transactions that look the same, see below.
+
+	// For fuzzy matches the transactions must move the same amount of money, be at most Days apart, have a posting
+	// to the same account, and have descriptions at least Similarity alike (from 0 to 1, where 1 means they have
+	// the same words). Transactions with different FITIDs are never fuzzy matches, since the bank says they are
+	// different. Similarity values of 0 or less mean 0.5.
+	Days       int
+	Similarity float64
+}
+
+// Duplicate is a transaction found to be a duplicate of an earlier one.
+type Duplicate struct {
+	T      int    // The index of the duplicate in File.T.
+	Of     int    // The index of the transaction it duplicates.
+	Reason string // One of DuplicateID, DuplicateFITID, or DuplicateFuzzy.
+}
+
+// Duplicates returns every transaction that duplicates an earlier one, in file order. Except for ID matches only
+// the latest revision of each transaction is considered. A transaction is only reported once, even if it matches
+// several others.
+func (f *File) Duplicates(opts DedupeOptions) []Duplicate {
+	if opts.Similarity <= 0 {
+		opts.Similarity = 0.5
+	}
+
+	dups := []Duplicate{}
+	found := map[int]bool{}
+	add := func(i, of int, reason string) {
+		if found[i] || found[of] {
+			return
+		}
+		found[i] = true
+		dups = append(dups, Duplicate{i, of, reason})
+	}
+
+	if opts.ID {
+		seen := map[[2]string]int{}
+		for i, tr := range f.T {
+			id := tr.KVPairs["ID"]
+			if id == "" {
+				continue
+			}
+			k := [2]string{id, tr.KVPairs["RID"]}
+			if j, ok := seen[k]; ok {
+				add(i, j, DuplicateID)
+				continue
+			}
+			seen[k] = i
+		}
+	}
+
+	ixs := f.latestRevisions()
+
+	if opts.FITID {
+		seen := map[[2]string]int{}
+		for _, i := range ixs {
+			tr := &f.T[i]
+			if tr.KVPairs["FITID"] == "" {
+				continue
+			}
+			k := [2]string{tr.KVPairs["Account"], tr.KVPairs["FITID"]}
+			if j, ok := seen[k]; ok {
+				add(i, j, DuplicateFITID)
+				continue
+			}
+			seen[k] = i
+		}
+	}
+
+	if opts.Fuzzy {
+		// Sorting by date means only a small window of transactions needs to be compared against each one.
+		sort.SliceStable(ixs, func(i, j int) bool {
+			return f.T[ixs[i]].Date.Before(f.T[ixs[j]].Date)
+		})
+		amounts := make([]int64, len(ixs))
+		for k, i := range ixs {
+			amounts[k] = transactionAmount(&f.T[i])
+		}
+
+		for k, i := range ixs {
+			limit := f.T[i].Date.AddDate(0, 0, opts.Days)
+			for l := k + 1; l < len(ixs) && !f.T[ixs[l]].Date.After(limit); l++ {
+				if amounts[k] == 0 || amounts[k] != amounts[l] || !fuzzyMatch(&f.T[i], &f.T[ixs[l]], opts.Similarity) {
+					continue
+				}
+				// Whichever comes later in the file is the duplicate.
+				if i < ixs[l] {
+					add(ixs[l], i, DuplicateFuzzy)
+				} else {
+					add(i, ixs[l], DuplicateFuzzy)
+				}
+			}
+		}
+	}
+
+	sort.Slice(dups, func(i, j int) bool {
+		return dups[i].T < dups[j].T
+	})
+	return dups
+}
+
+// Deduplicate finds duplicate transactions with Duplicates and removes them from the file, along with all of their
+// earlier revisions. If flag is true the duplicates are kept, but get a "Duplicate" KV pair naming the transaction
+// they duplicate so they can be reviewed by hand. The KV pair is set directly instead of adding a new revision, so
+// nothing is left behind in the history once it is dealt with.
+// The returned list of duplicates uses indexes from before any transactions were removed.
+func (f *File) Deduplicate(opts DedupeOptions, flag bool) []Duplicate {
+	dups := f.Duplicates(opts)
+
+	if flag {
+		for _, dup := range dups {
+			f.T[dup.T].KVPairs["Duplicate"] = duplicateRef(&f.T[dup.Of])
+		}
+		return dups
+	}
+
+	remove := map[int]bool{}
+	ids := map[string]bool{}
+	for _, dup := range dups {
+		remove[dup.T] = true
+		// An ID duplicate shares its ID with the transaction it duplicates, so only that one copy can go.
+		if id := f.T[dup.T].KVPairs["ID"]; id != "" && dup.Reason != DuplicateID {
+			ids[id] = true
+		}
+	}
+
+	trs := []Transaction{}
+	kept := make([]int, len(f.T)+1) // The number of transactions kept before each index.
+	for i, tr := range f.T {
+		kept[i] = len(trs)
+		if remove[i] || ids[tr.KVPairs["ID"]] {
+			continue
+		}
+		trs = append(trs, tr)
+	}
+	kept[len(f.T)] = len(trs)
+	f.T = trs
+
+	for i := range f.D {
+		if f.D[i].FoundBefore < len(kept) {
+			f.D[i].FoundBefore = kept[f.D[i].FoundBefore]
+		}
+	}
+	return dups
+}
+
+// suspectDuplicates finds new transactions (made by an importer) that look like they duplicate one already in the
+// file, but have a different FITID. The result maps indexes in trs to the index in f.T of the transaction each one
+// seems to duplicate. Each transaction in the file is only matched once. See OFXImportOptions for the rules.
+func (f *File) suspectDuplicates(trs []Transaction, days int, similarity float64) map[int]int {
+	if similarity <= 0 {
+		similarity = 0.5
+	}
+	window := time.Duration(days) * 24 * time.Hour
+
+	existing := f.latestRevisions()
+	ids := map[string]bool{}
+	for _, j := range existing {
+		ids[f.T[j].KVPairs["ID"]] = true
+	}
+
+	used := map[int]bool{}
+	dups := map[int]int{}
+	for i := range trs {
+		tr := &trs[i]
+		acct := tr.KVPairs["Account"]
+		amount := transactionAmount(tr)
+		if tr.KVPairs["FITID"] == "" || acct == "" || amount == 0 {
+			continue
+		}
+		// Edits of existing transactions (posted versions of pending ones) aren't duplicates.
+		if ids[tr.KVPairs["ID"]] {
+			continue
+		}
+
+		for _, j := range existing {
+			ex := &f.T[j]
+			if used[j] || ex.KVPairs["FITID"] == tr.KVPairs["FITID"] {
+				continue
+			}
+			if d := ex.Date.Sub(tr.Date); d > window || d < -window {
+				continue
+			}
+			if !postsTo(ex, acct) || transactionAmount(ex) != amount {
+				continue
+			}
+			if descriptionSimilarity(ex.Description, tr.Description) < similarity {
+				continue
+			}
+			used[j] = true
+			dups[i] = j
+			break
+		}
+	}
+	return dups
+}
+
+// postsTo returns true if the transaction has a posting to the account or one of its sub accounts.
+func postsTo(tr *Transaction, account string) bool {
+	for _, p := range tr.Postings {
+		if p.Account == account || strings.HasPrefix(p.Account, account+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// transactionAmount returns the total of the positive postings in a transaction, or 0 if it does not balance.
+func transactionAmount(tr *Transaction) int64 {
+	ok, accounts := tr.Balance()
+	if !ok {
+		return 0
+	}
+	total := int64(0)
+	for _, v := range accounts {
+		if v > 0 {
+			total += v
+		}
+	}
+	return total
+}
+
+func fuzzyMatch(a, b *Transaction, similarity float64) bool {
+	if a.KVPairs["FITID"] != "" && b.KVPairs["FITID"] != "" && a.KVPairs["FITID"] != b.KVPairs["FITID"] {
+		return false
+	}
+
+	shared := false
+	for _, pa := range a.Postings {
+		for _, pb := range b.Postings {
+			if pa.Account == pb.Account {
+				shared = true
+			}
+		}
+	}
+	if !shared {
+		return false
+	}
+
+	return descriptionSimilarity(a.Description, b.Description) >= similarity
+}
+
+// descriptionSimilarity returns the fraction of words the two descriptions have in common, from 0 to 1.
+func descriptionSimilarity(a, b string) float64 {
+	ta, tb := descriptionTokens(a), descriptionTokens(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		if normalizeDescription(a) == normalizeDescription(b) {
+			return 1
+		}
+		return 0
+	}
+
+	words := map[string]bool{}
+	for _, w := range ta {
+		words[w] = true
+	}
+	common := 0
+	for _, w := range tb {
+		if words[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+// duplicateRef returns a string that identifies the transaction, for the "Duplicate" KV pair.
+func duplicateRef(tr *Transaction) string {
+	if id := tr.KVPairs["ID"]; id != "" {
+		return id
+	}
+	return tr.Date.Format("2006/01/02") + " " + tr.Description
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of PostingChange.
+const (
+	DiffAdded    = "added"
+	DiffRemoved  = "removed"
+	DiffModified = "modified"
+)
+
+// FieldChange is a change to one field of a transaction, or to one KV pair. Values are written as they would be in
+// a ledger file. Missing KV pairs are empty.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// PostingChange is a posting that was added, removed, or changed.
+type PostingChange struct {
+	Kind string   // One of DiffAdded, DiffRemoved, or DiffModified.
+	Old  *Posting // nil for added postings.
+	New  *Posting // nil for removed postings.
+}
+
+// TransactionDiff lists everything that differs between two revisions of a transaction.
+type TransactionDiff struct {
+	Fields   []FieldChange // Date, ClearDate, Status, Code, Description, and Comments, in that order.
+	Postings []PostingChange
+	KVPairs  []FieldChange // Sorted by key.
+
+	TagsAdded   []string // Sorted.
+	TagsRemoved []string
+}
+
+// DiffTransactions compares two transactions, usually two revisions of the same transaction. Postings are matched
+// up with an identical posting if there is one, otherwise with a posting to the same account, so changing the amount
+// of a posting shows up as a change instead of a removal and an addition. The RID is left out, since every revision
+// has a different one.
+func DiffTransactions(a, b *Transaction) *TransactionDiff {
+	d := &TransactionDiff{}
+
+	field := func(name, old, new string) {
+		if old != new {
+			d.Fields = append(d.Fields, FieldChange{name, old, new})
+		}
+	}
+	date := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006/01/02")
+	}
+	timeOfDay := func(tr *Transaction) string {
+		if !tr.HasTime {
+			return date(tr.Date)
+		}
+		return date(tr.Date) + " " + formatTimeOfDay(tr.Date)
+	}
+	field("Date", timeOfDay(a), timeOfDay(b))
+	field("ClearDate", date(a.ClearDate), date(b.ClearDate))
+	field("Status", a.Status.String(), b.Status.String())
+	field("Code", a.Code, b.Code)
+	field("Description", a.Description, b.Description)
+	field("Comments", strings.Join(a.Comments, "\n"), strings.Join(b.Comments, "\n"))
+
+	d.Postings = diffPostings(a.Postings, b.Postings)
+
+	keys := []string{}
+	for k := range a.KVPairs {
+		keys = append(keys, k)
+	}
+	for k := range b.KVPairs {
+		if _, ok := a.KVPairs[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k != "RID" && a.KVPairs[k] != b.KVPairs[k] {
+			d.KVPairs = append(d.KVPairs, FieldChange{k, a.KVPairs[k], b.KVPairs[k]})
+		}
+	}
+
+	for tag, ok := range b.Tags {
+		if ok && !a.Tags[tag] {
+			d.TagsAdded = append(d.TagsAdded, tag)
+		}
+	}
+	for tag, ok := range a.Tags {
+		if ok && !b.Tags[tag] {
+			d.TagsRemoved = append(d.TagsRemoved, tag)
+		}
+	}
+	sort.Strings(d.TagsAdded)
+	sort.Strings(d.TagsRemoved)
+	return d
+}
+
+// diffPostings matches up the old and new postings. Changes are in the order of the new postings, with removed
+// postings last.
+func diffPostings(old, new []Posting) []PostingChange {
+	match := make([]int, len(new)) // The old posting matched with each new one, or -1.
+	used := make([]bool, len(old))
+	for pass := 0; pass < 2; pass++ {
+		for i := range new {
+			if pass == 1 && match[i] != -1 {
+				continue
+			}
+			match[i] = -1
+			for j := range old {
+				if used[j] {
+					continue
+				}
+				if pass == 0 && old[j] == new[i] || pass == 1 && old[j].Account == new[i].Account {
+					match[i], used[j] = j, true
+					break
+				}
+			}
+		}
+	}
+
+	changes := []PostingChange{}
+	for i, j := range match {
+		switch {
+		case j == -1:
+			changes = append(changes, PostingChange{DiffAdded, nil, &new[i]})
+		case old[j] != new[i]:
+			changes = append(changes, PostingChange{DiffModified, &old[j], &new[i]})
+		}
+	}
+	for j := range old {
+		if !used[j] {
+			changes = append(changes, PostingChange{DiffRemoved, &old[j], nil})
+		}
+	}
+	return changes
+}
+
+// Empty returns true if the transactions were the same.
+func (d *TransactionDiff) Empty() bool {
+	return len(d.Fields) == 0 && len(d.Postings) == 0 && len(d.KVPairs) == 0 && len(d.TagsAdded) == 0 &&
+		len(d.TagsRemoved) == 0
+}
+
+// String renders the diff as text, one change per line:
+//
+//	Description: "Coffee" -> "Coffee Shop"
+//	- Expenses:Food  $5.00
+//	+ Expenses:Dining  $5.00
+//	~ Assets:Checking  $-5.00 -> Assets:Checking  $-6.00
+//	Tags: +dining -food
+//	Payee: "" -> "Joe's"
+func (d *TransactionDiff) String() string {
+	lines := []string{}
+	for _, f := range d.Fields {
+		lines = append(lines, fmt.Sprintf("%v: %q -> %q", f.Field, f.Old, f.New))
+	}
+
+	opts := FormatOptions{AccountWidth: 1}
+	for _, p := range d.Postings {
+		switch p.Kind {
+		case DiffAdded:
+			lines = append(lines, "+ "+p.New.Format(opts))
+		case DiffRemoved:
+			lines = append(lines, "- "+p.Old.Format(opts))
+		default:
+			lines = append(lines, "~ "+p.Old.Format(opts)+" -> "+p.New.Format(opts))
+		}
+	}
+
+	if len(d.TagsAdded)+len(d.TagsRemoved) > 0 {
+		tags := []string{}
+		for _, tag := range d.TagsAdded {
+			tags = append(tags, "+"+tag)
+		}
+		for _, tag := range d.TagsRemoved {
+			tags = append(tags, "-"+tag)
+		}
+		lines = append(lines, "Tags: "+strings.Join(tags, " "))
+	}
+
+	for _, kv := range d.KVPairs {
+		lines = append(lines, fmt.Sprintf("%v: %q -> %q", kv.Field, kv.Old, kv.New))
+	}
+	return strings.Join(lines, "\n")
+}
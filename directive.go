@@ -24,28 +24,77 @@ package ledger
 
 import (
 	"bytes"
+	"fmt"
+	"strings"
 
-	"github.com/samuellwn/ledger/parse/lex"
 	"golang.org/x/exp/slices"
 )
 
 // Directive is a simple type to represent a partially parsed, but not validated, command directive.
 type Directive struct {
-	Type        string       // The keyword that starts the directive.
-	Argument    string       // Any remaining content that was on the first line of the directive.
-	Lines       []string     // Subsequent indented lines. Stored here unparsed.
-	FoundBefore int          // The transaction index this directive precedes.
-	Location    lex.Location // Line number this directive begins at.
+	Type        string   // The keyword that starts the directive.
+	Argument    string   // Any remaining content that was on the first line of the directive.
+	Lines       []string // Subsequent indented lines. Stored here unparsed.
+	FoundBefore int      // The transaction index this directive precedes.
+	Location    Position // Where this directive begins.
+
+	// The source text of the directive, only set if the parser was asked to keep it. Works exactly like
+	// Transaction.Raw.
+	Raw   string
+	rawOf string
+
+	// The parsed contents of common directive types (one of the typed directive structs, see ParseDirective), set
+	// by the parser. Nil for other directives, or if the directive couldn't be parsed. Like Raw, this is only
+	// valid until the directive is modified, so use Parse instead of reading it directly.
+	Value   any
+	valueOf string
+}
+
+// SetRaw sets the source text of this directive. The raw text will only be used until the next time the
+// directive is modified.
+func (d *Directive) SetRaw(raw string) {
+	if raw != "" && !strings.HasSuffix(raw, "\n") {
+		raw += "\n"
+	}
+	d.Raw = raw
+	d.rawOf = d.String()
+}
+
+// Unmodified returns true if the directive has raw source text that still matches its contents.
+func (d *Directive) Unmodified() bool {
+	return d.Raw != "" && d.String() == d.rawOf
 }
 
 func (d *Directive) String() string {
 	buf := new(bytes.Buffer)
 
+	// Comments kept by the parser.
+	if d.Type == ";" {
+		for _, line := range d.Lines {
+			buf.WriteRune(';')
+			buf.WriteString(line)
+			buf.WriteRune('\n')
+		}
+		return buf.String()
+	}
+
 	buf.WriteString(d.Type)
-	buf.WriteRune(' ')
-	buf.WriteString(d.Argument)
+	if d.Argument != "" || !BlockDirective(d.Type) {
+		buf.WriteRune(' ')
+		buf.WriteString(d.Argument)
+	}
 	buf.WriteRune('\n')
 
+	// Block directives keep their lines exactly as they were, and end with a matching end line.
+	if BlockDirective(d.Type) {
+		for _, line := range d.Lines {
+			buf.WriteString(line)
+			buf.WriteRune('\n')
+		}
+		buf.WriteString("end " + d.Type + "\n")
+		return buf.String()
+	}
+
 	for _, line := range d.Lines {
 		buf.WriteRune('\t')
 		buf.WriteString(line)
@@ -55,6 +104,18 @@ func (d *Directive) String() string {
 	return buf.String()
 }
 
+// BlockDirective returns true for directives that are blocks of free text ending in an "end" line, comment blocks
+// and the test blocks used in ledger's documentation:
+//
+//	comment
+//	This isn't parsed.
+//	end comment
+//
+// Their lines are kept as they are, not trimmed or indented.
+func BlockDirective(typ string) bool {
+	return typ == "comment" || typ == "test"
+}
+
 // Compare two directives to see if they are identical.
 func (d *Directive) Compare(d2 Directive) bool {
 	ok := d.Type == d2.Type && d.Argument == d2.Argument && len(d.Lines) == len(d2.Lines)
@@ -76,3 +137,19 @@ func (d *Directive) CleanCopy() *Directive {
 	nd.Lines = slices.Clone(d.Lines)
 	return &nd
 }
+
+// DirectiveError wraps an error from reading the contents of a directive with where the directive is.
+type DirectiveError struct {
+	D    int // The index of the directive in File.D.
+	L    Position
+	Type string
+	Err  error
+}
+
+func (err DirectiveError) Error() string {
+	return fmt.Sprintf("%v (%v directive at %v)", err.Err, err.Type, err.L)
+}
+
+func (err DirectiveError) Unwrap() error {
+	return err.Err
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// AccountDirective is the parsed form of an account directive:
+//
+//	account Assets:Checking
+//		note The joint account
+//		alias checking
+//		payee ^Interest
+//		default
+type AccountDirective struct {
+	Name    string
+	Note    string   // The contents of the note subdirective.
+	Aliases []string // One string for each alias subdirective.
+	Payees  []string // One string for each payee subdirective.
+	Default bool     // True if the default subdirective is present.
+}
+
+// PayeeDirective is the parsed form of a payee directive:
+//
+//	payee Corner Store
+//		alias ^CORNER STORE #\d+
+//		uuid 2a2e21d434356f886c84371eebac6e44f1337fda
+type PayeeDirective struct {
+	Name    string
+	Aliases []string // One string for each regexp to match with.
+	Uuids   []string // One string for each uuid to check.
+}
+
+// CommodityDirective is the parsed form of a commodity directive:
+//
+//	commodity €
+//		note Euros
+//		format 1.000,00 €
+//		precision 2
+//		default
+type CommodityDirective struct {
+	Symbol    string // The argument, which may also be an example amount if there is no format subdirective.
+	Note      string
+	Format    string // The example amount from the format subdirective (or the argument), empty if there isn't one.
+	Precision int    // From the precision subdirective, 0 if there isn't one.
+	Default   bool
+}
+
+// TagDirective is the parsed form of a tag directive. The value expressions are not parsed.
+//
+//	tag Receipt
+//		check value =~ /pdf$/
+type TagDirective struct {
+	Name    string
+	Checks  []string // One string for each check subdirective.
+	Asserts []string // One string for each assert subdirective.
+}
+
+// AliasDirective is the parsed form of a top level alias directive, `alias NAME=ACCOUNT`.
+type AliasDirective struct {
+	Name    string
+	Account string
+}
+
+// YearDirective is the parsed form of a year directive (`year 2024` or `Y 2024`), which sets the year of dates
+// that leave it out.
+type YearDirective struct {
+	Year int
+}
+
+// ParseDirective parses the contents of the common directive types into one of the typed directive structs above,
+// returned as a pointer. Returns nil (and no error) for any other type of directive. Ledger is lax about
+// subdirectives, so any that aren't understood are ignored.
+func ParseDirective(d *Directive) (any, error) {
+	switch d.Type {
+	case "account":
+		acct := &AccountDirective{Name: d.Argument}
+		// filter out some things that cause funny behavior
+		if strings.Contains(acct.Name, "  ") || strings.ContainsAny(acct.Name, ";\t") {
+			return nil, ErrMalformedAccountName{acct.Name, d.Location}
+		}
+		for i, line := range d.Lines {
+			sub, arg := cutSubdirective(line)
+			switch sub {
+			case "default":
+				acct.Default = true
+			case "alias":
+				if strings.Contains(arg, "  ") || strings.ContainsAny(arg, ";\t") {
+					return nil, ErrMalformedAccountName{arg, d.Location.At(d.Location.L(d.Location.Line() + uint64(i)))}
+				}
+				acct.Aliases = append(acct.Aliases, arg)
+			case "payee":
+				acct.Payees = append(acct.Payees, arg)
+			case "note":
+				acct.Note = arg
+			}
+		}
+		return acct, nil
+	case "payee":
+		payee := &PayeeDirective{Name: d.Argument}
+		for _, line := range d.Lines {
+			sub, arg := cutSubdirective(line)
+			switch sub {
+			case "alias":
+				payee.Aliases = append(payee.Aliases, arg)
+			case "uuid":
+				payee.Uuids = append(payee.Uuids, arg)
+			}
+		}
+		return payee, nil
+	case "commodity":
+		c := &CommodityDirective{Symbol: strings.TrimSpace(d.Argument)}
+		if strings.IndexFunc(d.Argument, unicode.IsDigit) != -1 {
+			c.Format = c.Symbol
+		}
+		for _, line := range d.Lines {
+			sub, arg := cutSubdirective(line)
+			switch sub {
+			case "format":
+				c.Format = arg
+			case "note":
+				c.Note = arg
+			case "default":
+				c.Default = true
+			case "precision":
+				n, err := strconv.Atoi(arg)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("Invalid commodity precision: %q", line)
+				}
+				c.Precision = n
+			}
+		}
+		return c, nil
+	case "tag":
+		tag := &TagDirective{Name: strings.TrimSpace(d.Argument)}
+		for _, line := range d.Lines {
+			sub, arg := cutSubdirective(line)
+			switch sub {
+			case "check":
+				tag.Checks = append(tag.Checks, arg)
+			case "assert":
+				tag.Asserts = append(tag.Asserts, arg)
+			}
+		}
+		return tag, nil
+	case "alias":
+		name, account, ok := strings.Cut(d.Argument, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid alias, expected NAME=ACCOUNT: %q", d.Argument)
+		}
+		return &AliasDirective{strings.TrimSpace(name), strings.TrimSpace(account)}, nil
+	case "year", "Y":
+		year, err := strconv.Atoi(strings.TrimSpace(d.Argument))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid year: %q", d.Argument)
+		}
+		return &YearDirective{year}, nil
+	}
+	return nil, nil
+}
+
+// cutSubdirective splits a subdirective line into its keyword and the trimmed remainder.
+func cutSubdirective(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	i := strings.IndexAny(line, " \t")
+	if i == -1 {
+		return line, ""
+	}
+	return line[:i], strings.TrimSpace(line[i:])
+}
+
+// Parse returns the parsed contents of the directive, see ParseDirective. The parser fills in Value as it reads
+// each directive, and this uses that as long as the directive hasn't been changed since. Otherwise the directive is
+// parsed again. The result is shared with the directive, so don't modify it.
+func (d *Directive) Parse() (any, error) {
+	if d.Value != nil && d.String() == d.valueOf {
+		return d.Value, nil
+	}
+	return ParseDirective(d)
+}
+
+// SetValue parses the directive and stores the result in Value. Errors are ignored and leave Value nil, Parse will
+// report them.
+func (d *Directive) SetValue() {
+	v, err := ParseDirective(d)
+	if err != nil {
+		v = nil
+	}
+	d.Value, d.valueOf = v, d.String()
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+func TestParseDirective(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+account Assets:Checking
+	note The joint account
+	alias checking
+	default
+
+payee Corner Store
+	alias ^CORNER
+
+commodity €
+	format 1.000,00 €
+	precision 2
+
+tag Receipt
+	check value =~ /pdf$/
+
+alias chk=Assets:Checking
+
+year 2024
+
+include other.ledger
+
+account Bad  Name
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acct, ok := f.D[0].Value.(*ledger.AccountDirective)
+	if !ok || acct.Name != "Assets:Checking" || acct.Note != "The joint account" || len(acct.Aliases) != 1 || !acct.Default {
+		t.Errorf("Incorrect account: %#v", f.D[0].Value)
+	}
+	if payee, ok := f.D[1].Value.(*ledger.PayeeDirective); !ok || payee.Name != "Corner Store" || payee.Aliases[0] != "^CORNER" {
+		t.Errorf("Incorrect payee: %#v", f.D[1].Value)
+	}
+	if c, ok := f.D[2].Value.(*ledger.CommodityDirective); !ok || c.Symbol != "€" || c.Format != "1.000,00 €" || c.Precision != 2 {
+		t.Errorf("Incorrect commodity: %#v", f.D[2].Value)
+	}
+	if tag, ok := f.D[3].Value.(*ledger.TagDirective); !ok || tag.Name != "Receipt" || tag.Checks[0] != "value =~ /pdf$/" {
+		t.Errorf("Incorrect tag: %#v", f.D[3].Value)
+	}
+	if alias, ok := f.D[4].Value.(*ledger.AliasDirective); !ok || alias.Name != "chk" || alias.Account != "Assets:Checking" {
+		t.Errorf("Incorrect alias: %#v", f.D[4].Value)
+	}
+	if year, ok := f.D[5].Value.(*ledger.YearDirective); !ok || year.Year != 2024 {
+		t.Errorf("Incorrect year: %#v", f.D[5].Value)
+	}
+	if f.D[6].Value != nil || f.D[7].Value != nil {
+		t.Errorf("Unexpected values: %#v, %#v", f.D[6].Value, f.D[7].Value)
+	}
+	if _, err := f.D[7].Parse(); err == nil {
+		t.Errorf("Malformed account directive didn't fail.")
+	}
+
+	// Changing the directive makes the stored value stale.
+	f.D[0].Argument = "Assets:Savings"
+	v, err := f.D[0].Parse()
+	if err != nil || v.(*ledger.AccountDirective).Name != "Assets:Savings" {
+		t.Errorf("Stale value: %#v, %v", v, err)
+	}
+}
+
+func TestExpandAliases(t *testing.T) {
+	src := `
+account Liabilities:CreditCard
+	alias CC
+
+2024/01/02 Coffee
+	Expenses:Food  $5.00
+	CC:Visa
+
+alias chk=Assets:Checking
+
+2024/01/03 Tea
+	Expenses:Food  $3.00
+	chk
+`
+	f, err := parse.Read(strings.NewReader(src), "", parse.Options{KeepRaw: true, ExpandAliases: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.T[0].Postings[1].Account != "Liabilities:CreditCard:Visa" || f.T[1].Postings[1].Account != "Assets:Checking" {
+		t.Errorf("Aliases not expanded: %v", f.T)
+	}
+	if !f.T[0].Unmodified() || !strings.Contains(f.T[0].Raw, "CC:Visa") {
+		t.Errorf("Source text with aliases not kept: %q", f.T[0].Raw)
+	}
+
+	f, err = parse.Read(strings.NewReader(src), "", parse.Options{KeepRaw: true, ExpandAliases: true, ResolveAliases: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &strings.Builder{}
+	if err := f.Format(buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "\tchk") || !strings.Contains(buf.String(), "Assets:Checking") {
+		t.Errorf("Aliases not resolved on output:\n%v", buf)
+	}
+}
+
+func TestTagDirectives(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+account Expenses:Travel
+account Assets:Checking
+payee Airline
+commodity $
+
+tag Trip
+	check value =~ /^[A-Z]/
+	assert value != "TBD"
+
+tag Receipt
+
+2024/01/02 Airline
+	; :Receipt:Business:
+	; Trip: hawaii
+	Expenses:Travel  $500.00
+	Assets:Checking
+
+2024/01/03 Airline
+	; Trip: TBD
+	Expenses:Travel  $50.00
+	Assets:Checking
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := f.T[0].TagValue("Trip"); !ok || v != "hawaii" {
+		t.Errorf("Incorrect tag value: %q, %v", v, ok)
+	}
+	if v, ok := f.T[0].TagValue("Receipt"); !ok || v != "" {
+		t.Errorf("Incorrect tag value: %q, %v", v, ok)
+	}
+
+	errs := f.Validate(ledger.ValidateOptions{Strict: true})
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 errors, got %v", errs)
+	}
+	if err, ok := errs[0].(ledger.UndeclaredError); !ok || err.Kind != ledger.UndeclaredTag || err.Name != "Business" {
+		t.Errorf("Expected an undeclared tag, got %v", errs[0])
+	}
+	if err, ok := errs[1].(ledger.TagError); !ok || err.Assert || err.Value != "hawaii" {
+		t.Errorf("Expected a failed check, got %v", errs[1])
+	}
+	if err, ok := errs[2].(ledger.TagError); !ok || !err.Assert {
+		t.Errorf("Expected a failed assert, got %v", errs[2])
+	}
+}
+
+func TestBlockDirectives(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+comment
+This isn't a transaction:
+2024/01/02 Nope
+	  indented stays indented
+
+end comment
+
+2024/01/02 Coffee
+	Expenses:Food  $5.00
+	Assets:Checking
+
+test reg Food
+24-Jan-02 Coffee     Expenses:Food      $5.00    $5.00
+end test
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.T) != 1 || len(f.D) != 2 {
+		t.Fatalf("Expected 1 transaction and 2 directives, got %v and %v", len(f.T), len(f.D))
+	}
+
+	want := "comment\nThis isn't a transaction:\n2024/01/02 Nope\n\t  indented stays indented\n\nend comment\n"
+	if got := f.D[0].String(); got != want {
+		t.Errorf("Incorrect comment block:\n%q\nwant:\n%q", got, want)
+	}
+	if f.D[1].Type != "test" || f.D[1].Argument != "reg Food" || len(f.D[1].Lines) != 1 {
+		t.Errorf("Incorrect test block: %#v", f.D[1])
+	}
+
+	if _, err := parse.ParseLedgerString("comment\nnever ends\n"); err == nil {
+		t.Errorf("Unterminated comment block didn't fail.")
+	}
+}
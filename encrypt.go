@@ -0,0 +1,172 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+)
+
+// Encryption methods.
+const (
+	EncryptNone = ""
+	EncryptGPG  = "gpg" // Uses the gpg command, with its keyring and agent.
+	EncryptAge  = "age" // Uses the age command.
+)
+
+// Encryption says how journals are encrypted at rest. Encryption is done by running the gpg or age command, so
+// keys stay in the keyring or identity files those tools already use. Decrypting doesn't depend on Method, the
+// format is detected from the data.
+type Encryption struct {
+	Method string // One of the Encrypt constants, used for writing.
+
+	// Who can decrypt the files written: gpg key IDs or email addresses, or age recipients ("age1..." keys, or
+	// "ssh-ed25519 ..." keys). For gpg an empty list means symmetric encryption with the passphrase file.
+	Recipients []string
+
+	Identity       string // An age identity file, used to decrypt age files.
+	PassphraseFile string // A file holding the passphrase for symmetric gpg encryption.
+}
+
+// EncryptionFromEnv returns the encryption settings from the environment: LEDGER_ENCRYPT (the method),
+// LEDGER_RECIPIENTS (comma separated), LEDGER_IDENTITY, and LEDGER_PASSPHRASE_FILE.
+func EncryptionFromEnv() *Encryption {
+	e := &Encryption{
+		Method:         os.Getenv("LEDGER_ENCRYPT"),
+		Identity:       os.Getenv("LEDGER_IDENTITY"),
+		PassphraseFile: os.Getenv("LEDGER_PASSPHRASE_FILE"),
+	}
+	for _, r := range strings.Split(os.Getenv("LEDGER_RECIPIENTS"), ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			e.Recipients = append(e.Recipients, r)
+		}
+	}
+	return e
+}
+
+// DetectEncryption returns the method a file was encrypted with, or EncryptNone if it is plain text.
+func DetectEncryption(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("-----BEGIN PGP MESSAGE-----")):
+		return EncryptGPG
+	case bytes.HasPrefix(data, []byte("age-encryption.org/v1\n")),
+		bytes.HasPrefix(data, []byte("-----BEGIN AGE ENCRYPTED FILE-----")):
+		return EncryptAge
+	}
+
+	// Binary OpenPGP messages start with a public key or symmetric key encrypted session key packet, in either the
+	// old or the new packet format. Those bytes can start UTF-8 text too, but encrypted data is never valid UTF-8.
+	if len(data) > 0 && !utf8.Valid(data) {
+		switch tag := data[0]; {
+		case tag&0xc0 == 0x80 && (tag>>2)&0x0f == 1, tag&0xc0 == 0x80 && (tag>>2)&0x0f == 3,
+			tag == 0xc1, tag == 0xc3:
+			return EncryptGPG
+		}
+	}
+	return EncryptNone
+}
+
+// ErrEncryption is returned when encrypting or decrypting fails.
+type ErrEncryption struct {
+	Method string
+	Msg    string
+}
+
+func (err ErrEncryption) Error() string {
+	return fmt.Sprintf("Could not use %v encryption: %v", err.Method, err.Msg)
+}
+
+// Decrypt decrypts data in any of the supported formats. Plain text is returned as is. The method the data was
+// encrypted with is also returned.
+func (e *Encryption) Decrypt(data []byte) ([]byte, string, error) {
+	method := DetectEncryption(data)
+	switch method {
+	case EncryptGPG:
+		args := []string{"--batch", "--quiet", "--decrypt"}
+		if e.PassphraseFile != "" {
+			args = append([]string{"--pinentry-mode", "loopback", "--passphrase-file", e.PassphraseFile}, args...)
+		}
+		plain, err := runCrypt(method, data, "gpg", args...)
+		return plain, method, err
+	case EncryptAge:
+		if e.Identity == "" {
+			return nil, method, ErrEncryption{method, "an identity file is needed to decrypt."}
+		}
+		plain, err := runCrypt(method, data, "age", "--decrypt", "-i", e.Identity)
+		return plain, method, err
+	}
+	return data, method, nil
+}
+
+// Encrypt encrypts data with the configured method. With EncryptNone the data is returned as is.
+func (e *Encryption) Encrypt(plain []byte) ([]byte, error) {
+	switch e.Method {
+	case EncryptNone:
+		return plain, nil
+	case EncryptGPG:
+		args := []string{"--batch", "--yes", "--quiet", "--trust-model", "always"}
+		if len(e.Recipients) == 0 {
+			if e.PassphraseFile == "" {
+				return nil, ErrEncryption{e.Method, "recipients or a passphrase file are needed to encrypt."}
+			}
+			args = append(args, "--pinentry-mode", "loopback", "--passphrase-file", e.PassphraseFile, "--symmetric")
+		} else {
+			args = append(args, "--encrypt")
+			for _, r := range e.Recipients {
+				args = append(args, "--recipient", r)
+			}
+		}
+		return runCrypt(e.Method, plain, "gpg", args...)
+	case EncryptAge:
+		if len(e.Recipients) == 0 {
+			return nil, ErrEncryption{e.Method, "recipients are needed to encrypt."}
+		}
+		args := []string{"--encrypt"}
+		for _, r := range e.Recipients {
+			args = append(args, "-r", r)
+		}
+		return runCrypt(e.Method, plain, "age", args...)
+	}
+	return nil, ErrEncryption{e.Method, "unknown method."}
+}
+
+// runCrypt runs an encryption command with data on its standard input.
+func runCrypt(method string, data []byte, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, ErrEncryption{method, msg}
+	}
+	return out, nil
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"testing"
+
+	"github.com/samuellwn/ledger"
+)
+
+func TestDetectEncryption(t *testing.T) {
+	cases := []struct {
+		data string
+		want string
+	}{
+		{"2026/01/02 Groceries\n\tExpenses:Food  $1.00\n", ledger.EncryptNone},
+		{"", ledger.EncryptNone},
+		{"-----BEGIN PGP MESSAGE-----\n\nhQEMA...", ledger.EncryptGPG},
+		{"\x8c\x0d\x04\x09\x03\x08\xff\xfe", ledger.EncryptGPG},
+		{"\x85\x01\x0c\x03\xff\xfe", ledger.EncryptGPG},
+		{"\xc1\xc0\x4c\x03\xff\xfe", ledger.EncryptGPG},
+		{"age-encryption.org/v1\n-> X25519 abc\n", ledger.EncryptAge},
+		{"-----BEGIN AGE ENCRYPTED FILE-----\nYWdl", ledger.EncryptAge},
+		{"\x80\xff\xfe", ledger.EncryptNone},
+	}
+	for _, c := range cases {
+		if got := ledger.DetectEncryption([]byte(c.data)); got != c.want {
+			t.Errorf("DetectEncryption(%q) = %q, want %q", c.data, got, c.want)
+		}
+	}
+}
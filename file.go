@@ -23,21 +23,33 @@ misrepresented as being the original software.
 package ledger
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"regexp"
 	"sort"
-	"strings"
+	"time"
 
 	"github.com/aclindsa/ofxgo"
-	"github.com/samuellwn/ledger/parse/lex"
+	"golang.org/x/exp/slices"
 )
 
 // File hold a parsed ledger file stored as lists of Directives and Transactions.
 type File struct {
 	T []Transaction
 	D []Directive
+
+	IDs IDGenerator // Gives IDs to transactions made by the importers and Matched. If nil DefaultIDs is used.
+}
+
+// ids returns the ID generator for new transactions in this file.
+func (f *File) ids() IDGenerator {
+	if f.IDs == nil {
+		return DefaultIDs
+	}
+	return f.IDs
 }
 
 // ErrImproperInterleave is returned by File.Format if the lists do not interleave properly.
@@ -46,38 +58,82 @@ var ErrImproperInterleave = errors.New("Ledger file transaction and directive li
 
 // Format writes out a ledger file, interleaving the transactions and directives according to the
 // "FoundBefore" values in the directives. The directive list is sorted on the FoundBefore values as
-// part of this operation.
+// part of this operation. Output is buffered, if writing fails the error says which transaction or directive was
+// being written and wraps the error from w.
 func (f *File) Format(w io.Writer) error {
+	return f.FormatWith(w, FormatOptions{})
+}
+
+// FormatWith is exactly like Format, but transactions are written using the given options.
+// Transactions and directives that kept their source text from parsing and have not been modified since are
+// written out exactly as they were found, regardless of the options. If the options don't set an amount format the
+// file's default is used (see File.AmountFormats), and exact amounts are written with the formats the file declares
+// unless the options give others.
+func (f *File) FormatWith(w io.Writer, opts FormatOptions) error {
+	if opts.Formats == nil {
+		afs, err := f.AmountFormats()
+		if err != nil {
+			return err
+		}
+		opts.Formats = afs
+	}
+	if opts.Amount.Decimal == 0 {
+		opts.Amount = opts.Formats.Default
+	}
+
 	// Use a stable sort to be minimally disruptive.
 	sort.SliceStable(f.D, func(i, j int) bool {
 		return f.D[i].FoundBefore < f.D[j].FoundBefore
 	})
 
+	// Check first, so nothing is written if the lists don't fit together.
+	if len(f.D) > 0 && (f.D[0].FoundBefore < 0 || f.D[len(f.D)-1].FoundBefore > len(f.T)) {
+		return ErrImproperInterleave
+	}
+
+	// Errors stick to the bufio.Writer, so if one write fails every write after it fails too.
+	bw := bufio.NewWriter(w)
 	ctr, cdr := 0, 0
 	for ctr < len(f.T) || cdr < len(f.D) {
 		// If we have remaining directives and the next directive goes before the current transaction
 		if cdr < len(f.D) && f.D[cdr].FoundBefore == ctr {
-			fmt.Fprintf(w, "\n%v", f.D[cdr].String())
+			text := f.D[cdr].Raw
+			if !f.D[cdr].Unmodified() {
+				text = f.D[cdr].String()
+			}
+			bw.WriteByte('\n')
+			_, err := bw.WriteString(text)
+			if err != nil {
+				return fmt.Errorf("Failed to write directive %v: %w", cdr, err)
+			}
 			cdr++
 			continue
 		}
 
-		// If we have remaining directives and we are out of transactions
-		if ctr >= len(f.T) {
-			return ErrImproperInterleave
-		}
-
 		// Write next transaction
-		fmt.Fprintf(w, "\n%v", f.T[ctr].String())
+		text := f.T[ctr].Raw
+		if !f.T[ctr].Unmodified() {
+			text = f.T[ctr].Format(opts)
+		}
+		bw.WriteByte('\n')
+		_, err := bw.WriteString(text)
+		if err != nil {
+			return fmt.Errorf("Failed to write transaction %v: %w", ctr, err)
+		}
 		ctr++
 	}
+
+	err := bw.Flush()
+	if err != nil {
+		return fmt.Errorf("Failed to write ledger file: %w", err)
+	}
 	return nil
 }
 
 // ErrMalformedAccountName is returned by File.Accounts if an account name is malformed.
 type ErrMalformedAccountName struct {
 	Name     string
-	Location lex.Location
+	Location Position
 }
 
 func (err ErrMalformedAccountName) Error() string {
@@ -93,42 +149,21 @@ func (f *File) Accounts() ([]Account, error) {
 			continue
 		}
 
-		acct := Account{
-			Name:           d.Argument,
+		v, err := f.D[dIx].Parse()
+		if err != nil {
+			return nil, err
+		}
+		ad := v.(*AccountDirective)
+		accts = append(accts, Account{
+			Name:           ad.Name,
+			Note:           ad.Note,
+			Aliases:        slices.Clone(ad.Aliases),
+			Payees:         slices.Clone(ad.Payees),
+			Default:        ad.Default,
 			FoundBefore:    d.FoundBefore,
 			Location:       d.Location,
 			DirectiveIndex: dIx,
-		}
-
-		// filter out some things that cause funny behavior
-		if strings.Contains(acct.Name, "  ") || strings.ContainsAny(acct.Name, ";\t") {
-			return nil, ErrMalformedAccountName{acct.Name, acct.Location}
-		}
-
-		for sdIx, sd := range d.Lines {
-			if strings.HasPrefix(sd, "default") {
-				// ledger is lax about directive parsing
-				acct.Default = true
-			} else if strings.HasPrefix(sd, "alias") {
-				alias := strings.TrimSpace(sd[len("alias"):])
-				// filter out some things that cause funny behavior
-				if strings.Contains(alias, "  ") || strings.ContainsAny(alias, ";\t") {
-					return nil, ErrMalformedAccountName{
-						Name:     alias,
-						Location: acct.Location.L(acct.Location.Line() + uint64(sdIx)),
-					}
-				}
-				acct.Aliases = append(acct.Aliases, alias)
-			} else if strings.HasPrefix(sd, "payee") {
-				payee := strings.TrimSpace(sd[len("payee"):])
-				acct.Payees = append(acct.Payees, payee)
-			} else if strings.HasPrefix(sd, "note") {
-				note := strings.TrimSpace(sd[len("note"):])
-				acct.Note = note
-			}
-		}
-
-		accts = append(accts, acct)
+		})
 	}
 	return accts, nil
 }
@@ -138,28 +173,23 @@ func (f *File) Accounts() ([]Account, error) {
 func (f *File) Payees() ([]Payee, error) {
 	payees := []Payee{}
 	for dIx, d := range f.D {
-		if d.Type != "account" {
+		if d.Type != "payee" {
 			continue
 		}
 
-		payee := Payee{
-			Name:           d.Argument,
+		v, err := f.D[dIx].Parse()
+		if err != nil {
+			return nil, err
+		}
+		pd := v.(*PayeeDirective)
+		payees = append(payees, Payee{
+			Name:           pd.Name,
+			Aliases:        slices.Clone(pd.Aliases),
+			Uuids:          slices.Clone(pd.Uuids),
 			FoundBefore:    d.FoundBefore,
 			Location:       d.Location,
 			DirectiveIndex: dIx,
-		}
-
-		for _, sd := range d.Lines {
-			if strings.HasPrefix(sd, "alias") {
-				alias := strings.TrimSpace(sd[len("alias"):])
-				payee.Aliases = append(payee.Aliases, alias)
-			} else if strings.HasPrefix(sd, "uuid") {
-				uuid := strings.TrimSpace(sd[len("uuid"):])
-				payee.Uuids = append(payee.Uuids, uuid)
-			}
-		}
-
-		payees = append(payees, payee)
+		})
 	}
 	return payees, nil
 }
@@ -173,9 +203,9 @@ type Account struct {
 	Payees  []string // One string for each payee subdirective.
 	Default bool     // True if the default subdirective is present.
 
-	FoundBefore    int          // The transaction index this account precedes.
-	DirectiveIndex int          // The index of this account in the list of all directives. Calling File.Format may ruin this relationship.
-	Location       lex.Location // Line number where this account starts.
+	FoundBefore    int      // The transaction index this account precedes.
+	DirectiveIndex int      // The index of this account in the list of all directives. Calling File.Format may ruin this relationship.
+	Location       Position // Where this account starts.
 }
 
 // Payee is a simple type representing a payee directive.
@@ -184,12 +214,12 @@ type Payee struct {
 	Aliases []string // One string for each regexp to match with.
 	Uuids   []string // One string for each uuid to check.
 
-	FoundBefore    int          // The transaction index this directive precedes.
-	DirectiveIndex int          // The index of this directive in the list of all directives. Calling File.Format may ruin this relationship.
-	Location       lex.Location // Line number where this directive starts.
+	FoundBefore    int      // The transaction index this directive precedes.
+	DirectiveIndex int      // The index of this directive in the list of all directives. Calling File.Format may ruin this relationship.
+	Location       Position // Where this directive starts.
 }
 
-// Matched finds transactions by regexp on the description, and returns a slice of found transactions
+// Matched finds transactions by regexp on the description (or by UUID, see Matcher), and returns a slice of found transactions
 // with postings and description modified by the first successful match from matchers. Only transactions
 // with a posting containing the given account will be modified.
 func (f *File) Matched(account string, matchers []Matcher) []Transaction {
@@ -197,7 +227,7 @@ func (f *File) Matched(account string, matchers []Matcher) []Transaction {
 	for _, ftr := range f.T {
 		tr := *ftr.CleanCopy()
 		if tr.Match(account, matchers) {
-			tr.KVPairs["RID"] = <-IDService
+			AssignIDs(f.ids(), &tr)
 			outTrs = append(outTrs, tr)
 		}
 	}
@@ -238,6 +268,13 @@ func (f *File) ParseMatchers() ([]Matcher, error) {
 		for _, payee := range payees {
 			for _, m := range pm {
 				if m.R.MatchString(payee.Name) {
+					for _, uuid := range payee.Uuids {
+						matchers = append(matchers, Matcher{
+							Account: account,
+							Payee:   payee.Name,
+							UUID:    uuid,
+						})
+					}
 					for _, alias := range payee.Aliases {
 						re, err := regexp.Compile(alias)
 						if err != nil {
@@ -268,47 +305,242 @@ const (
 	OFXDescNameMemo
 )
 
-// ImportOFX imports the OFX response/file into this file. Already imported transactions will be skipped.
+// ImportOFX imports the OFX response/file into this file. Already imported transactions will be skipped, and
+// importing a statement again adds nothing, not even the balance assertions.
+// If the OFX file does not parse it is run through CleanOFX and parsing is tried again. Bank, credit card, and
+// investment statements are supported. For investment statements bankAcct is split into sub accounts, with cash
+// in "<bankAcct>:Cash" and each security in "<bankAcct>:<ticker>".
 func (f *File) ImportOFX(ofxFile io.Reader, descSrc OFXDescSrc, bankAcct, defaultAcct, equityAcct string) error {
 	// Load OFX file
-	ofxd, err := ofxgo.ParseResponse(ofxFile)
+	ofxd, err := parseOFX(ofxFile)
 	if err != nil {
 		return err
 	}
 
-	// Load set of seen transaction ids from ofx
-	seenIds := map[string]bool{}
-	for _, tr := range f.T {
-		if tr.KVPairs["FITID"] == "" || tr.KVPairs["Account"] != bankAcct {
+	stmts := ofxStatements(ofxd)
+	if len(stmts) == 0 {
+		return errors.New("No statements found.")
+	}
+	if len(stmts) != 1 {
+		return errors.New("Too many accounts, use ImportOFXAccounts for files with more than one account.")
+	}
+	return f.importOFXStatement(stmts[0], ofxSecurities(ofxd), &ImportResult{Delta: map[string]int64{}}, descSrc, bankAcct, defaultAcct, equityAcct)
+}
+
+// ImportResult summarizes an import.
+type ImportResult struct {
+	New      int // Transactions that were new, not counting statement balance assertions.
+	Seen     int // Transactions skipped because they were already imported.
+	Suspect  int // Transactions found by the fuzzy duplicate check, flagged or skipped (and counted as seen).
+	Resolved int // New transactions that were the posted version of a pending one, and were added as an edit of it.
+
+	Begin time.Time
+	End   time.Time // The range of dates covered by the transactions in the file, new or not.
+
+	Delta map[string]int64 // The change in the balance of each imported account from the new transactions.
+
+	Transactions []Transaction // The new transactions, including statement balance assertions.
+}
+
+// importedValue returns the change to the imported account from a transaction made by an importer, which is the
+// total of the postings that aren't to the default (null) account.
+func importedValue(tr *Transaction) int64 {
+	v := int64(0)
+	for _, p := range tr.Postings {
+		if !p.Null {
+			v += p.Value
+		}
+	}
+	return v
+}
+
+// record adds a transaction from the file to the result. The value is the change to the account's balance.
+func (r *ImportResult) record(account string, date time.Time, v int64, seen bool) {
+	if r.Begin.IsZero() || date.Before(r.Begin) {
+		r.Begin = date
+	}
+	if date.After(r.End) {
+		r.End = date
+	}
+	if seen {
+		r.Seen++
+		return
+	}
+	r.New++
+	r.Delta[account] += v
+}
+
+// OFXAccount identifies an account in an OFX file. BankID is the broker ID for investment accounts, and empty for
+// credit cards (which only have an account ID).
+type OFXAccount struct {
+	BankID string
+	AcctID string
+}
+
+// OFXAccounts maps the accounts in an OFX file to ledger accounts, for ImportOFXAccounts.
+type OFXAccounts struct {
+	// Ledger account names by OFX account. An entry with an empty BankID matches any account with that AcctID.
+	Accounts map[OFXAccount]string
+
+	Default string // Used for any account not in the map. If empty unmapped accounts are an error.
+}
+
+// ErrUnmappedOFXAccount is returned by ImportOFXAccounts when an OFX file has an account without a mapping.
+type ErrUnmappedOFXAccount OFXAccount
+
+func (err ErrUnmappedOFXAccount) Error() string {
+	return fmt.Sprintf("No ledger account for OFX account %q at bank %q.", err.AcctID, err.BankID)
+}
+
+// Account returns the ledger account for the OFX account, or an error if there isn't one.
+func (m *OFXAccounts) Account(acct OFXAccount) (string, error) {
+	if a, ok := m.Accounts[acct]; ok {
+		return a, nil
+	}
+	if a, ok := m.Accounts[OFXAccount{AcctID: acct.AcctID}]; ok {
+		return a, nil
+	}
+	if m.Default != "" {
+		return m.Default, nil
+	}
+	return "", ErrUnmappedOFXAccount(acct)
+}
+
+// OFXImportOptions controls ImportOFXAccounts.
+type OFXImportOptions struct {
+	DescSrc     OFXDescSrc
+	DefaultAcct string // The other side of every imported transaction.
+	EquityAcct  string // Statement balance differences go here. If empty no balance assertions are added.
+
+	DryRun bool // Don't change the file, only report what would be added.
+
+	// Second stage duplicate detection, for banks that change FITIDs (for example when a pending transaction
+	// posts). A new transaction that moves the same amount of money in the same account as an existing one with a
+	// different FITID, at most Days apart, with descriptions at least Similarity alike (see DedupeOptions) is a
+	// suspect duplicate. Suspects get a "Duplicate" KV pair naming the existing transaction, or are skipped if
+	// SkipFuzzy is set.
+	Fuzzy      bool
+	Days       int
+	Similarity float64
+	SkipFuzzy  bool
+}
+
+// ImportOFXAccounts is like ImportOFX, but imports every account in the OFX file, booking each one to the ledger
+// account it maps to. Accounts without any transactions are skipped. Nothing is imported if any account fails.
+// The result says what was (or for a dry run, would be) added. A dry run doesn't change the file.
+func (f *File) ImportOFXAccounts(ofxFile io.Reader, accounts OFXAccounts, opts OFXImportOptions) (*ImportResult, error) {
+	ofxd, err := parseOFX(ofxFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the mapping before doing anything else.
+	stmts := ofxStatements(ofxd)
+	accts := []string{}
+	for _, stmt := range stmts {
+		acct, err := accounts.Account(ofxAccountOf(stmt))
+		if err != nil {
+			return nil, err
+		}
+		accts = append(accts, acct)
+	}
+
+	// Work on a copy that shares the existing transactions, so nothing changes if one of the statements fails.
+	nf := &File{T: f.T[:len(f.T):len(f.T)], D: f.D, IDs: f.IDs}
+	tickers := ofxSecurities(ofxd)
+	result := &ImportResult{Delta: map[string]int64{}}
+	found := false
+	for i, stmt := range stmts {
+		err := nf.importOFXStatement(stmt, tickers, result, opts.DescSrc, accts[i], opts.DefaultAcct, opts.EquityAcct)
+		if err == errNoOFXTransactions {
 			continue
 		}
-		seenIds[tr.KVPairs["FITID"]] = true
+		if err != nil {
+			return nil, err
+		}
+		found = true
+	}
+	if !found {
+		return nil, errNoOFXTransactions
 	}
 
-	// Convert it to ledger transactions
-	if len(ofxd.Bank)+len(ofxd.CreditCard) != 1 {
-		return errors.New("Too many banks or credit cards.")
+	result.Resolved = nf.resolvePending(len(f.T))
+
+	if opts.Fuzzy {
+		added := nf.T[len(f.T):]
+		dups := f.suspectDuplicates(added, opts.Days, opts.Similarity)
+		nf.T = nf.T[:len(f.T):len(f.T)]
+		for i, tr := range added {
+			j, ok := dups[i]
+			if ok {
+				result.Suspect++
+				if opts.SkipFuzzy {
+					result.New--
+					result.Seen++
+					result.Delta[tr.KVPairs["Account"]] -= importedValue(&tr)
+					continue
+				}
+				tr.KVPairs["Duplicate"] = duplicateRef(&f.T[j])
+			}
+			nf.T = append(nf.T, tr)
+		}
 	}
 
-	bank := append(ofxd.Bank, ofxd.CreditCard...)[0]
+	result.Transactions = nf.T[len(f.T):]
+	if !opts.DryRun {
+		f.T = nf.T
+	}
+	return result, nil
+}
+
+var errNoOFXTransactions = errors.New("No transactions found.")
+
+// ofxStatements returns all the bank, credit card, and investment statements in the response.
+func ofxStatements(ofxd *ofxgo.Response) []ofxgo.Message {
+	stmts := []ofxgo.Message{}
+	stmts = append(stmts, ofxd.Bank...)
+	stmts = append(stmts, ofxd.CreditCard...)
+	stmts = append(stmts, ofxd.InvStmt...)
+	return stmts
+}
+
+// ofxAccountOf returns the account a statement is for.
+func ofxAccountOf(stmt ofxgo.Message) OFXAccount {
+	switch s := stmt.(type) {
+	case *ofxgo.StatementResponse:
+		return OFXAccount{BankID: string(s.BankAcctFrom.BankID), AcctID: string(s.BankAcctFrom.AcctID)}
+	case *ofxgo.CCStatementResponse:
+		return OFXAccount{AcctID: string(s.CCAcctFrom.AcctID)}
+	case *ofxgo.InvStatementResponse:
+		return OFXAccount{BankID: string(s.InvAcctFrom.BrokerID), AcctID: string(s.InvAcctFrom.AcctID)}
+	}
+	return OFXAccount{}
+}
+
+// importOFXStatement imports a single statement from an OFX response.
+func (f *File) importOFXStatement(stmt ofxgo.Message, tickers map[string]string, result *ImportResult, descSrc OFXDescSrc, bankAcct, defaultAcct, equityAcct string) error {
+	// Load set of seen transaction ids from ofx
+	seenIds := f.SeenFITIDs(bankAcct)
 
 	var trns []ofxgo.Transaction
 	var bal ofxgo.Amount
 	var asOf ofxgo.Date
-	if b, ok := bank.(*ofxgo.StatementResponse); ok {
+	if b, ok := stmt.(*ofxgo.StatementResponse); ok {
 		trns = b.BankTranList.Transactions
 		bal = b.BalAmt
 		asOf = b.DtAsOf
-	} else if cc, ok := bank.(*ofxgo.CCStatementResponse); ok {
+	} else if cc, ok := stmt.(*ofxgo.CCStatementResponse); ok {
 		trns = cc.BankTranList.Transactions
 		bal = cc.BalAmt
 		asOf = cc.DtAsOf
+	} else if inv, ok := stmt.(*ofxgo.InvStatementResponse); ok {
+		return f.importOFXInvestment(inv, tickers, result, descSrc, bankAcct, defaultAcct, equityAcct)
 	} else {
 		return errors.New("Unexpected response type.")
 	}
 
 	if len(trns) == 0 {
-		return errors.New("No transactions found.")
+		return errNoOFXTransactions
 	}
 
 	var sum int64
@@ -321,6 +553,13 @@ func (f *File) ImportOFX(ofxFile io.Reader, descSrc OFXDescSrc, bankAcct, defaul
 
 		sum += v
 
+		result.record(bankAcct, str.DtPosted.Time, v, seenIds[string(str.FiTID)])
+
+		// Already imported, but it still counts towards the balance.
+		if seenIds[string(str.FiTID)] {
+			continue
+		}
+
 		desc := ""
 		switch descSrc {
 		case OFXDescName:
@@ -336,8 +575,6 @@ func (f *File) ImportOFX(ofxFile io.Reader, descSrc OFXDescSrc, bankAcct, defaul
 			Date:        str.DtPosted.Time,
 			Status:      StatusUndefined,
 			KVPairs: map[string]string{
-				"ID":      <-IDService,
-				"RID":     <-IDService,
 				"FITID":   string(str.FiTID),
 				"TrnTyp":  str.TrnType.String(),
 				"Memo":    string(str.Memo),
@@ -355,6 +592,7 @@ func (f *File) ImportOFX(ofxFile io.Reader, descSrc OFXDescSrc, bankAcct, defaul
 				},
 			},
 		}
+		AssignIDs(f.ids(), &tr)
 
 		ltrns = append(ltrns, tr)
 	}
@@ -365,57 +603,144 @@ func (f *File) ImportOFX(ofxFile io.Reader, descSrc OFXDescSrc, bankAcct, defaul
 			return err
 		}
 
-		tr := Transaction{
-			Description: "Statement Opening Balance",
-			Date:        ltrns[0].Date,
-			Status:      StatusUndefined,
-			KVPairs: map[string]string{
-				"ID":             <-IDService,
-				"RID":            <-IDService,
-				"OpeningBalance": bankAcct,
-			},
-			Postings: []Posting{{
-				Account:   bankAcct,
-				Null:      true,
-				Assert:    v - sum,
-				HasAssert: true,
-			}, {
-				Account: equityAcct,
-				Null:    true,
-			}},
+		// Banks list transactions in whatever order they like.
+		first := trns[0].DtPosted.Time
+		for _, str := range trns {
+			if str.DtPosted.Time.Before(first) {
+				first = str.DtPosted.Time
+			}
 		}
-		ltrns = append([]Transaction{tr}, ltrns...)
 
-		ltrns = append(ltrns, Transaction{
-			Description: "Statement Closing Balance",
-			Date:        asOf.Time,
-			Status:      StatusUndefined,
-			KVPairs: map[string]string{
-				"ID":             <-IDService,
-				"RID":            <-IDService,
-				"ClosingBalance": bankAcct,
-			},
-			Postings: []Posting{{
-				Account:   bankAcct,
-				Null:      true,
-				Assert:    v,
-				HasAssert: true,
-			}, {
-				Account: equityAcct,
-				Null:    true,
-			}},
-		})
+		ltrns = f.addStatementBalances(ltrns, bankAcct, equityAcct, first, v-sum, asOf.Time, v)
 	}
 
+	n := len(f.T)
 	f.T = append(f.T, ltrns...)
+	f.resolvePending(n)
 
 	return nil
 }
 
+// SeenFITIDs returns the set of financial institution transaction IDs (the "FITID" KV) already imported for the
+// given account. Importers use this to skip transactions they have already seen. Transactions that are still
+// pending are left out, so their posted versions can be matched up with them.
+func (f *File) SeenFITIDs(bankAcct string) map[string]bool {
+	seen := map[string]bool{}
+	for _, tr := range f.T {
+		if tr.KVPairs["FITID"] == "" || tr.KVPairs["Account"] != bankAcct {
+			continue
+		}
+		seen[tr.KVPairs["FITID"]] = true
+	}
+	for _, i := range f.latestRevisions() {
+		if f.T[i].Pending() && f.T[i].KVPairs["Account"] == bankAcct {
+			delete(seen, f.T[i].KVPairs["FITID"])
+		}
+	}
+	return seen
+}
+
+// StatementBalances returns a pair of transactions asserting the opening and closing balances of a bank statement
+// for the given account, with any difference going to the equity account.
+func StatementBalances(bankAcct, equityAcct string, openDate time.Time, open int64, closeDate time.Time, close int64) (Transaction, Transaction) {
+	return statementBalances(DefaultIDs, bankAcct, equityAcct, openDate, open, closeDate, close)
+}
+
+func statementBalances(gen IDGenerator, bankAcct, equityAcct string, openDate time.Time, open int64, closeDate time.Time, close int64) (Transaction, Transaction) {
+	opening := Transaction{
+		Description: "Statement Opening Balance",
+		Date:        openDate,
+		Status:      StatusUndefined,
+		KVPairs: map[string]string{
+			"OpeningBalance": bankAcct,
+		},
+		Postings: []Posting{{
+			Account:   bankAcct,
+			Null:      true,
+			Assert:    open,
+			HasAssert: true,
+		}, {
+			Account: equityAcct,
+			Null:    true,
+		}},
+	}
+	closing := Transaction{
+		Description: "Statement Closing Balance",
+		Date:        closeDate,
+		Status:      StatusUndefined,
+		KVPairs: map[string]string{
+			"ClosingBalance": bankAcct,
+		},
+		Postings: []Posting{{
+			Account:   bankAcct,
+			Null:      true,
+			Assert:    close,
+			HasAssert: true,
+		}, {
+			Account: equityAcct,
+			Null:    true,
+		}},
+	}
+	AssignIDs(gen, &opening)
+	AssignIDs(gen, &closing)
+	return opening, closing
+}
+
+// addStatementBalances puts statement opening and closing balance assertions (see StatementBalances) around the
+// new transactions from a statement. If there are no new transactions (the statement was imported already) nothing
+// is added, and balances the file already has for the account on the same date are left out.
+func (f *File) addStatementBalances(strns []Transaction, bankAcct, equityAcct string, openDate time.Time, open int64, closeDate time.Time, close int64) []Transaction {
+	if len(strns) == 0 {
+		return strns
+	}
+
+	has := func(kind string, date time.Time) bool {
+		for i := range f.T {
+			if f.T[i].KVPairs[kind] == bankAcct && f.T[i].Date.Equal(date) {
+				return true
+			}
+		}
+		return false
+	}
+
+	opening, closing := statementBalances(f.ids(), bankAcct, equityAcct, openDate, open, closeDate, close)
+	if !has("OpeningBalance", openDate) {
+		strns = append([]Transaction{opening}, strns...)
+	}
+	if !has("ClosingBalance", closeDate) {
+		strns = append(strns, closing)
+	}
+	return strns
+}
+
+// parseOFX parses an OFX file, falling back to a cleaned up version of the file if the original is too broken.
+func parseOFX(r io.Reader) (*ofxgo.Response, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ofxd, err := ofxgo.ParseResponse(bytes.NewReader(data))
+	if err == nil {
+		return ofxd, nil
+	}
+
+	cleaned, cerr := CleanOFX(data)
+	if cerr != nil {
+		return nil, err
+	}
+	ofxd, cerr = ofxgo.ParseResponse(bytes.NewReader(cleaned))
+	if cerr != nil {
+		// The error from the original file is likely to make more sense.
+		return nil, err
+	}
+	return ofxd, nil
+}
+
 // CleanCopy takes a perfect copy of the file object. Any edits to the returned File
 // will not modify this method's receiver.
 func (f *File) CleanCopy() *File {
-	nf := &File{[]Transaction{}, []Directive{}}
+	nf := &File{T: []Transaction{}, D: []Directive{}, IDs: f.IDs}
 
 	for _, tr := range f.T {
 		nf.T = append(nf.T, *tr.CleanCopy())
@@ -428,27 +753,28 @@ func (f *File) CleanCopy() *File {
 	return nf
 }
 
-// StripHistory removes all edit history. This method assumes all directives
-// are at the beginning of the file. If any directive has a FoundBefore greater
-// than 0 data corruption can occur.
+// StripHistory removes all edit history. Transactions whose latest revision
+// is a void are removed completely. Each remaining transaction takes the place
+// of its first revision, and directives are moved along with the transactions
+// they precede, the same way LTail adjusts them.
 func (f *File) StripHistory() {
-	newTrs := []Transaction{}
-	trIxs := map[string]int{}
-	for _, tr := range f.T {
-		id, ok := tr.KVPairs["ID"]
-		if !ok || id == "" {
-			newTrs = append(newTrs, tr)
-			continue
+	// before[i] is the number of transactions kept that go before index i of the old list.
+	trs := []Transaction{}
+	before := make([]int, len(f.T)+1)
+	for _, h := range f.History() {
+		if tr := f.T[h.Latest()]; !tr.Voided() {
+			trs = append(trs, tr)
+			before[h.Revisions[0]+1]++
 		}
+	}
+	for i := 1; i < len(before); i++ {
+		before[i] += before[i-1]
+	}
 
-		if idx, ok := trIxs[id]; ok {
-			newTrs[idx] = tr
-			continue
+	for i := range f.D {
+		if fb := f.D[i].FoundBefore; fb >= 0 && fb < len(before) {
+			f.D[i].FoundBefore = before[fb]
 		}
-
-		trIxs[id] = len(newTrs)
-		newTrs = append(newTrs, tr)
 	}
-
-	f.T = newTrs
+	f.T = trs
 }
@@ -0,0 +1,305 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Recurring is a transaction that repeats on a regular schedule, found by File.Recurring.
+type Recurring struct {
+	Payee string // The description of the latest occurrence.
+
+	// The time between occurrences, as for time.AddDate. Monthly schedules keep to the same day of the month, or the
+	// last day for months that are too short.
+	Months int
+	Days   int
+
+	Count    int         // The number of occurrences found.
+	Last     time.Time   // The date of the latest occurrence.
+	Template Transaction // A copy of the latest occurrence with its null postings filled in, used for projections.
+}
+
+// After returns the date of the next occurrence after one on date t.
+func (r *Recurring) After(t time.Time) time.Time {
+	if r.Months == 0 {
+		return t.AddDate(0, 0, r.Days)
+	}
+	y, m, _ := t.Date()
+	first := time.Date(y, m+time.Month(r.Months), 1, 0, 0, 0, 0, t.Location())
+	day := r.Last.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// recurringPeriods are the schedules File.Recurring looks for, with the range of days allowed between occurrences.
+var recurringPeriods = []struct {
+	months, days int
+	min, max     int
+}{
+	{0, 7, 6, 8},
+	{0, 14, 13, 15},
+	{1, 0, 27, 34},
+	{3, 0, 85, 97},
+	{12, 0, 358, 372},
+}
+
+// ForecastOptions controls how File.Recurring finds recurring transactions and how File.Forecast projects them.
+type ForecastOptions struct {
+	// Projections start the day after this date. Defaults to the date of the last transaction. Recurring
+	// transactions that have missed two or more occurrences by this date are taken to have stopped.
+	Start time.Time
+
+	Months int // How many months to project forward. Defaults to 3.
+
+	// A transaction is recurring if there are at least MinCount (default 3) occurrences of it with the same
+	// description (ignoring case and numbers) and accounts, all on the same schedule, and with amounts no more than
+	// Tolerance (default 0.1, or 10%) different from the typical amount.
+	MinCount  int
+	Tolerance float64
+
+	// Only project the balances of accounts matching this. Defaults to everything under Assets and Liabilities.
+	Account *regexp.Regexp
+}
+
+func (opts *ForecastOptions) defaults() {
+	if opts.Months <= 0 {
+		opts.Months = 3
+	}
+	if opts.MinCount < 2 {
+		opts.MinCount = 3
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = 0.1
+	}
+	if opts.Account == nil {
+		opts.Account = netWorthAccounts
+	}
+}
+
+// Recurring finds transactions that repeat on a weekly, biweekly, monthly, quarterly, or yearly schedule, sorted by
+// the date of their next occurrence. Only the latest revision of each transaction is considered, and the options
+// Start, MinCount, and Tolerance are used. Returns an error if any of the transactions do not balance.
+func (f *File) Recurring(opts ForecastOptions) ([]Recurring, error) {
+	opts.defaults()
+
+	trs, _, err := f.reportTransactions(&ReportQuery{})
+	if err != nil {
+		return nil, err
+	}
+	if len(trs) == 0 {
+		return []Recurring{}, nil
+	}
+	if opts.Start.IsZero() {
+		opts.Start = trs[len(trs)-1].Date
+	}
+
+	// reportTransactions returns the transactions in date order, so each group is in date order too.
+	groups := map[string][]*Transaction{}
+	for i := range trs {
+		tr := &trs[i]
+		if tr.Date.After(opts.Start) {
+			continue
+		}
+		accounts := []string{}
+		for _, p := range tr.Postings {
+			accounts = append(accounts, p.Account)
+		}
+		slices.Sort(accounts)
+		key := strings.Join(descriptionTokens(tr.Description), " ")
+		if key == "" {
+			key = normalizeDescription(tr.Description)
+		}
+		key += "\x00" + strings.Join(slices.Compact(accounts), "\x00")
+		groups[key] = append(groups[key], tr)
+	}
+
+	found := []Recurring{}
+	for _, group := range groups {
+		r, ok := recurring(group, opts)
+		if !ok {
+			continue
+		}
+		// Missing two occurrences in a row means it has probably stopped.
+		if r.After(r.After(r.Last)).Before(opts.Start) {
+			continue
+		}
+		found = append(found, r)
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i].After(found[i].Last), found[j].After(found[j].Last)
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return found[i].Payee < found[j].Payee
+	})
+	return found, nil
+}
+
+// recurring checks if a group of transactions (in date order) is on a regular schedule with similar amounts.
+func recurring(group []*Transaction, opts ForecastOptions) (Recurring, bool) {
+	if len(group) < opts.MinCount {
+		return Recurring{}, false
+	}
+
+	amounts := make([]int64, len(group))
+	for i, tr := range group {
+		amounts[i] = transactionAmount(tr)
+	}
+	typical := slices.Clone(amounts)
+	slices.Sort(typical)
+	median := typical[len(typical)/2]
+	if median == 0 {
+		return Recurring{}, false
+	}
+	for _, v := range amounts {
+		if float64(abs(v-median)) > float64(median)*opts.Tolerance {
+			return Recurring{}, false
+		}
+	}
+
+	for _, period := range recurringPeriods {
+		regular := true
+		for i := 1; i < len(group) && regular; i++ {
+			gap := int(group[i].Date.Sub(group[i-1].Date).Hours()/24 + 0.5)
+			regular = gap >= period.min && gap <= period.max
+		}
+		if !regular {
+			continue
+		}
+
+		last := group[len(group)-1]
+		template := last.CleanCopy()
+		for i := range template.Postings {
+			template.Postings[i].Null = false
+			template.Postings[i].HasAssert = false
+			template.Postings[i].Assert = 0
+		}
+		return Recurring{
+			Payee:    last.Description,
+			Months:   period.months,
+			Days:     period.days,
+			Count:    len(group),
+			Last:     last.Date,
+			Template: *template,
+		}, true
+	}
+	return Recurring{}, false
+}
+
+// Forecast is the result of projecting recurring transactions forward.
+type Forecast struct {
+	Recurring    []Recurring   // The recurring transactions that were projected.
+	Transactions []Transaction // The projected transactions, in date order.
+
+	// The projected balance of each selected account, sorted by account name. Each series starts with the balance
+	// at the start date, followed by a point for each projected transaction that changes the balance. Only
+	// accounts with a balance or a projected transaction are included.
+	Balances []Series
+}
+
+// Forecast finds the recurring transactions (see File.Recurring) and projects them forward from the start date,
+// returning the projected transactions along with the resulting account balances. Projected transactions have no
+// status, ID, k/v pairs, or comments, and use the amounts of the latest occurrence.
+// Returns an error if any of the transactions do not balance.
+func (f *File) Forecast(opts ForecastOptions) (*Forecast, error) {
+	opts.defaults()
+
+	if opts.Start.IsZero() {
+		for _, i := range f.latestRevisions() {
+			if f.T[i].Date.After(opts.Start) {
+				opts.Start = f.T[i].Date
+			}
+		}
+	}
+
+	found, err := f.Recurring(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fc := &Forecast{Recurring: found, Transactions: []Transaction{}, Balances: []Series{}}
+	end := opts.Start.AddDate(0, opts.Months, 0)
+	for _, r := range found {
+		for d := r.After(r.Last); !d.After(end); d = r.After(d) {
+			if !d.After(opts.Start) {
+				continue
+			}
+			tr := r.Template.CleanCopy()
+			tr.Date = d
+			tr.ClearDate = time.Time{}
+			tr.Status = StatusUndefined
+			tr.Code = ""
+			tr.Comments = nil
+			tr.KVPairs = map[string]string{}
+			tr.Raw = ""
+			for i := range tr.Postings {
+				tr.Postings[i].Status = StatusUndefined
+			}
+			fc.Transactions = append(fc.Transactions, *tr)
+		}
+	}
+	sort.SliceStable(fc.Transactions, func(i, j int) bool {
+		return fc.Transactions[i].Date.Before(fc.Transactions[j].Date)
+	})
+
+	opening, err := f.BalanceReport(ReportQuery{Account: opts.Account, End: opts.Start.AddDate(0, 0, 1)}, 0)
+	if err != nil {
+		return nil, err
+	}
+	balances := map[string]*Series{}
+	for account, v := range opening {
+		if v != 0 {
+			balances[account] = &Series{Name: account, Points: []SeriesPoint{{opts.Start, v}}}
+		}
+	}
+	for _, tr := range fc.Transactions {
+		for _, p := range tr.Postings {
+			if !opts.Account.MatchString(p.Account) {
+				continue
+			}
+			s, ok := balances[p.Account]
+			if !ok {
+				s = &Series{Name: p.Account, Points: []SeriesPoint{{opts.Start, 0}}}
+				balances[p.Account] = s
+			}
+			s.Points = append(s.Points, SeriesPoint{tr.Date, s.Points[len(s.Points)-1].Value + p.Value})
+		}
+	}
+
+	accounts := maps.Keys(balances)
+	slices.Sort(accounts)
+	for _, account := range accounts {
+		fc.Balances = append(fc.Balances, *balances[account])
+	}
+	return fc, nil
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"html/template"
+	"io"
+	"time"
+)
+
+// HTMLReportOptions controls File.WriteHTMLReport.
+type HTMLReportOptions struct {
+	Title string      // Defaults to "Ledger Report".
+	Query ReportQuery // Selects the postings in both reports.
+	Depth int         // Collapse the balance report to this many levels, same as for BalanceReport.
+
+	NoBalance  bool // Leave out the balance report.
+	NoRegister bool // Leave out the register report.
+}
+
+type htmlReport struct {
+	Title     string
+	Period    string
+	Generated string
+	Balance   []*AccountNode
+	Total     int64
+	Register  []RegisterRow
+	Show      struct{ Balance, Register bool }
+}
+
+// WriteHTMLReport writes a standalone HTML page (no outside stylesheets or scripts) with a balance report as an
+// expandable account tree and a register report as a sortable table, ready to email or archive as a statement.
+// Returns an error if any of the selected transactions do not balance.
+func (f *File) WriteHTMLReport(w io.Writer, opts HTMLReportOptions) error {
+	report := htmlReport{
+		Title:     opts.Title,
+		Period:    htmlPeriod(opts.Query),
+		Generated: time.Now().Format("2006/01/02"),
+	}
+	if report.Title == "" {
+		report.Title = "Ledger Report"
+	}
+	report.Show.Balance, report.Show.Register = !opts.NoBalance, !opts.NoRegister
+
+	if report.Show.Balance {
+		accounts, err := f.BalanceReport(opts.Query, opts.Depth)
+		if err != nil {
+			return err
+		}
+		tree := NewAccountTree()
+		tree.SetBalances(accounts)
+		report.Balance, report.Total = tree.Root.Children, tree.Root.Total
+	}
+	if report.Show.Register {
+		rows, err := f.Register(opts.Query)
+		if err != nil {
+			return err
+		}
+		report.Register = rows
+	}
+
+	return htmlReportTemplate.Execute(w, &report)
+}
+
+// htmlPeriod describes the date range of a query.
+func htmlPeriod(q ReportQuery) string {
+	switch {
+	case q.Begin.IsZero() && q.End.IsZero():
+		return "All dates"
+	case q.End.IsZero():
+		return "From " + q.Begin.Format("2006/01/02")
+	case q.Begin.IsZero():
+		return "Through " + q.End.AddDate(0, 0, -1).Format("2006/01/02")
+	}
+	return q.Begin.Format("2006/01/02") + " through " + q.End.AddDate(0, 0, -1).Format("2006/01/02")
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"value":    FormatValue,
+	"negative": func(v int64) bool { return v < 0 },
+	"date":     func(t time.Time) string { return t.Format("2006/01/02") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; color: #222; }
+h1 { margin-bottom: 0; }
+.period { color: #666; margin-top: 0.2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { padding: 0.25em 0.6em; text-align: left; border-bottom: 1px solid #ddd; }
+th { background: #f4f4f4; cursor: pointer; user-select: none; }
+th.sorted-asc::after { content: " \25B2"; }
+th.sorted-desc::after { content: " \25BC"; }
+td.amount, th.amount { text-align: right; font-variant-numeric: tabular-nums; white-space: nowrap; }
+.negative { color: #b00; }
+.tree details { margin-left: 1.2em; }
+.tree > details { margin-left: 0; }
+.tree summary, .tree .leaf { display: flex; justify-content: space-between; padding: 0.2em 0; border-bottom: 1px solid #eee; }
+.tree .leaf { margin-left: 1.2em; }
+.tree .total { display: flex; justify-content: space-between; font-weight: bold; border-top: 2px solid #222; padding-top: 0.3em; }
+.footer { color: #999; font-size: small; }
+@media print { th { cursor: auto; } }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="period">{{.Period}}</p>
+{{if .Show.Balance}}
+<h2>Balances</h2>
+<div class="tree">
+{{range .Balance}}{{template "account" .}}{{end}}
+<div class="total"><span>Total</span><span class="amount{{if negative .Total}} negative{{end}}">{{value .Total}}</span></div>
+</div>
+{{end}}
+{{if .Show.Register}}
+<h2>Register</h2>
+<table class="sortable">
+<thead><tr><th>Date</th><th>Payee</th><th>Account</th><th class="amount">Amount</th><th class="amount">Total</th></tr></thead>
+<tbody>
+{{range .Register}}<tr>
+<td>{{date .Date}}</td>
+<td>{{.Payee}}</td>
+<td>{{.Account}}</td>
+<td class="amount{{if negative .Amount}} negative{{end}}" data-sort="{{.Amount}}">{{value .Amount}}</td>
+<td class="amount{{if negative .Total}} negative{{end}}" data-sort="{{.Total}}">{{value .Total}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+{{end}}
+<p class="footer">Generated {{.Generated}}</p>
+<script>
+// Click a column heading to sort by it, click again to reverse. Cells sort by their data-sort value if they have
+// one, numerically if it is a number.
+document.querySelectorAll("table.sortable").forEach(function (table) {
+	table.querySelectorAll("th").forEach(function (th, col) {
+		th.addEventListener("click", function () {
+			var asc = !th.classList.contains("sorted-asc");
+			table.querySelectorAll("th").forEach(function (h) { h.classList.remove("sorted-asc", "sorted-desc"); });
+			th.classList.add(asc ? "sorted-asc" : "sorted-desc");
+			var body = table.tBodies[0];
+			var rows = Array.prototype.slice.call(body.rows);
+			var key = function (row) {
+				var cell = row.cells[col];
+				var v = cell.hasAttribute("data-sort") ? cell.getAttribute("data-sort") : cell.textContent;
+				return v !== "" && !isNaN(v) ? Number(v) : v.toLowerCase();
+			};
+			rows.sort(function (a, b) {
+				var x = key(a), y = key(b);
+				return (x < y ? -1 : x > y ? 1 : 0) * (asc ? 1 : -1);
+			});
+			rows.forEach(function (row) { body.appendChild(row); });
+		});
+	});
+});
+</script>
+</body>
+</html>
+{{define "account"}}{{if .Children}}<details open>
+<summary><span>{{.Name}}</span><span class="amount{{if negative .Total}} negative{{end}}">{{value .Total}}</span></summary>
+{{range .Children}}{{template "account" .}}{{end}}</details>
+{{else}}<div class="leaf"><span title="{{.Account}}">{{.Name}}</span><span class="amount{{if negative .Total}} negative{{end}}">{{value .Total}}</span></div>
+{{end}}{{end}}`))
@@ -23,6 +23,14 @@ misrepresented as being the original software.
 package ledger
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/teris-io/shortid"
@@ -32,10 +40,11 @@ import (
 var IDService <-chan string
 
 func init() {
-	go func() {
-		c := make(chan string)
-		IDService = c
+	// The channel has to exist before init returns, otherwise an early read blocks forever on a nil channel.
+	c := make(chan string)
+	IDService = c
 
+	go func() {
 		idsource := shortid.MustNew(1, shortid.DefaultABC, uint64(time.Now().UnixNano()))
 
 		for {
@@ -43,3 +52,256 @@ func init() {
 		}
 	}()
 }
+
+// IDGenerator makes the transaction IDs and revision IDs given to new transactions and revisions. Generators must be
+// safe to use from multiple goroutines.
+type IDGenerator interface {
+	// NewID returns the ID for a new transaction. The transaction is complete except for its ID and RID, though it
+	// may be nil if the ID is for something other than a transaction.
+	NewID(tr *Transaction) string
+
+	// NewRID returns the revision ID for a new revision of the transaction. The transaction is complete, with its
+	// ID and the RID of the revision it replaces (if any).
+	NewRID(tr *Transaction) string
+}
+
+// DefaultIDs is the generator used by anything that isn't given one of its own.
+var DefaultIDs IDGenerator = ServiceIDs{}
+
+// AssignIDs gives the transaction a new revision ID from the generator, and a new ID if it doesn't have one yet. A
+// nil generator means DefaultIDs.
+func AssignIDs(gen IDGenerator, tr *Transaction) {
+	if gen == nil {
+		gen = DefaultIDs
+	}
+	if tr.KVPairs == nil {
+		tr.KVPairs = map[string]string{}
+	}
+	if tr.KVPairs["ID"] == "" {
+		delete(tr.KVPairs, "RID")
+		tr.KVPairs["ID"] = gen.NewID(tr)
+	}
+	tr.KVPairs["RID"] = gen.NewRID(tr)
+}
+
+// ParseIDGenerator returns a new generator by name: "shortid" (the IDService, the default), "ulid", "uuidv7",
+// "hash", or "fitid".
+func ParseIDGenerator(name string) (IDGenerator, error) {
+	switch name {
+	case "", "shortid":
+		return ServiceIDs{}, nil
+	case "ulid":
+		return &ULIDs{}, nil
+	case "uuidv7":
+		return &UUIDv7s{}, nil
+	case "hash":
+		return &HashIDs{}, nil
+	case "fitid":
+		return &FITIDs{}, nil
+	}
+	return nil, fmt.Errorf("Unknown ID generator: %q", name)
+}
+
+// ServiceIDs generates short random IDs by reading IDService.
+type ServiceIDs struct{}
+
+func (ServiceIDs) NewID(tr *Transaction) string {
+	return <-IDService
+}
+
+func (ServiceIDs) NewRID(tr *Transaction) string {
+	return <-IDService
+}
+
+// ULIDs generates ULIDs: 26 character IDs that sort in the order they were made. IDs made in the same millisecond
+// are still in order.
+type ULIDs struct {
+	lock    sync.Mutex
+	last    int64    // Time of the last ID, in milliseconds.
+	entropy [10]byte // Random part of the last ID.
+}
+
+func (g *ULIDs) NewID(tr *Transaction) string {
+	return g.next()
+}
+
+func (g *ULIDs) NewRID(tr *Transaction) string {
+	return g.next()
+}
+
+// crockford is the base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (g *ULIDs) next() string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	ms := time.Now().UnixMilli()
+	if ms <= g.last {
+		// Same millisecond (or the clock went backwards), count up from the last ID to stay in order.
+		ms = g.last
+		for i := len(g.entropy) - 1; i >= 0; i-- {
+			g.entropy[i]++
+			if g.entropy[i] != 0 {
+				break
+			}
+		}
+	} else {
+		rand.Read(g.entropy[:])
+	}
+	g.last = ms
+
+	id := [16]byte{}
+	binary.BigEndian.PutUint16(id[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:], uint32(ms))
+	copy(id[6:], g.entropy[:])
+
+	// 128 bits as 26 base32 digits, the first digit only gets the top 3 bits.
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// UUIDv7s generates version 7 UUIDs, which sort in the order they were made (to the millisecond).
+type UUIDv7s struct {
+	lock sync.Mutex
+	last int64  // Time of the last ID, in milliseconds.
+	seq  uint16 // Counter for IDs made in the same millisecond, the 12 bit rand_a field.
+}
+
+func (g *UUIDv7s) NewID(tr *Transaction) string {
+	return g.next()
+}
+
+func (g *UUIDv7s) NewRID(tr *Transaction) string {
+	return g.next()
+}
+
+func (g *UUIDv7s) next() string {
+	id := [16]byte{}
+	rand.Read(id[6:])
+
+	g.lock.Lock()
+	ms := time.Now().UnixMilli()
+	if ms <= g.last {
+		ms = g.last
+		g.seq++
+		if g.seq > 0xfff {
+			// Out of room this millisecond, borrow the next one.
+			ms++
+			g.seq = 0
+		}
+	} else {
+		g.seq = binary.BigEndian.Uint16(id[6:]) & 0x7ff // Leave room to count up.
+	}
+	g.last = ms
+	seq := g.seq
+	g.lock.Unlock()
+
+	binary.BigEndian.PutUint16(id[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:], uint32(ms))
+	binary.BigEndian.PutUint16(id[6:], 0x7000|seq)
+	id[8] = id[8]&0x3f | 0x80
+
+	h := hex.EncodeToString(id[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// HashIDs generates IDs from the content of the transaction, so importing the same data twice gives the same IDs.
+// The ID is a hash of the transaction without its ID and RID, and the RID is a hash of the transaction with its ID
+// and previous RID, so every revision in a history gets a different one. Identical transactions given IDs by the same
+// generator get a counter added to tell them apart. IDs for anything that isn't a transaction come from IDService.
+type HashIDs struct {
+	lock sync.Mutex
+	seen map[string]int
+}
+
+func (g *HashIDs) NewID(tr *Transaction) string {
+	if tr == nil {
+		return <-IDService
+	}
+	ntr := tr.CleanCopy()
+	delete(ntr.KVPairs, "ID")
+	delete(ntr.KVPairs, "RID")
+	return g.hash("ID\n" + ntr.String())
+}
+
+func (g *HashIDs) NewRID(tr *Transaction) string {
+	return g.hash("RID\n" + tr.KVPairs["RID"] + "\n" + tr.String())
+}
+
+func (g *HashIDs) hash(content string) string {
+	id := hashID(content)
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.seen == nil {
+		g.seen = map[string]int{}
+	}
+	g.seen[id]++
+	if n := g.seen[id]; n > 1 {
+		return id + "-" + strconv.Itoa(n)
+	}
+	return id
+}
+
+func hashID(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return base64.RawURLEncoding.EncodeToString(sum[:9])
+}
+
+// FITIDs generates IDs for imported transactions from their bank account and FITID (the "Account" and "FITID" KV
+// pairs), so importing the same bank data on different machines gives the same IDs and the copies merge cleanly.
+// Statement balance transactions get IDs from their account and date the same way. Revision IDs for these
+// transactions are content hashes, same as HashIDs. Anything else gets its IDs from the fallback.
+type FITIDs struct {
+	Fallback IDGenerator // Used for everything without a FITID. If nil ServiceIDs are used.
+
+	hashes HashIDs
+}
+
+func (g *FITIDs) fallback() IDGenerator {
+	if g.Fallback == nil {
+		return ServiceIDs{}
+	}
+	return g.Fallback
+}
+
+// key returns the stable identity of an imported transaction, or "" if it doesn't have one.
+func (g *FITIDs) key(tr *Transaction) string {
+	if tr == nil {
+		return ""
+	}
+	date := tr.Date.Format("2006/01/02")
+	switch {
+	case tr.KVPairs["FITID"] != "":
+		// A bank only uses a FITID once per account, so there is no need to count repeats.
+		return "FITID\n" + tr.KVPairs["Account"] + "\n" + tr.KVPairs["FITID"]
+	case tr.KVPairs["OpeningBalance"] != "":
+		return "OpeningBalance\n" + tr.KVPairs["OpeningBalance"] + "\n" + date
+	case tr.KVPairs["ClosingBalance"] != "":
+		return "ClosingBalance\n" + tr.KVPairs["ClosingBalance"] + "\n" + date
+	}
+	return ""
+}
+
+func (g *FITIDs) NewID(tr *Transaction) string {
+	key := g.key(tr)
+	if key == "" {
+		return g.fallback().NewID(tr)
+	}
+	return hashID(key)
+}
+
+func (g *FITIDs) NewRID(tr *Transaction) string {
+	if g.key(tr) == "" {
+		return g.fallback().NewRID(tr)
+	}
+	return g.hashes.NewRID(tr)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/samuellwn/ledger"
+)
+
+func TestIDGenerators(t *testing.T) {
+	formats := map[string]*regexp.Regexp{
+		"ulid":   regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+		"uuidv7": regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+	}
+	for name, format := range formats {
+		gen, err := ledger.ParseIDGenerator(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Sorting by ID must keep the order they were made in, even inside a millisecond.
+		last := ""
+		for i := 0; i < 1000; i++ {
+			id := gen.NewID(nil)
+			if !format.MatchString(id) {
+				t.Fatalf("%v: Malformed ID: %q", name, id)
+			}
+			if id <= last {
+				t.Fatalf("%v: ID %q not after %q", name, id, last)
+			}
+			last = id
+		}
+	}
+}
+
+func TestHashIDs(t *testing.T) {
+	tr := ledger.Transaction{
+		Description: "Groceries",
+		Date:        time.Date(2022, 1, 5, 0, 0, 0, 0, time.UTC),
+		Postings: []ledger.Posting{
+			{Account: "Expenses:Food", Value: 500000},
+			{Account: "Assets:Checking", Null: true},
+		},
+	}
+
+	a, b := &ledger.HashIDs{}, &ledger.HashIDs{}
+	tra, trb := *tr.CleanCopy(), *tr.CleanCopy()
+	ledger.AssignIDs(a, &tra)
+	ledger.AssignIDs(b, &trb)
+	if tra.KVPairs["ID"] != trb.KVPairs["ID"] || tra.KVPairs["RID"] != trb.KVPairs["RID"] {
+		t.Errorf("Same content, different IDs: %v and %v", tra.KVPairs, trb.KVPairs)
+	}
+	if tra.KVPairs["ID"] == tra.KVPairs["RID"] {
+		t.Errorf("ID and RID are the same: %v", tra.KVPairs)
+	}
+
+	// A repeat from the same generator has to be told apart.
+	trc := *tr.CleanCopy()
+	ledger.AssignIDs(a, &trc)
+	if trc.KVPairs["ID"] == tra.KVPairs["ID"] {
+		t.Errorf("Repeated transaction got the same ID: %v", trc.KVPairs["ID"])
+	}
+
+	// New revisions get a new RID, but keep the ID.
+	rev := *tra.CleanCopy()
+	ledger.AssignIDs(a, &rev)
+	if rev.KVPairs["ID"] != tra.KVPairs["ID"] || rev.KVPairs["RID"] == tra.KVPairs["RID"] {
+		t.Errorf("Bad revision IDs: %v after %v", rev.KVPairs, tra.KVPairs)
+	}
+}
+
+func TestFITIDs(t *testing.T) {
+	ofx, err := os.ReadFile("tools/examples/example.qbo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two independent imports, as if on different machines.
+	imports := []*ledger.File{}
+	for i := 0; i < 2; i++ {
+		f := &ledger.File{IDs: &ledger.FITIDs{}}
+		err := f.ImportOFX(bytes.NewReader(ofx), ledger.OFXDescName, "Assets:Checking", "Expenses:Unknown", "Equity:Balance Error")
+		if err != nil {
+			t.Fatal(err)
+		}
+		imports = append(imports, f)
+	}
+
+	if len(imports[0].T) == 0 {
+		t.Fatal("Nothing imported.")
+	}
+	for i := range imports[0].T {
+		a, b := imports[0].T[i].KVPairs, imports[1].T[i].KVPairs
+		if a["ID"] == "" || a["ID"] != b["ID"] || a["RID"] != b["RID"] {
+			t.Errorf("Transaction %v: IDs differ between imports: %v/%v and %v/%v", i, a["ID"], a["RID"], b["ID"], b["RID"])
+		}
+	}
+}
@@ -0,0 +1,329 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samuellwn/ledger"
+)
+
+// openFixture opens a statement file from testdata/import. It is closed when the test ends.
+func openFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	r, err := os.Open(filepath.Join("testdata/import", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// importedEntry is what an importer should make of one entry in a statement.
+type importedEntry struct {
+	date  string
+	value int64
+	fitid string
+	desc  string
+}
+
+// checkImported fails the test if the imported transactions don't match the entries, in order. Each transaction
+// must move the value between the bank account and a null posting.
+func checkImported(t *testing.T, trs []ledger.Transaction, bankAcct string, want []importedEntry) {
+	t.Helper()
+
+	if len(trs) != len(want) {
+		t.Fatalf("Expected %v transactions, got %v.", len(want), len(trs))
+	}
+	for i, w := range want {
+		tr := &trs[i]
+		if date := tr.Date.Format("2006/01/02"); date != w.date {
+			t.Errorf("Transaction %v: expected date %v, got %v.", i, w.date, date)
+		}
+		if len(tr.Postings) != 2 || tr.Postings[0].Account != bankAcct || !tr.Postings[1].Null {
+			t.Errorf("Transaction %v: malformed postings:\n%v", i, tr)
+			continue
+		}
+		if tr.Postings[0].Value != w.value {
+			t.Errorf("Transaction %v: expected %v, got %v.", i, ledger.FormatValue(w.value), ledger.FormatValue(tr.Postings[0].Value))
+		}
+		if tr.KVPairs["FITID"] != w.fitid {
+			t.Errorf("Transaction %v: expected FITID %q, got %q.", i, w.fitid, tr.KVPairs["FITID"])
+		}
+		if tr.Description != w.desc {
+			t.Errorf("Transaction %v: expected description %q, got %q.", i, w.desc, tr.Description)
+		}
+	}
+}
+
+// checkBalances fails the test if the transactions don't start with an opening balance and end with a closing
+// balance for the account, with the given dates and assertions. The transactions between them are returned.
+func checkBalances(t *testing.T, trs []ledger.Transaction, bankAcct string, openDate string, open int64, closeDate string, close int64) []ledger.Transaction {
+	t.Helper()
+
+	if len(trs) < 2 {
+		t.Fatalf("Expected statement balances, got %v transactions.", len(trs))
+	}
+	check := func(tr *ledger.Transaction, kind, date string, v int64) {
+		t.Helper()
+		p := tr.Postings[0]
+		if tr.KVPairs[kind] != bankAcct || p.Account != bankAcct || !p.HasAssert {
+			t.Errorf("Expected a %v assertion for %v:\n%v", kind, bankAcct, tr)
+			return
+		}
+		if got := tr.Date.Format("2006/01/02"); got != date || p.Assert != v {
+			t.Errorf("Expected a %v of %v on %v, got %v on %v.", kind, ledger.FormatValue(v), date, ledger.FormatValue(p.Assert), got)
+		}
+	}
+	check(&trs[0], "OpeningBalance", openDate, open)
+	check(&trs[len(trs)-1], "ClosingBalance", closeDate, close)
+	return trs[1 : len(trs)-1]
+}
+
+func TestImportCAMT053(t *testing.T) {
+	f := &ledger.File{}
+	err := f.ImportCAMT053(openFixture(t, "statement.camt053.xml"), "Assets:Checking", "Expenses:Unknown", "Equity:Adjustments")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pending entry counts for the dates but not for the booked balances.
+	entries := checkBalances(t, f.T, "Assets:Checking", "2023/03/02", 10000000, "2023/03/06", 12345600)
+	checkImported(t, entries, "Assets:Checking", []importedEntry{
+		{"2023/03/02", 3000000, "REF001", "Employer Inc"},
+		{"2023/03/05", -654400, "REF002", "Grocery Store"},
+		{"2023/03/06", -100000, "PEND1", "Coffee Shop"},
+	})
+	if !entries[2].Pending() || entries[2].Status != ledger.StatusPending {
+		t.Errorf("Pending entry wasn't imported as pending:\n%v", &entries[2])
+	}
+	if entries[0].KVPairs["Memo"] != "Salary March" {
+		t.Errorf("Expected memo %q, got %q.", "Salary March", entries[0].KVPairs["Memo"])
+	}
+
+	// Importing the same statement again adds nothing, not even balances.
+	n := len(f.T)
+	err = f.ImportCAMT053(openFixture(t, "statement.camt053.xml"), "Assets:Checking", "Expenses:Unknown", "Equity:Adjustments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.T) != n {
+		t.Errorf("Importing again added %v transactions.", len(f.T)-n)
+	}
+}
+
+func TestImportMT940(t *testing.T) {
+	f := &ledger.File{}
+	err := f.ImportMT940(openFixture(t, "statement.mt940"), "Assets:Checking", "Expenses:Unknown", "Equity:Adjustments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.T) != 9 {
+		t.Fatalf("Expected two statements with 9 transactions, got %v.", len(f.T))
+	}
+
+	// The closing balance date is used if it's after the last entry.
+	entries := checkBalances(t, f.T[:4], "Assets:Checking", "2023/03/02", 10000000, "2023/03/06", 12345600)
+	checkImported(t, entries, "Assets:Checking", []importedEntry{
+		{"2023/03/02", 3000000, "BANKREF1", "Employer Inc"},
+		{"2023/03/05", -654400, "BANKREF2", "Grocery Store card payment"},
+	})
+	if entries[0].KVPairs["Memo"] != "Salary March" || entries[0].KVPairs["TrnTyp"] != "NTRF" {
+		t.Errorf("Expected memo %q and type NTRF, got %q and %q.", "Salary March", entries[0].KVPairs["Memo"], entries[0].KVPairs["TrnTyp"])
+	}
+
+	// The booking date of the fee is in the year after its value date. The last two entries only have customer
+	// references, and a reversed debit is a credit.
+	entries = checkBalances(t, f.T[4:], "Assets:Checking", "2024/01/02", 12345600, "2024/01/02", 12245600)
+	checkImported(t, entries, "Assets:Checking", []importedEntry{
+		{"2024/01/02", -100000, "", "Fees"},
+		{"2024/01/02", -50000, "REF3", "Unknown"},
+		{"2024/01/02", 50000, "REF4", "Card fee reversal"},
+	})
+
+	// Importing the same statements again only adds the entry without a reference, and no balances since the
+	// file already has them.
+	n := len(f.T)
+	err = f.ImportMT940(openFixture(t, "statement.mt940"), "Assets:Checking", "Expenses:Unknown", "Equity:Adjustments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImported(t, f.T[n:], "Assets:Checking", []importedEntry{
+		{"2024/01/02", -100000, "", "Fees"},
+	})
+}
+
+func TestImportCSVProfiles(t *testing.T) {
+	cases := map[string]struct {
+		balances bool // Starts and ends with statement balances of $1000.00 on 03/02 and $1234.56 on 03/05.
+		entries  []importedEntry
+	}{
+		"chase": {true, []importedEntry{
+			{"2023/03/02", 3000000, "", "EMPLOYER INC     PAYROLL                    PPD ID: 1234567890"},
+			{"2023/03/05", -654400, "", "GROCERY STORE #123      ANYTOWN    ST"},
+		}},
+		"chase-credit": {false, []importedEntry{
+			{"2023/03/04", 1000000, "", "Payment Thank You-Mobile"},
+			{"2023/03/02", -45000, "", "COFFEE SHOP"},
+		}},
+		"bofa": {true, []importedEntry{
+			{"2023/03/02", 3000000, "", "EMPLOYER INC DES:PAYROLL ID:XXXXX12345 INDN:DOE JOHN CO ID:XXXXX67890 PPD"},
+			{"2023/03/05", -654400, "", "GROCERY STORE 03/04 PURCHASE ANYTOWN ST"},
+		}},
+		"amex": {false, []importedEntry{
+			{"2023/03/04", 1000000, "", "AUTOPAY PAYMENT - THANK YOU"},
+			{"2023/03/02", -45000, "", "COFFEE SHOP NEW YORK NY"},
+		}},
+		"capitalone": {false, []importedEntry{
+			{"2023/03/04", 1000000, "", "CAPITAL ONE MOBILE PYMT"},
+			{"2023/03/02", -45000, "", "COFFEE SHOP"},
+		}},
+		"discover": {false, []importedEntry{
+			{"2023/03/02", -45000, "", "COFFEE SHOP NEW YORK NY"},
+			{"2023/03/04", 1000000, "", "INTERNET PAYMENT - THANK YOU"},
+		}},
+		"wellsfargo": {false, []importedEntry{
+			{"2023/03/02", 3000000, "", "EMPLOYER INC PAYROLL"},
+			{"2023/03/05", -654400, "", "PURCHASE AUTHORIZED ON 03/04 GROCERY STORE"},
+		}},
+	}
+
+	for name, profile := range ledger.CSVProfiles {
+		name, profile := name, profile
+		t.Run(name, func(t *testing.T) {
+			c, ok := cases[name]
+			if !ok {
+				t.Fatalf("No test case for the %v profile.", name)
+			}
+
+			f := &ledger.File{}
+			err := f.ImportCSV(openFixture(t, "csv/"+name+".csv"), profile, "Assets:Bank", "Expenses:Unknown", "Equity:Adjustments")
+			if err != nil {
+				t.Fatal(err)
+			}
+			trs := f.T
+			if c.balances {
+				trs = checkBalances(t, trs, "Assets:Bank", "2023/03/02", 10000000, "2023/03/05", 12345600)
+			}
+			checkImported(t, trs, "Assets:Bank", c.entries)
+		})
+	}
+}
+
+func TestImportOFX(t *testing.T) {
+	cases := []struct {
+		name    string
+		entries []importedEntry
+	}{
+		{"statement.ofx", []importedEntry{
+			{"2023/03/02", 3000000, "2023030201", "EMPLOYER INC"},
+			{"2023/03/05", -654400, "2023030501", "A&P GROCERY"},
+		}},
+		// Needs CleanOFX before it will parse, see TestCleanOFX.
+		{"malformed.ofx", []importedEntry{
+			{"2023/03/02", 3000000, "2023030201", "CAFÉ EMPLOYER INC"},
+			{"2023/03/05", -654400, "2023030501", "A&P GROCERY"},
+		}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			f := &ledger.File{}
+			err := f.ImportOFX(openFixture(t, c.name), ledger.OFXDescName, "Assets:Checking", "Expenses:Unknown", "Equity:Adjustments")
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries := checkBalances(t, f.T, "Assets:Checking", "2023/03/02", 10000000, "2023/03/06", 12345600)
+			checkImported(t, entries, "Assets:Checking", c.entries)
+
+			// Importing the same statement again adds nothing, not even balances.
+			n := len(f.T)
+			err = f.ImportOFX(openFixture(t, c.name), ledger.OFXDescName, "Assets:Checking", "Expenses:Unknown", "Equity:Adjustments")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.T) != n {
+				t.Errorf("Importing again added %v transactions.", len(f.T)-n)
+			}
+		})
+	}
+}
+
+func TestCleanOFX(t *testing.T) {
+	data, err := os.ReadFile("testdata/import/malformed.ofx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clean, err := ledger.CleanOFX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The result must be well formed XML, with every aggregate closed where it should be.
+	dec := xml.NewDecoder(bytes.NewReader(clean))
+	path := []string{}
+	trns := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Cleaned OFX isn't well formed: %v\n%s", err, clean)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			path = append(path, tok.Name.Local)
+			switch tok.Name.Local {
+			case "STMTTRN":
+				trns++
+				if parent := path[len(path)-2]; parent != "BANKTRANLIST" {
+					t.Errorf("Transaction %v is inside %v.", trns, parent)
+				}
+			case "CHECKNUM":
+				t.Errorf("Empty element wasn't dropped.")
+			}
+		case xml.EndElement:
+			path = path[:len(path)-1]
+		}
+	}
+	if trns != 2 {
+		t.Errorf("Expected 2 transactions, got %v.", trns)
+	}
+	for _, want := range []string{"<NAME>CAFÉ EMPLOYER INC</NAME>", "<NAME>A&amp;P GROCERY</NAME>"} {
+		if !bytes.Contains(clean, []byte(want)) {
+			t.Errorf("Cleaned OFX doesn't contain %q:\n%s", want, clean)
+		}
+	}
+
+	_, err = ledger.CleanOFX([]byte("Date,Description,Amount\n"))
+	if err != ledger.ErrNotOFX {
+		t.Errorf("Expected ErrNotOFX for a CSV file, got %v.", err)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/samuellwn/ledger/parse"
+)
+
+func TestIncremental(t *testing.T) {
+	opts := parse.Options{KeepRaw: true, ExpandAliases: true, Year: 2022, Name: "grow.ledger"}
+	inc := parse.NewIncremental(opts)
+
+	data := ""
+	check := func(appended bool, more string) {
+		t.Helper()
+		data += more
+		r := bytes.NewReader([]byte(data))
+		if inc.Appended(r, r.Size()) != appended {
+			t.Fatalf("Expected Appended to return %v.", appended)
+		}
+		got, err := inc.Load(r, r.Size())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := parse.ParseLedgerWith(parse.NewCharReader(data, 1), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got.T) != len(want.T) || len(got.D) != len(want.D) {
+			t.Fatalf("Expected %v transactions and %v directives, got %v and %v", len(want.T), len(want.D), len(got.T), len(got.D))
+		}
+		for i := range want.T {
+			if got.T[i].String() != want.T[i].String() || got.T[i].Location != want.T[i].Location {
+				t.Fatalf("Transaction %v is different:\n%v (%v)\n%v (%v)", i, want.T[i].String(), want.T[i].Location,
+					got.T[i].String(), got.T[i].Location)
+			}
+		}
+		for i := range want.D {
+			if !got.D[i].Compare(want.D[i]) || got.D[i].FoundBefore != want.D[i].FoundBefore {
+				t.Errorf("Directive %v is different: %#v", i, got.D[i])
+			}
+		}
+	}
+
+	check(true, "commodity €\n\tformat 1.000,00 €\n\nalias Food=Expenses:Food\n\n1/15 * Groceries\n\tFood  1.234,56 €\n")
+
+	// More postings for the last transaction.
+	check(true, "\tBank\n\n")
+
+	// Directives that change how the new transactions are read.
+	check(true, "Y2023\n\n2/15 * Groceries\n\tFood  12,00 €\n\tBank\n\n3/15 * Groceries\n\tFood  2,00 €\n\tBank\n")
+	check(true, "\n4/15 Groceries\n\tFood  5,00 €\n\tBank\n\ncomment\n\n2024/01/01 Not a transaction\n\nend comment\n\n")
+	check(true, "5/15 Groceries\n\tFood  5,00 €\n\tBank\n\n")
+
+	// Nothing new.
+	check(true, "")
+
+	// Changing what was already parsed starts over.
+	data = data[:strings.Index(data, "4/15")]
+	check(false, "")
+	data = strings.Replace(data, "Groceries", "Shopping!", 1)
+	check(false, "")
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"sort"
+	"time"
+)
+
+// Index holds lookup tables for the transactions in a File, so tools don't need to scan the whole file for every
+// ID they look for. The index is a snapshot, it needs to be rebuilt after any change to the transaction list.
+type Index struct {
+	byID    map[string][]int // Every revision of each transaction, in file order.
+	byRID   map[string]int
+	byRev   map[string]int // By ID and RID.
+	byFITID map[string][]int
+	byDate  []int // Every transaction, in date order then file order.
+	dates   []time.Time
+}
+
+// Index builds an index of the transactions in the file. All values are indexes into f.T.
+func (f *File) Index() *Index {
+	ix := &Index{
+		byID:    map[string][]int{},
+		byRID:   map[string]int{},
+		byRev:   map[string]int{},
+		byFITID: map[string][]int{},
+		byDate:  make([]int, len(f.T)),
+		dates:   make([]time.Time, len(f.T)),
+	}
+	for i := range f.T {
+		kvs := f.T[i].KVPairs
+		if id := kvs["ID"]; id != "" {
+			ix.byID[id] = append(ix.byID[id], i)
+		}
+		if rid := kvs["RID"]; rid != "" {
+			ix.byRID[rid] = i
+			ix.byRev[kvs["ID"]+"\x00"+rid] = i
+		}
+		if fitid := kvs["FITID"]; fitid != "" {
+			ix.byFITID[fitid] = append(ix.byFITID[fitid], i)
+		}
+		ix.byDate[i] = i
+	}
+
+	sort.SliceStable(ix.byDate, func(i, j int) bool {
+		return f.T[ix.byDate[i]].Date.Before(f.T[ix.byDate[j]].Date)
+	})
+	for n, i := range ix.byDate {
+		ix.dates[n] = f.T[i].Date
+	}
+	return ix
+}
+
+// FindByID returns the latest revision of the transaction with the ID.
+func (ix *Index) FindByID(id string) (int, bool) {
+	revs := ix.byID[id]
+	if len(revs) == 0 {
+		return -1, false
+	}
+	return revs[len(revs)-1], true
+}
+
+// FindRevisions returns every revision of the transaction with the ID, in file order.
+func (ix *Index) FindRevisions(id string) []int {
+	return ix.byID[id]
+}
+
+// FindRevision returns the last transaction with the ID and RID. If the RID is empty this is the same as FindByID.
+func (ix *Index) FindRevision(id, rid string) (int, bool) {
+	if rid == "" {
+		return ix.FindByID(id)
+	}
+	i, ok := ix.byRev[id+"\x00"+rid]
+	if !ok {
+		return -1, false
+	}
+	return i, true
+}
+
+// FindByRID returns the transaction with the revision ID (the last one, if there are several).
+func (ix *Index) FindByRID(rid string) (int, bool) {
+	i, ok := ix.byRID[rid]
+	if !ok {
+		return -1, false
+	}
+	return i, true
+}
+
+// FindByFITID returns the transactions with the FITID, in file order. The same FITID may be used by different bank
+// accounts, and revisions of an imported transaction keep its FITID.
+func (ix *Index) FindByFITID(fitid string) []int {
+	return ix.byFITID[fitid]
+}
+
+// Between returns the transactions on or after begin and before end, in date order then file order. Either date may
+// be zero to leave that end open.
+func (ix *Index) Between(begin, end time.Time) []int {
+	from, to := 0, len(ix.dates)
+	if !begin.IsZero() {
+		from = sort.Search(len(ix.dates), func(i int) bool { return !ix.dates[i].Before(begin) })
+	}
+	if !end.IsZero() {
+		to = sort.Search(len(ix.dates), func(i int) bool { return !ix.dates[i].Before(end) })
+	}
+	if to < from {
+		return nil
+	}
+	return ix.byDate[from:to:to]
+}
+
+// Find returns the index of the latest revision of the transaction with the ID. This scans the file, use Index
+// when looking up more than a few IDs.
+func (f *File) Find(id string) (int, bool) {
+	for i := len(f.T) - 1; i >= 0; i-- {
+		if f.T[i].KVPairs["ID"] == id {
+			return i, true
+		}
+	}
+	return -1, false
+}
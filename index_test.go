@@ -0,0 +1,94 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuellwn/ledger/parse"
+)
+
+func TestIndex(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+2022/01/03 Rent
+	; ID: a
+	; RID: a1
+	Expenses:Rent  $500.00
+	Assets:Checking
+
+2022/01/01 Groceries
+	; FITID: 123
+	Expenses:Food  $20.00
+	Assets:Checking
+
+2022/01/03 Rent
+	; ID: a
+	; RID: a2
+	Expenses:Rent  $550.00
+	Assets:Checking
+
+2022/01/02 Coffee
+	Expenses:Food  $5.00
+	Assets:Checking
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ix := f.Index()
+	if i, ok := ix.FindByID("a"); !ok || i != 2 {
+		t.Errorf("FindByID gave %v, expected 2.", i)
+	}
+	if revs := ix.FindRevisions("a"); len(revs) != 2 || revs[0] != 0 {
+		t.Errorf("FindRevisions gave %v, expected [0 2].", revs)
+	}
+	if i, ok := ix.FindRevision("a", "a1"); !ok || i != 0 {
+		t.Errorf("FindRevision gave %v, expected 0.", i)
+	}
+	if _, ok := ix.FindRevision("b", "a1"); ok {
+		t.Errorf("FindRevision found a revision of the wrong transaction.")
+	}
+	if i, ok := ix.FindByRID("a2"); !ok || i != 2 {
+		t.Errorf("FindByRID gave %v, expected 2.", i)
+	}
+	if trs := ix.FindByFITID("123"); len(trs) != 1 || trs[0] != 1 {
+		t.Errorf("FindByFITID gave %v, expected [1].", trs)
+	}
+	if i, ok := f.Find("a"); !ok || i != 2 {
+		t.Errorf("Find gave %v, expected 2.", i)
+	}
+
+	between := ix.Between(time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC), time.Time{})
+	if len(between) != 3 || between[0] != 3 || between[1] != 0 || between[2] != 2 {
+		t.Errorf("Between gave %v, expected [3 0 2].", between)
+	}
+	if between := ix.Between(time.Time{}, time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)); len(between) != 1 {
+		t.Errorf("Between gave %v, expected [1].", between)
+	}
+
+	f.StripHistory()
+	if len(f.T) != 3 || f.T[0].Postings[0].Value != 5500000 {
+		t.Errorf("StripHistory didn't keep the latest revision in place of the first.")
+	}
+}
@@ -0,0 +1,356 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samuellwn/ledger/parse/lex"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+/*
+JSON Schema
+
+Files, transactions, postings, and directives all marshal to JSON objects. Optional fields are left out when they
+are empty.
+
+File:
+
+	{
+		"transactions": [Transaction...],
+		"directives":   [Directive...]
+	}
+
+Transaction:
+
+	{
+		"date":        "2006-01-02",
+		"clearDate":   "2006-01-02",    (optional)
+		"status":      "cleared",       "cleared", "pending", or "" (optional)
+		"code":        "1234",          (optional)
+		"description": "Groceries",
+		"postings":    [Posting...],
+		"comments":    ["A comment"],   (optional)
+		"tags":        ["Tag1"],        sorted (optional)
+		"kv":          {"ID": "x"},     (optional)
+		"line":        12               (optional)
+	}
+
+Posting:
+
+	{
+		"status":     "cleared",        same as for transactions (optional)
+		"account":    "Expenses:Food",
+		"null":       true,             the amount is implied (optional)
+		"amount":     200000,           thousandths of a cent, left out for null postings
+		"amountText": "$20.00",         formatted amount, left out for null postings
+		"assert":     52500,            balance assertion (optional)
+		"assertText": "$5.25",          formatted balance assertion (optional)
+		"note":       "A note"          (optional)
+	}
+
+When unmarshaling a posting, "amountText" and "assertText" are only used if the matching raw value is missing.
+
+Directive:
+
+	{
+		"type":        "account",
+		"argument":    "Expenses:Food", (optional)
+		"lines":       ["note Food"],   (optional)
+		"foundBefore": 0,
+		"line":        3                (optional)
+	}
+*/
+
+const jsonDate = "2006-01-02"
+
+func (s status) String() string {
+	switch s {
+	case StatusClear:
+		return "cleared"
+	case StatusPending:
+		return "pending"
+	default:
+		return ""
+	}
+}
+
+// ParseStatus parses a status as written by its String method ("cleared", "pending", or empty). The ledger
+// symbols "*" and "!" are also accepted.
+func ParseStatus(s string) (status, error) {
+	switch s {
+	case "cleared", "*":
+		return StatusClear, nil
+	case "pending", "!":
+		return StatusPending, nil
+	case "", "uncleared":
+		return StatusUndefined, nil
+	}
+	return StatusUndefined, fmt.Errorf("Unknown transaction status: %q", s)
+}
+
+type jsonFile struct {
+	Transactions []Transaction `json:"transactions"`
+	Directives   []Directive   `json:"directives"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (f *File) MarshalJSON() ([]byte, error) {
+	jf := jsonFile{Transactions: f.T, Directives: f.D}
+	if jf.Transactions == nil {
+		jf.Transactions = []Transaction{}
+	}
+	if jf.Directives == nil {
+		jf.Directives = []Directive{}
+	}
+	return json.Marshal(jf)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *File) UnmarshalJSON(data []byte) error {
+	jf := jsonFile{}
+	err := json.Unmarshal(data, &jf)
+	if err != nil {
+		return err
+	}
+	f.T, f.D = jf.Transactions, jf.Directives
+	if f.T == nil {
+		f.T = []Transaction{}
+	}
+	return nil
+}
+
+type jsonTransaction struct {
+	Date        string            `json:"date"`
+	ClearDate   string            `json:"clearDate,omitempty"`
+	Status      string            `json:"status,omitempty"`
+	Code        string            `json:"code,omitempty"`
+	Description string            `json:"description"`
+	Postings    []Posting         `json:"postings"`
+	Comments    []string          `json:"comments,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	KVPairs     map[string]string `json:"kv,omitempty"`
+	File        string            `json:"file,omitempty"`
+	Line        uint64            `json:"line,omitempty"`
+	Column      uint16            `json:"column,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	jt := jsonTransaction{
+		Date:        t.Date.Format(jsonDate),
+		Status:      t.Status.String(),
+		Code:        t.Code,
+		Description: t.Description,
+		Postings:    t.Postings,
+		Comments:    t.Comments,
+		KVPairs:     t.KVPairs,
+		File:        t.Location.File,
+		Line:        t.Location.Line(),
+		Column:      t.Location.Column(),
+	}
+	if !t.ClearDate.IsZero() {
+		jt.ClearDate = t.ClearDate.Format(jsonDate)
+	}
+	if jt.Postings == nil {
+		jt.Postings = []Posting{}
+	}
+	if len(t.Tags) != 0 {
+		jt.Tags = maps.Keys(t.Tags)
+		slices.Sort(jt.Tags)
+	}
+	return json.Marshal(jt)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	jt := jsonTransaction{}
+	err := json.Unmarshal(data, &jt)
+	if err != nil {
+		return err
+	}
+
+	nt := Transaction{
+		Code:        jt.Code,
+		Description: jt.Description,
+		Postings:    jt.Postings,
+		Comments:    jt.Comments,
+		Tags:        map[string]bool{},
+		KVPairs:     jt.KVPairs,
+		Location:    Position{jt.File, lex.Location(0).L(jt.Line).C(jt.Column)},
+	}
+
+	nt.Date, err = time.Parse(jsonDate, jt.Date)
+	if err != nil {
+		return err
+	}
+	if jt.ClearDate != "" {
+		nt.ClearDate, err = time.Parse(jsonDate, jt.ClearDate)
+		if err != nil {
+			return err
+		}
+	}
+
+	nt.Status, err = ParseStatus(jt.Status)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range jt.Tags {
+		nt.Tags[tag] = true
+	}
+	if nt.KVPairs == nil {
+		nt.KVPairs = map[string]string{}
+	}
+
+	*t = nt
+	return nil
+}
+
+type jsonPosting struct {
+	Status     string `json:"status,omitempty"`
+	Account    string `json:"account"`
+	Null       bool   `json:"null,omitempty"`
+	Amount     *int64 `json:"amount,omitempty"`
+	AmountText string `json:"amountText,omitempty"`
+	Assert     *int64 `json:"assert,omitempty"`
+	AssertText string `json:"assertText,omitempty"`
+	Note       string `json:"note,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p Posting) MarshalJSON() ([]byte, error) {
+	jp := jsonPosting{
+		Status:  p.Status.String(),
+		Account: p.Account,
+		Null:    p.Null,
+		Note:    p.Note,
+	}
+	if !p.Null {
+		jp.Amount = &p.Value
+		jp.AmountText = FormatValue(p.Value)
+	}
+	if p.HasAssert {
+		jp.Assert = &p.Assert
+		jp.AssertText = FormatValue(p.Assert)
+	}
+	return json.Marshal(jp)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *Posting) UnmarshalJSON(data []byte) error {
+	jp := jsonPosting{}
+	err := json.Unmarshal(data, &jp)
+	if err != nil {
+		return err
+	}
+
+	np := Posting{
+		Account: jp.Account,
+		Null:    jp.Null,
+		Note:    jp.Note,
+	}
+
+	np.Status, err = ParseStatus(jp.Status)
+	if err != nil {
+		return err
+	}
+
+	if !np.Null {
+		np.Value, err = jsonAmount(jp.Amount, jp.AmountText)
+		if err != nil {
+			return err
+		}
+	}
+
+	if jp.Assert != nil || jp.AssertText != "" {
+		np.HasAssert = true
+		np.Assert, err = jsonAmount(jp.Assert, jp.AssertText)
+		if err != nil {
+			return err
+		}
+	}
+
+	*p = np
+	return nil
+}
+
+// jsonAmount returns the raw amount if there is one, otherwise the text amount is parsed.
+func jsonAmount(raw *int64, text string) (int64, error) {
+	if raw != nil {
+		return *raw, nil
+	}
+	if text == "" {
+		return 0, errors.New("Posting is not null but has no amount.")
+	}
+	text = strings.ReplaceAll(strings.TrimSpace(text), ",", "")
+	text = strings.Replace(text, "$", "", 1)
+	return ParseValueNumber(text)
+}
+
+type jsonDirective struct {
+	Type        string   `json:"type"`
+	Argument    string   `json:"argument,omitempty"`
+	Lines       []string `json:"lines,omitempty"`
+	FoundBefore int      `json:"foundBefore"`
+	File        string   `json:"file,omitempty"`
+	Line        uint64   `json:"line,omitempty"`
+	Column      uint16   `json:"column,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Directive) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonDirective{
+		Type:        d.Type,
+		Argument:    d.Argument,
+		Lines:       d.Lines,
+		FoundBefore: d.FoundBefore,
+		File:        d.Location.File,
+		Line:        d.Location.Line(),
+		Column:      d.Location.Column(),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Directive) UnmarshalJSON(data []byte) error {
+	jd := jsonDirective{}
+	err := json.Unmarshal(data, &jd)
+	if err != nil {
+		return err
+	}
+
+	*d = Directive{
+		Type:        jd.Type,
+		Argument:    jd.Argument,
+		Lines:       jd.Lines,
+		FoundBefore: jd.FoundBefore,
+		Location:    Position{jd.File, lex.Location(0).L(jd.Line).C(jd.Column)},
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/samuellwn/ledger"
+)
+
+// matchTransaction returns a transaction on the given day moving value from Assets:Checking to Expenses:Unknown.
+// If null is set the Expenses:Unknown posting is null instead of the other one.
+func matchTransaction(day int, value int64, null bool) ledger.Transaction {
+	return ledger.Transaction{
+		Date:        time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC),
+		Description: "VENDOR 1234",
+		Postings: []ledger.Posting{
+			{Account: "Expenses:Unknown", Value: value, Null: null},
+			{Account: "Assets:Checking", Value: -value, Null: !null},
+		},
+	}
+}
+
+func TestMatchConditions(t *testing.T) {
+	jan := func(day int) time.Time { return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC) }
+	cases := []struct {
+		name    string
+		matcher ledger.Matcher
+		day     int
+		value   int64
+		want    bool
+	}{
+		{"no conditions", ledger.Matcher{}, 1, 50000, true},
+		{"positive", ledger.Matcher{Sign: 1}, 1, 50000, true},
+		{"positive refund", ledger.Matcher{Sign: 1}, 1, -50000, false},
+		{"negative", ledger.Matcher{Sign: -1}, 1, -50000, true},
+		{"negative purchase", ledger.Matcher{Sign: -1}, 1, 50000, false},
+		{"positive zero", ledger.Matcher{Sign: 1}, 1, 0, false},
+		{"negative zero", ledger.Matcher{Sign: -1}, 1, 0, false},
+		{"at min", ledger.Matcher{MinAmount: 50000, HasMinAmount: true}, 1, 50000, true},
+		{"below min", ledger.Matcher{MinAmount: 50000, HasMinAmount: true}, 1, 49999, false},
+		{"at max", ledger.Matcher{MaxAmount: 50000, HasMaxAmount: true}, 1, 50000, true},
+		{"above max", ledger.Matcher{MaxAmount: 50000, HasMaxAmount: true}, 1, 50001, false},
+		{"max of a refund", ledger.Matcher{MaxAmount: 50000, HasMaxAmount: true}, 1, -50000, true},
+		{"min of a refund", ledger.Matcher{MinAmount: 60000, HasMinAmount: true}, 1, -50000, false},
+		{"zero max", ledger.Matcher{HasMaxAmount: true}, 1, 0, true},
+		{"on begin", ledger.Matcher{Begin: jan(10)}, 10, 50000, true},
+		{"before begin", ledger.Matcher{Begin: jan(10)}, 9, 50000, false},
+		{"before end", ledger.Matcher{End: jan(10)}, 9, 50000, true},
+		{"on end", ledger.Matcher{End: jan(10)}, 10, 50000, false},
+		{"everything", ledger.Matcher{Sign: -1, MinAmount: 10000, HasMinAmount: true, MaxAmount: 90000,
+			HasMaxAmount: true, Begin: jan(1), End: jan(31)}, 15, -50000, true},
+	}
+	for _, c := range cases {
+		c.matcher.R = regexp.MustCompile("^VENDOR")
+		c.matcher.Account = "Expenses:Vendor"
+
+		tr := matchTransaction(c.day, c.value, false)
+		if got := tr.Match("Expenses:Unknown", []ledger.Matcher{c.matcher}); got != c.want {
+			t.Errorf("%v: expected %v, got %v", c.name, c.want, got)
+		}
+		want := "Expenses:Unknown"
+		if c.want {
+			want = "Expenses:Vendor"
+		}
+		if tr.Postings[0].Account != want {
+			t.Errorf("%v: expected the posting to be for %v, got %v", c.name, want, tr.Postings[0].Account)
+		}
+	}
+}
+
+func TestMatchSplits(t *testing.T) {
+	cases := []struct {
+		name   string
+		splits []ledger.MatchSplit
+		value  int64
+		null   bool
+		want   []ledger.Posting // Checked for account, value, and null.
+	}{
+		{
+			"fixed",
+			[]ledger.MatchSplit{{Account: "Expenses:Taxes", Value: 40000}, {Account: "Assets:401k", Value: 15000}},
+			100000, false,
+			[]ledger.Posting{{Account: "Expenses:Taxes", Value: 40000}, {Account: "Assets:401k", Value: 15000},
+				{Account: "Expenses:Vendor", Value: 45000}, {Account: "Assets:Checking", Value: -100000, Null: true}},
+		},
+		{
+			"percent",
+			[]ledger.MatchSplit{{Account: "Expenses:Groceries", Percent: 60}},
+			100000, false,
+			[]ledger.Posting{{Account: "Expenses:Groceries", Value: 60000}, {Account: "Expenses:Vendor", Value: 40000},
+				{Account: "Assets:Checking", Value: -100000, Null: true}},
+		},
+		{
+			// Each third is rounded, and whatever that leaves goes to the matcher's account.
+			"percent rounding",
+			[]ledger.MatchSplit{{Account: "Expenses:A", Percent: 100.0 / 3}, {Account: "Expenses:B", Percent: 100.0 / 3}},
+			100000, false,
+			[]ledger.Posting{{Account: "Expenses:A", Value: 33333}, {Account: "Expenses:B", Value: 33333},
+				{Account: "Expenses:Vendor", Value: 33334}, {Account: "Assets:Checking", Value: -100000, Null: true}},
+		},
+		{
+			"percent rounding up",
+			[]ledger.MatchSplit{{Account: "Expenses:A", Percent: 50}, {Account: "Expenses:B", Percent: 25}},
+			3, false,
+			[]ledger.Posting{{Account: "Expenses:A", Value: 2}, {Account: "Expenses:B", Value: 1},
+				{Account: "Expenses:Vendor", Value: 0}, {Account: "Assets:Checking", Value: -3, Null: true}},
+		},
+		{
+			"percent of a refund",
+			[]ledger.MatchSplit{{Account: "Expenses:Groceries", Percent: 60}},
+			-100000, false,
+			[]ledger.Posting{{Account: "Expenses:Groceries", Value: -60000}, {Account: "Expenses:Vendor", Value: -40000},
+				{Account: "Assets:Checking", Value: 100000, Null: true}},
+		},
+		{
+			// The replaced posting's amount was implied, so the left over one must still be.
+			"null",
+			[]ledger.MatchSplit{{Account: "Expenses:Taxes", Value: 40000}},
+			100000, true,
+			[]ledger.Posting{{Account: "Expenses:Taxes", Value: 40000}, {Account: "Expenses:Vendor", Value: 60000, Null: true},
+				{Account: "Assets:Checking", Value: -100000}},
+		},
+	}
+	for _, c := range cases {
+		m := ledger.Matcher{R: regexp.MustCompile("^VENDOR"), Account: "Expenses:Vendor", Splits: c.splits}
+
+		tr := matchTransaction(1, c.value, c.null)
+		if !tr.Match("Expenses:Unknown", []ledger.Matcher{m}) {
+			t.Errorf("%v: expected a match", c.name)
+			continue
+		}
+		if len(tr.Postings) != len(c.want) {
+			t.Errorf("%v: expected %v postings, got %v:\n%v", c.name, len(c.want), len(tr.Postings), tr.String())
+			continue
+		}
+		for i, p := range tr.Postings {
+			want := c.want[i]
+			if p.Account != want.Account || p.Null != want.Null || !p.Null && p.Value != want.Value {
+				t.Errorf("%v: posting %v: expected %v %v (null %v), got %v %v (null %v)", c.name, i, want.Account,
+					want.Value, want.Null, p.Account, p.Value, p.Null)
+			}
+		}
+		if ok, _ := tr.Balance(); !ok {
+			t.Errorf("%v: the split transaction doesn't balance:\n%v", c.name, tr.String())
+		}
+	}
+}
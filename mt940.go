@@ -0,0 +1,387 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// SWIFT MT940 statements are a list of fields, each starting with a tag like ":61:" at the start of a line. Fields
+// may continue over several lines, and a line with a single "-" ends a statement.
+
+var mt940StatementLine = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+(?:,\d*)?)([NSF][A-Z0-9]{3})([^/\n]*)(?://([^\n]*))?`)
+
+var mt940Balance = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})(\d+(?:,\d*)?)`)
+
+type mt940Field struct {
+	tag   string
+	value string
+}
+
+type mt940Entry struct {
+	date    time.Time
+	value   int64
+	typ     string
+	fitid   string
+	details string
+}
+
+type mt940Statement struct {
+	open, close         int64
+	hasOpen, hasClose   bool
+	openDate, closeDate time.Time
+	entries             []*mt940Entry
+}
+
+// ImportMT940 imports a SWIFT MT940 bank statement file into this file. This works exactly like ImportOFX: already
+// imported transactions (by FITID) are skipped, and if an equity account is given, statement opening and closing
+// balance assertions are added. Importing a statement again adds nothing, not even the balances.
+//
+// Each :61: statement line becomes a transaction. The FITID is the bank's reference, or the customer reference if
+// there is no bank reference. The :86: details are used for the description and the Memo and Name KV pairs. If the
+// details use the common "?20" style subfields, the name (?32 and ?33) is used for the description and the purpose
+// (?20 to ?29) is used for the memo, otherwise the whole thing is used as the description.
+//
+// Files that are not valid UTF-8 are assumed to be Latin-1. The currency is ignored.
+func (f *File) ImportMT940(mt940File io.Reader, bankAcct, defaultAcct, equityAcct string) error {
+	data, err := io.ReadAll(mt940File)
+	if err != nil {
+		return err
+	}
+	if !utf8.Valid(data) {
+		data, err = charmap.ISO8859_1.NewDecoder().Bytes(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	stmts, err := parseMT940(data)
+	if err != nil {
+		return err
+	}
+
+	seenIds := f.SeenFITIDs(bankAcct)
+
+	ltrns := []Transaction{}
+	found := false
+	for _, stmt := range stmts {
+		if len(stmt.entries) == 0 {
+			continue
+		}
+		found = true
+
+		var sum int64
+		strns := []Transaction{}
+		for _, entry := range stmt.entries {
+			sum += entry.value
+
+			if entry.fitid != "" && seenIds[entry.fitid] {
+				continue
+			}
+
+			name, memo := mt940Details(entry.details)
+			desc := name
+			if desc == "" {
+				desc = memo
+			}
+			if desc == "" {
+				desc = "Unknown"
+			}
+
+			tr := Transaction{
+				Description: desc,
+				Date:        entry.date,
+				Status:      StatusUndefined,
+				KVPairs: map[string]string{
+					"TrnTyp":  entry.typ,
+					"Memo":    memo,
+					"Name":    name,
+					"Account": bankAcct,
+				},
+				Postings: []Posting{
+					{
+						Account: bankAcct,
+						Value:   entry.value,
+					},
+					{
+						Account: defaultAcct,
+						Null:    true,
+					},
+				},
+			}
+			if entry.fitid != "" {
+				tr.KVPairs["FITID"] = entry.fitid
+			}
+			AssignIDs(f.ids(), &tr)
+
+			strns = append(strns, tr)
+		}
+
+		if equityAcct != "" && (stmt.hasOpen || stmt.hasClose) {
+			open, close := stmt.open, stmt.close
+			if !stmt.hasOpen {
+				open = close - sum
+			}
+			if !stmt.hasClose {
+				close = open + sum
+			}
+			first, last := stmt.entries[0].date, stmt.entries[0].date
+			for _, entry := range stmt.entries {
+				if entry.date.Before(first) {
+					first = entry.date
+				}
+				if entry.date.After(last) {
+					last = entry.date
+				}
+			}
+			if stmt.hasClose && stmt.closeDate.After(last) {
+				last = stmt.closeDate
+			}
+
+			strns = f.addStatementBalances(strns, bankAcct, equityAcct, first, open, last, close)
+		}
+
+		ltrns = append(ltrns, strns...)
+	}
+
+	if !found {
+		return errors.New("No transactions found.")
+	}
+
+	n := len(f.T)
+	f.T = append(f.T, ltrns...)
+	f.resolvePending(n)
+	return nil
+}
+
+// mt940Fields splits a file into fields. Anything that is not part of a field (SWIFT headers, blank lines, etc) is
+// dropped. Statement separators are returned as a field with the tag "-".
+func mt940Fields(data []byte) []mt940Field {
+	fields := []mt940Field{}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+
+		// SWIFT envelopes wrap the message text in "{4:" and "-}".
+		line = strings.TrimPrefix(line, "{4:")
+		if strings.HasPrefix(line, "-") && strings.Trim(line, "-}") == "" {
+			fields = append(fields, mt940Field{tag: "-"})
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			end := strings.Index(line[1:], ":")
+			if end != -1 {
+				fields = append(fields, mt940Field{tag: line[1 : end+1], value: line[end+2:]})
+				continue
+			}
+		}
+
+		if len(fields) == 0 || fields[len(fields)-1].tag == "-" {
+			continue
+		}
+		fields[len(fields)-1].value += "\n" + line
+	}
+	return fields
+}
+
+func parseMT940(data []byte) ([]*mt940Statement, error) {
+	stmts := []*mt940Statement{}
+	var stmt *mt940Statement
+	var last *mt940Entry
+	for _, field := range mt940Fields(data) {
+		if stmt == nil && field.tag != "-" {
+			stmt = &mt940Statement{}
+			stmts = append(stmts, stmt)
+		}
+
+		switch field.tag {
+		case "-":
+			stmt, last = nil, nil
+		case "60F", "60M":
+			v, date, err := parseMT940Balance(field.value)
+			if err != nil {
+				return nil, err
+			}
+			stmt.open, stmt.openDate, stmt.hasOpen = v, date, true
+			last = nil
+		case "62F", "62M":
+			v, date, err := parseMT940Balance(field.value)
+			if err != nil {
+				return nil, err
+			}
+			stmt.close, stmt.closeDate, stmt.hasClose = v, date, true
+			last = nil
+		case "61":
+			entry, err := parseMT940Entry(field.value)
+			if err != nil {
+				return nil, err
+			}
+			stmt.entries = append(stmt.entries, entry)
+			last = entry
+		case "86":
+			// Only details right after a statement line belong to it, the rest are for the whole statement.
+			if last != nil {
+				last.details = field.value
+			}
+			last = nil
+		default:
+			last = nil
+		}
+	}
+
+	if len(stmts) == 0 {
+		return nil, errors.New("No statements found.")
+	}
+	return stmts, nil
+}
+
+func parseMT940Entry(value string) (*mt940Entry, error) {
+	m := mt940StatementLine.FindStringSubmatch(value)
+	if m == nil {
+		return nil, fmt.Errorf("Malformed MT940 statement line: %q", value)
+	}
+
+	date, err := parseMT940Date(m[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// The optional booking date has no year, so it is taken from the value date. Handle statements that cross
+	// the end of the year.
+	if m[2] != "" {
+		booked, err := time.Parse("20060102", fmt.Sprintf("%04d%s", date.Year(), m[2]))
+		if err != nil {
+			return nil, err
+		}
+		if booked.Sub(date) > 180*24*time.Hour {
+			booked = booked.AddDate(-1, 0, 0)
+		} else if date.Sub(booked) > 180*24*time.Hour {
+			booked = booked.AddDate(1, 0, 0)
+		}
+		date = booked
+	}
+
+	v, err := parseMT940Amount(m[5])
+	if err != nil {
+		return nil, err
+	}
+	// A reversal of a credit is a debit and the other way around.
+	if m[3] == "D" || m[3] == "RC" {
+		v = -v
+	}
+
+	fitid := strings.TrimSpace(m[8])
+	if fitid == "" && m[7] != "NONREF" {
+		fitid = strings.TrimSpace(m[7])
+	}
+
+	return &mt940Entry{
+		date:  date,
+		value: v,
+		typ:   m[6],
+		fitid: fitid,
+	}, nil
+}
+
+func parseMT940Balance(value string) (int64, time.Time, error) {
+	m := mt940Balance.FindStringSubmatch(value)
+	if m == nil {
+		return 0, time.Time{}, fmt.Errorf("Malformed MT940 balance: %q", value)
+	}
+
+	date, err := parseMT940Date(m[2])
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	v, err := parseMT940Amount(m[4])
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if m[1] == "D" {
+		v = -v
+	}
+	return v, date, nil
+}
+
+func parseMT940Date(s string) (time.Time, error) {
+	year, err := strconv.Atoi(s[:2])
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Two digit years, pick the closest century.
+	if year < 80 {
+		year += 2000
+	} else {
+		year += 1900
+	}
+	return time.Parse("20060102", fmt.Sprintf("%04d%s", year, s[2:]))
+}
+
+func parseMT940Amount(s string) (int64, error) {
+	return ParseValueNumber(strings.Replace(s, ",", ".", 1))
+}
+
+// mt940Details splits :86: details into a name and a memo.
+func mt940Details(details string) (name, memo string) {
+	details = strings.ReplaceAll(details, "\n", "")
+	if !strings.Contains(details, "?") {
+		return "", strings.TrimSpace(details)
+	}
+
+	names, purpose, text := []string{}, []string{}, ""
+	for i, sub := range strings.Split(details, "?") {
+		if i == 0 || len(sub) < 2 {
+			continue
+		}
+		code, v := sub[:2], strings.TrimSpace(sub[2:])
+		switch {
+		case code == "00":
+			text = v
+		case code >= "20" && code <= "29", code >= "60" && code <= "63":
+			purpose = append(purpose, v)
+		case code == "32" || code == "33":
+			names = append(names, v)
+		}
+	}
+
+	name = strings.TrimSpace(strings.Join(names, ""))
+	memo = strings.TrimSpace(strings.Join(purpose, " "))
+	if memo == "" {
+		memo = text
+	}
+	return name, memo
+}
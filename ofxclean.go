@@ -0,0 +1,236 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// ErrNotOFX is returned by CleanOFX if the data does not have an OFX header.
+var ErrNotOFX = errors.New("Data does not look like an OFX file.")
+
+var ofxEntityRe = regexp.MustCompile(`^&(#[0-9]+|#x[0-9a-fA-F]+|[a-zA-Z]+);`)
+
+// ofxAggregates are the aggregates found in statements. Without a closing tag somewhere in the file there is no other
+// way to tell an aggregate from an empty leaf element.
+var ofxAggregates = map[string]bool{
+	"OFX": true, "SIGNONMSGSRSV1": true, "SONRS": true, "STATUS": true, "FI": true,
+	"BANKMSGSRSV1": true, "STMTTRNRS": true, "STMTRS": true, "BANKACCTFROM": true, "BANKACCTTO": true,
+	"BANKTRANLIST": true, "STMTTRN": true, "PAYEE": true, "LEDGERBAL": true, "AVAILBAL": true,
+	"CREDITCARDMSGSRSV1": true, "CCSTMTTRNRS": true, "CCSTMTRS": true, "CCACCTFROM": true, "CCACCTTO": true,
+	"INVSTMTMSGSRSV1": true, "INVSTMTTRNRS": true, "INVSTMTRS": true, "INVACCTFROM": true, "INVTRANLIST": true,
+	"INVBANKTRAN": true, "INVTRAN": true, "INVBUY": true, "INVSELL": true, "BUYSTOCK": true, "SELLSTOCK": true,
+	"BUYMF": true, "SELLMF": true, "INCOME": true, "REINVEST": true, "TRANSFER": true, "INVPOSLIST": true,
+	"INVPOS": true, "POSSTOCK": true, "POSMF": true, "POSOPT": true, "POSDEBT": true, "POSOTHER": true,
+	"INVBAL": true, "SECLISTMSGSRSV1": true, "SECLIST": true, "SECINFO": true, "SECID": true, "STOCKINFO": true,
+	"MFINFO": true, "OPTINFO": true, "DEBTINFO": true, "OTHERINFO": true, "CURRENCY": true, "ORIGCURRENCY": true,
+}
+
+// CleanOFX takes an OFX 1.x (SGML) file and rewrites it as a well formed OFX 2 (XML) file, fixing the more common
+// mistakes banks make along the way:
+//
+//   - Anything before the header (blank lines, byte order marks, HTTP headers) is dropped.
+//   - The header is rebuilt, so missing, misordered, or oddly spaced header fields don't matter.
+//   - Text that is not valid UTF-8 is assumed to be Windows-1252 (a superset of Latin-1) and converted.
+//   - Leaf elements get closing tags, and empty leaf elements are dropped.
+//   - Aggregates that are never closed are closed when their parent is (or the next one with the same name starts),
+//     and stray closing tags are dropped.
+//   - Unescaped ampersands are escaped.
+//
+// OFX 2 files are returned unchanged except for the first two fixes. ImportOFX uses this automatically if a file
+// fails to parse, so most users will never need to call it directly.
+func CleanOFX(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	if !utf8.Valid(data) {
+		decoded, err := charmap.Windows1252.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, err
+		}
+		data = decoded
+	}
+
+	// OFX 2 is XML, which we can't do much to fix.
+	if i := bytes.Index(data, []byte("<?xml")); i != -1 {
+		return data[i:], nil
+	}
+
+	start := bytes.Index(bytes.ToUpper(data), []byte("OFXHEADER"))
+	if start == -1 {
+		return nil, ErrNotOFX
+	}
+	data = data[start:]
+
+	body := bytes.IndexByte(data, '<')
+	if body == -1 {
+		return nil, ErrNotOFX
+	}
+
+	out := new(bytes.Buffer)
+	out.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"no\"?>\n")
+	out.WriteString("<?OFX OFXHEADER=\"200\" VERSION=\"211\" SECURITY=\"NONE\" OLDFILEUID=\"NONE\" NEWFILEUID=\"NONE\"?>\n")
+	cleanOFXBody(out, string(data[body:]))
+	return out.Bytes(), nil
+}
+
+type ofxToken struct {
+	end  bool   // True for closing tags.
+	name string // Empty for text.
+	text string
+}
+
+func tokenizeOFX(body string) []ofxToken {
+	tokens := []ofxToken{}
+	for len(body) > 0 {
+		i := strings.IndexByte(body, '<')
+		if i != 0 {
+			if i == -1 {
+				i = len(body)
+			}
+			tokens = append(tokens, ofxToken{text: body[:i]})
+			body = body[i:]
+			continue
+		}
+
+		j := strings.IndexByte(body, '>')
+		if j == -1 {
+			// An unterminated tag at the end of the file, just drop it.
+			break
+		}
+		tag := strings.TrimSpace(body[1:j])
+		body = body[j+1:]
+
+		switch {
+		case strings.HasPrefix(tag, "/"):
+			tokens = append(tokens, ofxToken{end: true, name: strings.ToUpper(strings.TrimSpace(tag[1:]))})
+		case strings.HasPrefix(tag, "!"), strings.HasPrefix(tag, "?"), tag == "":
+			// Comments and such.
+		default:
+			tokens = append(tokens, ofxToken{name: strings.ToUpper(tag)})
+		}
+	}
+	return tokens
+}
+
+func cleanOFXBody(out *bytes.Buffer, body string) {
+	tokens := tokenizeOFX(body)
+
+	// Any element that is closed somewhere (or is a known aggregate) is treated as an aggregate when it has no text.
+	closed := maps.Clone(ofxAggregates)
+	for _, tok := range tokens {
+		if tok.end {
+			closed[tok.name] = true
+		}
+	}
+
+	stack := []string{}
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok.name == "":
+			// Text between aggregates is just whitespace (or junk), leaf text is handled with the leaf.
+
+		case tok.end:
+			open := -1
+			for j := len(stack) - 1; j >= 0; j-- {
+				if stack[j] == tok.name {
+					open = j
+					break
+				}
+			}
+			if open == -1 {
+				// A closing tag for a leaf that is already closed or something that was never opened.
+				continue
+			}
+			for len(stack) > open {
+				out.WriteString("</" + stack[len(stack)-1] + ">")
+				stack = stack[:len(stack)-1]
+			}
+
+		default:
+			text := ""
+			if i+1 < len(tokens) && tokens[i+1].name == "" {
+				text = strings.TrimSpace(tokens[i+1].text)
+			}
+
+			if text != "" {
+				out.WriteString("<" + tok.name + ">")
+				writeOFXText(out, text)
+				out.WriteString("</" + tok.name + ">")
+				i++
+				if i+1 < len(tokens) && tokens[i+1].end && tokens[i+1].name == tok.name {
+					i++
+				}
+				continue
+			}
+
+			if !closed[tok.name] {
+				// An empty leaf element, these just confuse the parser.
+				continue
+			}
+			// Aggregates aren't nested in themselves, so an open one with the same name is a sibling that was never
+			// closed (usually STMTTRN).
+			for j := len(stack) - 1; j >= 0; j-- {
+				if stack[j] == tok.name {
+					for len(stack) > j {
+						out.WriteString("</" + stack[len(stack)-1] + ">")
+						stack = stack[:len(stack)-1]
+					}
+					break
+				}
+			}
+			out.WriteString("<" + tok.name + ">")
+			stack = append(stack, tok.name)
+		}
+	}
+	for len(stack) > 0 {
+		out.WriteString("</" + stack[len(stack)-1] + ">")
+		stack = stack[:len(stack)-1]
+	}
+	out.WriteString("\n")
+}
+
+// writeOFXText writes out leaf element text, escaping anything that would not be valid XML.
+func writeOFXText(out *bytes.Buffer, text string) {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '&':
+			if ofxEntityRe.MatchString(text[i:]) {
+				out.WriteByte('&')
+			} else {
+				out.WriteString("&amp;")
+			}
+		case '>':
+			out.WriteString("&gt;")
+		default:
+			out.WriteByte(text[i])
+		}
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+)
+
+// OFXServer is everything needed to sign on to a bank's OFX Direct Connect server. The values for a bank can
+// usually be found at ofxhome.com or in the settings of other finance programs.
+type OFXServer struct {
+	URL string
+	Org string
+	FID string
+
+	// Some servers only talk to clients they know, so these may need to be set to pretend to be one. The
+	// defaults are whatever ofxgo uses (Quicken 2017, OFX 2.03).
+	AppID   string
+	AppVer  string
+	Version string // The OFX version, such as "102" or "220".
+
+	User     string
+	Password string
+}
+
+// OFXRemoteAccount is an account to download statements for. Type is "checking", "savings", "moneymrkt",
+// "creditline", "cd", "creditcard", or "investment". For investment accounts BankID is the broker ID, and for
+// credit cards it is not used.
+type OFXRemoteAccount struct {
+	OFXAccount
+	Type string
+}
+
+// ErrOFXServer is returned by FetchOFX when the server answers with an error status.
+type ErrOFXServer struct {
+	Account string // The account ID, empty if signing on failed.
+	Code    int
+	Message string
+}
+
+func (err ErrOFXServer) Error() string {
+	if err.Account == "" {
+		return fmt.Sprintf("OFX server refused sign on (code %v): %v", err.Code, err.Message)
+	}
+	return fmt.Sprintf("OFX server returned an error for account %q (code %v): %v", err.Account, err.Code, err.Message)
+}
+
+// FetchOFX downloads statements for the accounts from the server, starting from the given date. If the server
+// speaks OFX 2.2 or newer pending transactions are asked for too. The raw response is returned, ready to pass to
+// ImportOFXAccounts.
+func FetchOFX(server OFXServer, accounts []OFXRemoteAccount, since time.Time) ([]byte, error) {
+	bc := &ofxgo.BasicClient{AppID: server.AppID, AppVer: server.AppVer}
+	if server.Version != "" {
+		v, err := ofxgo.NewOfxVersion(server.Version)
+		if err != nil {
+			return nil, err
+		}
+		bc.SpecVersion = v
+	}
+	client := ofxgo.GetClient(server.URL, bc)
+
+	req := ofxgo.Request{
+		URL: server.URL,
+		Signon: ofxgo.SignonRequest{
+			UserID:   ofxgo.String(server.User),
+			UserPass: ofxgo.String(server.Password),
+			Org:      ofxgo.String(server.Org),
+			Fid:      ofxgo.String(server.FID),
+		},
+	}
+	start := ofxgo.Date{Time: since}
+	pending := ofxgo.Boolean(bc.OfxVersion() >= ofxgo.OfxVersion220) // Only OFX 2.2 can ask for pending transactions.
+	uids := map[ofxgo.UID]string{}
+	for _, acct := range accounts {
+		uid, err := ofxgo.RandomUID()
+		if err != nil {
+			return nil, err
+		}
+		uids[*uid] = acct.AcctID
+
+		switch strings.ToLower(acct.Type) {
+		case "creditcard":
+			req.CreditCard = append(req.CreditCard, &ofxgo.CCStatementRequest{
+				TrnUID:         *uid,
+				CCAcctFrom:     ofxgo.CCAcct{AcctID: ofxgo.String(acct.AcctID)},
+				DtStart:        &start,
+				Include:        true,
+				IncludePending: pending,
+			})
+		case "investment":
+			req.InvStmt = append(req.InvStmt, &ofxgo.InvStatementRequest{
+				TrnUID:         *uid,
+				InvAcctFrom:    ofxgo.InvAcct{BrokerID: ofxgo.String(acct.BankID), AcctID: ofxgo.String(acct.AcctID)},
+				DtStart:        &start,
+				Include:        true,
+				IncludePos:     true,
+				IncludeBalance: true,
+			})
+		default:
+			typ, err := ofxgo.NewAcctType(strings.ToUpper(acct.Type))
+			if err != nil {
+				return nil, fmt.Errorf("Unknown OFX account type %q for account %q.", acct.Type, acct.AcctID)
+			}
+			req.Bank = append(req.Bank, &ofxgo.StatementRequest{
+				TrnUID: *uid,
+				BankAcctFrom: ofxgo.BankAcct{
+					BankID:   ofxgo.String(acct.BankID),
+					AcctID:   ofxgo.String(acct.AcctID),
+					AcctType: typ,
+				},
+				DtStart:        &start,
+				Include:        true,
+				IncludePending: pending,
+			})
+		}
+	}
+
+	resp, err := client.RequestNoParse(&req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse it once here so sign on and per account errors are reported as such, instead of as an empty file.
+	ofxd, err := ofxgo.ParseResponse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if ofxd.Signon.Status.Severity == "ERROR" {
+		return nil, ofxServerError("", &ofxd.Signon.Status)
+	}
+	for _, stmt := range ofxStatements(ofxd) {
+		var uid ofxgo.UID
+		var status *ofxgo.Status
+		switch s := stmt.(type) {
+		case *ofxgo.StatementResponse:
+			uid, status = s.TrnUID, &s.Status
+		case *ofxgo.CCStatementResponse:
+			uid, status = s.TrnUID, &s.Status
+		case *ofxgo.InvStatementResponse:
+			uid, status = s.TrnUID, &s.Status
+		}
+		if status != nil && status.Severity == "ERROR" {
+			// Error responses don't always say which account they are for, but they do have the request's UID.
+			return nil, ofxServerError(uids[uid], status)
+		}
+	}
+	return data, nil
+}
+
+func ofxServerError(acct string, status *ofxgo.Status) error {
+	msg := string(status.Message)
+	if msg == "" {
+		msg, _ = status.CodeMeaning()
+	}
+	return ErrOFXServer{Account: acct, Code: int(status.Code), Message: msg}
+}
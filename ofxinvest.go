@@ -0,0 +1,316 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/aclindsa/ofxgo"
+)
+
+// ofxSecurities maps security IDs (usually CUSIPs) to the ticker, for all the securities listed in the response.
+func ofxSecurities(ofxd *ofxgo.Response) map[string]string {
+	tickers := map[string]string{}
+	for _, msg := range ofxd.SecList {
+		list, ok := msg.(*ofxgo.SecurityList)
+		if !ok {
+			continue
+		}
+		for _, sec := range list.Securities {
+			var info ofxgo.SecInfo
+			switch s := sec.(type) {
+			case ofxgo.StockInfo:
+				info = s.SecInfo
+			case ofxgo.MFInfo:
+				info = s.SecInfo
+			case ofxgo.OptInfo:
+				info = s.SecInfo
+			case ofxgo.DebtInfo:
+				info = s.SecInfo
+			case ofxgo.OtherInfo:
+				info = s.SecInfo
+			default:
+				continue
+			}
+			if info.Ticker != "" {
+				tickers[string(info.SecID.UniqueID)] = string(info.Ticker)
+			}
+		}
+	}
+	return tickers
+}
+
+// ofxRat converts an OFX amount to a value.
+func ofxRat(r *big.Rat) (int64, error) {
+	return ParseValueNumber(r.FloatString(4))
+}
+
+// ofxUnits formats a number of units without trailing zeros.
+func ofxUnits(a ofxgo.Amount) string {
+	s := a.FloatString(6)
+	return strings.TrimRight(strings.TrimRight(s, "0"), ".")
+}
+
+// importOFXInvestment does the work of ImportOFX for investment statements. Amounts are only in dollars, so
+// holdings are valued at the price of each trade, with the number of units and the price kept in the posting note
+// (as "10 AAPL @ $150.00") and in the "Units", "UnitPrice", and "Security" KV pairs. Money that comes from or goes
+// to somewhere outside the account (income, fees, deposits) goes to the default account. Splits, security
+// transfers, journal entries between sub accounts, and option closures don't change any dollar amounts, so they
+// are left out.
+func (f *File) importOFXInvestment(stmt *ofxgo.InvStatementResponse, tickers map[string]string, result *ImportResult, descSrc OFXDescSrc, invAcct, defaultAcct, equityAcct string) error {
+	if stmt.InvTranList == nil {
+		return errNoOFXTransactions
+	}
+
+	seenIds := f.SeenFITIDs(invAcct)
+	cashAcct := invAcct + ":Cash"
+
+	// Common parts of every transaction, the caller adds the postings.
+	newTr := func(typ, action string, it *ofxgo.InvTran, secID ofxgo.SecurityID) Transaction {
+		security := tickers[string(secID.UniqueID)]
+		if security == "" {
+			security = string(secID.UniqueID)
+		}
+
+		desc := strings.TrimSpace(action + " " + security)
+		switch descSrc {
+		case OFXDescMemo:
+			if it.Memo != "" {
+				desc = string(it.Memo)
+			}
+		case OFXDescNameMemo:
+			desc = strings.TrimSpace(desc + " " + string(it.Memo))
+		}
+
+		tr := Transaction{
+			Description: desc,
+			Date:        it.DtTrade.Time,
+			Status:      StatusUndefined,
+			KVPairs: map[string]string{
+				"FITID":   string(it.FiTID),
+				"TrnTyp":  typ,
+				"Memo":    string(it.Memo),
+				"Account": invAcct,
+			},
+		}
+		if security != "" {
+			tr.KVPairs["Security"] = security
+		}
+		return tr
+	}
+
+	// A posting of units of a security at a price.
+	trade := func(tr *Transaction, units, price ofxgo.Amount) (int64, error) {
+		v, err := ofxRat(new(big.Rat).Mul(&units.Rat, &price.Rat))
+		if err != nil {
+			return 0, err
+		}
+		p, err := ofxRat(&price.Rat)
+		if err != nil {
+			return 0, err
+		}
+
+		security := tr.KVPairs["Security"]
+		tr.KVPairs["Units"] = ofxUnits(units)
+		tr.KVPairs["UnitPrice"] = FormatValueNumber(p)
+		tr.Postings = append(tr.Postings, Posting{
+			Account: invAcct + ":" + security,
+			Value:   v,
+			Note:    ofxUnits(units) + " " + security + " @ " + FormatValue(p),
+		})
+		return v, nil
+	}
+
+	var sum int64
+	found := 0
+	ltrns := []Transaction{}
+	add := func(tr Transaction, cash int64, other int64) {
+		found++
+		if cash != 0 {
+			tr.Postings = append(tr.Postings, Posting{Account: cashAcct, Value: cash})
+		}
+		// Whatever is left over (income, fees, commissions) goes to the default account.
+		if other != 0 {
+			tr.Postings = append(tr.Postings, Posting{Account: defaultAcct, Null: true})
+		}
+		sum += cash
+
+		result.record(invAcct, tr.Date, importedValue(&tr), seenIds[tr.KVPairs["FITID"]])
+		if !seenIds[tr.KVPairs["FITID"]] {
+			AssignIDs(f.ids(), &tr)
+			ltrns = append(ltrns, tr)
+		}
+	}
+
+	for _, itr := range stmt.InvTranList.InvTransactions {
+		var ib *ofxgo.InvBuy
+		var is *ofxgo.InvSell
+		switch t := itr.(type) {
+		case ofxgo.BuyStock:
+			ib = &t.InvBuy
+		case ofxgo.BuyMF:
+			ib = &t.InvBuy
+		case ofxgo.BuyDebt:
+			ib = &t.InvBuy
+		case ofxgo.BuyOpt:
+			ib = &t.InvBuy
+		case ofxgo.BuyOther:
+			ib = &t.InvBuy
+		case ofxgo.SellStock:
+			is = &t.InvSell
+		case ofxgo.SellMF:
+			is = &t.InvSell
+		case ofxgo.SellDebt:
+			is = &t.InvSell
+		case ofxgo.SellOpt:
+			is = &t.InvSell
+		case ofxgo.SellOther:
+			is = &t.InvSell
+
+		case ofxgo.Reinvest:
+			tr := newTr(t.TransactionType(), "Reinvest", &t.InvTran, t.SecID)
+			tr.KVPairs["IncomeType"] = t.IncomeType.String()
+			v, err := trade(&tr, t.Units, t.UnitPrice)
+			if err != nil {
+				return err
+			}
+			add(tr, 0, -v)
+			continue
+		case ofxgo.Income:
+			tr := newTr(t.TransactionType(), "Income", &t.InvTran, t.SecID)
+			tr.KVPairs["IncomeType"] = t.IncomeType.String()
+			v, err := ofxRat(&t.Total.Rat)
+			if err != nil {
+				return err
+			}
+			add(tr, v, -v)
+			continue
+		case ofxgo.RetOfCap:
+			tr := newTr(t.TransactionType(), "Return of Capital", &t.InvTran, t.SecID)
+			v, err := ofxRat(&t.Total.Rat)
+			if err != nil {
+				return err
+			}
+			tr.Postings = append(tr.Postings, Posting{Account: invAcct + ":" + tr.KVPairs["Security"], Value: -v})
+			add(tr, v, 0)
+			continue
+		case ofxgo.InvExpense:
+			tr := newTr(t.TransactionType(), "Expense", &t.InvTran, t.SecID)
+			v, err := ofxRat(&t.Total.Rat)
+			if err != nil {
+				return err
+			}
+			add(tr, v, -v)
+			continue
+		case ofxgo.MarginInterest:
+			tr := newTr(t.TransactionType(), "Margin Interest", &t.InvTran, ofxgo.SecurityID{})
+			v, err := ofxRat(&t.Total.Rat)
+			if err != nil {
+				return err
+			}
+			add(tr, v, -v)
+			continue
+		default:
+			continue
+		}
+
+		var tr Transaction
+		var units, price, total ofxgo.Amount
+		if ib != nil {
+			tr = newTr(itr.TransactionType(), "Buy", &ib.InvTran, ib.SecID)
+			units, price, total = ib.Units, ib.UnitPrice, ib.Total
+		} else {
+			tr = newTr(itr.TransactionType(), "Sell", &is.InvTran, is.SecID)
+			units, price, total = is.Units, is.UnitPrice, is.Total
+			if is.Gain.Sign() != 0 {
+				tr.KVPairs["Gain"] = ofxUnits(is.Gain)
+			}
+		}
+		v, err := trade(&tr, units, price)
+		if err != nil {
+			return err
+		}
+		cash, err := ofxRat(&total.Rat)
+		if err != nil {
+			return err
+		}
+		add(tr, cash, v+cash)
+	}
+
+	for _, btr := range stmt.InvTranList.BankTransactions {
+		for _, str := range btr.Transactions {
+			v, err := ParseValueNumber(str.TrnAmt.String())
+			if err != nil {
+				return err
+			}
+
+			desc := ""
+			switch descSrc {
+			case OFXDescName:
+				desc = string(str.Name)
+			case OFXDescMemo:
+				desc = string(str.Memo)
+			case OFXDescNameMemo:
+				desc = string(str.Name + str.Memo)
+			}
+
+			tr := Transaction{
+				Description: desc,
+				Date:        str.DtPosted.Time,
+				Status:      StatusUndefined,
+				KVPairs: map[string]string{
+					"FITID":   string(str.FiTID),
+					"TrnTyp":  str.TrnType.String(),
+					"Memo":    string(str.Memo),
+					"Name":    string(str.Name),
+					"Account": invAcct,
+				},
+			}
+			add(tr, v, -v)
+		}
+	}
+
+	if found == 0 {
+		return errNoOFXTransactions
+	}
+
+	if equityAcct != "" && stmt.InvBal != nil {
+		v, err := ofxRat(&stmt.InvBal.AvailCash.Rat)
+		if err != nil {
+			return err
+		}
+
+		first := stmt.DtAsOf.Time
+		for _, tr := range ltrns {
+			if tr.Date.Before(first) {
+				first = tr.Date
+			}
+		}
+
+		ltrns = f.addStatementBalances(ltrns, cashAcct, equityAcct, first, v-sum, stmt.DtAsOf.Time, v)
+	}
+
+	f.T = append(f.T, ltrns...)
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/samuellwn/ledger/parse"
+	"github.com/samuellwn/ledger/parse/lex"
+)
+
+func TestParseParallel(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	// Enough transactions to be split up, with directives that change how later transactions are read spread
+	// through the file, and a comment block that looks like transactions.
+	buf := &strings.Builder{}
+	buf.WriteString("commodity €\n\tformat 1.000,00 €\n\nalias Food=Expenses:Food\n\n")
+	for i := 0; i < 30000; i++ {
+		switch i {
+		case 5000:
+			buf.WriteString("Y2023\n\n")
+		case 10000:
+			buf.WriteString("comment\n\n2024/01/01 Not a transaction\n\nend comment\n\n")
+		case 15000:
+			buf.WriteString("account Assets:Checking\n\talias Bank\n\n")
+		}
+		fmt.Fprintf(buf, "%v/15 * Groceries %v\n\tFood  1.234,%02d €\n\tBank\n\n", i%12+1, i, i%100)
+	}
+	input := buf.String()
+
+	opts := parse.Options{KeepRaw: true, KeepComments: true, ExpandAliases: true, Year: 2022, Name: "big.ledger"}
+	want, err := parse.ParseLedgerWith(parse.NewCharReader(input, 1), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parse.ParseParallel(input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.T) != len(want.T) || len(got.D) != len(want.D) {
+		t.Fatalf("Expected %v transactions and %v directives, got %v and %v", len(want.T), len(want.D), len(got.T), len(got.D))
+	}
+	for i := range want.T {
+		if got.T[i].String() != want.T[i].String() || got.T[i].Location != want.T[i].Location {
+			t.Fatalf("Transaction %v is different:\n%v (%v)\n%v (%v)", i, want.T[i].String(), want.T[i].Location,
+				got.T[i].String(), got.T[i].Location)
+		}
+	}
+	for i := range want.D {
+		if !got.D[i].Compare(want.D[i]) || got.D[i].FoundBefore != want.D[i].FoundBefore {
+			t.Errorf("Directive %v is different: %#v", i, got.D[i])
+		}
+	}
+	if got.T[29999].Date.Year() != 2023 || got.T[29999].Postings[0].Account != "Expenses:Food" {
+		t.Errorf("Directives weren't applied to later chunks: %v", got.T[29999].String())
+	}
+
+	wbuf, gbuf := &bytes.Buffer{}, &bytes.Buffer{}
+	if want.Format(wbuf) != nil || got.Format(gbuf) != nil || wbuf.String() != gbuf.String() {
+		t.Errorf("Formatted output is different.")
+	}
+
+	// Errors in later chunks are still reported, with the right line.
+	_, err = parse.ParseParallel(input+"2024/01/02 (Broken\n", opts)
+	malformed, ok := err.(parse.ErrMalformed)
+	if !ok || lex.Location(malformed).Line() != uint64(strings.Count(input, "\n")+1) {
+		t.Errorf("Incorrect error: %v", err)
+	}
+}
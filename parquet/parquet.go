@@ -0,0 +1,95 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package parquet
+
+import (
+	"io"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// row is a single row of a parquet export, one per posting. Amounts are decimals with four places, so they are exact
+// and tools like DuckDB and pandas see them as numbers.
+type row struct {
+	Date        int32             `parquet:"name=date, type=INT32, convertedtype=DATE"`
+	Status      string            `parquet:"name=status, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Code        string            `parquet:"name=code, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Payee       string            `parquet:"name=payee, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Account     string            `parquet:"name=account, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Amount      int64             `parquet:"name=amount, type=INT64, convertedtype=DECIMAL, scale=4, precision=18"`
+	Commodity   string            `parquet:"name=commodity, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Note        string            `parquet:"name=note, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Tags        []string          `parquet:"name=tags, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	KV          map[string]string `parquet:"name=kv, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Transaction int64             `parquet:"name=transaction, type=INT64"`
+}
+
+// Export writes a Parquet file with one row for each posting selected by the query, in chronological order, for
+// loading into DuckDB, pandas, or BI tools. The columns are date, status, code, payee (the description), account,
+// amount (a decimal with four places), commodity, note, tags (a list), kv (a map of the k/v pairs), and
+// transaction (the index of the transaction in the file, so postings can be grouped back together). Amounts for
+// null postings are filled in.
+// Returns an error if any of the selected transactions do not balance.
+func Export(w io.Writer, f *ledger.File, q ledger.ReportQuery) error {
+	rows, err := f.Register(q)
+	if err != nil {
+		return err
+	}
+
+	pw, err := writer.NewParquetWriterFromWriter(w, new(row), 1)
+	if err != nil {
+		return err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	epoch := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, r := range rows {
+		tr := &f.T[r.T]
+		tags := maps.Keys(tr.Tags)
+		slices.Sort(tags)
+		y, m, d := r.Date.Date()
+
+		err := pw.Write(row{
+			Date:        int32(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(epoch).Hours() / 24),
+			Status:      tr.Postings[r.P].EffectiveStatus(tr).String(),
+			Code:        tr.Code,
+			Payee:       tr.Description,
+			Account:     r.Account,
+			Amount:      r.Amount,
+			Commodity:   "$",
+			Note:        tr.Postings[r.P].Note,
+			Tags:        tags,
+			KV:          tr.KVPairs,
+			Transaction: int64(r.T),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return pw.WriteStop()
+}
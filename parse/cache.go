@@ -0,0 +1,230 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package parse
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/samuellwn/ledger"
+)
+
+// cacheVersion must be changed whenever the parser or the ledger types change in a way that makes old cache files
+// wrong. Cache files from other versions are ignored.
+const cacheVersion = 2
+
+// Cache keeps binary copies of parsed ledger files in a directory, so loading a file that hasn't changed since the
+// last time skips the parser. A cached copy is used if the file has the same size and modification time as when it
+// was cached, or the same contents (by hash), and was parsed with the same options by the same version of the
+// parser. Otherwise the file is parsed and the cached copy replaced.
+//
+// The cache is only an optimization, so problems reading or writing cache files are ignored. The zero value is a
+// disabled cache, which always parses.
+//
+// Cache files are not encrypted, so don't use a cache for files that are.
+type Cache struct {
+	Dir string
+}
+
+// CacheFromEnv returns the cache set by the environment. LEDGER_CACHE is the directory to keep cache files in, if
+// it is not set the cache is disabled.
+func CacheFromEnv() Cache {
+	return Cache{Dir: os.Getenv("LEDGER_CACHE")}
+}
+
+// cacheHeader is the start of a cache file, which says what the cached copy was made from.
+type cacheHeader struct {
+	Version int
+	Options string
+	Size    int64
+	ModTime time.Time
+	Hash    [sha256.Size]byte
+}
+
+// cacheBody is the parsed file. Directive.Value is left out, since it can hold anything, and is filled in again
+// when the file is read back.
+type cacheBody struct {
+	T []ledger.Transaction
+	D []ledger.Directive
+}
+
+// Load is like the Load function, but uses the cache. Files that are not regular files are never cached.
+func (c Cache) Load(path string, opts Options) (*ledger.File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if f := c.Lookup(path, info, opts); f != nil {
+		return f, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.Parse(data, path, info, opts)
+}
+
+// Lookup returns the cached copy of the named file if the file hasn't changed size or modification time since it
+// was cached, or nil if there isn't one.
+func (c Cache) Lookup(name string, info os.FileInfo, opts Options) *ledger.File {
+	if c.Dir == "" || info == nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	return c.read(name, opts, func(h *cacheHeader) bool {
+		return h.Size == info.Size() && h.ModTime.Equal(info.ModTime())
+	})
+}
+
+// Parse parses the contents of the named file like Read, unless the cache has a copy of the same contents. Info may
+// be nil, if it isn't the cached copy also records the size and modification time for Lookup.
+func (c Cache) Parse(data []byte, name string, info os.FileInfo, opts Options) (*ledger.File, error) {
+	if c.Dir == "" || info != nil && !info.Mode().IsRegular() {
+		return Read(bytes.NewReader(data), name, opts)
+	}
+
+	hash := sha256.Sum256(data)
+	if f := c.read(name, opts, func(h *cacheHeader) bool { return h.Hash == hash }); f != nil {
+		return f, nil
+	}
+
+	f, err := Read(bytes.NewReader(data), name, opts)
+	if err != nil {
+		return nil, err
+	}
+	h := cacheHeader{Version: cacheVersion, Options: cacheOptions(name, opts), Hash: hash}
+	if info != nil {
+		h.Size, h.ModTime = info.Size(), info.ModTime()
+	}
+	c.write(name, opts, &h, f)
+	return f, nil
+}
+
+// cacheOptions returns the options in a form that can be compared. The year short dates default to is filled in,
+// so cached files are parsed again in a new year.
+func cacheOptions(name string, opts Options) string {
+	if opts.Year == 0 {
+		opts.Year = time.Now().Year()
+	}
+	if opts.Name == "" {
+		opts.Name = name
+	}
+	return fmt.Sprintf("%#v", opts)
+}
+
+// path returns the path of the cache file for a file parsed with the given options. Each file gets a cache file for
+// each set of options, so tools that use different options don't keep replacing each other's copies.
+func (c Cache) path(name string, opts Options) string {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		abs = name
+	}
+	key := sha256.Sum256([]byte(abs + "\x00" + cacheOptions(name, opts)))
+	return filepath.Join(c.Dir, hex.EncodeToString(key[:16])+".gob")
+}
+
+// read returns the cached copy of a file if there is one and its header matches, otherwise nil.
+func (c Cache) read(name string, opts Options, match func(h *cacheHeader) bool) *ledger.File {
+	r, err := os.Open(c.path(name, opts))
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+
+	dec := gob.NewDecoder(r)
+	h := cacheHeader{}
+	if dec.Decode(&h) != nil || h.Version != cacheVersion || h.Options != cacheOptions(name, opts) || !match(&h) {
+		return nil
+	}
+	body := cacheBody{}
+	if dec.Decode(&body) != nil {
+		return nil
+	}
+
+	// Restore everything that isn't saved. Empty maps come back as nil, but the parser always makes them.
+	for i := range body.T {
+		tr := &body.T[i]
+		if tr.Tags == nil {
+			tr.Tags = map[string]bool{}
+		}
+		if tr.KVPairs == nil {
+			tr.KVPairs = map[string]string{}
+		}
+		if tr.Raw != "" {
+			tr.SetRaw(tr.Raw)
+		}
+	}
+	for i := range body.D {
+		if body.D[i].Raw != "" {
+			body.D[i].SetRaw(body.D[i].Raw)
+		}
+		if body.D[i].Type != ";" {
+			body.D[i].SetValue()
+		}
+	}
+	if body.T == nil {
+		body.T = []ledger.Transaction{}
+	}
+	if body.D == nil {
+		body.D = []ledger.Directive{}
+	}
+	return &ledger.File{T: body.T, D: body.D}
+}
+
+// write saves a cached copy of a file. The copy is written to a temporary file first, so a reader never sees half
+// of one.
+func (c Cache) write(name string, opts Options, h *cacheHeader, f *ledger.File) {
+	body := cacheBody{T: f.T, D: make([]ledger.Directive, len(f.D))}
+	for i, d := range f.D {
+		d.Value = nil
+		body.D[i] = d
+	}
+
+	err := os.MkdirAll(c.Dir, 0700)
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(c.Dir, "cache-*")
+	if err != nil {
+		return
+	}
+	enc := gob.NewEncoder(tmp)
+	err = enc.Encode(h)
+	if err == nil {
+		err = enc.Encode(&body)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(name, opts))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
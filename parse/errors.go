@@ -42,6 +42,17 @@ func (err ErrBadAmount) Error() string {
 	return fmt.Sprintf("Amount value out of range on line: %v", lex.Location(err))
 }
 
+// ErrUnknownCommodity is returned by the parser when it finds an amount with a commodity symbol that hasn't been
+// declared. Only one currency is supported, but it may be written in any declared format.
+type ErrUnknownCommodity struct {
+	Symbol   string
+	Location lex.Location
+}
+
+func (err ErrUnknownCommodity) Error() string {
+	return fmt.Sprintf("Unknown commodity %q on line: %v", err.Symbol, err.Location)
+}
+
 // ErrUnexpectedEnd is returned by the parser when the end of input is found unexpectedly.
 type ErrUnexpectedEnd lex.Location
 
@@ -62,3 +73,10 @@ type ErrMalformedTagLine lex.Location
 func (err ErrMalformedTagLine) Error() string {
 	return fmt.Sprintf("Malformed tags in transaction on line: %v", lex.Location(err))
 }
+
+// ErrIncludeCycle is returned by ResolveIncludes when a file ends up including itself.
+type ErrIncludeCycle string
+
+func (err ErrIncludeCycle) Error() string {
+	return fmt.Sprintf("File includes itself: %v", string(err))
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/samuellwn/ledger"
+)
+
+// LoadAll is exactly like Load, except that included files are loaded as well, see ResolveIncludes. Returns the
+// paths of all the files that were loaded, starting with path itself.
+func LoadAll(path string, opts Options) (*ledger.File, []string, error) {
+	f, err := Load(path, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := ResolveIncludes(f, path, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, append([]string{path}, files...), nil
+}
+
+// ResolveIncludes loads the files named by any include directives in f (which was read from the file at path) and
+// splices their transactions and directives into f where the include directive was, so f looks like one big file.
+// The include directives themselves are kept. Includes are resolved recursively, relative paths are relative to the
+// directory of the file with the include directive, and globs are allowed, same as ledger. Returns the paths of all
+// the files that were loaded.
+func ResolveIncludes(f *ledger.File, path string, opts Options) ([]string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	err = resolveIncludes(f, abs, map[string]bool{abs: true}, &files, opts)
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func resolveIncludes(f *ledger.File, path string, parents map[string]bool, files *[]string, opts Options) error {
+	// Walk the directives backwards, so splicing in a file doesn't move the directives we still have to look at.
+	for i := len(f.D) - 1; i >= 0; i-- {
+		if f.D[i].Type != "include" {
+			continue
+		}
+
+		paths, err := includePaths(f.D[i].Argument, filepath.Dir(path))
+		if err != nil {
+			return &FileError{Name: path, Err: err}
+		}
+
+		// Load the files in reverse too, since each one is spliced in right after the include.
+		for j := len(paths) - 1; j >= 0; j-- {
+			if parents[paths[j]] {
+				return &FileError{Name: path, Err: ErrIncludeCycle(paths[j])}
+			}
+
+			inc, err := Load(paths[j], opts)
+			if err != nil {
+				return err
+			}
+			parents[paths[j]] = true
+			err = resolveIncludes(inc, paths[j], parents, files, opts)
+			delete(parents, paths[j])
+			if err != nil {
+				return err
+			}
+
+			splice(f, i, inc)
+		}
+
+		*files = append(*files, paths...)
+	}
+	return nil
+}
+
+// includePaths returns the absolute paths of the files named by the argument of an include directive.
+func includePaths(arg string, dir string) ([]string, error) {
+	arg = strings.TrimSpace(arg)
+	if strings.HasPrefix(arg, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		arg = filepath.Join(home, arg[2:])
+	}
+	if !filepath.IsAbs(arg) {
+		arg = filepath.Join(dir, arg)
+	}
+
+	if !strings.ContainsAny(arg, "*?[") {
+		return []string{arg}, nil
+	}
+	paths, err := filepath.Glob(arg)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, &os.PathError{Op: "include", Path: arg, Err: os.ErrNotExist}
+	}
+	return paths, nil
+}
+
+// splice inserts the contents of inc into f right after the directive at index d.
+func splice(f *ledger.File, d int, inc *ledger.File) {
+	at := f.D[d].FoundBefore
+
+	trs := make([]ledger.Transaction, 0, len(f.T)+len(inc.T))
+	trs = append(trs, f.T[:at]...)
+	trs = append(trs, inc.T...)
+	trs = append(trs, f.T[at:]...)
+
+	ds := make([]ledger.Directive, 0, len(f.D)+len(inc.D))
+	ds = append(ds, f.D[:d+1]...)
+	for _, dir := range inc.D {
+		dir.FoundBefore += at
+		ds = append(ds, dir)
+	}
+	for _, dir := range f.D[d+1:] {
+		dir.FoundBefore += len(inc.T)
+		ds = append(ds, dir)
+	}
+
+	f.T, f.D = trs, ds
+}
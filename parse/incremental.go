@@ -0,0 +1,136 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package parse
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/samuellwn/ledger"
+)
+
+// guardSize is how much of the file before the new data Incremental checks to make sure it was only added to.
+const guardSize = 4096
+
+// Incremental parses a file that grows over time, like a journal that transactions are appended to, without
+// parsing all of it again every time it changes. It remembers where it stopped and what the parser state was at
+// that point, so when the file has only had data added to the end just the new data (and the transaction before
+// it, which the new data might add postings to) is parsed.
+//
+// Only the bytes just before the new data are checked to make sure that the file was added to, not changed, so
+// don't use it for files that might be edited in place without changing their size. If the file got smaller, or
+// those bytes changed, the whole file is parsed again.
+type Incremental struct {
+	opts Options
+
+	done *ledger.File // Everything before offset, which won't be parsed again.
+	st   *parseState  // The parser state at offset.
+
+	offset int64  // Where the part of the file that still has to be parsed starts.
+	line   uint   // The line number at offset.
+	guard  []byte // The bytes just before offset.
+}
+
+// NewIncremental returns an incremental parser for a file, using the given options.
+func NewIncremental(opts Options) *Incremental {
+	inc := &Incremental{opts: opts}
+	inc.reset()
+	return inc
+}
+
+func (inc *Incremental) reset() {
+	inc.done = &ledger.File{T: []ledger.Transaction{}, D: []ledger.Directive{}}
+	inc.st = newParseState(inc.opts)
+	inc.offset, inc.line, inc.guard = 0, 1, nil
+}
+
+// Appended returns true if the file (with the given size) looks like it was only added to since the last call to
+// Load, so only the new data will be parsed.
+func (inc *Incremental) Appended(r io.ReaderAt, size int64) bool {
+	if size < inc.offset {
+		return false
+	}
+	guard := make([]byte, len(inc.guard))
+	_, err := r.ReadAt(guard, inc.offset-int64(len(guard)))
+	return err == nil && bytes.Equal(guard, inc.guard)
+}
+
+// Load parses the file, which has the given size, and returns all of it. The result is a copy, so it may be modified
+// without affecting later calls. Parse errors are reported the same way as for Read, and the next call starts over
+// from the same place.
+func (inc *Incremental) Load(r io.ReaderAt, size int64) (*ledger.File, error) {
+	if !inc.Appended(r, size) {
+		inc.reset()
+	}
+	data := make([]byte, size-inc.offset)
+	n, err := r.ReadAt(data, inc.offset)
+	if n < len(data) {
+		return nil, err
+	}
+
+	// Everything before the last transaction is done for good, but the last transaction has to be parsed again
+	// next time since whatever is added might belong to it. Big changes (like the first time) are parsed in parallel.
+	chunks := splitChunks(string(data), 0)
+	last := chunks[len(chunks)-1]
+	done, st, err := parseParallel(string(data[:len(data)-len(last.text)]), inc.line, inc.opts, inc.st.clone())
+	if err != nil {
+		return nil, inc.error(err)
+	}
+	pending, err := parseLedger(NewCharReader(last.text, inc.line+last.line-1), inc.opts, st.clone())
+	if err != nil {
+		return nil, inc.error(err)
+	}
+
+	appendFile(inc.done, done)
+	inc.st = st
+	inc.offset = size - int64(len(last.text))
+	inc.line += last.line - 1
+	inc.guard = nil
+	if inc.offset > 0 {
+		start := inc.offset - guardSize
+		if start < 0 {
+			start = 0
+		}
+		inc.guard = make([]byte, inc.offset-start)
+		_, err = r.ReadAt(inc.guard, start)
+		if err != nil {
+			// Start over next time.
+			inc.reset()
+		}
+	}
+
+	f := &ledger.File{
+		T: make([]ledger.Transaction, 0, len(inc.done.T)+len(pending.T)),
+		D: make([]ledger.Directive, 0, len(inc.done.D)+len(pending.D)),
+	}
+	appendFile(f, inc.done)
+	appendFile(f, pending)
+	return f, nil
+}
+
+func (inc *Incremental) error(err error) error {
+	if inc.opts.Name != "" {
+		return &FileError{Name: inc.opts.Name, Err: err}
+	}
+	return err
+}
@@ -43,6 +43,9 @@ type CharReader struct {
 	NL   Location
 	NC   rune
 	NEOF bool // true if current NC and NL are invalid, will be at end of input with next advance
+
+	recording bool
+	recorded  []rune
 }
 
 // NewCharReader returns a new CharReader with the input preadvanced so that all fields are valid.
@@ -120,6 +123,9 @@ func (cr *CharReader) Next() {
 	if cr.EOF {
 		return
 	}
+	if cr.recording {
+		cr.recorded = append(cr.recorded, cr.C)
+	}
 	if cr.NEOF {
 		cr.EOF = true
 		return
@@ -136,7 +142,6 @@ again:
 		cr.NEOF = true
 		return
 	}
-	cr.NL = cr.NL.CPlus()
 
 	// We simply strip carriage returns.
 	if cr.NC == '\r' {
@@ -145,10 +150,25 @@ again:
 		goto again
 	}
 
-	if cr.NC == '\n' {
-		cr.NL = cr.NL.LPlus().C(0)
+	// A newline is the last character of its line, the character after it starts the next line.
+	if cr.C == '\n' {
+		cr.NL = cr.NL.LPlus().C(1)
 		return
 	}
+	cr.NL = cr.NL.CPlus()
+}
+
+// StartRecording starts saving every character the reader advances past, beginning with the current one.
+func (cr *CharReader) StartRecording() {
+	cr.recording = true
+	cr.recorded = cr.recorded[:0]
+}
+
+// StopRecording stops saving characters and returns everything saved since StartRecording was called. Carriage
+// returns are not included, since the reader never returns them.
+func (cr *CharReader) StopRecording() string {
+	cr.recording = false
+	return string(cr.recorded)
 }
 
 // Eat the given characters until something else is found or EOF.
@@ -231,7 +251,7 @@ func (l Location) String() string {
 // L is a composite constructor for a location, setting the line part. If you pass in an integer that is too
 // large to fit the 48 bit storage area, 0 will be used instead.
 func (l Location) L(i uint64) Location {
-	if uint64(i)&0xffff000000000000 != 0 {
+	if i&0xffff000000000000 != 0 {
 		i = 0
 	}
 	l = l & 0xffff000000000000
@@ -239,12 +259,8 @@ func (l Location) L(i uint64) Location {
 	return l
 }
 
-// C is a composite constructor for a location, setting the column part. If you pass in an integer that is
-// too large to fit the 16 bit storage area, 0 will be used instead.
+// C is a composite constructor for a location, setting the column part.
 func (l Location) C(i uint16) Location {
-	if (uint64(i)<<48)&0x0000ffffffffffff != 0 {
-		i = 0
-	}
 	l = l & 0x0000ffffffffffff
 	l = l | (Location(i) << 48)
 	return l
@@ -257,9 +273,13 @@ func (l Location) LPlus() Location {
 	return l.L(i)
 }
 
-// CPlus increments the column portion of a Location and returns the result.
+// CPlus increments the column portion of a Location and returns the result. Columns past the 16 bit limit stay
+// at the limit instead of wrapping around.
 func (l Location) CPlus() Location {
 	i := l.Column()
+	if i == 0xffff {
+		return l
+	}
 	i++
 	return l.C(i)
 }
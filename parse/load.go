@@ -0,0 +1,74 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package parse
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/samuellwn/ledger"
+)
+
+// FileError wraps an error from loading a ledger file with the name of the file.
+type FileError struct {
+	Name string
+	Err  error
+}
+
+func (err *FileError) Error() string {
+	return fmt.Sprintf("%v: %v", err.Name, err.Err)
+}
+
+func (err *FileError) Unwrap() error {
+	return err.Err
+}
+
+// Read parses a ledger file from a reader, using the given options. If name is not empty any error is wrapped
+// in a *FileError with that name, and it is used for opts.Name unless that is already set. The whole file is read
+// into memory first, so big files can be parsed in parallel, see ParseParallel.
+func Read(r io.Reader, name string, opts Options) (*ledger.File, error) {
+	if opts.Name == "" {
+		opts.Name = name
+	}
+	var f *ledger.File
+	data, err := io.ReadAll(r)
+	if err == nil {
+		f, err = ParseParallel(string(data), opts)
+	}
+	if err != nil && name != "" {
+		return nil, &FileError{Name: name, Err: err}
+	}
+	return f, err
+}
+
+// Load parses the ledger file at the given path, using the given options. Parse errors are wrapped in a *FileError
+// with the path, and errors opening the file already include it.
+func Load(path string, opts Options) (*ledger.File, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return Read(r, path, opts)
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package parse
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/samuellwn/ledger"
+)
+
+// Files smaller than this aren't worth splitting up, see ParseParallel.
+const parallelMin = 1 << 20
+
+// ParseParallel parses a whole ledger file, same as ParseLedgerWith. Big files are split into chunks at blank lines
+// before transactions, the chunks are parsed by several goroutines, and the results are put back together in
+// order, so the result is exactly the same as parsing the file in one go. Small files are parsed the normal way.
+//
+// The directives that change how later transactions are read (commodity and D directives for amount formats, year
+// directives, and aliases) are read ahead of time, so each chunk starts out the same way it would have if the file
+// was parsed in order.
+func ParseParallel(input string, opts Options) (*ledger.File, error) {
+	f, _, err := parseParallel(input, 1, opts, newParseState(opts))
+	return f, err
+}
+
+// parseParallel does the work for ParseParallel, for input that starts on the given line with the given state. The
+// state at the end of the input is returned as well, st may or may not be changed.
+func parseParallel(input string, line uint, opts Options, st *parseState) (*ledger.File, *parseState, error) {
+	sequential := func() (*ledger.File, *parseState, error) {
+		f, err := parseLedger(NewCharReader(input, line), opts, st)
+		return f, st, err
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if len(input) < parallelMin || workers < 2 {
+		return sequential()
+	}
+	chunks := splitChunks(input, len(input)/(workers*4))
+	if len(chunks) < 2 {
+		return sequential()
+	}
+	for i := range chunks {
+		chunks[i].line += line - 1
+	}
+
+	// Work out what each chunk starts with from the directives in the chunks before it.
+	states := make([]*parseState, len(chunks))
+	next := st.clone()
+	for i, c := range chunks {
+		states[i] = next.clone()
+		if c.settings == "" {
+			continue
+		}
+		_, err := parseLedger(NewCharReader(c.settings, c.line), opts, next)
+		if err != nil {
+			// The chunk has a syntax error. Parsing in order reports it properly.
+			return sequential()
+		}
+	}
+
+	files := make([]*ledger.File, len(chunks))
+	errs := make([]error, len(chunks))
+	wg := sync.WaitGroup{}
+	limit := make(chan struct{}, workers)
+	for i := range chunks {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			files[i], errs[i] = parseLedger(NewCharReader(chunks[i].text, chunks[i].line), opts, states[i])
+			<-limit
+		}(i)
+	}
+	wg.Wait()
+
+	f := &ledger.File{T: []ledger.Transaction{}, D: []ledger.Directive{}}
+	for i, cf := range files {
+		if errs[i] != nil {
+			return nil, nil, errs[i]
+		}
+		appendFile(f, cf)
+	}
+	return f, next, nil
+}
+
+// appendFile adds the transactions and directives from src to the end of dst.
+func appendFile(dst, src *ledger.File) {
+	for _, d := range src.D {
+		d.FoundBefore += len(dst.T)
+		dst.D = append(dst.D, d)
+	}
+	dst.T = append(dst.T, src.T...)
+}
+
+// chunk is a piece of a file that can be parsed on its own.
+type chunk struct {
+	text string
+	line uint // The line number of the first line of text.
+
+	// The directives in the chunk that change how later transactions are read.
+	settings string
+}
+
+// splitChunks splits the input into chunks of about size bytes. Chunks only start at transactions (lines starting
+// with a digit) that come after a blank line, and never inside of a comment or test block, so each chunk can be
+// parsed by itself.
+func splitChunks(input string, size int) []chunk {
+	chunks := []chunk{}
+	current := chunk{line: 1}
+	start := 0
+	settings := &strings.Builder{}
+
+	line := uint(0)
+	blank := true  // The last line was empty.
+	open := false  // Indented lines belong to the last transaction or directive.
+	keep := false  // The last directive changes the parser state, so its lines are part of the settings.
+	endBlock := "" // The line that ends the block directive we are in.
+	for at := 0; at < len(input); {
+		end := strings.IndexByte(input[at:], '\n') + 1
+		if end == 0 {
+			end = len(input) - at
+		}
+		text := strings.TrimRight(input[at:at+end], "\r\n")
+		line++
+
+		switch {
+		case endBlock != "":
+			if strings.TrimSpace(text) == endBlock {
+				endBlock = ""
+			}
+			blank, open, keep = false, false, false
+
+		case strings.TrimSpace(text) == "":
+			if keep && text != "" {
+				// Directives keep lines that are only white space.
+				settings.WriteString(text + "\n")
+			}
+			blank = text == ""
+			if blank {
+				open, keep = false, false
+			}
+
+		case (text[0] == ' ' || text[0] == '\t') && open:
+			if keep {
+				settings.WriteString(text + "\n")
+			}
+			blank = false
+
+		default:
+			item := strings.TrimLeft(text, " \t")
+			if blank && item == text && item[0] >= '0' && item[0] <= '9' && at-start >= size {
+				current.text, current.settings = input[start:at], settings.String()
+				chunks = append(chunks, current)
+				current, start = chunk{line: line}, at
+				settings.Reset()
+			}
+
+			typ, _, _ := strings.Cut(item, " ")
+			blank, open, keep = false, item[0] != ';', settingsDirective(typ)
+			if keep {
+				settings.WriteString(item + "\n")
+			}
+			if ledger.BlockDirective(typ) {
+				endBlock, open = "end "+typ, false
+			}
+		}
+		at += end
+	}
+
+	current.text, current.settings = input[start:], settings.String()
+	return append(chunks, current)
+}
+
+// settingsDirective returns true for the directive types that change how the parser reads later transactions.
+func settingsDirective(typ string) bool {
+	switch typ {
+	case "commodity", "D", "year", "Y", "alias", "account":
+		return true
+	}
+	return len(typ) > 1 && typ[0] == 'Y' && strings.Trim(typ[1:], "0123456789") == ""
+}
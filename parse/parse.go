@@ -24,11 +24,15 @@ package parse
 
 import (
 	"io"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/samuellwn/ledger"
 	"github.com/samuellwn/ledger/parse/lex"
+	"golang.org/x/exp/maps"
 )
 
 /*
@@ -46,10 +50,107 @@ func ParseLedgerString(input string) (*ledger.File, error) {
 	return ParseLedger(lex.NewCharReader(input, 1))
 }
 
+// Options controls optional parser behavior. The zero value gives the default behavior.
+type Options struct {
+	// KeepRaw saves the source text of each transaction and directive so that File.Format can write out any
+	// that were not modified exactly as they were found.
+	KeepRaw bool
+
+	// KeepComments saves comments that are not part of a transaction as directives with the type ";", with each
+	// line of the comment (minus the leading semicolon) in Lines. Otherwise they are thrown away.
+	KeepComments bool
+
+	// Amount is the amount format used for files that don't declare one with a commodity or D directive. The zero
+	// value means ledger.DefaultAmountFormat. Amounts with a "$" are always read as dollars.
+	Amount ledger.AmountFormat
+
+	// ExpandAliases replaces account aliases in postings with the accounts they stand for, so reports see the full
+	// names. Aliases come from alias directives (alias CC=Liabilities:CreditCard) and alias lines in account
+	// directives, and apply from where they are declared on. Same as ledger, an alias matches the whole account
+	// name or its first part, so CC:Visa becomes Liabilities:CreditCard:Visa.
+	//
+	// The source text kept by KeepRaw still has the aliases, so they are written back out as they were. Set
+	// ResolveAliases as well to drop the source text of transactions that used aliases, so the full names are
+	// written out instead.
+	ExpandAliases  bool
+	ResolveAliases bool
+
+	// Year is used for short dates (03/15) until a year directive (year 2024, or Y2024) sets another year. The zero
+	// value means the current year, same as ledger.
+	Year int
+
+	// Name is the name of the file being parsed, recorded in the position of every transaction, posting, and
+	// directive. Read and Load set it to the name they are given.
+	Name string
+}
+
 // ParseLedger parses a ledger from a CharReader into a File.
 func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
+	return ParseLedgerWith(cr, Options{})
+}
+
+// ParseLedgerWith parses a ledger from a CharReader into a File, using the given options.
+func ParseLedgerWith(cr *lex.CharReader, opts Options) (*ledger.File, error) {
+	return parseLedger(cr, opts, newParseState(opts))
+}
+
+// parseState is what the parser remembers from the directives it has seen so far, which changes how later
+// transactions are read.
+type parseState struct {
+	formats *ledger.AmountFormats
+	year    int
+	aliases map[string]string
+
+	// Account names, payees, tags, and amounts repeat all through a file, so each one is only allocated once and
+	// then reused, see intern. The buffers are reused for reading them.
+	strings map[string]string
+	runes   []rune
+	bytes   []byte
+}
+
+func newParseState(opts Options) *parseState {
+	if opts.Amount.Decimal == 0 {
+		opts.Amount = ledger.DefaultAmountFormat
+	}
+	st := &parseState{
+		formats: ledger.NewAmountFormats(opts.Amount),
+		year:    opts.Year,
+		aliases: map[string]string{},
+		strings: map[string]string{},
+	}
+	if st.year == 0 {
+		st.year = time.Now().Year()
+	}
+	return st
+}
+
+func (st *parseState) clone() *parseState {
+	formats := *st.formats
+	formats.Commodities = maps.Clone(formats.Commodities)
+	return &parseState{formats: &formats, year: st.year, aliases: maps.Clone(st.aliases), strings: map[string]string{}}
+}
+
+// intern returns the runes as a string, the same string every time for the same runes.
+func (st *parseState) intern(r []rune) string {
+	st.bytes = st.bytes[:0]
+	for _, c := range r {
+		st.bytes = utf8.AppendRune(st.bytes, c)
+	}
+	// Looking up a converted byte slice doesn't allocate.
+	if s, ok := st.strings[string(st.bytes)]; ok {
+		return s
+	}
+	s := string(st.bytes)
+	st.strings[s] = s
+	return s
+}
+
+// parseLedger is ParseLedgerWith, starting from the given state instead of a fresh one. The state is updated by
+// any directives that are read.
+func parseLedger(cr *lex.CharReader, opts Options, st *parseState) (*ledger.File, error) {
 	transactions := []ledger.Transaction{}
 	directives := []ledger.Directive{}
+	formats, aliases := st.formats, st.aliases
 	for !cr.EOF {
 		// Eat any leading white space, also lines that are blank.
 		cr.Eat(" \t")
@@ -59,17 +160,47 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 		}
 
 		// Consume comments that are not part of the body of a transaction.
-		if cr.C == ';' {
+		if cr.C == ';' && !opts.KeepComments {
 			cr.EatUntil("\n")
 			cr.Next()
 			continue
 		}
+		if cr.C == ';' {
+			// Consecutive comment lines are kept together as a single directive.
+			current := ledger.Directive{
+				Type:        ";",
+				FoundBefore: len(transactions),
+				Location:    ledger.Position{File: opts.Name, Location: cr.L},
+			}
+			if opts.KeepRaw {
+				cr.StartRecording()
+			}
 
-		if !(cr.Match("0123456789") && cr.NMatch("0123456789")) {
+			for !cr.EOF && cr.C == ';' {
+				cr.Next()
+				line := []rune{}
+				if !cr.EOF && cr.C != '\n' {
+					line = cr.ReadUntil("\n", line)
+				}
+				current.Lines = append(current.Lines, strings.TrimRight(string(line), " \t"))
+				cr.Next()
+			}
+
+			if opts.KeepRaw {
+				current.SetRaw(cr.StopRecording())
+			}
+			directives = append(directives, current)
+			continue
+		}
+
+		if !(cr.Match("0123456789") && cr.NMatch("0123456789/-.")) {
 			// The start of this line doesn't look like a date, so it must be a directive.
 			current := ledger.Directive{
 				FoundBefore: len(transactions),
-				Location:    cr.L,
+				Location:    ledger.Position{File: opts.Name, Location: cr.L},
+			}
+			if opts.KeepRaw {
+				cr.StartRecording()
 			}
 
 			typ, err := ReadUntilTrimmed(cr, " \n")
@@ -77,31 +208,65 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 				return nil, err
 			}
 			current.Type = typ
+			if len(typ) > 1 && typ[0] == 'Y' && strings.Trim(typ[1:], "0123456789") == "" {
+				// Y2024 is the same as Y 2024.
+				current.Type, current.Argument = "Y", typ[1:]
+			}
 
-			if cr.NC != '\n' {
-				arg, err := ReadUntilTrimmed(cr, "\n")
+			if ledger.BlockDirective(current.Type) {
+				err = readBlock(cr, &current)
 				if err != nil {
 					return nil, err
 				}
-				cr.Next()
-				current.Argument = arg
-			}
-
-			for cr.Match(" \t") {
-				cr.Eat(" \t")
-				if cr.EOF {
-					return nil, ErrUnexpectedEnd(cr.L)
+			} else {
+				if cr.C == '\n' {
+					// The type was the whole line (or it had the argument built in, like Y2024).
+					cr.Next()
+				} else if cr.NC != '\n' {
+					arg, err := ReadUntilTrimmed(cr, "\n")
+					if err != nil {
+						return nil, err
+					}
+					cr.Next()
+					current.Argument = arg
 				}
 
-				line, err := ReadUntilTrimmed(cr, "\n")
-				if err != nil {
-					return nil, err
+				for cr.Match(" \t") {
+					cr.Eat(" \t")
+					if cr.EOF {
+						return nil, ErrUnexpectedEnd(cr.L)
+					}
+
+					line, err := ReadUntilTrimmed(cr, "\n")
+					if err != nil {
+						return nil, err
+					}
+					cr.Next()
+
+					current.Lines = append(current.Lines, line)
 				}
-				cr.Next()
+			}
 
-				current.Lines = append(current.Lines, line)
+			if opts.KeepRaw {
+				current.SetRaw(cr.StopRecording())
+			}
+			current.SetValue()
+			switch v := current.Value.(type) {
+			case *ledger.YearDirective:
+				st.year = v.Year
+			case *ledger.AliasDirective:
+				aliases[v.Name] = v.Account
+			case *ledger.AccountDirective:
+				for _, alias := range v.Aliases {
+					aliases[alias] = v.Name
+				}
 			}
 
+			// Formats apply from where they are declared on.
+			err = formats.AddDirective(&current)
+			if err != nil {
+				return nil, ErrMalformed(current.Location.Location)
+			}
 			directives = append(directives, current)
 			continue
 		}
@@ -111,18 +276,21 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 		current := ledger.Transaction{
 			Tags:     map[string]bool{},
 			KVPairs:  map[string]string{},
-			Location: cr.L,
+			Location: ledger.Position{File: opts.Name, Location: cr.L},
+		}
+		if opts.KeepRaw {
+			cr.StartRecording()
 		}
 
 		// Parse the leading dates(s)
-		date, err := ParseDate(cr)
+		date, err := ParseDateIn(cr, st.year)
 		if err != nil {
 			return nil, err
 		}
 		current.Date = date
 		if cr.C == '=' {
 			cr.Next()
-			date, err := ParseDate(cr)
+			date, err := ParseDateIn(cr, st.year)
 			if err != nil {
 				return nil, err
 			}
@@ -135,50 +303,73 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 			return nil, ErrUnexpectedEnd(cr.L)
 		}
 
-		// The optional cleared indicator
-		if cr.C == '*' {
-			current.Status = ledger.StatusClear
-			cr.Next()
-		} else if cr.C == '!' {
-			current.Status = ledger.StatusPending
-			cr.Next()
-		} else {
-			current.Status = ledger.StatusUndefined
+		// An optional time of day. A description that starts with a number can't be told apart from a time until
+		// it has been read, so if it isn't a time it goes back on the front of the description.
+		lead := ""
+		if cr.Match("0123456789") {
+			clock := string(cr.ReadMatch("0123456789:", nil))
+			if tod, ok := parseTimeOfDay(clock); ok && cr.Match(" \t\n") {
+				current.Date = current.Date.Add(tod)
+				current.HasTime = true
+				cr.Eat(" \t")
+				if cr.EOF {
+					return nil, ErrUnexpectedEnd(cr.L)
+				}
+			} else {
+				lead = clock
+			}
 		}
 
-		// Maybe more whitespace (only if there was a cleared indicator)
-		cr.Eat(" \t")
-		if cr.EOF {
-			return nil, ErrUnexpectedEnd(cr.L)
-		}
+		if lead == "" {
+			// The optional cleared indicator
+			if cr.C == '*' {
+				current.Status = ledger.StatusClear
+				cr.Next()
+			} else if cr.C == '!' {
+				current.Status = ledger.StatusPending
+				cr.Next()
+			} else {
+				current.Status = ledger.StatusUndefined
+			}
 
-		// An optional "code"
-		if cr.C == '(' {
-			cr.Next()
+			// Maybe more whitespace (only if there was a cleared indicator)
 			cr.Eat(" \t")
-			desc, err := ReadUntilTrimmed(cr, ")\n")
-			if err != nil {
-				return nil, err
+			if cr.EOF {
+				return nil, ErrUnexpectedEnd(cr.L)
 			}
-			if cr.C == '\n' {
-				return nil, ErrMalformed(cr.L)
+
+			// An optional "code"
+			if cr.C == '(' {
+				cr.Next()
+				cr.Eat(" \t")
+				desc, err := ReadUntilTrimmed(cr, ")\n")
+				if err != nil {
+					return nil, err
+				}
+				if cr.C == '\n' {
+					return nil, ErrMalformed(cr.L)
+				}
+				current.Code = desc
+				cr.Next()
 			}
-			current.Code = desc
-			cr.Next()
 		}
 
 		// Even more ws
+		if lead != "" && cr.Match(" \t") {
+			lead += " "
+		}
 		cr.Eat(" \t")
 		if cr.EOF {
 			return nil, ErrUnexpectedEnd(cr.L)
 		}
 
 		// And, to cap the first line off, the description.
-		desc, err := ReadUntilTrimmed(cr, "\n")
-		if err != nil {
-			return nil, err
+		st.runes = append(st.runes[:0], []rune(lead)...)
+		st.runes = cr.ReadUntil("\n", st.runes)
+		if cr.EOF {
+			return nil, ErrUnexpectedEnd(cr.L)
 		}
-		current.Description = desc
+		current.Description = st.intern(trimRunes(st.runes))
 		cr.Next()
 
 		// Now parse the individual postings or comment lines.
@@ -198,7 +389,7 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 				}
 
 				// OK, we are going to read the line into a buffer, trying to look for patterns as we go.
-				ln := []rune{}
+				ln := st.runes[:0]
 				key := ""
 
 				// 0: Starting.
@@ -232,7 +423,7 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 					// Found a leading colon, read tags.
 					if state == 1 {
 						if cr.C == ':' {
-							tag := strings.TrimSpace(string(ln))
+							tag := st.intern(trimRunes(ln))
 							if tag != "" {
 								current.Tags[tag] = true
 								ln = ln[:0]
@@ -258,7 +449,7 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 						if cr.C == ':' {
 							if cr.NMatch(" \t") {
 								// Dump ln and save aside as the key.
-								key = string(ln)
+								key = st.intern(ln)
 								ln = ln[:0]
 
 								// Get ready to read value.
@@ -320,6 +511,7 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 					continue
 				}
 				cr.Next()
+				st.runes = ln
 
 				if state == 1 {
 					for _, c := range ln {
@@ -344,7 +536,7 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 			}
 
 			// Otherwise must be a actual posting
-			post := ledger.Posting{}
+			post := ledger.Posting{Location: current.Location.At(cr.L)}
 
 			// The optional cleared indicator, TBH I didn't even know this was a thing until I looked at the spec.
 			if cr.C == '*' {
@@ -368,7 +560,7 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 			// I am going to allow spaces in account names, but only one in a row. Two or more spaces or a tab
 			// ends the name.
 
-			buf := []rune{}
+			buf := st.runes[:0]
 			for {
 				if cr.C == '\t' || cr.C == '\n' || (cr.C == ' ' && cr.NC == ' ') {
 					break
@@ -383,17 +575,22 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 			if len(buf) == 0 {
 				return nil, ErrMalformed(cr.L)
 			}
-			post.Account = string(buf)
+			post.Account = st.intern(buf)
+			st.runes = buf
 
 			cr.Eat(" \t")
 			if cr.EOF {
 				return nil, ErrUnexpectedEnd(cr.L)
 			}
 
-			post.Value, post.Null, err = ReadAmount(cr)
+			amount, symbol := ledger.Amount{}, ""
+			post.Value, amount, symbol, post.Null, err = readAmount(cr, formats, st)
 			if err != nil {
 				return nil, err
 			}
+			if amount.Scale() > ledger.ValueScale {
+				post.Amount, post.Commodity = amount, symbol
+			}
 
 			cr.Eat(" \t")
 			if cr.EOF {
@@ -413,7 +610,7 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 
 				post.HasAssert = true
 				null := false
-				post.Assert, null, err = ReadAmount(cr)
+				post.Assert, _, _, null, err = readAmount(cr, formats, st)
 				if err != nil {
 					return nil, err
 				}
@@ -436,6 +633,9 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 				}
 				cr.Next()
 				post.Note = line
+				if date, aux, note, ok := parseNoteDates(line, st.year); ok {
+					post.Date, post.AuxDate, post.Note = date, aux, note
+				}
 				current.Postings = append(current.Postings, post)
 				continue
 			}
@@ -453,76 +653,90 @@ func ParseLedger(cr *lex.CharReader) (*ledger.File, error) {
 			current.Postings = append(current.Postings, post)
 		}
 
+		expanded := false
+		if opts.ExpandAliases {
+			for i := range current.Postings {
+				if account, ok := expandAlias(aliases, current.Postings[i].Account); ok {
+					current.Postings[i].Account = account
+					expanded = true
+				}
+			}
+		}
+
+		if opts.KeepRaw {
+			raw := cr.StopRecording()
+			if !expanded || !opts.ResolveAliases {
+				current.SetRaw(raw)
+			}
+		}
 		transactions = append(transactions, current)
 	}
 
 	return &ledger.File{T: transactions, D: directives}, nil
 }
 
+// ReadAmount reads an amount in the default format, see ReadAmountWith.
 func ReadAmount(cr *lex.CharReader) (v int64, null bool, err error) {
-	// Read the amount. Currently only supporting USD with or without the leading $
-	if cr.C == '$' {
-		cr.Next()
+	return ReadAmountWith(cr, ledger.NewAmountFormats(ledger.DefaultAmountFormat))
+}
 
-		// Just in case...
-		cr.Eat(" \t")
-		if cr.EOF {
-			return 0, false, ErrUnexpectedEnd(cr.L)
-		}
-	}
+// ReadAmountWith reads an amount, using the given formats to make sense of it (see ledger.AmountFormats.ParseAmount).
+// The amount ends at a newline, comment, balance assertion, tab, or two spaces in a row. If there is no amount at all
+// null is true. Amounts in commodities with more decimal places than a posting value has are rounded.
+func ReadAmountWith(cr *lex.CharReader, formats *ledger.AmountFormats) (v int64, null bool, err error) {
+	v, _, _, null, err = readAmount(cr, formats, nil)
+	return v, null, err
+}
 
-	neg := false
-	if cr.C == '-' {
+// readAmount is ReadAmountWith, using the buffers and strings of the parser state if it isn't nil. The exact amount
+// is also returned, along with the symbol of its commodity.
+func readAmount(cr *lex.CharReader, formats *ledger.AmountFormats, st *parseState) (v int64, a ledger.Amount, symbol string, null bool, err error) {
+	l := cr.L
+	buf := []rune{}
+	if st != nil {
+		buf = st.runes[:0]
+	}
+	for !cr.EOF && !cr.Match("\n;=\t") && !(cr.C == ' ' && cr.NC == ' ') {
+		buf = append(buf, cr.C)
 		cr.Next()
-		neg = true
+	}
+	if cr.EOF {
+		return 0, a, "", false, ErrUnexpectedEnd(cr.L)
 	}
 
-	// Read the numeric part of the amount
-	// This is probably shitty, and maybe wrong, but I hope not. I 1000% need to write tests for this.
-	whole := int64(0)
-	part := int64(0)
-	cur := &whole
-	null = true
-	for cr.MatchNumeric() || cr.C == '.' || cr.C == ',' {
-		if cr.C == '.' {
-			if cur == &part || null == true {
-				return 0, false, ErrBadAmount(cr.L)
-			}
-			cr.Next()
-			cur = &part
-			continue
-		}
-		if cr.C == ',' {
-			cr.Next()
-			continue
-		}
+	amount := ""
+	if st != nil {
+		st.runes = buf
+		amount = st.intern(trimRunes(buf))
+	} else {
+		amount = string(trimRunes(buf))
+	}
+	if amount == "" {
+		return 0, a, "", true, nil
+	}
+	a, symbol, err = formats.ParseAmount(amount)
+	if uc, ok := err.(ledger.ErrUnknownCommodity); ok {
+		return 0, a, "", false, ErrUnknownCommodity{uc.Symbol, l}
+	}
+	if err != nil {
+		return 0, a, "", false, ErrBadAmount(l)
+	}
+	v, ok := a.Value()
+	if !ok {
+		return 0, a, "", false, ErrBadAmount(l)
+	}
+	return v, a, symbol, false, nil
+}
 
-		*cur = *cur*10 + int64(cr.C-'0')
-		null = false
-		cr.Next()
-		if cr.EOF {
-			return 0, false, ErrUnexpectedEnd(cr.L)
-		}
+// trimRunes returns the runes with white space trimmed from both ends, same as strings.TrimSpace.
+func trimRunes(r []rune) []rune {
+	for len(r) > 0 && unicode.IsSpace(r[0]) {
+		r = r[1:]
 	}
-	if !null {
-		whole = whole * 10000
-		if part > 9999 {
-			return 0, false, ErrBadAmount(cr.L)
-		}
-		switch {
-		case part < 9:
-			part = part * 1000
-		case part < 99:
-			part = part * 100
-		case part < 9999:
-			part = part * 10
-		}
-		v = whole + part
-		if neg {
-			v = -v
-		}
+	for len(r) > 0 && unicode.IsSpace(r[len(r)-1]) {
+		r = r[:len(r)-1]
 	}
-	return v, null, nil
+	return r
 }
 
 // ReadUntilTrimmed reads characters from the CharReader until one of the characters in `chars` is found.
@@ -550,49 +764,156 @@ func ReadUntilTrimmed(cr *lex.CharReader, chars string) (string, error) {
 	return string(ln), nil
 }
 
-// ParseDate reads a date (in yyyy/mm/dd format) from the CharReader.
+// ParseDate reads a date (in yyyy/mm/dd format) from the CharReader. The separators may also be "-" or ".".
 func ParseDate(cr *lex.CharReader) (time.Time, error) {
-	date := []rune{}
-	ok := false
+	return ParseDateIn(cr, 0)
+}
+
+// ParseDateIn is exactly like ParseDate, but if year is not 0 short dates that leave out the year (mm/dd, the month
+// and day may be a single digit) are also allowed, and are taken to be in that year. Same as ledger.
+func ParseDateIn(cr *lex.CharReader, year int) (time.Time, error) {
 	var t time.Time
+	l := cr.L
 
-	ok, date = cr.ReadMatchLimit("0123456789", date, 4)
-	if !ok {
+	first, err := readDatePart(cr, 4)
+	if err != nil {
+		return t, err
+	}
+	if !cr.Match("/-.") {
 		return t, ErrBadDate(cr.L)
 	}
-	if cr.EOF {
-		return t, ErrUnexpectedEnd(cr.L)
+	cr.Next()
+	second, err := readDatePart(cr, 2)
+	if err != nil {
+		return t, err
 	}
 
 	if !cr.Match("/-.") {
-		return t, ErrBadDate(cr.L)
+		if year == 0 || len(first) > 2 {
+			return t, ErrBadDate(cr.L)
+		}
+		month, _ := strconv.Atoi(first)
+		day, _ := strconv.Atoi(second)
+		t = time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if int(t.Month()) != month || t.Day() != day {
+			return time.Time{}, ErrBadDate(l)
+		}
+		return t, nil
 	}
-	date = append(date, '/')
 	cr.Next()
+	third, err := readDatePart(cr, 2)
+	if err != nil {
+		return t, err
+	}
 
-	ok, date = cr.ReadMatchLimit("0123456789", date, 2)
-	if !ok {
-		return t, ErrBadDate(cr.L)
+	if len(first) != 4 || len(second) != 2 || len(third) != 2 {
+		return t, ErrBadDate(l)
 	}
-	if cr.EOF {
-		return t, ErrUnexpectedEnd(cr.L)
+	return time.Parse("2006/01/02", first+"/"+second+"/"+third)
+}
+
+// readBlock reads the rest of a block directive (see ledger.BlockDirective), everything up to the matching end line.
+// The lines are kept exactly as they are.
+func readBlock(cr *lex.CharReader, d *ledger.Directive) error {
+	if cr.C != '\n' {
+		d.Argument = strings.TrimSpace(string(cr.ReadUntil("\n", nil)))
 	}
+	for {
+		if cr.EOF {
+			return ErrUnexpectedEnd(cr.L)
+		}
+		cr.Next()
+		if cr.EOF {
+			return ErrUnexpectedEnd(cr.L)
+		}
 
-	if !cr.Match("/-.") {
-		return t, ErrBadDate(cr.L)
+		line := string(cr.ReadUntil("\n", nil))
+		if strings.TrimSpace(line) == "end "+d.Type {
+			if !cr.EOF {
+				cr.Next()
+			}
+			return nil
+		}
+		d.Lines = append(d.Lines, line)
 	}
-	date = append(date, '/')
-	cr.Next()
+}
 
-	ok, date = cr.ReadMatchLimit("0123456789", date, 2)
-	if !ok {
-		return t, ErrBadDate(cr.L)
+// expandAlias returns the account an alias stands for, see Options.ExpandAliases. Returns false if the account
+// isn't an alias.
+func expandAlias(aliases map[string]string, account string) (string, bool) {
+	if full, ok := aliases[account]; ok {
+		return full, true
 	}
-	if cr.EOF {
-		return t, ErrUnexpectedEnd(cr.L)
+	first, rest, ok := strings.Cut(account, ":")
+	if full, found := aliases[first]; ok && found {
+		return full + ":" + rest, true
+	}
+	return account, false
+}
+
+// parseNoteDates reads the posting dates from the start of a posting note, "[DATE]", "[=AUXDATE]", or
+// "[DATE=AUXDATE]", and returns them along with the rest of the note. Returns false if the note doesn't start with
+// dates, so notes that just happen to start with a bracket are left alone.
+func parseNoteDates(note string, year int) (date, aux time.Time, rest string, ok bool) {
+	if !strings.HasPrefix(note, "[") {
+		return
+	}
+	end := strings.IndexRune(note, ']')
+	if end == -1 {
+		return
+	}
+
+	// The dates are read up to the closing bracket, which also stops the date reader from hitting the end.
+	cr := NewCharReader(note[1:end+1], 1)
+	var err error
+	if cr.C != '=' {
+		date, err = ParseDateIn(cr, year)
+		if err != nil {
+			return
+		}
+	}
+	if cr.C == '=' {
+		cr.Next()
+		aux, err = ParseDateIn(cr, year)
+		if err != nil {
+			return
+		}
+	}
+	if cr.C != ']' || date.IsZero() && aux.IsZero() {
+		return
+	}
+	return date, aux, strings.TrimSpace(note[end+1:]), true
+}
+
+// parseTimeOfDay parses a time of day, HH:MM or HH:MM:SS (the hour may be a single digit), into the time since
+// midnight.
+func parseTimeOfDay(s string) (time.Duration, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || len(parts[0]) < 1 || len(parts[0]) > 2 {
+		return 0, false
+	}
+	limits := []int{24, 60, 60}
+	d := time.Duration(0)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || i > 0 && len(part) != 2 || n >= limits[i] {
+			return 0, false
+		}
+		d += time.Duration(n) * []time.Duration{time.Hour, time.Minute, time.Second}[i]
 	}
+	return d, true
+}
 
-	return time.Parse("2006/01/02", string(date))
+// readDatePart reads one to limit digits of a date.
+func readDatePart(cr *lex.CharReader, limit int) (string, error) {
+	ok, part := cr.ReadMatchLimit("0123456789", nil, limit)
+	if cr.EOF {
+		return "", ErrUnexpectedEnd(cr.L)
+	}
+	if !ok && len(part) == 0 {
+		return "", ErrBadDate(cr.L)
+	}
+	return string(part), nil
 }
 
 // NewCharReader returns a new lex.CharReader with the input preadvanced so that all fields are valid.
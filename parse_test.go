@@ -0,0 +1,73 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/samuellwn/ledger/parse"
+)
+
+// benchJournal returns a journal with n transactions that look like a real one: a small set of payees and accounts
+// used over and over, IDs, and tags.
+func benchJournal(n int) string {
+	payees := []string{"Grocery Store", "Gas Station", "Coffee Shop", "Electric Company", "Landlord", "Restaurant"}
+	accounts := []string{"Expenses:Food:Groceries", "Expenses:Auto:Gas", "Expenses:Food:Coffee", "Expenses:Utilities",
+		"Expenses:Rent", "Expenses:Food:Dining"}
+
+	buf := &strings.Builder{}
+	for i := 0; i < n; i++ {
+		j := i % len(payees)
+		fmt.Fprintf(buf, "2024/%02d/%02d * %v\n\t; :imported:\n\t; ID: %08x\n\t; RID: %08x\n", i%12+1, i%28+1, payees[j], i, i)
+		fmt.Fprintf(buf, "\t%v  $%v.%02d\n\tAssets:Checking\n\n", accounts[j], i%500, i%100)
+	}
+	return buf.String()
+}
+
+func BenchmarkParseLedger(b *testing.B) {
+	input := benchJournal(10000)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := parse.ParseLedgerWith(parse.NewCharReader(input, 1), parse.Options{})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseParallel(b *testing.B) {
+	input := benchJournal(40000)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := parse.ParseParallel(input, parse.Options{})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"regexp"
+)
+
+// PayeeChange is a transaction description that File.PayeeChanges would replace.
+type PayeeChange struct {
+	T    int    // The index of the transaction in File.T.
+	From string // The description now.
+	To   string // The payee name it should be.
+}
+
+// PayeeChanges finds the latest revisions of transactions whose descriptions don't use the normalized payee name,
+// in file order. A transaction with a "UUID" k/v pair matching the uuid line of a payee directive gets that payee.
+// Otherwise the alias lines of the payee directives (regexps for the description) are tried in order, and then
+// any of the given matchers (such as from a match file) that set a payee. Amount conditions of the matchers are
+// checked against the total amount the transaction moves, since there is no account to check them against.
+// Returns an error if one of the aliases isn't a valid regexp.
+func (f *File) PayeeChanges(matchers []Matcher) ([]PayeeChange, error) {
+	payees, err := f.Payees()
+	if err != nil {
+		return nil, err
+	}
+
+	// UUIDs are exact, so they go before all the aliases.
+	uuids, aliases := []Matcher{}, []Matcher{}
+	for _, p := range payees {
+		for _, uuid := range p.Uuids {
+			if uuid != "" {
+				uuids = append(uuids, Matcher{UUID: uuid, Payee: p.Name})
+			}
+		}
+		for _, alias := range p.Aliases {
+			re, err := regexp.Compile(alias)
+			if err != nil {
+				return nil, err
+			}
+			aliases = append(aliases, Matcher{R: re, Payee: p.Name})
+		}
+	}
+	aliases = append(uuids, aliases...)
+	for _, m := range matchers {
+		if m.Payee != "" {
+			aliases = append(aliases, m)
+		}
+	}
+
+	changes := []PayeeChange{}
+	for _, i := range f.latestRevisions() {
+		tr := &f.T[i]
+
+		name, ok := "", false
+		amount := transactionAmount(tr)
+		for _, m := range aliases {
+			if m.matches(tr.Description, tr.KVPairs) && m.matchConditions(tr.Date, amount) {
+				name, ok = m.Payee, true
+				break
+			}
+		}
+		if ok && name != tr.Description {
+			changes = append(changes, PayeeChange{T: i, From: tr.Description, To: name})
+		}
+	}
+	return changes, nil
+}
+
+// NormalizePayees replaces transaction descriptions with the payee names found by File.PayeeChanges, so that
+// "AMZN Mktp US*1234" and "Amazon.com" both become "Amazon". Transactions with an ID get a new revision (with a new
+// RID) so the change syncs like any other edit, transactions without one are changed in place. Returns the changes
+// that were made, with T set to the index of the changed transaction.
+func (f *File) NormalizePayees(matchers []Matcher) ([]PayeeChange, error) {
+	changes, err := f.PayeeChanges(matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	for c := range changes {
+		i := changes[c].T
+		if f.T[i].KVPairs["ID"] == "" {
+			f.T[i].Description = changes[c].To
+			continue
+		}
+
+		tr := f.T[i].CleanCopy()
+		tr.Description = changes[c].To
+		err := f.AppendEdit(*tr)
+		if err != nil {
+			return nil, err
+		}
+		changes[c].T = len(f.T) - 1
+	}
+	return changes, nil
+}
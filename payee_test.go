@@ -0,0 +1,144 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+func TestNormalizePayees(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+payee Amazon
+	alias ^AMZN
+	alias (?i)amazon\.com
+
+payee Landlord
+	uuid 1234
+
+2022/01/05 * AMZN Mktp US*1234
+	; ID: a1
+	; RID: r1
+	Expenses:Shopping             $25.00
+	Assets:Checking
+
+2022/01/06 * AMAZON.COM
+	Expenses:Shopping              $5.00
+	Assets:Checking
+
+2022/01/07 * Check 1001
+	; UUID: 1234
+	Expenses:Rent                $500.00
+	Assets:Checking
+
+2022/01/08 * SQ *COFFEE
+	Expenses:Coffee                $4.00
+	Assets:Checking
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matchers := []ledger.Matcher{{R: regexp.MustCompile("COFFEE"), Payee: "Coffee Shop"}}
+	changes, err := f.NormalizePayees(matchers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 4 {
+		t.Fatalf("Incorrect changes: %#v", changes)
+	}
+	if f.T[0].Description != "AMZN Mktp US*1234" || f.T[4].Description != "Amazon" || f.T[4].KVPairs["ID"] != "a1" {
+		t.Errorf("Transaction with an ID not revised: %#v", f.T)
+	}
+	if f.T[1].Description != "Amazon" || f.T[2].Description != "Landlord" || f.T[3].Description != "Coffee Shop" {
+		t.Errorf("Incorrect descriptions: %q, %q, %q", f.T[1].Description, f.T[2].Description, f.T[3].Description)
+	}
+
+	changes, err = f.PayeeChanges(matchers)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Payees changed twice: %#v, %v", changes, err)
+	}
+}
+
+func TestPayeeMatchers(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+account Expenses:Rent
+	payee ^Landlord$
+
+account Expenses:Shopping
+	payee Amazon
+
+payee Amazon
+	alias ^AMZN
+
+payee Landlord
+	uuid 1234
+
+2022/01/05 * AMZN Mktp US*1234
+	Expenses:Unknown              $25.00
+	Assets:Checking
+
+2022/01/07 * Check 1001
+	; UUID: 1234
+	Expenses:Unknown             $500.00
+	Assets:Checking
+
+2022/01/08 * Check 1002
+	Expenses:Unknown             $500.00
+	Assets:Checking
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payees, err := f.Payees()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payees) != 2 || payees[0].Name != "Amazon" || payees[0].Aliases[0] != "^AMZN" || payees[1].Uuids[0] != "1234" {
+		t.Fatalf("Incorrect payees: %#v", payees)
+	}
+
+	matchers, err := f.ParseMatchers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One for the landlord's uuid, then the account regexp, then the same for Amazon's alias.
+	if len(matchers) != 4 || matchers[0].UUID != "1234" || matchers[2].R.String() != "^AMZN" {
+		t.Fatalf("Incorrect matchers: %#v", matchers)
+	}
+
+	matched := f.Matched("Expenses:Unknown", matchers)
+	if len(matched) != 2 {
+		t.Fatalf("Incorrect number of matched transactions: %#v", matched)
+	}
+	if matched[0].Description != "Amazon" || matched[0].Postings[0].Account != "Expenses:Shopping" {
+		t.Errorf("Alias not applied: %#v", matched[0])
+	}
+	if matched[1].Description != "Landlord" || matched[1].Postings[0].Account != "Expenses:Rent" {
+		t.Errorf("UUID not applied: %#v", matched[1])
+	}
+}
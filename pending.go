@@ -0,0 +1,177 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"time"
+)
+
+// pendingDays is how long after a pending transaction its posted version may be dated.
+const pendingDays = 10
+
+// Pending returns true if the transaction was imported as pending (with a "Pending: true" KV pair) and hasn't been
+// posted yet. When the bank posts the transaction the importers find the pending one and add the posted version as
+// an edit of it (with the posted date, amount, and FITID), so any changes made to the pending transaction (such as
+// its account) are kept and it isn't imported twice.
+func (t *Transaction) Pending() bool {
+	return t.KVPairs["Pending"] == "true"
+}
+
+// resolvePending checks the transactions from index from on (the ones just imported) against the pending
+// transactions from before that. Posted versions of pending transactions are replaced with an edit of the pending
+// transaction, and transactions that are still pending and were already imported are removed. Returns the number
+// of pending transactions that were posted.
+func (f *File) resolvePending(from int) int {
+	pending := []int{}
+	for _, i := range f.latestRevisions() {
+		if i < from && f.T[i].Pending() {
+			pending = append(pending, i)
+		}
+	}
+	if len(pending) == 0 {
+		return 0
+	}
+
+	resolved := 0
+	used := map[int]bool{}
+	kept := f.T[:from:from]
+	for _, tr := range f.T[from:] {
+		j := f.matchPending(pending, used, &tr)
+		if j == -1 {
+			kept = append(kept, tr)
+			continue
+		}
+		used[j] = true
+		if tr.Pending() {
+			continue
+		}
+		kept = append(kept, f.postPending(&f.T[j], &tr))
+		resolved++
+	}
+	f.T = kept
+	return resolved
+}
+
+// matchPending returns the index of the pending transaction that the imported transaction is a version of, or -1.
+// Transactions with the same FITID always match. Otherwise a posted transaction matches a pending one in the same
+// account dated at most pendingDays before it, if it has the same amount and a description with something in
+// common, or a different amount and a similar description. The closest date wins.
+func (f *File) matchPending(pending []int, used map[int]bool, tr *Transaction) int {
+	acct := tr.KVPairs["Account"]
+	if acct == "" {
+		return -1
+	}
+	amount := accountValue(tr, acct)
+
+	best, bestd := -1, time.Duration(0)
+	for _, j := range pending {
+		p := &f.T[j]
+		if used[j] || p.KVPairs["Account"] != acct {
+			continue
+		}
+		if fitid := tr.KVPairs["FITID"]; fitid != "" && fitid == p.KVPairs["FITID"] {
+			return j
+		}
+		if tr.Pending() {
+			continue
+		}
+
+		d := tr.Date.Sub(p.Date)
+		if d < -24*time.Hour || d > pendingDays*24*time.Hour {
+			continue
+		}
+		sim := descriptionSimilarity(p.Description, tr.Description)
+		if !(accountValue(p, acct) == amount && sim > 0) && sim < 0.5 {
+			continue
+		}
+		if d < 0 {
+			d = -d
+		}
+		if best == -1 || d < bestd {
+			best, bestd = j, d
+		}
+	}
+	return best
+}
+
+// postPending returns a new revision of the pending transaction updated to match the posted one. If the amount
+// changed (a tip, a currency conversion) the null posting takes up the difference, or the last other posting if
+// there isn't one. The posted description is used unless the pending one was changed since it was imported.
+func (f *File) postPending(p, posted *Transaction) Transaction {
+	acct := posted.KVPairs["Account"]
+	rev := *p.CleanCopy()
+	for _, tr := range f.T {
+		if tr.KVPairs["ID"] == p.KVPairs["ID"] {
+			if tr.Description == p.Description {
+				rev.Description = posted.Description
+			}
+			break
+		}
+	}
+	rev.Date = posted.Date
+	rev.Status = posted.Status
+	delete(rev.KVPairs, "Pending")
+	for _, k := range []string{"FITID", "TrnTyp", "Memo", "Name"} {
+		if v, ok := posted.KVPairs[k]; ok {
+			rev.KVPairs[k] = v
+		}
+	}
+
+	diff := accountValue(posted, acct) - accountValue(p, acct)
+	bank, null, last := -1, -1, -1
+	for i, pp := range rev.Postings {
+		switch {
+		case pp.Account == acct && bank == -1:
+			bank = i
+		case pp.Null:
+			null = i
+		default:
+			last = i
+		}
+	}
+	if bank != -1 {
+		rev.Postings[bank].Value += diff
+		for _, pp := range posted.Postings {
+			if pp.Account == acct {
+				rev.Postings[bank].Assert, rev.Postings[bank].HasAssert = pp.Assert, pp.HasAssert
+			}
+		}
+		if null == -1 && last != -1 {
+			rev.Postings[last].Value -= diff
+		}
+	}
+
+	AssignIDs(f.ids(), &rev)
+	return rev
+}
+
+// accountValue returns the total of the postings to the account.
+func accountValue(tr *Transaction, acct string) int64 {
+	v := int64(0)
+	for _, p := range tr.Postings {
+		if p.Account == acct && !p.Null {
+			v += p.Value
+		}
+	}
+	return v
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/samuellwn/ledger"
+)
+
+func TestPendingImport(t *testing.T) {
+	profile := ledger.CSVProfile{
+		Date:        "date",
+		Amount:      "amount",
+		Description: []string{"desc"},
+		FITID:       "id",
+		Pending:     "status",
+		Status:      ledger.StatusClear,
+	}
+	pending := `date,amount,desc,id,status
+01/02/2022,-10.00,PENDING COFFEE SHOP,p1,pending
+01/02/2022,-20.00,GROCERY,p2,pending
+`
+	posted := `date,amount,desc,id,status
+01/04/2022,-12.00,COFFEE SHOP,x9,
+01/03/2022,-20.00,GROCERY,p2,
+`
+
+	f := &ledger.File{}
+	err := f.ImportCSV(strings.NewReader(pending), profile, "Assets:Checking", "Expenses:Unknown", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Categorize the first one by hand.
+	tr := *f.T[0].CleanCopy()
+	tr.Postings[1].Account = "Expenses:Coffee"
+	ledger.AssignIDs(nil, &tr)
+	f.T = append(f.T, tr)
+
+	// Downloading the same pending transactions again doesn't add anything.
+	err = f.ImportCSV(strings.NewReader(pending), profile, "Assets:Checking", "Expenses:Unknown", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.T) != 3 {
+		t.Fatalf("Pending transactions imported twice, %v transactions.", len(f.T))
+	}
+
+	err = f.ImportCSV(strings.NewReader(posted), profile, "Assets:Checking", "Expenses:Unknown", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.StripHistory()
+	if len(f.T) != 2 {
+		t.Fatalf("Expected 2 transactions, got %v:\n%v", len(f.T), f.T)
+	}
+
+	// The coffee got a tip added when it posted, with a new FITID and description.
+	coffee := f.T[0]
+	if coffee.Pending() || coffee.Status != ledger.StatusClear || coffee.KVPairs["FITID"] != "x9" {
+		t.Errorf("Coffee not posted:\n%v", coffee.String())
+	}
+	if coffee.Description != "COFFEE SHOP" || coffee.Postings[0].Value != -120000 || coffee.Postings[1].Account != "Expenses:Coffee" {
+		t.Errorf("Coffee not updated:\n%v", coffee.String())
+	}
+	if f.T[1].Pending() || f.T[1].Date.Day() != 3 {
+		t.Errorf("Groceries not posted:\n%v", f.T[1].String())
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/samuellwn/ledger/parse/lex"
+)
+
+// Position is where a transaction, posting, or directive was parsed from: the name of the file, and the line and
+// column within it. File is empty if the source didn't have a name, and the whole position is zero for things
+// that weren't parsed.
+type Position struct {
+	File string
+	lex.Location
+}
+
+// At returns a position in the same file at a different location.
+func (p Position) At(l lex.Location) Position {
+	return Position{p.File, l}
+}
+
+func (p Position) String() string {
+	if p.File == "" {
+		return p.Location.String()
+	}
+	return fmt.Sprintf("%v:%v", p.File, p.Location)
+}
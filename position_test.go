@@ -0,0 +1,107 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+	"github.com/samuellwn/ledger/parse/lex"
+)
+
+func TestPositions(t *testing.T) {
+	f, err := parse.Read(strings.NewReader(`account Assets:Checking
+
+2024/01/02 Coffee
+	Expenses:Food  $5.00
+  * Assets:Checking  $-5.00 = $10.00
+`), "test.ledger", parse.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(what string, got ledger.Position, want string) {
+		t.Helper()
+		if got.String() != want {
+			t.Errorf("Incorrect position for %v: %v, want %v", what, got, want)
+		}
+	}
+	check("directive", f.D[0].Location, "test.ledger:1:1")
+	check("transaction", f.T[0].Location, "test.ledger:3:1")
+	check("posting 0", f.T[0].Postings[0].Location, "test.ledger:4:2")
+	check("posting 1", f.T[0].Postings[1].Location, "test.ledger:5:3")
+
+	errs := f.CheckAssertions()
+	if len(errs) != 1 {
+		t.Fatalf("Expected one assertion error, got %v", errs)
+	}
+	assert := errs[0].(ledger.AssertionError)
+	check("assertion", assert.PL, "test.ledger:5:3")
+	if !strings.Contains(assert.Error(), "test.ledger:3:1") {
+		t.Errorf("Assertion error doesn't include the transaction position: %v", assert)
+	}
+
+	// Errors found at the end of a line belong to that line, not the next one.
+	_, err = parse.ParseLedgerString("2024/01/02 (1234\n\tExpenses:Food  $5.00\n")
+	var malformed parse.ErrMalformed
+	if !errors.As(err, &malformed) {
+		t.Fatalf("Expected a malformed transaction error, got %v", err)
+	}
+	if got := lex.Location(malformed); got.String() != "1:17" {
+		t.Errorf("Incorrect position for unclosed code: %v", got)
+	}
+}
+
+func TestWrappedErrors(t *testing.T) {
+	f, err := parse.Read(strings.NewReader(`P 2024/01/02 AAPL
+
+2024/01/02 Coffee
+	; ID: abc
+	Expenses:Food  $5.00
+	Assets:Checking  $-4.00
+`), "test.ledger", parse.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.PriceDB()
+	var derr ledger.DirectiveError
+	if !errors.As(err, &derr) {
+		t.Fatalf("Expected a directive error, got %v", err)
+	}
+	if derr.D != 0 || derr.Type != "P" || derr.L.String() != "test.ledger:1:1" || derr.Unwrap() == nil {
+		t.Errorf("Incorrect directive error: %#v", derr)
+	}
+
+	errs := f.CheckAssertions()
+	var berr ledger.BalanceError
+	if len(errs) != 1 || !errors.As(errs[0], &berr) {
+		t.Fatalf("Expected a balance error, got %v", errs)
+	}
+	if berr.ID != "abc" || berr.L.String() != "test.ledger:3:1" {
+		t.Errorf("Incorrect balance error: %#v", berr)
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Price is the value of one unit of a commodity on a date, from a P directive.
+type Price struct {
+	Date   time.Time
+	Symbol string
+	Value  int64 // In the same units as posting values.
+}
+
+// PriceDB holds the prices of commodities over time.
+type PriceDB struct {
+	prices map[string][]Price // By symbol, in date order.
+}
+
+// ErrNoPrice is returned when a report needs the price of a commodity and there isn't one on or before the date.
+type ErrNoPrice struct {
+	Symbol string
+	Date   time.Time
+}
+
+func (err ErrNoPrice) Error() string {
+	return fmt.Sprintf("No price for %q on or before %v.", err.Symbol, err.Date.Format("2006/01/02"))
+}
+
+// NewPriceDB returns an empty price database.
+func NewPriceDB() *PriceDB {
+	return &PriceDB{prices: map[string][]Price{}}
+}
+
+// Add adds a price. A later price for the same commodity and date replaces the earlier one.
+func (db *PriceDB) Add(p Price) {
+	prices := db.prices[p.Symbol]
+	i := sort.Search(len(prices), func(i int) bool { return !prices[i].Date.Before(p.Date) })
+	if i < len(prices) && prices[i].Date.Equal(p.Date) {
+		prices[i] = p
+		return
+	}
+	prices = append(prices, Price{})
+	copy(prices[i+1:], prices[i:])
+	prices[i] = p
+	db.prices[p.Symbol] = prices
+}
+
+// AddDirective adds the price from a P directive, ignoring any other kind of directive. P directives give a date
+// (with an optional time, which is ignored), a commodity, and its price:
+//
+//	P 2026/01/02 AAPL $150.00
+//	P 2026/01/02 12:00:00 € $1.10
+//
+// The price is parsed with the given amount formats.
+func (db *PriceDB) AddDirective(d *Directive, formats *AmountFormats) error {
+	if d.Type != "P" {
+		return nil
+	}
+
+	fields := strings.Fields(d.Argument)
+	if len(fields) > 1 && strings.Contains(fields[1], ":") {
+		fields = append(fields[:1], fields[2:]...)
+	}
+	if len(fields) < 3 {
+		return fmt.Errorf("Malformed price directive: %q", d.Argument)
+	}
+
+	date, err := time.Parse("2006/01/02", strings.ReplaceAll(fields[0], "-", "/"))
+	if err != nil {
+		return fmt.Errorf("Malformed price directive: %q", d.Argument)
+	}
+	v, err := formats.Parse(strings.Join(fields[2:], " "))
+	if err != nil {
+		return err
+	}
+	db.Add(Price{Date: date, Symbol: fields[1], Value: v})
+	return nil
+}
+
+// At returns the latest price of the commodity on or before the date.
+func (db *PriceDB) At(symbol string, date time.Time) (int64, bool) {
+	prices := db.prices[symbol]
+	i := sort.Search(len(prices), func(i int) bool { return prices[i].Date.After(date) })
+	if i == 0 {
+		return 0, false
+	}
+	return prices[i-1].Value, true
+}
+
+// Latest returns the latest price of the commodity.
+func (db *PriceDB) Latest(symbol string) (int64, bool) {
+	prices := db.prices[symbol]
+	if len(prices) == 0 {
+		return 0, false
+	}
+	return prices[len(prices)-1].Value, true
+}
+
+// PriceDB returns the prices from all the P directives in the file.
+func (f *File) PriceDB() (*PriceDB, error) {
+	formats, err := f.AmountFormats()
+	if err != nil {
+		return nil, err
+	}
+
+	db := NewPriceDB()
+	for i := range f.D {
+		err := db.AddDirective(&f.D[i], formats)
+		if err != nil {
+			return nil, DirectiveError{i, f.D[i].Location, f.D[i].Type, err}
+		}
+	}
+	return db, nil
+}
+
+var unitsNote = regexp.MustCompile(`^(-?[0-9.]+) (\S+) @ `)
+
+// PostingUnits returns the number of units of a commodity held by a posting, from a note like
+// "10 AAPL @ $150.00" as written by the investment and beancount importers. Returns false if the posting doesn't
+// have one.
+func PostingUnits(p *Posting) (Amount, string, bool) {
+	m := unitsNote.FindStringSubmatch(strings.TrimSpace(p.Note))
+	if m == nil {
+		return Amount{}, "", false
+	}
+	units, err := ParseAmount(m[1])
+	if err != nil {
+		return Amount{}, "", false
+	}
+	return units, m[2], true
+}
+
+// exchange converts a posting value for a report with the Exchange option set. Postings that hold units of a
+// commodity are valued at its price on the date, and then the value is converted to the exchange commodity (unless
+// that is the commodity values are kept in). Holdings without a price keep their value.
+func (db *PriceDB) exchange(p *Posting, date time.Time, q *ReportQuery, base string) (int64, error) {
+	price := func(symbol string) (int64, bool) {
+		if q.ExchangeLatest {
+			return db.Latest(symbol)
+		}
+		return db.At(symbol, date)
+	}
+
+	v := p.Value
+	if units, symbol, ok := PostingUnits(p); ok {
+		if each, ok := price(symbol); ok {
+			if v, ok = units.Mul(ValueAmount(each)).Value(); !ok {
+				return 0, ErrMalformedAmount{p.Note}
+			}
+		}
+	}
+
+	if q.Exchange == base || q.Exchange == "$" {
+		return v, nil
+	}
+	rate, ok := price(q.Exchange)
+	if !ok || rate == 0 {
+		return 0, ErrNoPrice{q.Exchange, date}
+	}
+	return ratValue(big.NewRat(v, rate)), nil
+}
+
+// ExchangeFormat returns the format for writing the values of a report made with the query: the format declared
+// for the exchange commodity, or DefaultAmountFormat if the query doesn't have one.
+func (f *File) ExchangeFormat(q ReportQuery) (AmountFormat, error) {
+	if q.Exchange == "" {
+		return DefaultAmountFormat, nil
+	}
+	formats, err := f.AmountFormats()
+	if err != nil {
+		return AmountFormat{}, err
+	}
+	if af, ok := formats.Commodities[q.Exchange]; ok {
+		return af, nil
+	}
+	if q.Exchange == "$" {
+		return DefaultAmountFormat, nil
+	}
+	return AmountFormat{Symbol: q.Exchange, After: true, Space: true, Decimal: '.'}, nil
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrAccountNotFound is returned by File.RenameAccount and File.MergeAccounts if the account is neither declared
+// nor used by any posting.
+type ErrAccountNotFound struct {
+	Name string
+}
+
+func (err ErrAccountNotFound) Error() string {
+	return fmt.Sprintf("Account %q is not declared or used.", err.Name)
+}
+
+// ErrAccountExists is returned by File.RenameAccount if the new name (or the new name of one of the sub accounts)
+// is already declared or used. Use File.MergeAccounts to combine accounts.
+type ErrAccountExists struct {
+	Name string
+}
+
+func (err ErrAccountExists) Error() string {
+	return fmt.Sprintf("Account %q already exists.", err.Name)
+}
+
+// RenameAccount renames an account and all of its sub accounts, so renaming Expenses:Food to Expenses:Groceries also
+// renames Expenses:Food:Snacks to Expenses:Groceries:Snacks. See File.MergeAccounts for what is changed. Returns the
+// number of transactions that were changed.
+func (f *File) RenameAccount(old, new string) (int, error) {
+	tree, err := f.AccountTree()
+	if err != nil {
+		return 0, err
+	}
+	n := tree.Find(old)
+	if n == nil || n.Account != old {
+		return 0, ErrAccountNotFound{old}
+	}
+
+	var exists error
+	walkNode(n, func(c *AccountNode) {
+		if exists == nil {
+			if renamed := new + strings.TrimPrefix(c.Account, old); tree.Find(renamed) != nil {
+				exists = ErrAccountExists{renamed}
+			}
+		}
+	})
+	if exists != nil {
+		return 0, exists
+	}
+
+	return f.MergeAccounts(old, new)
+}
+
+// MergeAccounts moves everything in one account (and its sub accounts) into another, so merging Expenses:Dining into
+// Expenses:Food also moves Expenses:Dining:Coffee to Expenses:Food:Coffee. The account doesn't need to exist yet.
+//
+// The postings of the latest revision of every transaction are rewritten, as a new revision (with a new RID) for
+// transactions with an ID so that the change syncs like any other edit, and in place for transactions without one.
+// Older revisions are left alone. Account directives are renamed, or if both accounts are declared, the aliases,
+// payees, and other lines of the old directive are added to the other and the old directive is removed. Matchers
+// built from the payee lines follow along. Top level alias directives and the postings of periodic and automated
+// transactions are also rewritten. Returns the number of transactions that were changed.
+func (f *File) MergeAccounts(from, to string) (int, error) {
+	tree, err := f.AccountTree()
+	if err != nil {
+		return 0, err
+	}
+	if n := tree.Find(from); n == nil || n.Account != from {
+		return 0, ErrAccountNotFound{from}
+	}
+	if from == to {
+		return 0, nil
+	}
+	if strings.HasPrefix(to, from+":") {
+		return 0, fmt.Errorf("Can't merge account %q into its own sub account %q.", from, to)
+	}
+
+	rename := func(account string) (string, bool) {
+		if account == from {
+			return to, true
+		}
+		if strings.HasPrefix(account, from+":") {
+			return to + account[len(from):], true
+		}
+		return account, false
+	}
+
+	changed := 0
+	for _, i := range f.latestRevisions() {
+		tr := f.T[i].CleanCopy()
+		touched := false
+		for j := range tr.Postings {
+			if account, ok := rename(tr.Postings[j].Account); ok {
+				tr.Postings[j].Account = account
+				touched = true
+			}
+		}
+		if !touched {
+			continue
+		}
+		changed++
+
+		if tr.KVPairs["ID"] == "" {
+			f.T[i] = *tr
+			continue
+		}
+		err := f.AppendEdit(*tr)
+		if err != nil {
+			return changed, err
+		}
+	}
+
+	f.renameDirectives(rename)
+	return changed, nil
+}
+
+// renameDirectives rewrites the account names in the directives, merging account directives that end up with the
+// same name.
+func (f *File) renameDirectives(rename func(string) (string, bool)) {
+	declared := map[string]int{}
+	for i, d := range f.D {
+		if d.Type == "account" {
+			declared[d.Argument] = i
+		}
+	}
+
+	kept := f.D[:0]
+	for i := range f.D {
+		d := f.D[i].CleanCopy()
+		switch d.Type {
+		case "account":
+			account, ok := rename(d.Argument)
+			if !ok {
+				break
+			}
+			if j, ok := declared[account]; ok && j != i {
+				// The other directive may come before or after this one, so merge into whichever survives.
+				other := &f.D[j]
+				if j < i {
+					other = &kept[indexOfDirective(kept, account)]
+				}
+				for _, line := range d.Lines {
+					if !containsLine(other.Lines, line) {
+						other.Lines = append(other.Lines, line)
+					}
+				}
+				continue
+			}
+			d.Argument = account
+		case "alias":
+			name, account, ok := strings.Cut(d.Argument, "=")
+			if !ok {
+				break
+			}
+			if account, ok := rename(strings.TrimSpace(account)); ok {
+				d.Argument = strings.TrimSpace(name) + "=" + account
+			}
+		case "~", "=":
+			for j, line := range d.Lines {
+				if strings.HasPrefix(line, ";") {
+					continue
+				}
+				end := len(line)
+				if sep := strings.Index(line, "  "); sep != -1 {
+					end = sep
+				}
+				if tab := strings.IndexRune(line, '\t'); tab != -1 && tab < end {
+					end = tab
+				}
+				if account, ok := rename(strings.TrimSpace(line[:end])); ok {
+					d.Lines[j] = account + line[end:]
+				}
+			}
+		}
+		kept = append(kept, *d)
+	}
+	f.D = kept
+}
+
+func indexOfDirective(ds []Directive, account string) int {
+	for i := range ds {
+		if ds[i].Type == "account" && ds[i].Argument == account {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+var TestRenameInput = `
+account Expenses:Dining
+	alias dining
+	payee Restaurant
+
+account Expenses:Food
+	note Everything edible
+
+alias eat=Expenses:Dining
+
+~ Monthly
+	Expenses:Dining:Coffee    $20.00
+	Assets
+
+2022/01/05 * Restaurant
+	; ID: a1
+	; RID: r1
+	Expenses:Dining           $25.00
+	Assets:Checking
+
+2022/01/06 * Coffee
+	Expenses:Dining:Coffee     $5.00
+	Assets:Checking
+
+2022/01/07 * Groceries
+	; ID: a2
+	; RID: r2
+	Expenses:Food             $50.00
+	Assets:Checking
+`
+
+func TestRenameAccount(t *testing.T) {
+	f, err := parse.ParseLedgerString(TestRenameInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.RenameAccount("Expenses:Dining", "Expenses:Food")
+	if !errors.As(err, &ledger.ErrAccountExists{}) {
+		t.Fatalf("Renaming onto an existing account should fail, got: %v", err)
+	}
+
+	n, err := f.RenameAccount("Expenses:Dining", "Expenses:Eating Out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first transaction gets a new revision, the second (without an ID) is changed in place.
+	if n != 2 || len(f.T) != 4 || f.T[3].KVPairs["ID"] != "a1" || f.T[3].KVPairs["RID"] == "r1" {
+		t.Fatalf("Incorrect transactions after rename: %v %#v", n, f.T)
+	}
+	if f.T[1].Postings[0].Account != "Expenses:Eating Out:Coffee" || f.T[0].Postings[0].Account != "Expenses:Dining" {
+		t.Errorf("Incorrect postings after rename: %#v", f.T)
+	}
+
+	buf := &bytes.Buffer{}
+	err = f.Format(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"account Expenses:Eating Out\n", "alias eat=Expenses:Eating Out\n", "\tExpenses:Eating Out:Coffee    $20.00\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Missing %q in:\n%v", want, buf.String())
+		}
+	}
+
+	matchers, err := f.ParseMatchers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matchers) != 1 || matchers[0].Account != "Expenses:Eating Out" {
+		t.Errorf("Incorrect matchers after rename: %#v", matchers)
+	}
+}
+
+func TestMergeAccounts(t *testing.T) {
+	f, err := parse.ParseLedgerString(TestRenameInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.MergeAccounts("Expenses:Dining", "Expenses:Food")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := f.Accounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].Name != "Expenses:Food" || accounts[0].Note != "Everything edible" ||
+		len(accounts[0].Aliases) != 1 || len(accounts[0].Payees) != 1 {
+		t.Errorf("Account directives not merged: %#v", accounts)
+	}
+
+	sums, err := f.BalanceReport(ledger.ReportQuery{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != 2 || sums["Expenses:Food"] != 800000 {
+		t.Errorf("Incorrect balances after merge: %#v", sums)
+	}
+}
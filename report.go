@@ -0,0 +1,399 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"regexp"
+	"sort"
+	"time"
+)
+
+// ReportQuery selects the postings a report operates on. The zero value selects everything.
+type ReportQuery struct {
+	Account *regexp.Regexp // Only postings to accounts matching this (optional).
+
+	Begin time.Time // Only transactions on or after this date (optional).
+	End   time.Time // Only transactions before this date (optional).
+
+	// If any of these are set, only postings with one of the selected statuses are included. A posting without
+	// a status of its own uses the status of its transaction, same as ledger.
+	Cleared   bool
+	Pending   bool
+	Uncleared bool
+
+	// Report the other postings of each transaction with a selected posting, instead of the selected postings.
+	// Same as the ledger --related option.
+	Related bool
+
+	// If set, value all postings in this commodity using the prices from the P directives in the file, same as
+	// the ledger --exchange option. Postings holding units of a commodity (see PostingUnits) are valued at its
+	// price too. Prices are taken on the date of each transaction, or the latest prices if ExchangeLatest is set.
+	Exchange       string
+	ExchangeLatest bool
+
+	// Use the effective dates of postings and transactions (see Posting.PostingDate) for the date range and for
+	// putting postings in periods, same as the ledger --effective option. Postings with their own dates always use
+	// them.
+	Effective bool
+}
+
+func (q *ReportQuery) matchDate(date time.Time) bool {
+	if !q.Begin.IsZero() && date.Before(q.Begin) {
+		return false
+	}
+	if !q.End.IsZero() && !date.Before(q.End) {
+		return false
+	}
+	return true
+}
+
+// matchTransaction returns true if any posting of the transaction is in the date range.
+func (q *ReportQuery) matchTransaction(tr *Transaction) bool {
+	if q.matchDate(tr.Date) {
+		return true
+	}
+	for i := range tr.Postings {
+		if q.matchDate(tr.Postings[i].PostingDate(tr, q.Effective)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *ReportQuery) matchPosting(tr *Transaction, p *Posting) bool {
+	if q.Account != nil && !q.Account.MatchString(p.Account) {
+		return false
+	}
+	if !q.matchDate(p.PostingDate(tr, q.Effective)) {
+		return false
+	}
+
+	if !q.Cleared && !q.Pending && !q.Uncleared {
+		return true
+	}
+	switch p.EffectiveStatus(tr) {
+	case StatusClear:
+		return q.Cleared
+	case StatusPending:
+		return q.Pending
+	default:
+		return q.Uncleared
+	}
+}
+
+// postings returns the indexes of the postings in the transaction that a report should include.
+func (q *ReportQuery) postings(tr *Transaction) []int {
+	selected, others := []int{}, []int{}
+	for i := range tr.Postings {
+		if q.matchPosting(tr, &tr.Postings[i]) {
+			selected = append(selected, i)
+		} else {
+			others = append(others, i)
+		}
+	}
+
+	if !q.Related {
+		return selected
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+	return others
+}
+
+// EffectiveStatus returns the status of the posting, or the status of the transaction it belongs to if the
+// posting does not have one.
+func (p *Posting) EffectiveStatus(tr *Transaction) status {
+	if p.Status != StatusUndefined {
+		return p.Status
+	}
+	return tr.Status
+}
+
+// reportTransactions returns copies of all the transactions selected by the query, in chronological order and
+// then file order, with all null postings filled in. The matching list of indexes into f.T is also returned.
+// Only the latest revision of each transaction is included. Balance assignments are resolved against the running
+// balances of all transactions, selected or not. If the query has an exchange commodity the values are converted
+// after balance assignments are resolved.
+func (f *File) reportTransactions(q *ReportQuery) ([]Transaction, []int, error) {
+	var prices *PriceDB
+	base := ""
+	if q.Exchange != "" {
+		formats, err := f.AmountFormats()
+		if err != nil {
+			return nil, nil, err
+		}
+		prices, err = f.PriceDB()
+		if err != nil {
+			return nil, nil, err
+		}
+		base = formats.Default.Symbol
+	}
+
+	ixs := f.latestRevisions()
+	sort.SliceStable(ixs, func(i, j int) bool {
+		return f.T[ixs[i]].Date.Before(f.T[ixs[j]].Date)
+	})
+
+	trs := []Transaction{}
+	selected := []int{}
+	balances := map[string]int64{}
+	for _, i := range ixs {
+		match := q.matchTransaction(&f.T[i])
+
+		values, err := assignedValues(i, &f.T[i], balances)
+		if err != nil {
+			if match {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		tr := f.T[i].CleanCopy()
+		for j := range tr.Postings {
+			tr.Postings[j].Value = values[j]
+			balances[tr.Postings[j].Account] += values[j]
+		}
+		if match && prices != nil {
+			for j := range tr.Postings {
+				tr.Postings[j].Value, err = prices.exchange(&tr.Postings[j], tr.Date, q, base)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+		if match {
+			trs = append(trs, *tr)
+			selected = append(selected, i)
+		}
+	}
+	return trs, selected, nil
+}
+
+// latestRevisions returns the indexes of the latest revision of every transaction, in order of the first revision.
+// Transactions without an ID are all included, and transactions that were voided are left out.
+func (f *File) latestRevisions() []int {
+	ixs := []int{}
+	for _, h := range f.History() {
+		if i := h.Latest(); !f.T[i].Voided() {
+			ixs = append(ixs, i)
+		}
+	}
+	return ixs
+}
+
+// RegisterRow is a single line of a register report.
+type RegisterRow struct {
+	Date    time.Time
+	Payee   string
+	Account string
+	Amount  int64 // The value of the posting.
+	Total   int64 // The running total of all the rows up to and including this one.
+
+	T int // The index of the transaction this row came from in File.T
+	P int // The index of the posting this row came from in the transaction.
+}
+
+// Register returns a register report, one row for each posting selected by the query along with a running
+// total, in chronological order. Same as `ledger register`.
+// Returns an error if any of the selected transactions do not balance.
+func (f *File) Register(q ReportQuery) ([]RegisterRow, error) {
+	trs, ixs, err := f.reportTransactions(&q)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []RegisterRow{}
+	for i, tr := range trs {
+		for _, j := range q.postings(&tr) {
+			p := &tr.Postings[j]
+			rows = append(rows, RegisterRow{
+				Date:    p.PostingDate(&tr, q.Effective),
+				Payee:   tr.Description,
+				Account: p.Account,
+				Amount:  p.Value,
+				T:       ixs[i],
+				P:       j,
+			})
+		}
+	}
+
+	// Postings with their own dates may need to move.
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Date.Before(rows[j].Date)
+	})
+	total := int64(0)
+	for i := range rows {
+		total += rows[i].Amount
+		rows[i].Total = total
+	}
+	return rows, nil
+}
+
+// BalanceReport sums the postings selected by the query, returning a map of accounts to their ending values in
+// the same form as SumTransactions (ready for FormatSums). If depth is greater than 0 any account nested deeper
+// than that is collapsed into its parent at that depth, so a depth of 1 gives totals for only the top level
+// accounts. Returns an error if any of the selected transactions do not balance.
+func (f *File) BalanceReport(q ReportQuery, depth int) (map[string]int64, error) {
+	trs, _, err := f.reportTransactions(&q)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := map[string]int64{}
+	for _, tr := range trs {
+		for _, j := range q.postings(&tr) {
+			p := &tr.Postings[j]
+			accounts[TruncateAccount(p.Account, depth)] += p.Value
+		}
+	}
+	return accounts, nil
+}
+
+// TruncateAccount removes any parts of the account name nested deeper than depth. If depth is less than 1 the
+// name is returned unchanged.
+func TruncateAccount(account string, depth int) string {
+	if depth < 1 {
+		return account
+	}
+	for i, c := range account {
+		if c != ':' {
+			continue
+		}
+		depth--
+		if depth == 0 {
+			return account[:i]
+		}
+	}
+	return account
+}
+
+// Interval is the length of the periods a PeriodReport is split into.
+type Interval int
+
+const (
+	IntervalWeekly Interval = iota
+	IntervalMonthly
+	IntervalQuarterly
+	IntervalYearly
+)
+
+// Start returns the beginning of the period containing t. Weeks start on Sunday, same as ledger.
+func (iv Interval) Start(t time.Time) time.Time {
+	y, m, d := t.Date()
+	switch iv {
+	case IntervalWeekly:
+		return time.Date(y, m, d-int(t.Weekday()), 0, 0, 0, 0, t.Location())
+	case IntervalMonthly:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	case IntervalQuarterly:
+		return time.Date(y, m-(m-1)%3, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// Next returns the beginning of the period after the one that starts at t.
+func (iv Interval) Next(t time.Time) time.Time {
+	switch iv {
+	case IntervalWeekly:
+		return t.AddDate(0, 0, 7)
+	case IntervalMonthly:
+		return t.AddDate(0, 1, 0)
+	case IntervalQuarterly:
+		return t.AddDate(0, 3, 0)
+	default:
+		return t.AddDate(1, 0, 0)
+	}
+}
+
+// PeriodReport holds per account sums for a series of consecutive periods.
+type PeriodReport struct {
+	Interval Interval
+	Periods  []time.Time        // The start date of each period, in order.
+	Sums     map[string][]int64 // Account name to the sum for each period, indexes match Periods.
+}
+
+// PeriodicReport sums the postings selected by the query per account for each period, like
+// `ledger register --monthly`. The periods run from the query's begin date (or the first selected transaction)
+// to its end date (or the last selected transaction), and include periods without any postings. Depth works the
+// same as it does for BalanceReport.
+// Returns an error if any of the selected transactions do not balance.
+func (f *File) PeriodicReport(q ReportQuery, interval Interval, depth int) (*PeriodReport, error) {
+	trs, _, err := f.reportTransactions(&q)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PeriodReport{Interval: interval, Periods: []time.Time{}, Sums: map[string][]int64{}}
+
+	// Postings with their own dates may be outside the range of their transactions' dates, so find the range from
+	// the postings.
+	var first, last time.Time
+	for _, tr := range trs {
+		for j := range tr.Postings {
+			date := tr.Postings[j].PostingDate(&tr, q.Effective)
+			if first.IsZero() || date.Before(first) {
+				first = date
+			}
+			if last.IsZero() || date.After(last) {
+				last = date
+			}
+		}
+	}
+	if !q.Begin.IsZero() {
+		first = q.Begin
+	}
+	if !q.End.IsZero() {
+		// The end date is exclusive.
+		last = q.End.AddDate(0, 0, -1)
+	}
+	if first.IsZero() {
+		return report, nil
+	}
+	for p := interval.Start(first); !p.After(last); p = interval.Next(p) {
+		report.Periods = append(report.Periods, p)
+	}
+
+	for _, tr := range trs {
+		for _, j := range q.postings(&tr) {
+			p := &tr.Postings[j]
+			date := p.PostingDate(&tr, q.Effective)
+			period := sort.Search(len(report.Periods), func(i int) bool {
+				return report.Periods[i].After(date)
+			}) - 1
+			if period < 0 {
+				continue
+			}
+
+			account := TruncateAccount(p.Account, depth)
+			sums, ok := report.Sums[account]
+			if !ok {
+				sums = make([]int64, len(report.Periods))
+				report.Sums[account] = sums
+			}
+			sums[period] += p.Value
+		}
+	}
+	return report, nil
+}
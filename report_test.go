@@ -0,0 +1,368 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+var TestReportsInput = `
+2022/02/03 * Paycheck
+	Income:Job                  $-1000.00
+	Assets:Checking
+
+2022/01/05 * Groceries
+	Expenses:Food:Groceries        $50.00
+	Assets:Checking
+
+2022/01/20 ! Restaurant
+	Expenses:Food:Eating Out       $25.00
+	Assets:Checking
+
+2022/04/01 Rent
+	Expenses:Rent                 $500.00
+	Assets:Checking
+`
+
+func TestReports(t *testing.T) {
+	f, err := parse.ParseLedgerString(TestReportsInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := f.Register(ledger.ReportQuery{Account: regexp.MustCompile("^Assets:")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("Incorrect number of register rows: %v", len(rows))
+	}
+	if rows[0].Payee != "Groceries" || rows[0].T != 1 {
+		t.Errorf("Register rows not in date order: %#v", rows[0])
+	}
+	if rows[3].Total != 4250000 {
+		t.Errorf("Incorrect running total: %v", rows[3].Total)
+	}
+
+	sums, err := f.BalanceReport(ledger.ReportQuery{
+		Begin:   time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:     time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+		Cleared: true,
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != 3 || sums["Expenses"] != 500000 || sums["Assets"] != 9500000 {
+		t.Errorf("Incorrect balance report: %#v", sums)
+	}
+
+	report, err := f.PeriodicReport(ledger.ReportQuery{Account: regexp.MustCompile("^Expenses:")}, ledger.IntervalMonthly, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Periods) != 4 {
+		t.Fatalf("Incorrect number of periods: %v", len(report.Periods))
+	}
+	food := report.Sums["Expenses:Food"]
+	if len(food) != 4 || food[0] != 750000 || food[1] != 0 || food[3] != 0 {
+		t.Errorf("Incorrect sums for Expenses:Food: %v", food)
+	}
+	if report.Sums["Expenses:Rent"][3] != 5000000 {
+		t.Errorf("Incorrect sums for Expenses:Rent: %v", report.Sums["Expenses:Rent"])
+	}
+}
+
+func TestBudgetReport(t *testing.T) {
+	f, err := parse.ParseLedgerString(TestReportsInput + `
+~ Monthly
+	Expenses:Food                 $100.00
+	Assets
+
+~ Yearly
+	Expenses:Rent                $6000.00 ; $500.00 a month.
+	Expenses:Food                 $120.00
+	Assets
+
+~ Monthly
+	Expenses:Food                  $60.00
+	Assets
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := f.BudgetReport(time.Date(2022, 1, 15, 0, 0, 0, 0, time.UTC), ledger.IntervalMonthly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Incorrect number of budget rows: %#v", rows)
+	}
+	// The second monthly food budget replaces the first, and the yearly one adds $10.00.
+	if rows[0].Account != "Expenses:Food" || rows[0].Budgeted != 700000 || rows[0].Actual != 750000 || rows[0].Remaining != -50000 {
+		t.Errorf("Incorrect food budget: %#v", rows[0])
+	}
+	if rows[1].Account != "Expenses:Rent" || rows[1].Budgeted != 5000000 || rows[1].Actual != 0 {
+		t.Errorf("Incorrect rent budget: %#v", rows[1])
+	}
+
+	f, err = parse.ParseLedgerString(TestReportsInput + `
+~ Monthly
+	Expenses:Food                 $100.00 ; :rollover:
+	Expenses:Rent                 $400.00
+	Assets
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err = f.BudgetReport(time.Date(2022, 3, 10, 0, 0, 0, 0, time.UTC), ledger.IntervalMonthly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// $25.00 left from January and $100.00 from February.
+	if len(rows) != 2 || rows[0].Rollover != 1250000 || rows[0].Remaining != 2250000 {
+		t.Errorf("Incorrect rollover budget: %#v", rows)
+	}
+	if rows[1].Rollover != 0 || rows[1].Remaining != 4000000 {
+		t.Errorf("Budget without rollover has a rollover: %#v", rows[1])
+	}
+}
+
+func TestHTMLReport(t *testing.T) {
+	f, err := parse.ParseLedgerString(TestReportsInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	err = f.WriteHTMLReport(buf, ledger.HTMLReportOptions{
+		Title: "Food & Fun",
+		Query: ledger.ReportQuery{Account: regexp.MustCompile("^Expenses:")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<title>Food &amp; Fun</title>",
+		"<summary><span>Food</span><span class=\"amount\">$75.00</span></summary>",
+		"<span title=\"Expenses:Food:Eating Out\">Eating Out</span>",
+		"<span>Total</span><span class=\"amount\">$575.00</span>",
+		"<td>Restaurant</td>",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Report is missing %q", want)
+		}
+	}
+}
+
+func TestSeries(t *testing.T) {
+	f, err := parse.ParseLedgerString(TestReportsInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worth, err := f.NetWorth(ledger.ReportQuery{Begin: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)}, ledger.IntervalMonthly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// January's spending still counts towards the balances even though it's before the begin date.
+	if len(worth.Points) != 3 || worth.Points[0].Value != 9250000 || worth.Points[2].Value != 4250000 {
+		t.Errorf("Incorrect net worth: %#v", worth.Points)
+	}
+
+	flow, err := f.CashFlow(ledger.ReportQuery{}, ledger.IntervalMonthly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flow) != 3 || len(flow[2].Points) != 4 {
+		t.Fatalf("Incorrect cash flow: %#v", flow)
+	}
+	if flow[0].Points[1].Value != 10000000 || flow[1].Points[0].Value != 750000 || flow[2].Points[3].Value != -5000000 {
+		t.Errorf("Incorrect cash flow: %#v", flow)
+	}
+
+	buf := &bytes.Buffer{}
+	err = ledger.WriteSeriesCSV(buf, flow...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "date,Income,Expenses,Net\n2022-01-01,0.00,75.00,-75.00\n") {
+		t.Errorf("Incorrect CSV output:\n%v", buf.String())
+	}
+}
+
+func TestForecast(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+2022/01/01 * Rent
+	Expenses:Rent                $1000.00
+	Assets:Checking
+
+2022/01/14 * ACME Payroll 1234
+	Income:Job                   $-900.00
+	Assets:Checking
+
+2022/01/28 * ACME Payroll 1299
+	Income:Job                   $-900.00
+	Assets:Checking
+
+2022/02/01 * Rent
+	Expenses:Rent                $1000.00
+	Assets:Checking
+
+2022/02/11 * ACME Payroll 1400
+	Income:Job                   $-905.00
+	Assets:Checking
+
+2022/02/25 * ACME Payroll 1500
+	Income:Job                   $-900.00
+	Assets:Checking
+
+2022/03/01 * Rent
+	Expenses:Rent                $1000.00
+	Assets:Checking
+
+2022/03/05 * Coffee
+	Expenses:Food                   $5.00
+	Assets:Checking
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc, err := f.Forecast(ledger.ForecastOptions{Months: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fc.Recurring) != 2 || fc.Recurring[0].Days != 14 || fc.Recurring[1].Months != 1 {
+		t.Fatalf("Incorrect recurring transactions: %#v", fc.Recurring)
+	}
+	if len(fc.Transactions) != 3 || !fc.Transactions[2].Date.Equal(time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Incorrect projected transactions: %#v", fc.Transactions)
+	}
+	checking := fc.Balances[0].Points
+	if len(checking) != 4 || checking[0].Value != 6000000 || checking[3].Value != 14000000 {
+		t.Errorf("Incorrect projected balances: %#v", checking)
+	}
+}
+
+func TestAccountTree(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+account Assets:Savings
+	note Rainy day fund
+	alias savings
+` + TestReportsInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := f.AccountTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets := tree.Find("Assets")
+	if assets == nil || len(assets.Children) != 2 || assets.Declared || assets.Used {
+		t.Fatalf("Incorrect Assets node: %#v", assets)
+	}
+	checking, savings := assets.Children[0], assets.Children[1]
+	if checking.Name != "Checking" || !checking.Used || checking.Declared || checking.Parent != assets {
+		t.Errorf("Incorrect Assets:Checking node: %#v", checking)
+	}
+	if tree.Find("savings") != savings || !savings.Declared || savings.Used || savings.Note != "Rainy day fund" {
+		t.Errorf("Incorrect Assets:Savings node: %#v", savings)
+	}
+
+	sums, err := f.BalanceReport(ledger.ReportQuery{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.SetBalances(sums)
+	if assets.Total != 4250000 || tree.Find("Expenses:Food").Total != 750000 || tree.Root.Total != 0 {
+		t.Errorf("Incorrect totals: %v, %v, %v", assets.Total, tree.Find("Expenses:Food").Total, tree.Root.Total)
+	}
+
+	names := []string{}
+	tree.Walk(func(n *ledger.AccountNode) {
+		names = append(names, n.Account)
+	})
+	if strings.Join(names, ",") != "Assets,Assets:Checking,Assets:Savings,Expenses,Expenses:Food,Expenses:Food:Eating Out,Expenses:Food:Groceries,Expenses:Rent,Income,Income:Job" {
+		t.Errorf("Incorrect walk order: %v", names)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+P 2026/01/01 AAPL $100.00
+P 2026/02/01 AAPL $150.00
+P 2026/01/01 € $1.25
+P 2026/02/01 12:00:00 € $1.00
+
+2026/01/05 Buy
+	Assets:Brokerage:AAPL  $1000.00 ; 10 AAPL @ $100.00
+	Assets:Checking
+
+2026/02/05 Coffee
+	Expenses:Food  $5.00
+	Assets:Checking
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		q     ledger.ReportQuery
+		stock int64
+		cash  int64
+	}{
+		{ledger.ReportQuery{}, 10000000, -10050000},
+		{ledger.ReportQuery{Exchange: "$", ExchangeLatest: true}, 15000000, -10050000},
+		{ledger.ReportQuery{Exchange: "€"}, 8000000, -8050000},
+		{ledger.ReportQuery{Exchange: "€", ExchangeLatest: true}, 15000000, -10050000},
+	}
+	for i, c := range cases {
+		accounts, err := f.BalanceReport(c.q, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accounts["Assets:Brokerage:AAPL"] != c.stock || accounts["Assets:Checking"] != c.cash {
+			t.Errorf("Case %v: Incorrect balances: %v", i, accounts)
+		}
+	}
+
+	_, err = f.BalanceReport(ledger.ReportQuery{Exchange: "GBP"}, 0)
+	if _, ok := err.(ledger.ErrNoPrice); !ok {
+		t.Errorf("Expected ErrNoPrice, got %v", err)
+	}
+
+	af, err := f.ExchangeFormat(ledger.ReportQuery{Exchange: "€"})
+	if err != nil || af.Format(-8050000) != "-805.00 €" {
+		t.Errorf("Incorrect exchange format: %#v", af)
+	}
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"fmt"
+)
+
+// Transactions are edited by appending a new revision rather than changing them in place, so a file is a log that
+// can be synced and merged. Every revision of a transaction has the same "ID" KV pair and its own "RID" (revision
+// ID) KV pair. The latest revision in file order is the current version of the transaction, and the first one
+// decides where it goes in source order. A revision with a "Void" KV pair deletes the transaction.
+
+// TransactionHistory is every revision of one transaction.
+type TransactionHistory struct {
+	ID        string // Empty for transactions without an ID, which have just the one revision.
+	Revisions []int  // Indexes into File.T, in file order.
+}
+
+// Latest returns the index of the current revision.
+func (h *TransactionHistory) Latest() int {
+	return h.Revisions[len(h.Revisions)-1]
+}
+
+// History returns the revisions of every transaction in the file, in order of their first revisions.
+func (f *File) History() []TransactionHistory {
+	hist := []TransactionHistory{}
+	byID := map[string]int{}
+	for i := range f.T {
+		id := f.T[i].KVPairs["ID"]
+		if id == "" {
+			hist = append(hist, TransactionHistory{Revisions: []int{i}})
+			continue
+		}
+		if j, ok := byID[id]; ok {
+			hist[j].Revisions = append(hist[j].Revisions, i)
+			continue
+		}
+		byID[id] = len(hist)
+		hist = append(hist, TransactionHistory{ID: id, Revisions: []int{i}})
+	}
+	return hist
+}
+
+// Revisions returns every revision of the transaction with the ID, oldest first. The transactions share their KV
+// pairs and postings with the file. To look up many transactions, build an Index and use Index.FindRevisions.
+func (f *File) Revisions(id string) []Transaction {
+	trs := []Transaction{}
+	if id == "" {
+		return trs
+	}
+	for i := range f.T {
+		if f.T[i].KVPairs["ID"] == id {
+			trs = append(trs, f.T[i])
+		}
+	}
+	return trs
+}
+
+// Current returns the current revision of the transaction with the ID. Returns false if there isn't one or it was
+// voided.
+func (f *File) Current(id string) (*Transaction, bool) {
+	i, ok := f.Find(id)
+	if !ok || f.T[i].Voided() {
+		return nil, false
+	}
+	return &f.T[i], true
+}
+
+// ErrNoTransaction is returned when there isn't a current revision of a transaction to edit.
+type ErrNoTransaction struct {
+	ID string
+}
+
+func (err ErrNoTransaction) Error() string {
+	return fmt.Sprintf("Transaction %q not found.", err.ID)
+}
+
+// AppendEdit adds a new revision of an existing transaction to the end of the file. The transaction must have the
+// ID of a transaction that wasn't voided, and it is given a new RID from the file's ID generator. Any raw source
+// text is dropped, since it no longer matches. Add a "Void" KV pair to void the transaction.
+func (f *File) AppendEdit(tr Transaction) error {
+	id := tr.KVPairs["ID"]
+	if _, ok := f.Current(id); id == "" || !ok {
+		return ErrNoTransaction{id}
+	}
+
+	tr.Raw = ""
+	AssignIDs(f.ids(), &tr)
+	f.T = append(f.T, tr)
+	return nil
+}
+
+// HistoryError is returned by File.ValidateHistory for a revision that breaks the revision rules.
+type HistoryError struct {
+	T       int
+	L       Position
+	ID      string
+	Problem string
+}
+
+func (err HistoryError) Error() string {
+	return fmt.Sprintf("Transaction %v (defined at %v) is a bad revision of %v: %v.", err.T, err.L, err.ID, err.Problem)
+}
+
+// ValidateHistory checks that the edit history of the file makes sense and returns all the problems found: no two
+// transactions may have the same ID and RID (so every revision of an edited transaction needs an RID), an RID may
+// only be used by one transaction, nothing may come after a void revision, and every revision must look like an edit
+// of the one before it (see IDCollisions). A nil result means no problems were found.
+func (f *File) ValidateHistory() []error {
+	errs := []error{}
+	seen := map[[2]string]int{}
+	rids := map[string]int{}
+	for _, h := range f.History() {
+		if h.ID == "" {
+			continue
+		}
+		for n, i := range h.Revisions {
+			tr := &f.T[i]
+			rid := tr.KVPairs["RID"]
+
+			k := [2]string{h.ID, rid}
+			if j, ok := seen[k]; ok {
+				errs = append(errs, DuplicateIDError{h.ID, rid, i, tr.Location, j})
+			} else {
+				seen[k] = i
+			}
+
+			if j, ok := rids[rid]; ok && rid != "" && f.T[j].KVPairs["ID"] != h.ID {
+				errs = append(errs, HistoryError{i, tr.Location, h.ID, fmt.Sprintf("its RID is also used by transaction %v", j)})
+			} else if !ok {
+				rids[rid] = i
+			}
+
+			if n > 0 && f.T[h.Revisions[n-1]].Voided() {
+				errs = append(errs, HistoryError{i, tr.Location, h.ID, "it comes after the transaction was voided"})
+			}
+		}
+	}
+	errs = append(errs, f.IDCollisions()...)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// DuplicateRevisions returns a DuplicateIDError for every transaction with the same ID and RID as an earlier one.
+// Unlike IDCollisions this isn't a guess, one of the two is always lost when the history is stripped or merged.
+// Transactions without an RID are skipped. A nil result means no duplicates were found.
+func (f *File) DuplicateRevisions() []error {
+	errs := []error{}
+	seen := map[[2]string]int{}
+	for i := range f.T {
+		id, rid := f.T[i].KVPairs["ID"], f.T[i].KVPairs["RID"]
+		if id == "" || rid == "" {
+			continue
+		}
+		k := [2]string{id, rid}
+		if j, ok := seen[k]; ok {
+			errs = append(errs, DuplicateIDError{id, rid, i, f.T[i].Location, j})
+			continue
+		}
+		seen[k] = i
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// IDCollisions finds transactions that share an ID with an earlier transaction but aren't revisions of it, and returns
+// an IDCollisionError for each. Edits can change anything, so this is a guess: a revision is taken to be a different
+// transaction if it has a different FITID than the revision before it, or if its date, description, and amount have
+// all changed. Void revisions are skipped. A nil result means no collisions were found.
+func (f *File) IDCollisions() []error {
+	errs := []error{}
+	for _, h := range f.History() {
+		if h.ID == "" {
+			continue
+		}
+		prev := -1
+		for _, i := range h.Revisions {
+			if f.T[i].Voided() {
+				continue
+			}
+			if prev != -1 {
+				if reason := unrelatedRevision(&f.T[prev], &f.T[i]); reason != "" {
+					errs = append(errs, IDCollisionError{h.ID, i, f.T[i].Location, prev, f.T[prev].Location, reason})
+				}
+			}
+			prev = i
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// unrelatedRevision returns why b doesn't look like an edit of a, or an empty string if it does.
+func unrelatedRevision(a, b *Transaction) string {
+	fa, fb := a.KVPairs["FITID"], b.KVPairs["FITID"]
+	if fa != "" && fb != "" && fa != fb {
+		return fmt.Sprintf("it has a different FITID (%v instead of %v)", fb, fa)
+	}
+	if !a.Date.Equal(b.Date) && a.Description != b.Description && transactionSize(a) != transactionSize(b) {
+		return "its date, description, and amount are all different"
+	}
+	return ""
+}
+
+// transactionSize returns the amount of money moved by a transaction, the larger of the sums of its positive and
+// negative postings. Null postings are left out.
+func transactionSize(tr *Transaction) int64 {
+	pos, neg := int64(0), int64(0)
+	for _, p := range tr.Postings {
+		if p.Null {
+			continue
+		}
+		if p.Value > 0 {
+			pos += p.Value
+		} else {
+			neg -= p.Value
+		}
+	}
+	if neg > pos {
+		return neg
+	}
+	return pos
+}
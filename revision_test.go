@@ -0,0 +1,260 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"testing"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+func TestRevisions(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+2022/01/01 Rent
+	; ID: a
+	; RID: a1
+	Expenses:Rent  $500.00
+	Assets:Checking
+
+2022/01/02 Coffee
+	; ID: b
+	; RID: b1
+	Expenses:Food  $5.00
+	Assets:Checking
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cur, ok := f.Current("a")
+	if !ok {
+		t.Fatal("No current revision.")
+	}
+	edit := *cur.CleanCopy()
+	edit.Postings[0].Value = 5500000
+	if err := f.AppendEdit(edit); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AppendEdit(ledger.Transaction{KVPairs: map[string]string{"ID": "c"}}); err == nil {
+		t.Errorf("Editing a missing transaction didn't fail.")
+	}
+
+	revs := f.Revisions("a")
+	if len(revs) != 2 || revs[1].Postings[0].Value != 5500000 || revs[1].KVPairs["RID"] == "a1" {
+		t.Errorf("Incorrect revisions: %v", revs)
+	}
+	hist := f.History()
+	if len(hist) != 2 || hist[0].ID != "a" || hist[0].Latest() != 2 || hist[1].Latest() != 1 {
+		t.Errorf("Incorrect history: %v", hist)
+	}
+	if errs := f.ValidateHistory(); errs != nil {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+
+	void := *f.T[1].CleanCopy()
+	void.KVPairs["Void"] = "true"
+	if err := f.AppendEdit(void); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Current("b"); ok {
+		t.Errorf("Voided transaction is still current.")
+	}
+
+	// Break every rule: a duplicate revision, an RID shared with another transaction, and an edit after a void.
+	dup := *f.T[0].CleanCopy()
+	shared := *f.T[0].CleanCopy()
+	shared.KVPairs["RID"] = "b1"
+	late := *f.T[1].CleanCopy()
+	late.KVPairs["RID"] = "b3"
+	f.T = append(f.T, dup, shared, late)
+	errs := f.ValidateHistory()
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 errors, got %v", errs)
+	}
+	if _, ok := errs[0].(ledger.DuplicateIDError); !ok {
+		t.Errorf("Expected a DuplicateIDError, got %v", errs[0])
+	}
+}
+
+func TestStripHistoryDirectives(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+2022/01/01 Rent
+	; ID: a
+	; RID: a1
+	Expenses:Rent  $500.00
+	Assets:Checking
+
+account Expenses:Food
+
+2022/01/02 Coffee
+	; ID: b
+	; RID: b1
+	Expenses:Food  $5.00
+	Assets:Checking
+
+2022/01/03 Rent
+	; ID: a
+	; RID: a2
+	Expenses:Rent  $550.00
+	Assets:Checking
+
+account Expenses:Gifts
+
+2022/01/04 Tea
+	; ID: c
+	; RID: c1
+	Expenses:Food  $3.00
+	Assets:Checking
+
+2022/01/05 Coffee
+	; ID: b
+	; RID: b2
+	; Void: true
+	Expenses:Food  $5.00
+	Assets:Checking
+
+account Assets:Savings
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.StripHistory()
+	if len(f.T) != 2 || len(f.D) != 3 {
+		t.Fatalf("Incorrect result: %v transactions, %v directives", len(f.T), len(f.D))
+	}
+	// The voided coffee is gone, so the first directive moves to the tea along with the second.
+	for i, want := range []int{1, 1, 2} {
+		if f.D[i].FoundBefore != want {
+			t.Errorf("Directive %v is before transaction %v, expected %v.", i, f.D[i].FoundBefore, want)
+		}
+	}
+}
+
+func TestDiffTransactions(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+2022/01/02 Coffee
+	; :food:
+	; ID: a
+	; RID: a1
+	Expenses:Food  $5.00
+	Assets:Checking  $-5.00
+
+2022/01/03 * Coffee Shop
+	; :dining:
+	; ID: a
+	; RID: a2
+	; Payee: Joe's
+	Expenses:Dining  $5.00
+	Assets:Checking  $-6.00
+	Assets:Cash  $1.00
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := ledger.DiffTransactions(&f.T[0], &f.T[1])
+	want := `Date: "2022/01/02" -> "2022/01/03"
+Status: "" -> "cleared"
+Description: "Coffee" -> "Coffee Shop"
++ Expenses:Dining  $5.00
+~ Assets:Checking  $-5.00 -> Assets:Checking  $-6.00
++ Assets:Cash  $1.00
+- Expenses:Food  $5.00
+Tags: +dining -food
+Payee: "" -> "Joe's"`
+	if d.String() != want {
+		t.Errorf("Incorrect diff:\n%v\n\nExpected:\n%v", d, want)
+	}
+
+	if d := ledger.DiffTransactions(&f.T[0], &f.T[0]); !d.Empty() {
+		t.Errorf("Diff of a transaction with itself is not empty:\n%v", d)
+	}
+}
+
+func TestIDCollisions(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+2022/01/01 Rent
+	; ID: a
+	; RID: a1
+	Expenses:Rent  $500.00
+	Assets:Checking
+
+2022/01/02 Coffee
+	; ID: b
+	; RID: b1
+	; FITID: 100
+	Expenses:Food  $5.00
+	Assets:Checking
+
+2022/01/05 Rent
+	; ID: a
+	; RID: a2
+	Expenses:Rent  $550.00
+	Assets:Checking
+
+2022/01/03 Tea
+	; ID: a
+	; RID: a3
+	Expenses:Food  $3.00
+	Assets:Checking
+
+2022/01/02 Coffee
+	; ID: b
+	; RID: b2
+	; FITID: 101
+	Expenses:Food  $5.00
+	Assets:Checking
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := f.IDCollisions()
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 collisions, got %v", errs)
+	}
+	for i, want := range [][2]int{{3, 2}, {4, 1}} {
+		err, ok := errs[i].(ledger.IDCollisionError)
+		if !ok || err.T != want[0] || err.Of != want[1] {
+			t.Errorf("Incorrect collision: %v", errs[i])
+		}
+	}
+	if len(f.ValidateHistory()) != 2 {
+		t.Errorf("ValidateHistory didn't report the collisions.")
+	}
+
+	// Only exact ID and RID duplicates are certain.
+	if errs := f.DuplicateRevisions(); errs != nil {
+		t.Errorf("Unexpected duplicates: %v", errs)
+	}
+	f.T = append(f.T, *f.T[2].CleanCopy())
+	errs = f.DuplicateRevisions()
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 duplicate, got %v", errs)
+	}
+	if err, ok := errs[0].(ledger.DuplicateIDError); !ok || err.T != 5 || err.Of != 2 {
+		t.Errorf("Incorrect duplicate: %v", errs[0])
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files in testdata/roundtrip from the current output.")
+
+// TestRoundTrip parses each journal in testdata/roundtrip, formats it, and parses the result again. Both parses must
+// give the same transactions and directives, and the formatted text must match the .golden file next to the journal.
+// Run with -update to accept changes to the formatted text.
+func TestRoundTrip(t *testing.T) {
+	paths, err := filepath.Glob("testdata/roundtrip/*.ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("No journals in testdata/roundtrip.")
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			want, err := parse.Load(path, parse.Options{KeepComments: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := &bytes.Buffer{}
+			err = want.Format(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := strings.TrimSuffix(path, ".ledger") + ".golden"
+			if *update {
+				err = os.WriteFile(golden, buf.Bytes(), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != string(expected) {
+				t.Errorf("Formatted output doesn't match %v:\n%v", golden, buf.String())
+			}
+
+			got, err := parse.Read(buf, golden, parse.Options{KeepComments: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareFiles(t, want, got)
+
+			// Formatting again changes nothing.
+			again := &bytes.Buffer{}
+			err = got.Format(again)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.String() != string(expected) {
+				t.Errorf("Formatting the output again changed it:\n%v", again.String())
+			}
+		})
+	}
+}
+
+// compareFiles fails the test if the files have different transactions or directives. Where things were found in
+// the source is ignored.
+func compareFiles(t *testing.T, want, got *ledger.File) {
+	t.Helper()
+
+	if len(got.T) != len(want.T) || len(got.D) != len(want.D) {
+		t.Fatalf("Expected %v transactions and %v directives, got %v and %v", len(want.T), len(want.D), len(got.T), len(got.D))
+	}
+	for i := range want.T {
+		w, g := want.T[i].CleanCopy(), got.T[i].CleanCopy()
+		for _, tr := range []*ledger.Transaction{w, g} {
+			tr.Location = ledger.Position{}
+			for j := range tr.Postings {
+				tr.Postings[j].Location = ledger.Position{}
+			}
+		}
+		if !reflect.DeepEqual(w, g) {
+			t.Errorf("Transaction %v is different:\n%#v\n%#v", i, w, g)
+		}
+	}
+	for i := range want.D {
+		if !got.D[i].Compare(want.D[i]) || got.D[i].FoundBefore != want.D[i].FoundBefore {
+			t.Errorf("Directive %v is different:\n%#v\n%#v", i, want.D[i], got.D[i])
+		}
+	}
+}
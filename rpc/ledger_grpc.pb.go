@@ -0,0 +1,439 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.21.12
+// source: ledger.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// LedgerClient is the client API for Ledger service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LedgerClient interface {
+	// ListTransactions returns the current revision of every transaction matching the filters, sorted by date.
+	ListTransactions(ctx context.Context, in *ListTransactionsRequest, opts ...grpc.CallOption) (*TransactionList, error)
+	// GetTransaction returns every revision of a transaction, oldest first.
+	GetTransaction(ctx context.Context, in *GetTransactionRequest, opts ...grpc.CallOption) (*TransactionList, error)
+	// AddTransaction adds a new transaction, and returns it with its ID and RID filled in.
+	AddTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Transaction, error)
+	// EditTransaction adds a new revision of the transaction with the same ID, and returns it with its new RID.
+	EditTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Transaction, error)
+	// VoidTransaction removes a transaction by adding a void revision.
+	VoidTransaction(ctx context.Context, in *VoidTransactionRequest, opts ...grpc.CallOption) (*VoidTransactionResponse, error)
+	// ListAccounts returns every account used by a transaction, sorted.
+	ListAccounts(ctx context.Context, in *ListAccountsRequest, opts ...grpc.CallOption) (*AccountList, error)
+	// GetBalances returns the account balances as display rows, with the account names already indented.
+	GetBalances(ctx context.Context, in *GetBalancesRequest, opts ...grpc.CallOption) (*Balances, error)
+	// GetRegister returns a register report.
+	GetRegister(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*Register, error)
+	// WatchEvents streams change events until the client hangs up.
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (Ledger_WatchEventsClient, error)
+}
+
+type ledgerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLedgerClient(cc grpc.ClientConnInterface) LedgerClient {
+	return &ledgerClient{cc}
+}
+
+func (c *ledgerClient) ListTransactions(ctx context.Context, in *ListTransactionsRequest, opts ...grpc.CallOption) (*TransactionList, error) {
+	out := new(TransactionList)
+	err := c.cc.Invoke(ctx, "/ledger.Ledger/ListTransactions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerClient) GetTransaction(ctx context.Context, in *GetTransactionRequest, opts ...grpc.CallOption) (*TransactionList, error) {
+	out := new(TransactionList)
+	err := c.cc.Invoke(ctx, "/ledger.Ledger/GetTransaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerClient) AddTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Transaction, error) {
+	out := new(Transaction)
+	err := c.cc.Invoke(ctx, "/ledger.Ledger/AddTransaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerClient) EditTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Transaction, error) {
+	out := new(Transaction)
+	err := c.cc.Invoke(ctx, "/ledger.Ledger/EditTransaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerClient) VoidTransaction(ctx context.Context, in *VoidTransactionRequest, opts ...grpc.CallOption) (*VoidTransactionResponse, error) {
+	out := new(VoidTransactionResponse)
+	err := c.cc.Invoke(ctx, "/ledger.Ledger/VoidTransaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerClient) ListAccounts(ctx context.Context, in *ListAccountsRequest, opts ...grpc.CallOption) (*AccountList, error) {
+	out := new(AccountList)
+	err := c.cc.Invoke(ctx, "/ledger.Ledger/ListAccounts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerClient) GetBalances(ctx context.Context, in *GetBalancesRequest, opts ...grpc.CallOption) (*Balances, error) {
+	out := new(Balances)
+	err := c.cc.Invoke(ctx, "/ledger.Ledger/GetBalances", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerClient) GetRegister(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*Register, error) {
+	out := new(Register)
+	err := c.cc.Invoke(ctx, "/ledger.Ledger/GetRegister", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (Ledger_WatchEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Ledger_ServiceDesc.Streams[0], "/ledger.Ledger/WatchEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ledgerWatchEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Ledger_WatchEventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type ledgerWatchEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *ledgerWatchEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LedgerServer is the server API for Ledger service.
+// All implementations must embed UnimplementedLedgerServer
+// for forward compatibility
+type LedgerServer interface {
+	// ListTransactions returns the current revision of every transaction matching the filters, sorted by date.
+	ListTransactions(context.Context, *ListTransactionsRequest) (*TransactionList, error)
+	// GetTransaction returns every revision of a transaction, oldest first.
+	GetTransaction(context.Context, *GetTransactionRequest) (*TransactionList, error)
+	// AddTransaction adds a new transaction, and returns it with its ID and RID filled in.
+	AddTransaction(context.Context, *Transaction) (*Transaction, error)
+	// EditTransaction adds a new revision of the transaction with the same ID, and returns it with its new RID.
+	EditTransaction(context.Context, *Transaction) (*Transaction, error)
+	// VoidTransaction removes a transaction by adding a void revision.
+	VoidTransaction(context.Context, *VoidTransactionRequest) (*VoidTransactionResponse, error)
+	// ListAccounts returns every account used by a transaction, sorted.
+	ListAccounts(context.Context, *ListAccountsRequest) (*AccountList, error)
+	// GetBalances returns the account balances as display rows, with the account names already indented.
+	GetBalances(context.Context, *GetBalancesRequest) (*Balances, error)
+	// GetRegister returns a register report.
+	GetRegister(context.Context, *RegisterRequest) (*Register, error)
+	// WatchEvents streams change events until the client hangs up.
+	WatchEvents(*WatchEventsRequest, Ledger_WatchEventsServer) error
+	mustEmbedUnimplementedLedgerServer()
+}
+
+// UnimplementedLedgerServer must be embedded to have forward compatible implementations.
+type UnimplementedLedgerServer struct {
+}
+
+func (UnimplementedLedgerServer) ListTransactions(context.Context, *ListTransactionsRequest) (*TransactionList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTransactions not implemented")
+}
+func (UnimplementedLedgerServer) GetTransaction(context.Context, *GetTransactionRequest) (*TransactionList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTransaction not implemented")
+}
+func (UnimplementedLedgerServer) AddTransaction(context.Context, *Transaction) (*Transaction, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddTransaction not implemented")
+}
+func (UnimplementedLedgerServer) EditTransaction(context.Context, *Transaction) (*Transaction, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EditTransaction not implemented")
+}
+func (UnimplementedLedgerServer) VoidTransaction(context.Context, *VoidTransactionRequest) (*VoidTransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VoidTransaction not implemented")
+}
+func (UnimplementedLedgerServer) ListAccounts(context.Context, *ListAccountsRequest) (*AccountList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAccounts not implemented")
+}
+func (UnimplementedLedgerServer) GetBalances(context.Context, *GetBalancesRequest) (*Balances, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBalances not implemented")
+}
+func (UnimplementedLedgerServer) GetRegister(context.Context, *RegisterRequest) (*Register, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRegister not implemented")
+}
+func (UnimplementedLedgerServer) WatchEvents(*WatchEventsRequest, Ledger_WatchEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedLedgerServer) mustEmbedUnimplementedLedgerServer() {}
+
+// UnsafeLedgerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LedgerServer will
+// result in compilation errors.
+type UnsafeLedgerServer interface {
+	mustEmbedUnimplementedLedgerServer()
+}
+
+func RegisterLedgerServer(s grpc.ServiceRegistrar, srv LedgerServer) {
+	s.RegisterService(&Ledger_ServiceDesc, srv)
+}
+
+func _Ledger_ListTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServer).ListTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ledger.Ledger/ListTransactions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServer).ListTransactions(ctx, req.(*ListTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ledger_GetTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServer).GetTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ledger.Ledger/GetTransaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServer).GetTransaction(ctx, req.(*GetTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ledger_AddTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Transaction)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServer).AddTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ledger.Ledger/AddTransaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServer).AddTransaction(ctx, req.(*Transaction))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ledger_EditTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Transaction)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServer).EditTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ledger.Ledger/EditTransaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServer).EditTransaction(ctx, req.(*Transaction))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ledger_VoidTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VoidTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServer).VoidTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ledger.Ledger/VoidTransaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServer).VoidTransaction(ctx, req.(*VoidTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ledger_ListAccounts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAccountsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServer).ListAccounts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ledger.Ledger/ListAccounts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServer).ListAccounts(ctx, req.(*ListAccountsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ledger_GetBalances_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBalancesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServer).GetBalances(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ledger.Ledger/GetBalances",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServer).GetBalances(ctx, req.(*GetBalancesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ledger_GetRegister_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServer).GetRegister(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ledger.Ledger/GetRegister",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServer).GetRegister(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ledger_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LedgerServer).WatchEvents(m, &ledgerWatchEventsServer{stream})
+}
+
+type Ledger_WatchEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type ledgerWatchEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *ledgerWatchEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Ledger_ServiceDesc is the grpc.ServiceDesc for Ledger service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ledger_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ledger.Ledger",
+	HandlerType: (*LedgerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListTransactions",
+			Handler:    _Ledger_ListTransactions_Handler,
+		},
+		{
+			MethodName: "GetTransaction",
+			Handler:    _Ledger_GetTransaction_Handler,
+		},
+		{
+			MethodName: "AddTransaction",
+			Handler:    _Ledger_AddTransaction_Handler,
+		},
+		{
+			MethodName: "EditTransaction",
+			Handler:    _Ledger_EditTransaction_Handler,
+		},
+		{
+			MethodName: "VoidTransaction",
+			Handler:    _Ledger_VoidTransaction_Handler,
+		},
+		{
+			MethodName: "ListAccounts",
+			Handler:    _Ledger_ListAccounts_Handler,
+		},
+		{
+			MethodName: "GetBalances",
+			Handler:    _Ledger_GetBalances_Handler,
+		},
+		{
+			MethodName: "GetRegister",
+			Handler:    _Ledger_GetRegister_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _Ledger_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ledger.proto",
+}
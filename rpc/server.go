@@ -0,0 +1,376 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+// Package rpc is a gRPC service for the ledger operations a Client provides. The service is defined in ledger.proto;
+// run go generate after changing it (protoc-gen-go and protoc-gen-go-grpc need to be installed).
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ledger.proto
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const dateFormat = "2006-01-02"
+
+// Server implements LedgerServer on top of a Client.
+type Server struct {
+	UnimplementedLedgerServer
+
+	c *client.Client
+}
+
+// NewServer returns a server for the given client. Register it with RegisterLedgerServer.
+func NewServer(c *client.Client) *Server {
+	return &Server{c: c}
+}
+
+// clientError converts an error from the client into a gRPC status error.
+func clientError(err error) error {
+	var berr ledger.BalanceError
+	var nerr ledger.MultipleNullError
+	switch {
+	case errors.Is(err, client.TransactionNotFoundError), errors.Is(err, client.MissingParentError):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, client.ReadOnlyError):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, client.ClosedError):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, client.MissingIDError), errors.As(err, &berr), errors.As(err, &nerr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func dateFilter(d DateFilter) (int, error) {
+	switch d {
+	case DateFilter_DATE_ALL:
+		return client.FilterAllDates, nil
+	case DateFilter_DATE_THIS_MONTH:
+		return client.FilterThisMonth, nil
+	case DateFilter_DATE_LAST_MONTH:
+		return client.FilterLastMonth, nil
+	case DateFilter_DATE_THIS_YEAR:
+		return client.FilterThisYear, nil
+	case DateFilter_DATE_LAST_YEAR:
+		return client.FilterLastYear, nil
+	default:
+		return 0, status.Errorf(codes.InvalidArgument, "Unknown date filter: %v", d)
+	}
+}
+
+func (s *Server) ListTransactions(ctx context.Context, req *ListTransactionsRequest) (*TransactionList, error) {
+	dfilter, err := dateFilter(req.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	sfilter := client.FilterAllStatus
+	switch req.Status {
+	case StatusFilter_STATUS_FILTER_ALL:
+	case StatusFilter_STATUS_FILTER_CLEARED:
+		sfilter = client.FilterClearStatus
+	case StatusFilter_STATUS_FILTER_PENDING:
+		sfilter = client.FilterPendingStatus
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown status filter: %v", req.Status)
+	}
+
+	tfilter := map[string]bool{}
+	for _, tag := range req.Tags {
+		tfilter[tag] = true
+	}
+	return toTransactionList(s.c.GetTransactions(dfilter, sfilter, tfilter)), nil
+}
+
+func (s *Server) GetTransaction(ctx context.Context, req *GetTransactionRequest) (*TransactionList, error) {
+	trs := s.c.GetTransactionWithHistory(req.Id)
+	if len(trs) == 0 {
+		return nil, clientError(client.TransactionNotFoundError)
+	}
+	return toTransactionList(trs), nil
+}
+
+func (s *Server) AddTransaction(ctx context.Context, req *Transaction) (*Transaction, error) {
+	tr, err := fromProto(req)
+	if err != nil {
+		return nil, err
+	}
+	delete(tr.KVPairs, "ID")
+
+	// AddTransaction fills in the IDs on our copy of the KV pairs.
+	err = s.c.AddTransaction(tr)
+	if err != nil {
+		return nil, clientError(err)
+	}
+	return toProto(&tr), nil
+}
+
+func (s *Server) EditTransaction(ctx context.Context, req *Transaction) (*Transaction, error) {
+	tr, err := fromProto(req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.c.AddTransactionEdit(tr)
+	if err != nil {
+		return nil, clientError(err)
+	}
+	return toProto(&tr), nil
+}
+
+func (s *Server) VoidTransaction(ctx context.Context, req *VoidTransactionRequest) (*VoidTransactionResponse, error) {
+	err := s.c.VoidTransaction(req.Id)
+	if err != nil {
+		return nil, clientError(err)
+	}
+	return &VoidTransactionResponse{}, nil
+}
+
+func (s *Server) ListAccounts(ctx context.Context, req *ListAccountsRequest) (*AccountList, error) {
+	return &AccountList{Accounts: s.c.GetAccountList()}, nil
+}
+
+func (s *Server) GetBalances(ctx context.Context, req *GetBalancesRequest) (*Balances, error) {
+	dfilter, err := dateFilter(req.Date)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.c.GetBalances(dfilter)
+	if err != nil {
+		return nil, clientError(err)
+	}
+
+	res := &Balances{}
+	for _, row := range rows {
+		res.Rows = append(res.Rows, &BalanceRow{Name: row[0], AmountText: row[1]})
+	}
+	return res, nil
+}
+
+func (s *Server) GetRegister(ctx context.Context, req *RegisterRequest) (*Register, error) {
+	q := ledger.ReportQuery{
+		Cleared:   req.Cleared,
+		Pending:   req.Pending,
+		Uncleared: req.Uncleared,
+		Related:   req.Related,
+	}
+
+	var err error
+	if req.Accounts != "" {
+		q.Account, err = regexp.Compile(req.Accounts)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	if req.Begin != "" {
+		q.Begin, err = time.Parse(dateFormat, req.Begin)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	if req.End != "" {
+		q.End, err = time.Parse(dateFormat, req.End)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	rows, err := s.c.GetRegister(q)
+	if err != nil {
+		return nil, clientError(err)
+	}
+
+	res := &Register{}
+	for _, row := range rows {
+		res.Rows = append(res.Rows, &RegisterRow{
+			Id:      row.ID,
+			Date:    row.Date.Format(dateFormat),
+			Payee:   row.Payee,
+			Account: row.Account,
+			Amount:  row.Amount,
+			Total:   row.Total,
+		})
+	}
+	return res, nil
+}
+
+func (s *Server) WatchEvents(req *WatchEventsRequest, stream Ledger_WatchEventsServer) error {
+	events, unsubscribe := s.c.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				return clientError(client.ClosedError)
+			}
+			// The event types are numbered the same as client.EventType.
+			err := stream.Send(&Event{Type: Event_Type(ev.Typ), Ids: ev.IDs})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func toTransactionList(trs []ledger.Transaction) *TransactionList {
+	res := &TransactionList{}
+	for i := range trs {
+		res.Transactions = append(res.Transactions, toProto(&trs[i]))
+	}
+	return res
+}
+
+func toStatus(tr *ledger.Transaction, p *ledger.Posting) Status {
+	s := tr.Status
+	if p != nil {
+		s = p.Status
+	}
+	switch s {
+	case ledger.StatusClear:
+		return Status_STATUS_CLEARED
+	case ledger.StatusPending:
+		return Status_STATUS_PENDING
+	default:
+		return Status_STATUS_UNDEFINED
+	}
+}
+
+// fromStatus returns an empty posting with the given status, since there isn't any other way to hold on to a status
+// outside the ledger package.
+func fromStatus(s Status) (ledger.Posting, error) {
+	switch s {
+	case Status_STATUS_UNDEFINED:
+		return ledger.Posting{}, nil
+	case Status_STATUS_PENDING:
+		return ledger.Posting{Status: ledger.StatusPending}, nil
+	case Status_STATUS_CLEARED:
+		return ledger.Posting{Status: ledger.StatusClear}, nil
+	default:
+		return ledger.Posting{}, status.Errorf(codes.InvalidArgument, "Unknown status: %v", s)
+	}
+}
+
+func toProto(tr *ledger.Transaction) *Transaction {
+	pt := &Transaction{
+		Id:          tr.KVPairs["ID"],
+		Rid:         tr.KVPairs["RID"],
+		Date:        tr.Date.Format(dateFormat),
+		Status:      toStatus(tr, nil),
+		Code:        tr.Code,
+		Description: tr.Description,
+		Comments:    tr.Comments,
+		Kv:          map[string]string{},
+	}
+	if !tr.ClearDate.IsZero() {
+		pt.ClearDate = tr.ClearDate.Format(dateFormat)
+	}
+	for i := range tr.Postings {
+		p := &tr.Postings[i]
+		pt.Postings = append(pt.Postings, &Posting{
+			Status:    toStatus(tr, p),
+			Account:   p.Account,
+			Amount:    p.Value,
+			Null:      p.Null,
+			HasAssert: p.HasAssert,
+			Assert:    p.Assert,
+			Note:      p.Note,
+		})
+	}
+	for tag := range tr.Tags {
+		pt.Tags = append(pt.Tags, tag)
+	}
+	sort.Strings(pt.Tags)
+	for k, v := range tr.KVPairs {
+		if k != "ID" && k != "RID" {
+			pt.Kv[k] = v
+		}
+	}
+	return pt
+}
+
+// fromProto converts a transaction sent to the server to a ledger.Transaction. The RID is always left out, since the
+// client sets it.
+func fromProto(pt *Transaction) (ledger.Transaction, error) {
+	tr := ledger.Transaction{
+		Code:        pt.Code,
+		Description: pt.Description,
+		Comments:    pt.Comments,
+		Tags:        map[string]bool{},
+		KVPairs:     map[string]string{},
+	}
+
+	var err error
+	tr.Date, err = time.Parse(dateFormat, pt.Date)
+	if err != nil {
+		return tr, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if pt.ClearDate != "" {
+		tr.ClearDate, err = time.Parse(dateFormat, pt.ClearDate)
+		if err != nil {
+			return tr, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	st, err := fromStatus(pt.Status)
+	if err != nil {
+		return tr, err
+	}
+	tr.Status = st.Status
+
+	for _, pp := range pt.Postings {
+		p, err := fromStatus(pp.Status)
+		if err != nil {
+			return tr, err
+		}
+		p.Account = pp.Account
+		p.Value = pp.Amount
+		p.Null = pp.Null
+		p.HasAssert = pp.HasAssert
+		p.Assert = pp.Assert
+		p.Note = pp.Note
+		tr.Postings = append(tr.Postings, p)
+	}
+	for _, tag := range pt.Tags {
+		tr.Tags[tag] = true
+	}
+	for k, v := range pt.Kv {
+		tr.KVPairs[k] = v
+	}
+	delete(tr.KVPairs, "RID")
+	if pt.Id != "" {
+		tr.KVPairs["ID"] = pt.Id
+	}
+	return tr, nil
+}
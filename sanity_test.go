@@ -23,6 +23,10 @@ misrepresented as being the original software.
 package ledger_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/samuellwn/ledger"
@@ -171,3 +175,54 @@ func TestBasicFunction(t *testing.T) {
 	}
 
 }
+
+// limitWriter fails once more than n bytes have been written to it.
+type limitWriter struct {
+	n int
+}
+
+var errFull = errors.New("Disk full.")
+
+func (w *limitWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errFull
+	}
+	w.n -= len(b)
+	return len(b), nil
+}
+
+func TestFormatErrors(t *testing.T) {
+	buf := &strings.Builder{}
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(buf, "2012/03/%02d * Groceries %v\n\tExpenses:Food  $20.00\n\tAssets:Cash\n\n", i%28+1, i)
+	}
+	f, err := parse.ParseLedger(parse.NewCharReader(buf.String(), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	if err = f.Format(out); err != nil {
+		t.Fatal(err)
+	}
+
+	// Errors are returned no matter where they happen, including the last flush.
+	for _, n := range []int{0, 5000, out.Len() - 1} {
+		err = f.Format(&limitWriter{n: n})
+		if !errors.Is(err, errFull) || !strings.HasPrefix(err.Error(), "Failed to write ") {
+			t.Errorf("Incorrect error with %v bytes: %v", n, err)
+		}
+	}
+	if err = f.Format(&limitWriter{n: out.Len()}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Directives that don't fit between the transactions fail before anything is written.
+	f.D = append(f.D, ledger.Directive{Type: "year", Argument: "2012", FoundBefore: len(f.T) + 1})
+	out.Reset()
+	if err = f.Format(out); err != ledger.ErrImproperInterleave || out.Len() != 0 {
+		t.Errorf("Incorrect error: %v (%v bytes written)", err, out.Len())
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"regexp"
+	"time"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Series is a named list of values over time, ready for plotting.
+type Series struct {
+	Name   string
+	Points []SeriesPoint
+}
+
+// SeriesPoint is a single value of a series. For series split into periods, Date is the start of the period the
+// value is for, and the value is either the balance at the end of the period or the sum over the period.
+type SeriesPoint struct {
+	Date  time.Time
+	Value int64
+}
+
+type jsonSeries struct {
+	Name   string        `json:"name"`
+	Points []SeriesPoint `json:"points"`
+}
+
+type jsonSeriesPoint struct {
+	Date       string `json:"date"`
+	Amount     int64  `json:"amount"`
+	AmountText string `json:"amountText"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Series) MarshalJSON() ([]byte, error) {
+	js := jsonSeries{Name: s.Name, Points: s.Points}
+	if js.Points == nil {
+		js.Points = []SeriesPoint{}
+	}
+	return json.Marshal(js)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p SeriesPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonSeriesPoint{
+		Date:       p.Date.Format(jsonDate),
+		Amount:     p.Value,
+		AmountText: FormatValue(p.Value),
+	})
+}
+
+var netWorthAccounts = regexp.MustCompile(`^(Assets|Liabilities)(:|$)`)
+var cashFlowAccounts = regexp.MustCompile(`^(Income|Expenses)(:|$)`)
+
+// NetWorth returns the net worth (assets minus liabilities) at the end of each period. The account in the query
+// is ignored, everything under Assets and Liabilities is counted. Transactions before the query's begin date still
+// count towards the balances.
+// Returns an error if any of the transactions do not balance.
+func (f *File) NetWorth(q ReportQuery, interval Interval) (*Series, error) {
+	q.Account = netWorthAccounts
+	report, err := f.balanceHistory(q, interval, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Series{Name: "Net Worth", Points: make([]SeriesPoint, len(report.Periods))}
+	for i, p := range report.Periods {
+		s.Points[i].Date = p
+		for _, sums := range report.Sums {
+			s.Points[i].Value += sums[i]
+		}
+	}
+	return s, nil
+}
+
+// CashFlow returns three series: the income, the expenses, and the net of the two (income less expenses) for each
+// period. Income is negated so that money earned is positive. The account in the query is ignored, everything under
+// Income and Expenses is counted.
+// Returns an error if any of the selected transactions do not balance.
+func (f *File) CashFlow(q ReportQuery, interval Interval) ([]Series, error) {
+	q.Account = cashFlowAccounts
+	report, err := f.PeriodicReport(q, interval, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	income := Series{Name: "Income", Points: make([]SeriesPoint, len(report.Periods))}
+	expenses := Series{Name: "Expenses", Points: make([]SeriesPoint, len(report.Periods))}
+	net := Series{Name: "Net", Points: make([]SeriesPoint, len(report.Periods))}
+	for i, p := range report.Periods {
+		in, out := int64(0), int64(0)
+		if sums, ok := report.Sums["Income"]; ok {
+			in = -sums[i]
+		}
+		if sums, ok := report.Sums["Expenses"]; ok {
+			out = sums[i]
+		}
+		income.Points[i] = SeriesPoint{Date: p, Value: in}
+		expenses.Points[i] = SeriesPoint{Date: p, Value: out}
+		net.Points[i] = SeriesPoint{Date: p, Value: in - out}
+	}
+	return []Series{income, expenses, net}, nil
+}
+
+// BalanceHistory returns the balance of each account selected by the query at the end of each period, one series per
+// account sorted by name. Depth works the same as it does for BalanceReport. Transactions before the query's begin
+// date still count towards the balances.
+// Returns an error if any of the transactions do not balance.
+func (f *File) BalanceHistory(q ReportQuery, interval Interval, depth int) ([]Series, error) {
+	report, err := f.balanceHistory(q, interval, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := maps.Keys(report.Sums)
+	slices.Sort(accounts)
+	series := make([]Series, 0, len(accounts))
+	for _, account := range accounts {
+		s := Series{Name: account, Points: make([]SeriesPoint, len(report.Periods))}
+		for i, p := range report.Periods {
+			s.Points[i] = SeriesPoint{Date: p, Value: report.Sums[account][i]}
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+// balanceHistory is PeriodicReport with running totals instead of per period sums. The totals start from the
+// balances as of the query's begin date.
+func (f *File) balanceHistory(q ReportQuery, interval Interval, depth int) (*PeriodReport, error) {
+	opening := map[string]int64{}
+	if !q.Begin.IsZero() {
+		oq := q
+		oq.Begin, oq.End = time.Time{}, q.Begin
+		var err error
+		opening, err = f.BalanceReport(oq, depth)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report, err := f.PeriodicReport(q, interval, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for account, v := range opening {
+		if v == 0 {
+			continue
+		}
+		if _, ok := report.Sums[account]; !ok {
+			report.Sums[account] = make([]int64, len(report.Periods))
+		}
+	}
+	for account, sums := range report.Sums {
+		total := opening[account]
+		for i := range sums {
+			total += sums[i]
+			sums[i] = total
+		}
+	}
+	return report, nil
+}
+
+// WriteSeriesCSV writes the series as CSV, with a date column followed by one column for each series. All of the
+// series must have the same dates, as the ones returned by a single call to NetWorth, CashFlow, or BalanceHistory do.
+func WriteSeriesCSV(w io.Writer, series ...Series) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"date"}
+	for _, s := range series {
+		header = append(header, s.Name)
+	}
+	err := cw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	if len(series) != 0 {
+		for i, p := range series[0].Points {
+			row := []string{p.Date.Format("2006-01-02")}
+			for _, s := range series {
+				row = append(row, FormatValueNumber(s.Points[i].Value))
+			}
+			err := cw.Write(row)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
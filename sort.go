@@ -0,0 +1,141 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import "sort"
+
+// SortKey is a single thing to order transactions by.
+type SortKey int
+
+const (
+	SortDate     SortKey = iota // Earlier dates first, including the time of day (see Transaction.HasTime).
+	SortID                      // Lexically by the "ID" KV pair, transactions with an ID first.
+	SortRID                     // Lexically by the "RID" KV pair, transactions with a RID first.
+	SortFITID                   // Lexically by the "FITID" KV pair, transactions with a FITID first.
+	SortLocation                // By the line (then column) the transaction was parsed from.
+)
+
+// DefaultSort is the order used by File.Sort if no keys are given.
+var DefaultSort = []SortKey{SortDate, SortID, SortRID, SortLocation}
+
+// CompareTransactions compares two transactions by each of the keys in turn until one of them tells the
+// transactions apart. Returns -1 if a goes first, 1 if b goes first, or 0 if none of the keys can order them.
+func CompareTransactions(a, b *Transaction, keys ...SortKey) int {
+	for _, key := range keys {
+		dir := 0
+		switch key {
+		case SortDate:
+			if a.Date.Before(b.Date) {
+				dir = -1
+			} else if a.Date.After(b.Date) {
+				dir = 1
+			}
+		case SortID:
+			dir = compareKV(a.KVPairs, b.KVPairs, "ID")
+		case SortRID:
+			dir = compareKV(a.KVPairs, b.KVPairs, "RID")
+		case SortFITID:
+			dir = compareKV(a.KVPairs, b.KVPairs, "FITID")
+		case SortLocation:
+			dir = compareUint(a.Location.Line(), b.Location.Line())
+			if dir == 0 {
+				dir = compareUint(uint64(a.Location.Column()), uint64(b.Location.Column()))
+			}
+		}
+		if dir != 0 {
+			return dir
+		}
+	}
+	return 0
+}
+
+func compareUint(a, b uint64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// -1 == a, 0 == neither, 1 == b
+func compareKV(a, b map[string]string, key string) int {
+	id1, ok1 := a[key]
+	id2, ok2 := b[key]
+
+	// If only one has the key, that one goes first.
+	if ok1 && !ok2 {
+		return -1
+	}
+	if !ok1 && ok2 {
+		return 1
+	}
+
+	// If neither has the key or both have identical values.
+	if id1 == id2 {
+		return 0
+	}
+
+	if id1 < id2 {
+		return -1
+	}
+	return 1
+}
+
+// SortTransactions does a stable sort of a list of transactions using CompareTransactions with the given keys.
+func SortTransactions(trs []Transaction, keys ...SortKey) {
+	sort.SliceStable(trs, func(i, j int) bool {
+		return CompareTransactions(&trs[i], &trs[j], keys...) < 0
+	})
+}
+
+// Sort does a stable sort of the transactions in this file using the given keys, or DefaultSort if there are
+// none. Directives stay in front of the same transaction they were in front of before the sort.
+func (f *File) Sort(keys ...SortKey) {
+	if len(keys) == 0 {
+		keys = DefaultSort
+	}
+
+	order := make([]int, len(f.T))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return CompareTransactions(&f.T[order[i]], &f.T[order[j]], keys...) < 0
+	})
+
+	trs := make([]Transaction, len(f.T))
+	moved := make([]int, len(f.T))
+	for to, from := range order {
+		trs[to] = f.T[from]
+		moved[from] = to
+	}
+	f.T = trs
+
+	for i := range f.D {
+		if f.D[i].FoundBefore < len(moved) {
+			f.D[i].FoundBefore = moved[f.D[i].FoundBefore]
+		}
+	}
+}
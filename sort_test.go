@@ -0,0 +1,122 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse/lex"
+)
+
+// sortTransaction makes a transaction for the sort tests. The KV pairs are given as key, value, key, value, ...
+func sortTransaction(date string, line uint64, col uint16, kv ...string) ledger.Transaction {
+	d, err := time.Parse("2006/01/02 15:04", date)
+	if err != nil {
+		d, _ = time.Parse("2006/01/02", date)
+	}
+	tr := ledger.Transaction{
+		Date:     d,
+		KVPairs:  map[string]string{},
+		Location: ledger.Position{Location: lex.Location(0).L(line).C(col)},
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		tr.KVPairs[kv[i]] = kv[i+1]
+	}
+	return tr
+}
+
+func TestCompareTransactions(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b ledger.Transaction
+		keys []ledger.SortKey
+		want int
+	}{
+		{"date", sortTransaction("2022/01/01", 9, 0), sortTransaction("2022/01/02", 1, 0), ledger.DefaultSort, -1},
+		{"time of day", sortTransaction("2022/01/01 13:00", 1, 0), sortTransaction("2022/01/01 09:00", 9, 0), ledger.DefaultSort, 1},
+		{"ID breaks date tie", sortTransaction("2022/01/01", 1, 0, "ID", "b"), sortTransaction("2022/01/01", 9, 0, "ID", "a"), ledger.DefaultSort, 1},
+		{"with ID first", sortTransaction("2022/01/01", 9, 0, "ID", "z"), sortTransaction("2022/01/01", 1, 0), ledger.DefaultSort, -1},
+		{"RID breaks ID tie", sortTransaction("2022/01/01", 9, 0, "ID", "a", "RID", "1"), sortTransaction("2022/01/01", 1, 0, "ID", "a", "RID", "2"), ledger.DefaultSort, -1},
+		{"line breaks tie", sortTransaction("2022/01/01", 9, 0, "ID", "a"), sortTransaction("2022/01/01", 1, 0, "ID", "a"), ledger.DefaultSort, 1},
+		{"column breaks tie", sortTransaction("2022/01/01", 1, 4, "ID", "a"), sortTransaction("2022/01/01", 1, 2, "ID", "a"), ledger.DefaultSort, 1},
+		{"all equal", sortTransaction("2022/01/01", 1, 0), sortTransaction("2022/01/01", 1, 0), ledger.DefaultSort, 0},
+		{"FITID", sortTransaction("2022/01/02", 1, 0, "FITID", "100"), sortTransaction("2022/01/01", 1, 0, "FITID", "099"), []ledger.SortKey{ledger.SortFITID}, 1},
+		{"FITID then date", sortTransaction("2022/01/02", 1, 0, "FITID", "1"), sortTransaction("2022/01/01", 1, 0, "FITID", "1"), []ledger.SortKey{ledger.SortFITID, ledger.SortDate}, 1},
+		{"no keys", sortTransaction("2022/01/02", 1, 0), sortTransaction("2022/01/01", 1, 0), nil, 0},
+	}
+
+	for _, c := range cases {
+		if got := ledger.CompareTransactions(&c.a, &c.b, c.keys...); got != c.want {
+			t.Errorf("%v: expected %v, got %v.", c.name, c.want, got)
+		}
+		if got := ledger.CompareTransactions(&c.b, &c.a, c.keys...); got != -c.want {
+			t.Errorf("%v: expected %v with the arguments swapped, got %v.", c.name, -c.want, got)
+		}
+	}
+}
+
+func TestSortTransactions(t *testing.T) {
+	cases := []struct {
+		name string
+		keys []ledger.SortKey
+		want []string // Descriptions in the expected order.
+	}{
+		{"default", ledger.DefaultSort, []string{"a1", "a2", "b", "no id", "c"}},
+		{"date only", []ledger.SortKey{ledger.SortDate}, []string{"b", "a2", "no id", "a1", "c"}},
+		{"ID only", []ledger.SortKey{ledger.SortID}, []string{"a2", "a1", "b", "c", "no id"}},
+		{"location", []ledger.SortKey{ledger.SortLocation}, []string{"c", "a1", "no id", "b", "a2"}},
+	}
+
+	for _, c := range cases {
+		// Listed in a different order than any of the cases want, so the result depends on the keys. The date only
+		// case keeps the list order for the ties, since the sort is stable.
+		trs := []ledger.Transaction{
+			sortTransaction("2022/01/01", 20, 0, "ID", "b"),
+			sortTransaction("2022/01/01", 40, 0, "ID", "a", "RID", "2"),
+			sortTransaction("2022/01/01", 15, 0),
+			sortTransaction("2022/01/01", 10, 0, "ID", "a", "RID", "1"),
+			sortTransaction("2022/01/03", 5, 0, "ID", "c"),
+		}
+		names := []string{"b", "a2", "no id", "a1", "c"}
+		for i := range trs {
+			trs[i].Description = names[i]
+		}
+
+		ledger.SortTransactions(trs, c.keys...)
+		got := []string{}
+		for _, tr := range trs {
+			got = append(got, tr.Description)
+		}
+		if len(got) != len(c.want) {
+			t.Fatalf("%v: lost transactions: %v", c.name, got)
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%v: expected %v, got %v.", c.name, c.want, got)
+				break
+			}
+		}
+	}
+}
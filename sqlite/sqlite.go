@@ -0,0 +1,439 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse/lex"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// schema is the layout of a journal database. Every transaction is stored, including old revisions, and seq
+// keeps the file order. Amounts are integers in ten thousandths of a dollar, same as in Posting. Null postings have
+// their amount filled in (if the transaction balances) but are marked null so loading the database gives back the
+// same file. The register view has amounts in dollars, for the latest revision of every transaction only.
+const schema = `
+DROP VIEW IF EXISTS register;
+DROP TABLE IF EXISTS directive_lines;
+DROP TABLE IF EXISTS directives;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS kv;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS postings;
+DROP TABLE IF EXISTS transactions;
+
+CREATE TABLE transactions (
+	seq         INTEGER PRIMARY KEY,
+	date        TEXT NOT NULL,
+	clear_date  TEXT,
+	status      TEXT NOT NULL,
+	code        TEXT NOT NULL,
+	description TEXT NOT NULL,
+	id          TEXT,
+	rid         TEXT,
+	latest      INTEGER NOT NULL,
+	line        INTEGER NOT NULL
+);
+
+CREATE TABLE postings (
+	seq        INTEGER NOT NULL REFERENCES transactions(seq),
+	idx        INTEGER NOT NULL,
+	status     TEXT NOT NULL,
+	account    TEXT NOT NULL,
+	amount     INTEGER,
+	is_null    INTEGER NOT NULL,
+	assert     INTEGER,
+	note       TEXT NOT NULL,
+	PRIMARY KEY (seq, idx)
+);
+CREATE INDEX postings_account ON postings(account);
+
+CREATE TABLE tags (
+	seq INTEGER NOT NULL REFERENCES transactions(seq),
+	tag TEXT NOT NULL,
+	PRIMARY KEY (seq, tag)
+);
+
+CREATE TABLE kv (
+	seq   INTEGER NOT NULL REFERENCES transactions(seq),
+	key   TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (seq, key)
+);
+
+CREATE TABLE comments (
+	seq  INTEGER NOT NULL REFERENCES transactions(seq),
+	idx  INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	PRIMARY KEY (seq, idx)
+);
+
+CREATE TABLE directives (
+	dseq         INTEGER PRIMARY KEY,
+	type         TEXT NOT NULL,
+	argument     TEXT NOT NULL,
+	found_before INTEGER NOT NULL,
+	line         INTEGER NOT NULL
+);
+
+CREATE TABLE directive_lines (
+	dseq INTEGER NOT NULL REFERENCES directives(dseq),
+	idx  INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	PRIMARY KEY (dseq, idx)
+);
+
+CREATE VIEW register AS
+	SELECT t.seq, t.date, t.description, p.account, p.amount / 10000.0 AS amount, p.status, t.status AS transaction_status
+	FROM transactions t JOIN postings p ON p.seq = t.seq
+	WHERE t.latest
+	ORDER BY t.date, t.seq, p.idx;
+`
+
+// Export writes the file to a SQLite database at the given path, for running SQL queries over it. The database is
+// created if it doesn't exist, and any journal tables already in it are replaced. See schema for the layout. Load
+// reads it back.
+//
+// A driver named "sqlite3" must be registered, the tools use github.com/mattn/go-sqlite3.
+func Export(f *ledger.File, path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Fill in null postings where possible. The latest revisions get balance assignments resolved, anything else
+	// (old revisions and voids) just gets balanced on its own.
+	filled := map[int][]int64{}
+	if rows, err := f.Register(ledger.ReportQuery{}); err == nil {
+		for _, row := range rows {
+			if filled[row.T] == nil {
+				filled[row.T] = make([]int64, len(f.T[row.T].Postings))
+			}
+			filled[row.T][row.P] = row.Amount
+		}
+	}
+	latest := map[int]bool{}
+	for _, h := range f.History() {
+		if i := h.Latest(); !f.T[i].Voided() {
+			latest[i] = true
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(schema)
+	if err != nil {
+		return err
+	}
+
+	for i := range f.T {
+		tr := &f.T[i]
+		_, err = tx.Exec(`INSERT INTO transactions VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, i, tr.Date.Format("2006-01-02"),
+			dateValue(tr.ClearDate), tr.Status.String(), tr.Code, tr.Description, textValue(tr.KVPairs["ID"]),
+			textValue(tr.KVPairs["RID"]), latest[i], tr.Location.Line())
+		if err != nil {
+			return err
+		}
+
+		values := postingValues(tr, filled[i])
+		for j, p := range tr.Postings {
+			var assert interface{}
+			if p.HasAssert {
+				assert = p.Assert
+			}
+			_, err = tx.Exec(`INSERT INTO postings VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, i, j, p.Status.String(), p.Account,
+				values[j], p.Null, assert, p.Note)
+			if err != nil {
+				return err
+			}
+		}
+
+		tags := maps.Keys(tr.Tags)
+		slices.Sort(tags)
+		for _, tag := range tags {
+			_, err = tx.Exec(`INSERT INTO tags VALUES (?, ?)`, i, tag)
+			if err != nil {
+				return err
+			}
+		}
+		for k, v := range tr.KVPairs {
+			_, err = tx.Exec(`INSERT INTO kv VALUES (?, ?, ?)`, i, k, v)
+			if err != nil {
+				return err
+			}
+		}
+		for j, line := range tr.Comments {
+			_, err = tx.Exec(`INSERT INTO comments VALUES (?, ?, ?)`, i, j, line)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, d := range f.D {
+		_, err = tx.Exec(`INSERT INTO directives VALUES (?, ?, ?, ?, ?)`, i, d.Type, d.Argument, d.FoundBefore, d.Location.Line())
+		if err != nil {
+			return err
+		}
+		for j, line := range d.Lines {
+			_, err = tx.Exec(`INSERT INTO directive_lines VALUES (?, ?, ?)`, i, j, line)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// postingValues returns the amount of each posting in the transaction, with null postings filled in from the
+// register values for the transaction if there are any. Amounts that can't be worked out are nil.
+func postingValues(tr *ledger.Transaction, filled []int64) []interface{} {
+	values := make([]interface{}, len(tr.Postings))
+	if filled != nil {
+		for j := range values {
+			values[j] = filled[j]
+		}
+		return values
+	}
+
+	// Without register values there are no balance assignments to worry about, a single null posting is just
+	// whatever it takes to balance.
+	sum, nulls := int64(0), 0
+	for j, p := range tr.Postings {
+		if p.Null {
+			nulls++
+			continue
+		}
+		values[j] = p.Value
+		sum += p.Value
+	}
+	for j, p := range tr.Postings {
+		if p.Null && nulls == 1 && !p.HasAssert {
+			values[j] = -sum
+		}
+	}
+	return values
+}
+
+func dateValue(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format("2006-01-02")
+}
+
+func textValue(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// Load reads a file back from a database written by Export.
+func Load(path string) (*ledger.File, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	f := &ledger.File{T: []ledger.Transaction{}, D: []ledger.Directive{}}
+	bySeq := map[int]int{}
+
+	rows, err := db.Query(`SELECT seq, date, clear_date, status, code, description, line FROM transactions ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var seq int
+		var date, status string
+		var clear sql.NullString
+		var line uint64
+		tr := ledger.Transaction{Tags: map[string]bool{}, KVPairs: map[string]string{}}
+		err = rows.Scan(&seq, &date, &clear, &status, &tr.Code, &tr.Description, &line)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tr.Date, err = time.Parse("2006-01-02", date)
+		if err == nil && clear.Valid {
+			tr.ClearDate, err = time.Parse("2006-01-02", clear.String)
+		}
+		if err == nil {
+			tr.Status, err = ledger.ParseStatus(status)
+		}
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Malformed transaction %v: %w", seq, err)
+		}
+		tr.Location = ledger.Position{Location: lex.Location(0).L(line)}
+		bySeq[seq] = len(f.T)
+		f.T = append(f.T, tr)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Everything else hangs off of a transaction.
+	lookup := func(seq int) (*ledger.Transaction, error) {
+		i, ok := bySeq[seq]
+		if !ok {
+			return nil, fmt.Errorf("Database refers to missing transaction %v.", seq)
+		}
+		return &f.T[i], nil
+	}
+
+	rows, err = db.Query(`SELECT seq, status, account, amount, is_null, assert, note FROM postings ORDER BY seq, idx`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var seq int
+		var status string
+		var amount, assert sql.NullInt64
+		p := ledger.Posting{}
+		err = rows.Scan(&seq, &status, &p.Account, &amount, &p.Null, &assert, &p.Note)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tr, err := lookup(seq)
+		if err == nil {
+			p.Status, err = ledger.ParseStatus(status)
+		}
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !p.Null {
+			p.Value = amount.Int64
+		}
+		p.Assert, p.HasAssert = assert.Int64, assert.Valid
+		tr.Postings = append(tr.Postings, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = eachRow(db, `SELECT seq, tag, '' FROM tags`, func(seq int, tag, _ string) error {
+		tr, err := lookup(seq)
+		if err == nil {
+			tr.Tags[tag] = true
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = eachRow(db, `SELECT seq, key, value FROM kv`, func(seq int, k, v string) error {
+		tr, err := lookup(seq)
+		if err == nil {
+			tr.KVPairs[k] = v
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = eachRow(db, `SELECT seq, text, '' FROM comments ORDER BY seq, idx`, func(seq int, line, _ string) error {
+		tr, err := lookup(seq)
+		if err == nil {
+			tr.Comments = append(tr.Comments, line)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byDSeq := map[int]int{}
+	rows, err = db.Query(`SELECT dseq, type, argument, found_before, line FROM directives ORDER BY dseq`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var dseq int
+		var line uint64
+		d := ledger.Directive{}
+		err = rows.Scan(&dseq, &d.Type, &d.Argument, &d.FoundBefore, &line)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.Location = ledger.Position{Location: lex.Location(0).L(line)}
+		byDSeq[dseq] = len(f.D)
+		f.D = append(f.D, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	err = eachRow(db, `SELECT dseq, text, '' FROM directive_lines ORDER BY dseq, idx`, func(dseq int, line, _ string) error {
+		i, ok := byDSeq[dseq]
+		if !ok {
+			return fmt.Errorf("Database refers to missing directive %v.", dseq)
+		}
+		f.D[i].Lines = append(f.D[i].Lines, line)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// eachRow runs a query returning a sequence number and two strings, and calls fn for each row.
+func eachRow(db *sql.DB, query string, fn func(seq int, a, b string) error) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var seq int
+		var a, b string
+		err = rows.Scan(&seq, &a, &b)
+		if err != nil {
+			return err
+		}
+		err = fn(seq, a, b)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sqlite_test
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/samuellwn/ledger/parse"
+	"github.com/samuellwn/ledger/sqlite"
+)
+
+func TestSQLiteRoundTrip(t *testing.T) {
+	f, err := parse.ParseLedgerString(`
+account Assets:Checking
+	note Main account
+
+2022/01/02 * (101) Coffee Shop
+	; A comment
+	; :food:
+	; ID: a1
+	; RID: r1
+	Expenses:Dining                                                $4.50 ; large
+	Assets:Checking
+
+2022/01/02 * (101) Coffee Shop
+	; :food:
+	; ID: a1
+	; RID: r2
+	Expenses:Dining                                                $5.00
+	! Assets:Checking                                              = $-5.00
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "journal.db")
+	err = sqlite.Export(f, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Exporting again replaces the old tables.
+	err = sqlite.Export(f, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var total float64
+	err = db.QueryRow(`SELECT SUM(amount) FROM register WHERE account = 'Assets:Checking'`).Scan(&total)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != -5 {
+		t.Errorf("Expected a register total of -5, got %v.", total)
+	}
+
+	nf, err := sqlite.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, got := new(bytes.Buffer), new(bytes.Buffer)
+	f.Format(want)
+	nf.Format(got)
+	if want.String() != got.String() {
+		t.Errorf("Loaded file doesn't match:\n%v\n%v", want, got)
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// AccountSuggestion is an account suggested by an AccountModel, along with a score between 0 and 1. The scores of
+// all suggestions for a description add up to 1.
+type AccountSuggestion struct {
+	Account string
+	Score   float64
+}
+
+// AccountModel is a simple frequency model of which accounts are used with which description words. It is used to
+// suggest accounts for new transactions based on how similar transactions were categorized in the past.
+type AccountModel struct {
+	docs   int                       // Number of transactions seen.
+	df     map[string]int            // Number of transactions each token appears in.
+	tokens map[string]map[string]int // Token -> account -> number of transactions.
+	exact  map[string]map[string]int // Whole normalized description -> account -> number of transactions.
+}
+
+// NewAccountModel builds a model from a list of transactions. The list should not contain old revisions of
+// transactions, see File.SuggestAccount.
+func NewAccountModel(trs []Transaction) *AccountModel {
+	m := &AccountModel{
+		df:     map[string]int{},
+		tokens: map[string]map[string]int{},
+		exact:  map[string]map[string]int{},
+	}
+	for _, tr := range trs {
+		m.Add(&tr)
+	}
+	return m
+}
+
+// Add adds a transaction to the model.
+func (m *AccountModel) Add(tr *Transaction) {
+	m.docs++
+
+	accounts := map[string]bool{}
+	for _, p := range tr.Postings {
+		accounts[p.Account] = true
+	}
+
+	for _, tok := range descriptionTokens(tr.Description) {
+		m.df[tok]++
+		if m.tokens[tok] == nil {
+			m.tokens[tok] = map[string]int{}
+		}
+		for account := range accounts {
+			m.tokens[tok][account]++
+		}
+	}
+
+	norm := normalizeDescription(tr.Description)
+	if m.exact[norm] == nil {
+		m.exact[norm] = map[string]int{}
+	}
+	for account := range accounts {
+		m.exact[norm][account]++
+	}
+}
+
+// SuggestAccount returns accounts used with similar descriptions, best first. Accounts that show up on nearly every
+// transaction (such as a checking account) will rank highly for everything, so those should be excluded, along
+// with any placeholder account like Unknown:Account.
+func (m *AccountModel) SuggestAccount(desc string, exclude ...string) []AccountSuggestion {
+	skip := map[string]bool{}
+	for _, account := range exclude {
+		skip[account] = true
+	}
+
+	scores := map[string]float64{}
+	for _, tok := range descriptionTokens(desc) {
+		df := m.df[tok]
+		if df == 0 {
+			continue
+		}
+		// Rare words say more about a transaction than common ones.
+		weight := math.Log(1 + float64(m.docs)/float64(df))
+		for account, n := range m.tokens[tok] {
+			if !skip[account] {
+				scores[account] += weight * float64(n) / float64(df)
+			}
+		}
+	}
+
+	// Having seen the exact same description before is a very strong hint.
+	if exact := m.exact[normalizeDescription(desc)]; exact != nil {
+		total := 0
+		for account, n := range exact {
+			if !skip[account] {
+				total += n
+			}
+		}
+		for account, n := range exact {
+			if !skip[account] {
+				scores[account] += 10 * float64(n) / float64(total)
+			}
+		}
+	}
+
+	total := 0.0
+	for _, score := range scores {
+		total += score
+	}
+
+	suggestions := make([]AccountSuggestion, 0, len(scores))
+	for account, score := range scores {
+		if score > 0 {
+			suggestions = append(suggestions, AccountSuggestion{Account: account, Score: score / total})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Account < suggestions[j].Account
+	})
+	return suggestions
+}
+
+// SuggestAccount builds an AccountModel from the latest revision of every transaction in the file, and returns
+// its suggestions for the description. If you need suggestions for more than one description, build the model
+// once with File.AccountModel instead.
+func (f *File) SuggestAccount(desc string, exclude ...string) []AccountSuggestion {
+	return f.AccountModel().SuggestAccount(desc, exclude...)
+}
+
+// AccountModel builds an AccountModel from the latest revision of every transaction in the file.
+func (f *File) AccountModel() *AccountModel {
+	ixs := f.latestRevisions()
+	latest := make([]Transaction, 0, len(ixs))
+	for _, i := range ixs {
+		latest = append(latest, f.T[i])
+	}
+	return NewAccountModel(latest)
+}
+
+// descriptionTokens splits a description into lower case words, dropping numbers and single characters since
+// those are mostly dates, store numbers, and reference codes.
+func descriptionTokens(desc string) []string {
+	words := strings.FieldsFunc(strings.ToLower(desc), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := map[string]bool{}
+	tokens := []string{}
+	for _, w := range words {
+		if len([]rune(w)) < 2 || seen[w] || strings.IndexFunc(w, unicode.IsLetter) == -1 {
+			continue
+		}
+		seen[w] = true
+		tokens = append(tokens, w)
+	}
+	return tokens
+}
+
+func normalizeDescription(desc string) string {
+	return strings.Join(strings.Fields(strings.ToLower(desc)), " ")
+}
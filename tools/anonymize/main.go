@@ -0,0 +1,58 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile, usage)
+	opts := ledger.AnonymizeOptions{}
+	fs.Flags.BoolVar(&opts.Amounts, "amounts", false, "Scramble amounts as well as names.")
+	fs.Flags.BoolVar(&opts.KeepMagnitude, "magnitude", false, "Keep scrambled amounts within 25% of the real ones.")
+	fs.Flags.Int64Var(&opts.Seed, "seed", time.Now().UnixNano(), "The random `seed` for scrambling amounts.")
+	fs.Parse()
+
+	f := tools.LoadLedgerFile(fs.SourceFile)
+	f.Anonymize(opts)
+	tools.WriteLedgerFile(fs.DestFile, f)
+}
+
+var usage = `Usage:
+
+This program scrambles a ledger file so it can be shared in a bug report
+without giving away anything personal. Descriptions, payees, and account names
+(except the top level, such as Assets or Expenses) are replaced with numbered
+placeholders, and comments, notes, and most KV pairs are removed. The same
+name is always replaced with the same placeholder, so the structure of the
+file is kept.
+
+Amounts are only changed with -amounts. Each transaction is then scaled by a
+random factor between 0.1 and 10 (or 0.75 and 1.25 with -magnitude) and
+balance assertions are updated to match, so a file that checked out before
+still does. Don't share the -seed used, since it can be used to undo this.
+`
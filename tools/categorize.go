@@ -0,0 +1,370 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package tools
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samuellwn/ledger"
+	"golang.org/x/exp/slices"
+)
+
+// Categorizer walks the transactions posting to a placeholder account (such as Unknown:Account) and asks the user
+// which account each one should go to instead. Chosen accounts are added as new revisions, the same way
+// File.Matched does, and can optionally be saved as new rules in a match file.
+type Categorizer struct {
+	F        *ledger.File
+	Account  string           // The placeholder account.
+	Matchers []ledger.Matcher // Used for suggestions.
+	RuleFile string           // If not empty, new rules are appended to this match or rule file.
+
+	In  *bufio.Reader
+	Out io.Writer
+
+	model   *ledger.AccountModel
+	known   []string         // All known accounts, sorted.
+	recent  []string         // Recently used accounts, most recent first.
+	session []ledger.Matcher // Rules added during this session.
+}
+
+// NewCategorizer returns a Categorizer reading from standard input and writing to standard output.
+func NewCategorizer(f *ledger.File, account string, matchers []ledger.Matcher, ruleFile string) *Categorizer {
+	return &Categorizer{
+		F:        f,
+		Account:  account,
+		Matchers: matchers,
+		RuleFile: ruleFile,
+		In:       bufio.NewReader(os.Stdin),
+		Out:      os.Stdout,
+	}
+}
+
+// latest returns the indexes of the latest revision of each transaction.
+func latest(f *ledger.File) []int {
+	ixs := []int{}
+	byID := map[string]int{}
+	for i, tr := range f.T {
+		id := tr.KVPairs["ID"]
+		if id == "" {
+			ixs = append(ixs, i)
+			continue
+		}
+		if j, ok := byID[id]; ok {
+			ixs[j] = i
+			continue
+		}
+		byID[id] = len(ixs)
+		ixs = append(ixs, i)
+	}
+	return ixs
+}
+
+func (c *Categorizer) loadAccounts(ixs []int) {
+	seen := map[string]bool{c.Account: true}
+	if accounts, err := c.F.Accounts(); err == nil {
+		for _, a := range accounts {
+			if !seen[a.Name] {
+				seen[a.Name] = true
+				c.known = append(c.known, a.Name)
+			}
+		}
+	}
+
+	// Most recent first, by date and then by position in the file.
+	byDate := slices.Clone(ixs)
+	sort.SliceStable(byDate, func(i, j int) bool {
+		return c.F.T[byDate[i]].Date.After(c.F.T[byDate[j]].Date)
+	})
+	for i := len(byDate) - 1; i >= 0; i-- {
+		for _, p := range c.F.T[byDate[i]].Postings {
+			if !seen[p.Account] {
+				seen[p.Account] = true
+				c.known = append(c.known, p.Account)
+			}
+		}
+	}
+	for _, ix := range byDate {
+		for _, p := range c.F.T[ix].Postings {
+			if p.Account != c.Account && !slices.Contains(c.recent, p.Account) {
+				c.recent = append(c.recent, p.Account)
+			}
+		}
+	}
+	sort.Strings(c.known)
+}
+
+// Run asks about every transaction posting to the placeholder account, until the user quits or runs out of
+// transactions. Returns the number of transactions changed.
+func (c *Categorizer) Run() int {
+	ixs := latest(c.F)
+	c.loadAccounts(ixs)
+	c.model = c.F.AccountModel()
+
+	todo := []int{}
+	for _, ix := range ixs {
+		for _, p := range c.F.T[ix].Postings {
+			if p.Account == c.Account {
+				todo = append(todo, ix)
+				break
+			}
+		}
+	}
+
+	changed := 0
+	for n, ix := range todo {
+		tr := c.F.T[ix].CleanCopy()
+
+		// Rules from earlier in the session take care of the rest of the same kind of transaction.
+		if tr.Match(c.Account, c.session) {
+			c.apply(tr)
+			changed++
+			fmt.Fprintf(c.Out, "[%v/%v] %v %v -> matched a new rule\n", n+1, len(todo), tr.Date.Format("2006/01/02"), tr.Description)
+			continue
+		}
+
+		_, amounts := tr.Balance()
+		fmt.Fprintf(c.Out, "\n[%v/%v] %v %v  %v\n", n+1, len(todo), tr.Date.Format("2006/01/02"), tr.Description, ledger.FormatValue(amounts[c.Account]))
+
+		suggestions := c.suggest(tr)
+		for i, s := range suggestions {
+			fmt.Fprintf(c.Out, "  %v) %v\n", i+1, s)
+		}
+
+		account, quit := c.ask(suggestions)
+		if quit {
+			break
+		}
+		if account == "" {
+			continue
+		}
+
+		tr.Match(c.Account, []ledger.Matcher{{R: regexp.MustCompile(""), Account: account}})
+		c.apply(tr)
+		c.model.Add(tr)
+		changed++
+
+		if i := slices.Index(c.recent, account); i != -1 {
+			c.recent = slices.Delete(c.recent, i, i+1)
+		}
+		c.recent = slices.Insert(c.recent, 0, account)
+		if !slices.Contains(c.known, account) {
+			c.known = append(c.known, account)
+			sort.Strings(c.known)
+		}
+
+		if c.RuleFile != "" {
+			c.saveRule(tr.Description, c.F.T[ix].Description, account)
+		}
+	}
+	return changed
+}
+
+func (c *Categorizer) apply(tr *ledger.Transaction) {
+	ledger.AssignIDs(c.F.IDs, tr)
+	c.F.T = append(c.F.T, *tr)
+}
+
+// suggest returns a short list of likely accounts for a transaction: accounts from matchers that match the
+// description but not the other conditions, then accounts used with similar descriptions, then recently used
+// accounts.
+func (c *Categorizer) suggest(tr *ledger.Transaction) []string {
+	suggestions := []string{}
+	add := func(account string) {
+		if account == "" || account == c.Account || slices.Contains(suggestions, account) {
+			return
+		}
+		for _, p := range tr.Postings {
+			if p.Account == account {
+				return
+			}
+		}
+		suggestions = append(suggestions, account)
+	}
+
+	for _, m := range c.Matchers {
+		if m.Matches(tr) {
+			add(m.Account)
+		}
+	}
+	exclude := []string{c.Account}
+	for _, p := range tr.Postings {
+		exclude = append(exclude, p.Account)
+	}
+	for _, s := range c.model.SuggestAccount(tr.Description, exclude...) {
+		if len(suggestions) >= 6 {
+			break
+		}
+		add(s.Account)
+	}
+	for _, account := range c.recent {
+		if len(suggestions) >= 9 {
+			break
+		}
+		add(account)
+	}
+	return suggestions
+}
+
+func (c *Categorizer) readLine(prompt string) (string, bool) {
+	fmt.Fprint(c.Out, prompt)
+	line, err := c.In.ReadString('\n')
+	if err != nil && line == "" {
+		return "", false
+	}
+	return strings.TrimSpace(line), true
+}
+
+// ask prompts for an account until it gets a usable answer. Returns true if the user wants to stop.
+func (c *Categorizer) ask(suggestions []string) (string, bool) {
+	for {
+		line, ok := c.readLine("Account (number, name, or prefix; empty to skip, q to quit): ")
+		if !ok || line == "q" {
+			return "", true
+		}
+		if line == "" {
+			return "", false
+		}
+
+		if n, err := strconv.Atoi(line); err == nil {
+			if n < 1 || n > len(suggestions) {
+				fmt.Fprintln(c.Out, "No such suggestion.")
+				continue
+			}
+			return suggestions[n-1], false
+		}
+
+		matches := c.complete(line)
+		switch {
+		case len(matches) == 1:
+			if matches[0] != line {
+				fmt.Fprintf(c.Out, "-> %v\n", matches[0])
+			}
+			return matches[0], false
+		case len(matches) > 1:
+			for i, m := range matches {
+				if i == 10 {
+					fmt.Fprintf(c.Out, "  ... and %v more\n", len(matches)-10)
+					break
+				}
+				fmt.Fprintf(c.Out, "  %v\n", m)
+			}
+			continue
+		}
+
+		if answer, _ := c.readLine(fmt.Sprintf("%v is a new account, use it anyway? [y/N] ", line)); strings.EqualFold(answer, "y") {
+			return line, false
+		}
+	}
+}
+
+// complete returns the known accounts that match the input. An exact match wins, otherwise any account with a
+// (case insensitive) prefix matching the input, or with each colon separated part of the input a prefix of the
+// same part of the account, matches.
+func (c *Categorizer) complete(input string) []string {
+	if slices.Contains(c.known, input) {
+		return []string{input}
+	}
+
+	parts := strings.Split(strings.ToLower(input), ":")
+	matches := []string{}
+	for _, account := range c.known {
+		lower := strings.ToLower(account)
+		if strings.HasPrefix(lower, strings.ToLower(input)) {
+			matches = append(matches, account)
+			continue
+		}
+
+		aparts := strings.Split(lower, ":")
+		if len(aparts) < len(parts) {
+			continue
+		}
+		ok := true
+		for i, part := range parts {
+			ok = ok && strings.HasPrefix(aparts[i], part)
+		}
+		if ok {
+			matches = append(matches, account)
+		}
+	}
+	return matches
+}
+
+// saveRule offers to save a rule for the transaction, and appends it to the rule file.
+func (c *Categorizer) saveRule(payee, desc, account string) {
+	answer, _ := c.readLine("Save a rule for this? [y/N] ")
+	if !strings.EqualFold(answer, "y") {
+		return
+	}
+
+	def := regexp.QuoteMeta(desc)
+	re, _ := c.readLine(fmt.Sprintf("Regexp [%v]: ", def))
+	if re == "" {
+		re = def
+	}
+	r, err := regexp.Compile(re)
+	if err != nil {
+		fmt.Fprintf(c.Out, "Invalid regexp, not saved: %v\n", err)
+		return
+	}
+	if payee == desc {
+		payee = ""
+	}
+
+	rf, err := os.OpenFile(c.RuleFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	HandleErr(err)
+	defer rf.Close()
+
+	if strings.HasSuffix(c.RuleFile, ".toml") {
+		rule := fmt.Sprintf("\n[[rule]]\nmatch = %v\naccount = %v\n", tomlString(re), tomlString(account))
+		if payee != "" {
+			rule += fmt.Sprintf("payee = %v\n", tomlString(payee))
+		}
+		_, err = rf.WriteString(rule)
+	} else {
+		w := csv.NewWriter(rf)
+		err = w.Write([]string{re, account, payee})
+		w.Flush()
+		if err == nil {
+			err = w.Error()
+		}
+	}
+	HandleErr(err)
+
+	c.session = append(c.session, ledger.Matcher{R: r, Account: account, Payee: payee})
+}
+
+// tomlString quotes a string for a TOML file, preferring literal strings so regexps don't need extra escaping.
+func tomlString(s string) string {
+	if !strings.ContainsAny(s, "'\n") {
+		return "'" + s + "'"
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"os"
+	"regexp"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagMasterFile, usage)
+	opts := ledger.CloseOptions{}
+	fs.Flags.Func("date", "Archive everything before this `date`.", func(s string) (err error) {
+		opts.Date, err = tools.ParseDate(s)
+		return
+	})
+	fs.Flags.StringVar(&opts.Equity, "equity", "Equity:Opening Balances", "The `account` opening balances are taken from.")
+	fs.Flags.Func("carry", "Only give accounts matching this `regexp` an opening balance.", func(s string) (err error) {
+		opts.Carry, err = regexp.Compile(s)
+		return
+	})
+	var archive *os.File
+	fs.Flags.Func("archive", "The `path` to write the archived transactions to.", func(s string) (err error) {
+		archive, err = os.Create(s)
+		return
+	})
+	fs.Parse()
+
+	tools.HandleErrS(fs.MasterFile == nil, "A master file is required.")
+	tools.HandleErrS(archive == nil, "An archive file is required.")
+	tools.HandleErrS(opts.Date.IsZero(), "A date is required.")
+
+	f := tools.LoadLedgerFile(fs.MasterFile)
+
+	af, rf, err := f.CloseBooks(opts)
+	tools.HandleErr(err)
+
+	tools.WriteLedgerFile(archive, af)
+	tools.WriteLedgerFile(fs.DestFile, rf)
+}
+
+var usage = `Usage:
+
+This program closes the books on a ledger file at a date. Everything before the
+date is written to the archive file, and everything else to the dest file,
+which starts with an "Opening Balances" transaction for each account that had
+a balance at the date, taken from the -equity account. Use -carry to only carry
+some accounts forward (for example "^(Assets|Liabilities):"), the balances of
+the rest are left in the equity account.
+
+The master file is not changed, check the results and then replace it with the
+new file. A transaction is only archived if its latest revision is before the
+date, and all of its revisions go with it. Every transaction keeps its ID, and
+the opening balances get IDs made from the date and account name, so if the
+same file is synced to several places closing the books on each of them with
+the same options gives the same result.
+`
@@ -0,0 +1,75 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagMasterFile, usage)
+	opts := ledger.DedupeOptions{}
+	fs.Flags.BoolVar(&opts.ID, "id", false, "Find transactions with the same ID and RID.")
+	fs.Flags.BoolVar(&opts.FITID, "fitid", false, "Find transactions from the same bank account with the same FITID.")
+	fs.Flags.BoolVar(&opts.Fuzzy, "fuzzy", false, "Find transactions with the same amount and similar descriptions on nearby dates.")
+	fs.Flags.IntVar(&opts.Days, "days", 3, "For -fuzzy, how many `days` apart the transactions may be.")
+	fs.Flags.Float64Var(&opts.Similarity, "similarity", 0.5, "For -fuzzy, how alike the descriptions must be, from 0 to 1.")
+	flag := fs.Flags.Bool("flag", false, "Add a \"Duplicate\" KV pair to duplicates instead of removing them.")
+	dryRun := fs.Flags.Bool("n", false, "Only list the duplicates, don't change the file.")
+	fs.Parse()
+
+	tools.HandleErrS(fs.MasterFile == nil, "A master file is required.")
+	if !opts.ID && !opts.FITID && !opts.Fuzzy {
+		opts.ID, opts.FITID = true, true
+	}
+
+	f := tools.LoadLedgerFile(fs.MasterFile)
+
+	dups := f.Duplicates(opts)
+	for _, dup := range dups {
+		fmt.Fprintf(os.Stderr, "Line %v duplicates line %v (%v).\n", f.T[dup.T].Location.Line(), f.T[dup.Of].Location.Line(), dup.Reason)
+	}
+
+	if !*dryRun && len(dups) > 0 {
+		f.Deduplicate(opts, *flag)
+		tools.WriteLedgerFile(fs.MasterFile, f)
+	}
+}
+
+var usage = `Usage:
+
+This program finds duplicate transactions in a ledger file and removes them,
+keeping the first copy. Duplicates can be found by ID (the same revision of a
+transaction appears twice, usually from a bad merge), by FITID (the same bank
+transaction was imported twice), or with -fuzzy by looking for transactions
+that move the same amount of money to the same accounts within a few days of
+each other and have similar descriptions. By default -id and -fitid are used.
+
+Fuzzy matching will find things that are not really duplicates, such as two
+identical purchases on the same day, so use -n to list them first, or -flag to
+mark them with a "Duplicate" KV pair for review instead of removing them.
+`
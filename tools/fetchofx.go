@@ -0,0 +1,194 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/samuellwn/ledger"
+)
+
+// A fetch config file is a TOML file with a list of OFX servers and the accounts to download from each. Only one
+// of password, password_env, and password_cmd should be given. The command is run without a shell and its output
+// (minus the trailing newline) is used as the password, so it can come from a password manager.
+//
+//	[[server]]
+//	name = "bank"                         # Used to pick servers on the command line.
+//	url = "https://ofx.example.com/ofx"
+//	org = "EXAMPLE"
+//	fid = "1234"
+//	appid = "QWIN"                        # Optional, some servers only talk to clients they know.
+//	appver = "2700"
+//	version = "102"                       # Optional OFX version.
+//	user = "me"
+//	password_cmd = ["pass", "show", "bank"]
+//
+//	[[server.account]]
+//	type = "checking"                     # checking, savings, moneymrkt, creditline, cd, creditcard, or investment
+//	bankid = "123456789"                  # The routing number, or broker ID for investment accounts.
+//	acctid = "0001234"
+//	account = "Assets:Bank:Checking"      # The ledger account to import to.
+
+type fetchFile struct {
+	Servers []fetchServer `toml:"server"`
+}
+
+type fetchServer struct {
+	Name        string         `toml:"name"`
+	URL         string         `toml:"url"`
+	Org         string         `toml:"org"`
+	FID         string         `toml:"fid"`
+	AppID       string         `toml:"appid"`
+	AppVer      string         `toml:"appver"`
+	Version     string         `toml:"version"`
+	User        string         `toml:"user"`
+	Password    string         `toml:"password"`
+	PasswordEnv string         `toml:"password_env"`
+	PasswordCmd []string       `toml:"password_cmd"`
+	Accounts    []fetchAccount `toml:"account"`
+}
+
+type fetchAccount struct {
+	Type    string `toml:"type"`
+	BankID  string `toml:"bankid"`
+	AcctID  string `toml:"acctid"`
+	Account string `toml:"account"`
+}
+
+// OFXConnection is a server from a fetch config file, along with the accounts to download from it and the ledger
+// accounts they import to.
+type OFXConnection struct {
+	Name     string
+	Server   ledger.OFXServer // The password is filled in by FetchOFX.
+	Accounts []ledger.OFXRemoteAccount
+	Mapping  ledger.OFXAccounts
+
+	passwordEnv string
+	passwordCmd []string
+}
+
+// LoadFetchConfig loads a fetch config file. On any error the message is logged to standard error and the program
+// exits with code 1.
+func LoadFetchConfig(cf *os.File) []OFXConnection {
+	ff := fetchFile{}
+	md, err := toml.NewDecoder(cf).Decode(&ff)
+	HandleErr(err)
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		HandleErr(fmt.Errorf("Unknown key in fetch config: %v", undecoded[0]))
+	}
+
+	conns := make([]OFXConnection, 0, len(ff.Servers))
+	for i, s := range ff.Servers {
+		HandleErrS(s.URL == "", fmt.Sprintf("Server %v has no url.", i+1))
+		HandleErrS(len(s.Accounts) == 0, fmt.Sprintf("Server %v has no accounts.", i+1))
+
+		conn := OFXConnection{
+			Name: s.Name,
+			Server: ledger.OFXServer{
+				URL:      s.URL,
+				Org:      s.Org,
+				FID:      s.FID,
+				AppID:    s.AppID,
+				AppVer:   s.AppVer,
+				Version:  s.Version,
+				User:     s.User,
+				Password: s.Password,
+			},
+			Mapping:     ledger.OFXAccounts{Accounts: map[ledger.OFXAccount]string{}},
+			passwordEnv: s.PasswordEnv,
+			passwordCmd: s.PasswordCmd,
+		}
+		for _, a := range s.Accounts {
+			HandleErrS(a.AcctID == "" || a.Account == "", fmt.Sprintf("Server %v has an account without an acctid or ledger account.", i+1))
+
+			acct := ledger.OFXAccount{BankID: a.BankID, AcctID: a.AcctID}
+			if strings.EqualFold(a.Type, "creditcard") {
+				// Credit card statements don't have a bank ID.
+				acct.BankID = ""
+			}
+			conn.Accounts = append(conn.Accounts, ledger.OFXRemoteAccount{OFXAccount: acct, Type: a.Type})
+			conn.Mapping.Accounts[acct] = a.Account
+		}
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// password returns the password for the server, from wherever the config file said to get it.
+func (conn *OFXConnection) password() (string, error) {
+	switch {
+	case conn.passwordEnv != "":
+		pw, ok := os.LookupEnv(conn.passwordEnv)
+		if !ok {
+			return "", fmt.Errorf("Password variable %v for server %q is not set.", conn.passwordEnv, conn.Name)
+		}
+		return pw, nil
+	case len(conn.passwordCmd) > 0:
+		cmd := exec.Command(conn.passwordCmd[0], conn.passwordCmd[1:]...)
+		cmd.Stdin, cmd.Stderr = os.Stdin, os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("Password command for server %q failed: %v", conn.Name, err)
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+	return conn.Server.Password, nil
+}
+
+// FetchSince returns the date to start downloading from for a connection: a week before the newest transaction
+// already imported to any of its accounts, so late posting and pending transactions are picked up again, or
+// 90 days ago if nothing has been imported yet. Transactions that were already imported are skipped by the merge.
+func FetchSince(journal *ledger.File, conn *OFXConnection) time.Time {
+	accounts := map[string]bool{}
+	for _, a := range conn.Mapping.Accounts {
+		accounts[a] = true
+	}
+
+	var newest time.Time
+	for _, tr := range journal.T {
+		if accounts[tr.KVPairs["Account"]] && tr.KVPairs["FITID"] != "" && tr.Date.After(newest) {
+			newest = tr.Date
+		}
+	}
+	if newest.IsZero() {
+		return time.Now().AddDate(0, 0, -90)
+	}
+	return newest.AddDate(0, 0, -7)
+}
+
+// FetchOFX downloads statements from the connection's server starting from since and merges them into the journal
+// the same way MergeOFX does. On error os.Exit is called and the error is logged to standard error.
+func FetchOFX(journal *ledger.File, conn *OFXConnection, since time.Time, opts ledger.OFXImportOptions, matchers []ledger.Matcher) *ledger.ImportResult {
+	server := conn.Server
+	server.Password = HandleErrV(conn.password())
+
+	data, err := ledger.FetchOFX(server, conn.Accounts, since)
+	HandleErr(err)
+	return MergeOFX(journal, bytes.NewReader(data), conn.Mapping, opts, matchers)
+}
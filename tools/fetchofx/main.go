@@ -0,0 +1,136 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagMasterFile|tools.FlagMatchFile|tools.FlagIDGenerator, usage)
+	opts := ledger.OFXImportOptions{}
+	var config *os.File
+	var since string
+	servers := []string{}
+	fs.Flags.Func("config", "The fetch config `file`.", func(s string) (err error) {
+		config, err = os.Open(s)
+		return
+	})
+	fs.Flags.Func("server", "Only download from the server with this `name`. May be given more than once.", func(s string) error {
+		servers = append(servers, s)
+		return nil
+	})
+	fs.Flags.StringVar(&since, "since", "", "Download transactions from this `date` on, instead of a week before the last one imported.")
+	fs.Flags.BoolVar(&opts.DryRun, "n", false, "Dry run. Print a summary and the transactions that would be added instead of changing the master file.")
+	fs.Flags.BoolVar(&opts.Fuzzy, "fuzzy", false, "Flag new transactions that look like duplicates of existing ones with a different FITID.")
+	fs.Flags.IntVar(&opts.Days, "days", 3, "For -fuzzy, how many `days` apart the transactions may be.")
+	fs.Flags.Float64Var(&opts.Similarity, "similarity", 0.5, "For -fuzzy, how alike the descriptions must be, from 0 to 1.")
+	fs.Flags.BoolVar(&opts.SkipFuzzy, "skip", false, "For -fuzzy, skip suspect duplicates instead of flagging them.")
+	fs.Parse()
+
+	tools.HandleErrS(config == nil, "A fetch config file is required (-config).")
+	tools.HandleErrS(fs.MasterFile == nil, "A master file is required (-master).")
+	conns := tools.LoadFetchConfig(config)
+	config.Close()
+
+	matchers := []ledger.Matcher{}
+	if fs.MatchFile != nil {
+		matchers = tools.LoadMatchFile(fs.MatchFile)
+	}
+
+	journal := tools.LoadLedgerFile(fs.MasterFile)
+
+	added := &ledger.File{T: []ledger.Transaction{}}
+	for i := range conns {
+		conn := &conns[i]
+		if len(servers) > 0 && !slices.Contains(servers, conn.Name) {
+			continue
+		}
+
+		start := tools.FetchSince(journal, conn)
+		if since != "" {
+			start = tools.HandleErrV(tools.ParseDate(since))
+		}
+
+		result := tools.FetchOFX(journal, conn, start, opts, matchers)
+		fmt.Fprintf(os.Stderr, "%v: %v new, %v already imported, %v updated from pending, %v suspect duplicates.\n",
+			conn.Name, result.New, result.Seen, result.Resolved, result.Suspect)
+		accts := maps.Keys(result.Delta)
+		sort.Strings(accts)
+		for _, acct := range accts {
+			fmt.Fprintf(os.Stderr, "  %v: %v\n", acct, ledger.FormatValue(result.Delta[acct]))
+		}
+		added.T = append(added.T, result.Transactions...)
+	}
+
+	if opts.DryRun {
+		tools.WriteLedgerFile(os.Stdout, added)
+		return
+	}
+	tools.WriteLedgerFile(fs.MasterFile, journal)
+}
+
+var usage = `Usage:
+
+This program downloads statements straight from your banks' OFX Direct Connect
+servers and adds any unseen transactions to a ledger file, the same as running
+mergeofx on a downloaded file.
+
+The servers, credentials, and accounts to download are listed in a TOML config
+file given with -config:
+
+	[[server]]
+	name = "bank"
+	url = "https://ofx.example.com/ofx"
+	org = "EXAMPLE"
+	fid = "1234"
+	user = "me"
+	password_cmd = ["pass", "show", "bank"]
+
+	[[server.account]]
+	type = "checking"
+	bankid = "123456789"
+	acctid = "0001234"
+	account = "Assets:Bank:Checking"
+
+The password may also be given directly with password, or read from an
+environment variable named by password_env. Some servers only answer clients
+they know, in which case set appid and appver (for example "QWIN" and "2700")
+and maybe version (the OFX version, such as "102").
+
+By default each server is asked for transactions starting a week before the
+newest transaction already imported to its accounts, or 90 days back if there
+are none. Transactions that were already imported are skipped, and pending
+transactions are updated when they post.
+
+With -n nothing is changed; the transactions that would be added are printed
+to standard output. A summary for each server is always printed to standard
+error.
+`
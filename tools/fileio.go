@@ -23,36 +23,275 @@ misrepresented as being the original software.
 package tools
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/csv"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/samuellwn/ledger"
 	"github.com/samuellwn/ledger/parse"
 )
 
-// LoadLedgerFile loads a ledger file from the given path. On any error the message is logged to standard error and the
-// program exits with code 1.
+// Encryption holds the settings used to decrypt and encrypt ledger files, from the LEDGER_ENCRYPT,
+// LEDGER_RECIPIENTS, LEDGER_IDENTITY, and LEDGER_PASSPHRASE_FILE environment variables. See
+// ledger.EncryptionFromEnv.
+var Encryption = ledger.EncryptionFromEnv()
+
+// CheckIDs makes LoadLedgerFile and LoadLedgerPath warn about transactions that share an ID without looking like
+// revisions of each other (see ledger.File.IDCollisions), listing every collision with its line numbers on standard
+// error. Merging or stripping the history of such a file may throw away transactions, but the check is only a guess
+// and correcting edits can set it off, so the file is still loaded. Set by the -no-check-ids flag.
+//
+// Files with two transactions that have the same ID and RID are always refused, see ledger.File.DuplicateRevisions.
+var CheckIDs = true
+
+// ExpandAliases makes LoadLedgerFile and LoadLedgerPath replace account aliases in postings with the full account
+// names, see parse.Options.ExpandAliases. The aliases are kept when the file is written back out.
+var ExpandAliases = false
+
+// Cache is used by LoadLedgerFile and LoadLedgerPath to skip parsing files that haven't changed since the last
+// time, from the LEDGER_CACHE environment variable. See parse.Cache. Encrypted files are never cached.
+var Cache = parse.CacheFromEnv()
+
+// encrypted maps the names of files loaded by LoadLedgerFile or LoadLedgerPath to the method they were encrypted
+// with, so WriteLedgerFile can encrypt them the same way again.
+var encrypted = map[string]string{}
+
+// LoadLedgerFile loads a ledger file from an open file. On any error the message (including the file name) is
+// logged to standard error and the program exits with code 1.
+// The source text of everything is kept, so transactions and directives that are not changed will be written out
+// exactly as they were found. Encrypted files are decrypted first, see Encryption.
 func LoadLedgerFile(f *os.File) *ledger.File {
-	lf, err := parse.ParseLedger(parse.NewRawCharReader(bufio.NewReader(f), 1))
-	HandleErr(err)
-	return lf
+	return HandleErrV(readLedger(f, f.Name()))
+}
+
+// LoadLedgerPath is exactly like LoadLedgerFile, but loads the file at the given path.
+func LoadLedgerPath(path string) *ledger.File {
+	f := HandleErrV(os.Open(path))
+	defer f.Close()
+	return HandleErrV(readLedger(f, path))
 }
 
-// WriteLedgerFile writes out a ledger file to the given path. On any error the message is logged to standard error
+func readLedger(r io.Reader, name string) (*ledger.File, error) {
+	opts := parse.Options{KeepRaw: true, ExpandAliases: ExpandAliases}
+	var info os.FileInfo
+	if file, ok := r.(*os.File); ok {
+		info, _ = file.Stat()
+	}
+
+	f := Cache.Lookup(name, info, opts)
+	if f == nil {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		plain, method, err := Encryption.Decrypt(data)
+		if err != nil {
+			return nil, &parse.FileError{Name: name, Err: err}
+		}
+		if method != ledger.EncryptNone {
+			// Never leave a decrypted copy in the cache.
+			encrypted[name] = method
+			f, err = parse.Read(bytes.NewReader(plain), name, opts)
+		} else {
+			f, err = Cache.Parse(plain, name, info, opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if errs := f.DuplicateRevisions(); errs != nil {
+		return nil, collisionError{name, errs}
+	}
+	if CheckIDs {
+		for _, err := range f.IDCollisions() {
+			fmt.Fprintf(os.Stderr, "Warning: %v: %v\n", name, err)
+		}
+	}
+	return f, nil
+}
+
+// collisionError is every ID collision found in a file.
+type collisionError struct {
+	name string
+	errs []error
+}
+
+func (err collisionError) Error() string {
+	lines := []string{}
+	for _, e := range err.errs {
+		lines = append(lines, fmt.Sprintf("%v: %v", err.name, e))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WriteLedgerFile writes out a ledger file to the given file. On any error the message is logged to standard error
 // and the program exits with code 1.
+// If the file was encrypted when it was loaded it is encrypted again the same way. Otherwise it is only encrypted if
+// LEDGER_ENCRYPT is set.
+//
+// Regular files are never changed in place. The new contents are written to a temporary file in the same directory
+// and synced to disk, the old version is kept as path.bak, and then the temporary file is renamed over the original.
+// If anything goes wrong the original file is left alone. The open file still refers to the old version afterwards.
 func WriteLedgerFile(f *os.File, d *ledger.File) {
-	_ = f.Truncate(0) // sometimes this gets called on os.Stdout
-	HandleErr(d.Format(f))
+	HandleErr(WriteLedgerFileHTTP(f, d))
+}
+
+// WriteLedgerFileHTTP is like WriteLedgerFile, but intended for use in HTTP handlers and the like where the standard
+// command error handling is not desirable.
+func WriteLedgerFileHTTP(f *os.File, d *ledger.File) error {
+	err := writeLedgerFile(f, d)
+	if err != nil {
+		return fmt.Errorf("Failed to write %v: %w", f.Name(), err)
+	}
+	return nil
+}
+
+func writeLedgerFile(f *os.File, d *ledger.File) error {
+	buf := &bytes.Buffer{}
+	err := d.Format(buf)
+	if err != nil {
+		return err
+	}
+
+	data, err := EncryptionFor(f.Name()).Encrypt(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		// Standard output and friends, these can't be replaced so just write to them.
+		_, err = f.Write(data)
+		return err
+	}
+	return replaceFile(f.Name(), info, data)
+}
+
+// EncryptionFor returns the encryption settings WriteLedgerFile uses for the named file: Encryption, with the method
+// the file was encrypted with when it was loaded if Encryption doesn't set one.
+func EncryptionFor(name string) *ledger.Encryption {
+	e := *Encryption
+	if method, ok := encrypted[name]; ok && e.Method == ledger.EncryptNone {
+		e.Method = method
+	}
+	return &e
+}
+
+// replaceFile atomically replaces the file at path (described by info) with data, keeping a backup of the old
+// version if it wasn't empty.
+func replaceFile(path string, info os.FileInfo, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	cerr := tmp.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// A hard link keeps the original in place until the rename, so there is never a moment without a journal. Some
+	// file systems don't do links, so fall back to copying.
+	if info.Size() > 0 {
+		backup := path + ".bak"
+		os.Remove(backup)
+		if os.Link(path, backup) != nil {
+			err = copyFile(path, backup)
+			if err != nil {
+				os.Remove(tmp.Name())
+				return err
+			}
+		}
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	SyncDir(filepath.Dir(path))
+	return nil
+}
+
+// copyFile copies the file at src to dst, syncing it to disk.
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	if err == nil {
+		err = out.Sync()
+	}
+	cerr := out.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// SyncDir makes sure a rename in the directory is on the disk. Not every system can sync a directory, so errors are
+// ignored.
+func SyncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
 }
 
 // LoadMatchFile loads a csv match file and parses it into a list of Matchers. On any error the message is logged to
 // standard error and the program exits with code 1.
+//
+// Each line has a description regexp, an account, a payee (which may be empty), and optionally an amount range, a
+// date range, and splits:
+//
+//	VENDOR,Expenses:Subscriptions,,9.99
+//	VENDOR,Expenses:Hardware,,200..
+//	PAYROLL,Income:Salary,Payroll,-..,2026/01/01..2026/12/31
+//	PAYROLL,Income:Salary,Payroll,,,Expenses:Taxes=400.00;Assets:401k=150.00
+//	COSTCO,Expenses:Household,,,,Expenses:Groceries=60%
+//
+// Amount ranges are "min..max" with either end optional, or a single amount for an exact match, and are compared
+// against the absolute value of the amount, so they can't be negative. A leading "+" or "-" limits the match to
+// positive or negative amounts. Date ranges are the same, but both ends are inclusive. Splits are separated by
+// semicolons, and each is an account and either a fixed amount or a percentage of the matched amount. See
+// ledger.MatchSplit.
+//
+// Files with a ".toml" extension are rule files, and are loaded with LoadMatchRules instead.
 func LoadMatchFile(mr *os.File) []ledger.Matcher {
-	mrdr := csv.NewReader(mr)
-	mrdr.FieldsPerRecord = 3
+	if strings.HasSuffix(mr.Name(), ".toml") {
+		return LoadMatchRules(mr)
+	}
+	return HandleErrV(ReadMatchFile(mr))
+}
+
+// ReadMatchFile parses a csv match file into a list of Matchers, returning an error instead of exiting. See
+// LoadMatchFile for the format.
+func ReadMatchFile(r io.Reader) ([]ledger.Matcher, error) {
+	mrdr := csv.NewReader(r)
+	mrdr.FieldsPerRecord = -1
 	mrdr.Comment = '#'
 
 	matchers := []ledger.Matcher{}
@@ -61,15 +300,124 @@ func LoadMatchFile(mr *os.File) []ledger.Matcher {
 		if err == io.EOF {
 			break
 		}
-		HandleErr(err)
+		if err != nil {
+			return nil, err
+		}
+
+		row, _ := mrdr.FieldPos(0)
+		if len(line) < 3 || len(line) > 6 {
+			return nil, fmt.Errorf("Match file line %v: expected 3 to 6 fields, found %v.", row, len(line))
+		}
 
-		reg := HandleErrV(regexp.Compile(line[0]))
+		reg, err := regexp.Compile(line[0])
+		if err != nil {
+			return nil, fmt.Errorf("Match file line %v: %w", row, err)
+		}
 
-		matchers = append(matchers, ledger.Matcher{
+		m := ledger.Matcher{
 			R:       reg,
 			Account: line[1],
 			Payee:   line[2],
-		})
+		}
+		if len(line) > 3 {
+			err = parseAmountRange(&m, line[3])
+		}
+		if err == nil && len(line) > 4 {
+			err = parseDateRange(&m, line[4])
+		}
+		if err == nil && len(line) > 5 {
+			m.Splits, err = parseSplits(line[5])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Match file line %v: %w", row, err)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+func parseAmountRange(m *ledger.Matcher, s string) error {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "+"):
+		m.Sign = 1
+		s = s[1:]
+	case strings.HasPrefix(s, "-"):
+		m.Sign = -1
+		s = s[1:]
+	}
+
+	min, max, isRange := strings.Cut(s, "..")
+	if !isRange {
+		max = min
+	}
+
+	var err error
+	if min = strings.TrimSpace(min); min != "" {
+		m.MinAmount, err = ledger.ParseCSVAmount(min)
+		if err != nil || m.MinAmount < 0 {
+			return fmt.Errorf("Invalid amount in match file: %q", min)
+		}
+		m.HasMinAmount = true
+	}
+	if max = strings.TrimSpace(max); max != "" {
+		m.MaxAmount, err = ledger.ParseCSVAmount(max)
+		if err != nil || m.MaxAmount < 0 {
+			return fmt.Errorf("Invalid amount in match file: %q", max)
+		}
+		m.HasMaxAmount = true
+	}
+	return nil
+}
+
+func parseSplits(s string) ([]ledger.MatchSplit, error) {
+	splits := []ledger.MatchSplit{}
+	for _, part := range strings.Split(s, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		account, amount, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid split in match file, expected account=amount: %q", part)
+		}
+
+		split := ledger.MatchSplit{Account: strings.TrimSpace(account)}
+		amount = strings.TrimSpace(amount)
+		var err error
+		if strings.HasSuffix(amount, "%") {
+			split.Percent, err = strconv.ParseFloat(strings.TrimSuffix(amount, "%"), 64)
+		} else {
+			split.Value, err = ledger.ParseCSVAmount(amount)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid split amount in match file: %q", amount)
+		}
+		splits = append(splits, split)
+	}
+	return splits, nil
+}
+
+func parseDateRange(m *ledger.Matcher, s string) error {
+	begin, end, isRange := strings.Cut(strings.TrimSpace(s), "..")
+	if !isRange {
+		end = begin
+	}
+
+	var err error
+	if begin = strings.TrimSpace(begin); begin != "" {
+		m.Begin, err = ParseDate(begin)
+		if err != nil {
+			return err
+		}
+	}
+	if end = strings.TrimSpace(end); end != "" {
+		m.End, err = ParseDate(end)
+		if err != nil {
+			return err
+		}
+		// The file uses inclusive dates.
+		m.End = m.End.AddDate(0, 0, 1)
 	}
-	return matchers
+	return nil
 }
@@ -25,7 +25,13 @@ package tools
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/samuellwn/ledger"
 )
 
 const (
@@ -36,6 +42,11 @@ const (
 	FlagAccountName             // Account name
 	FlagID                      // Transaction ID
 	FlagRID                     // Transaction revision ID
+	FlagQuery                   // Report query (date range, account regexp, status)
+	FlagIDGenerator             // ID generator for new transactions (sets ledger.DefaultIDs)
+	FlagOFXAccounts             // OFX account to ledger account mapping
+	FlagExchange                // Report exchange commodity (sets Query.Exchange, use with FlagQuery)
+	FlagAliases                 // Expand account aliases when loading (sets ExpandAliases)
 )
 
 // FlagSet is used to store the results from the common flags. Not all of these values will be valid, even if
@@ -48,22 +59,30 @@ type FlagSet struct {
 	AccountName string
 	ID          string
 	RID         string
+	Query       ledger.ReportQuery
+	OFXAccounts map[ledger.OFXAccount]string
 
 	Flags *flag.FlagSet
+
+	truncated  bool // DestFile was emptied by Output.
+	noCheckIDs bool // Set CheckIDs to false after parsing.
 }
 
 // CommonFlagSet returns a flagset filled out with your choice of several common flags.
 func CommonFlagSet(flags int, usage string) *FlagSet {
 	fs := &FlagSet{
-		DestFile:   os.Stdout,
-		SourceFile: os.Stdin,
-		Flags:      flag.NewFlagSet(os.Args[0], flag.ExitOnError),
+		DestFile:    os.Stdout,
+		SourceFile:  os.Stdin,
+		OFXAccounts: map[ledger.OFXAccount]string{},
+		Flags:       flag.NewFlagSet(os.Args[0], flag.ExitOnError),
 	}
 
 	if flags&FlagDestFile != 0 {
 		fs.Flags.Func("dest", "The output file `path`.", func(s string) (err error) {
+			// Not truncated here, ledger files are replaced by WriteLedgerFile (keeping a backup) and everything
+			// else truncates it with Output when it is ready to write.
 			if s != "-" {
-				fs.DestFile, err = os.Create(s)
+				fs.DestFile, err = os.OpenFile(s, os.O_RDWR|os.O_CREATE, 0666)
 			}
 			return
 		})
@@ -86,7 +105,7 @@ func CommonFlagSet(flags int, usage string) *FlagSet {
 	}
 
 	if flags&FlagMatchFile != 0 {
-		fs.Flags.Func("match", "Path to the match information `csv` file.", func(s string) (err error) {
+		fs.Flags.Func("match", "Path to the match information `file`, either a csv match file or a toml rule file.", func(s string) (err error) {
 			if s != "-" {
 				fs.MatchFile, err = os.Open(s)
 			} else {
@@ -108,6 +127,64 @@ func CommonFlagSet(flags int, usage string) *FlagSet {
 		fs.Flags.StringVar(&fs.RID, "rid", "NIL", "A transaction revision `ID` used to specify the point in the file to act from.")
 	}
 
+	if flags&FlagQuery != 0 {
+		fs.Flags.Func("accounts", "Only include postings to accounts matching this `regexp`.", func(s string) (err error) {
+			fs.Query.Account, err = regexp.Compile(s)
+			return
+		})
+		fs.Flags.Func("begin", "Only include transactions on or after this `date`.", func(s string) (err error) {
+			fs.Query.Begin, err = ParseDate(s)
+			return
+		})
+		fs.Flags.Func("end", "Only include transactions before this `date`.", func(s string) (err error) {
+			fs.Query.End, err = ParseDate(s)
+			return
+		})
+		fs.Flags.BoolVar(&fs.Query.Cleared, "cleared", false, "Include cleared postings. If none of -cleared, -pending, or -uncleared are given all postings are included.")
+		fs.Flags.BoolVar(&fs.Query.Pending, "pending", false, "Include pending postings.")
+		fs.Flags.BoolVar(&fs.Query.Uncleared, "uncleared", false, "Include postings that are neither cleared nor pending.")
+		fs.Flags.BoolVar(&fs.Query.Related, "related", false, "Show the other postings of each transaction with a selected posting instead.")
+		fs.Flags.BoolVar(&fs.Query.Effective, "effective", false, "Use effective dates (=date on transactions, [=date] on postings) for the date range and periods.")
+	}
+
+	if flags&FlagExchange != 0 {
+		exchange := func(s string) error {
+			fs.Query.Exchange = s
+			return nil
+		}
+		fs.Flags.Func("X", "Value all postings in this `commodity`, using the prices from P directives.", exchange)
+		fs.Flags.Func("exchange", "Same as -X.", exchange)
+		fs.Flags.BoolVar(&fs.Query.ExchangeLatest, "latest", false, "With -X, use the latest prices instead of the prices on each transaction's date.")
+	}
+
+	if flags&FlagAliases != 0 {
+		fs.Flags.BoolVar(&ExpandAliases, "expand-aliases", false, "Replace account aliases (from alias directives and account directive alias lines) with the full account names.")
+	}
+
+	if flags&FlagIDGenerator != 0 {
+		fs.Flags.Func("ids", "How to make new transaction IDs: \"shortid\", \"ulid\", \"uuidv7\", \"hash\" (of the content), or \"fitid\" (of the bank account and FITID). (default \"shortid\")", func(s string) (err error) {
+			ledger.DefaultIDs, err = ledger.ParseIDGenerator(s)
+			return
+		})
+	}
+
+	if flags&FlagOFXAccounts != 0 {
+		fs.Flags.Func("map", "Book an OFX account to a ledger account, `[bankid/]acctid=account`. May be given more than once.", func(s string) error {
+			ofx, account, ok := strings.Cut(s, "=")
+			if !ok || account == "" {
+				return fmt.Errorf("Malformed account mapping: %q", s)
+			}
+			acct := ledger.OFXAccount{AcctID: ofx}
+			if bank, id, ok := strings.Cut(ofx, "/"); ok {
+				acct = ledger.OFXAccount{BankID: bank, AcctID: id}
+			}
+			fs.OFXAccounts[acct] = account
+			return nil
+		})
+	}
+
+	fs.Flags.BoolVar(&fs.noCheckIDs, "no-check-ids", false, "Don't warn about transactions that share an ID but don't look like revisions of each other.")
+
 	fs.Flags.Usage = func() {
 		fmt.Fprintln(os.Stderr, usage)
 		fs.Flags.PrintDefaults()
@@ -116,6 +193,36 @@ func CommonFlagSet(flags int, usage string) *FlagSet {
 	return fs
 }
 
+// ParseDate parses a date given on the command line, in either yyyy/mm/dd or yyyy-mm-dd format.
+func ParseDate(s string) (time.Time, error) {
+	t, err := time.Parse("2006/01/02", s)
+	if err != nil {
+		return time.Parse("2006-01-02", s)
+	}
+	return t, nil
+}
+
+// Output empties the destination file (if it is a regular file) and returns it, for tools that write something other
+// than a ledger file to it. Ledger files should be written with WriteLedgerFile instead, which replaces the file
+// atomically. On error the message is logged to standard error and the program exits with code 1.
+func (fs *FlagSet) Output() *os.File {
+	if fs.truncated {
+		return fs.DestFile
+	}
+	fs.truncated = true
+
+	info, err := fs.DestFile.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return fs.DestFile
+	}
+	HandleErr(fs.DestFile.Truncate(0))
+	HandleErrV(fs.DestFile.Seek(0, io.SeekStart))
+	return fs.DestFile
+}
+
 func (fs *FlagSet) Parse() {
 	fs.Flags.Parse(os.Args[1:])
+	if fs.noCheckIDs {
+		CheckIDs = false
+	}
 }
@@ -0,0 +1,50 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile|tools.FlagIDGenerator, usage)
+	fs.Parse()
+
+	f := &ledger.File{T: []ledger.Transaction{}, D: []ledger.Directive{}}
+	tools.HandleErr(f.ImportBeancount(fs.SourceFile))
+
+	tools.WriteLedgerFile(fs.DestFile, f)
+}
+
+var usage = `Usage:
+
+This program takes a beancount file and converts it to a ledger file.
+
+Only USD amounts are supported; postings in other currencies are converted
+using their cost or price. Payees become descriptions, narrations, links, and
+metadata become k/v pairs, and pad and balance directives become balance
+assignments and assertions. Directives with no ledger equivalent are kept as
+comments. Files written by tobeancount convert back to the original accounts,
+k/v pairs, codes, and clear dates.
+`
@@ -23,16 +23,14 @@ misrepresented as being the original software.
 package main
 
 import (
-	"encoding/csv"
 	"flag"
 	"fmt"
-	"io"
 	"os"
-	"strconv"
+	"sort"
 	"strings"
-	"time"
 
 	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
 )
 
 var usage string = `Usage: fromcsv [-o <dest>]|[-output <dest>] options... <src>
@@ -43,6 +41,23 @@ Converts a CSV file to a ledger file.
 		Show this help.
 	-o, -output <file> (default stdout)
 		Write transactions to this file
+	-profile <name>
+		Use a built in bank profile for the column layout. Any of the
+		column and format options below override the profile. Known
+		profiles: PROFILES
+	-delimiter <char> (default ,)
+		The field separator. "tab", "semicolon", and "comma" may be used
+		instead of the character itself.
+	-lazyquotes
+		Allow stray quotes in fields instead of failing.
+	-skip <n>, -skipfooter <n>
+		Skip this many lines at the start (before the header) or end of
+		the file. Trailing blank lines don't count towards the footer.
+	-encoding <name>
+		The character encoding of the file, such as utf-8, latin1,
+		windows-1252, utf-16le, or utf-16be. By default UTF-16 is detected
+		by its byte order mark, and anything that isn't valid UTF-8 is
+		read as windows-1252 (which includes latin1).
 	-datefmt <date> (default 01/02/2006)
 		Use an example date for Mon Jan 2, 2006 3:04:05 PM to specify the
 		date format to parse from.
@@ -54,6 +69,14 @@ Converts a CSV file to a ledger file.
 		This argument specifies which field contains the amount. The header
 		will be used to find the field. If -noheader is specified, then
 		the value must be the index of the field.
+	-debit <name>, -credit <name>
+		Use separate columns for money taken from and added to the account
+		instead of a single amount column.
+	-negate
+		Negate all amounts, for exports that list charges as positive.
+	-decimal <char> (default .)
+		The decimal separator, "." or ",". With "," periods are taken to
+		be thousands separators, as in 1.234,56.
 	-desc <name> (default desc)
 		This argument specifies which field contains the desciption. The header
 		will be used to find the field. If -noheader is specified, then
@@ -64,46 +87,175 @@ Converts a CSV file to a ledger file.
 		Positive amounts will take from this account
 	-to <account> (default Account:To)
 		Positive amounts will add to this account
+	-balance <name>
+		This argument specifies which field contains the running balance.
+		If given, statement opening and closing balance assertions are
+		added, so missing or duplicated rows show up as a balance error.
+	-pending <name>
+		This argument specifies which field says if a transaction is
+		pending ("pending", "true", "yes", or "y"). Pending transactions
+		are updated in place when their posted versions are imported.
+	-assert
+		Also add a balance assertion from the -balance field to each
+		transaction.
+	-equity <account> (default Equity:Balance Error)
+		Differences in the opening and closing balances go to this account
+	-ids <name> (default shortid)
+		How to make new transaction IDs: shortid, ulid, uuidv7, hash, or
+		fitid. Hash IDs are made from the content of the transaction, so
+		importing the same file again gives the same IDs. Fitid IDs are
+		made from the profile's FITID column and the account, so imports of
+		the same bank data on different machines agree.
+	-match <file>
+		Use the rules in this match file to replace the -from account (and
+		optionally the description) of matching transactions. The file is
+		the same three column CSV used by the other tools: a regexp for the
+		description, the account, and an optional payee. Files ending in
+		.toml are read as rule files instead.
 `
 
 var output string
-var noHeader bool
-
-var dateFmt string
-var dateField string
-var descField map[string]bool = map[string]bool{}
-var amountField string
+var profileName string
+var matchFile string
 
 var accountFrom string
 var accountTo string
-
-var dateFieldIx int = -1
-var descFieldIx map[int]bool = map[int]bool{}
-var amountFieldIx int = -1
+var accountEquity string
 
 var help bool
 
 func main() {
+	profile := ledger.CSVProfile{
+		Date:       "date",
+		DateFormat: "01/02/2006",
+		Amount:     "amount",
+		Status:     ledger.StatusClear,
+	}
+	overrides := ledger.CSVProfile{}
+	descField := []string{}
+
 	flag.StringVar(&output, "output", "-", "file to write csv to")
 	flag.StringVar(&output, "o", "-", "file to write csv to")
-	flag.BoolVar(&noHeader, "noheader", false, "the csv doesn't contain any header")
-	flag.StringVar(&dateFmt, "datefmt", "01/02/2006", "Jan 2, 2006 at 3:04:05 PM in expected date format")
-	flag.StringVar(&dateField, "date", "date", "name of date field")
-	flag.StringVar(&amountField, "amount", "amount", "name of amount field")
+	flag.StringVar(&profileName, "profile", "", "name of a built in bank profile")
+	flag.Func("delimiter", "field separator", func(arg string) error {
+		switch arg {
+		case "tab", "\\t":
+			overrides.Comma = '\t'
+		case "semicolon":
+			overrides.Comma = ';'
+		case "comma":
+			overrides.Comma = ','
+		default:
+			r := []rune(arg)
+			if len(r) != 1 {
+				return fmt.Errorf("delimiter must be a single character: %q", arg)
+			}
+			overrides.Comma = r[0]
+		}
+		return nil
+	})
+	flag.BoolVar(&overrides.LazyQuotes, "lazyquotes", false, "allow stray quotes in fields")
+	flag.IntVar(&overrides.SkipRows, "skip", 0, "lines to skip at the start of the file")
+	flag.IntVar(&overrides.SkipFooter, "skipfooter", 0, "lines to skip at the end of the file")
+	flag.StringVar(&overrides.Encoding, "encoding", "", "character encoding of the file")
+	flag.BoolVar(&overrides.NoHeader, "noheader", false, "the csv doesn't contain any header")
+	flag.StringVar(&overrides.DateFormat, "datefmt", "01/02/2006", "Jan 2, 2006 at 3:04:05 PM in expected date format")
+	flag.StringVar(&overrides.Date, "date", "date", "name of date field")
+	flag.StringVar(&overrides.Amount, "amount", "amount", "name of amount field")
+	flag.StringVar(&overrides.Debit, "debit", "", "name of debit field")
+	flag.StringVar(&overrides.Credit, "credit", "", "name of credit field")
+	flag.BoolVar(&overrides.Negate, "negate", false, "negate all amounts")
+	flag.Func("decimal", "decimal separator", func(arg string) error {
+		if arg != "." && arg != "," {
+			return fmt.Errorf("decimal separator must be \".\" or \",\": %q", arg)
+		}
+		overrides.Decimal = rune(arg[0])
+		return nil
+	})
+	flag.StringVar(&overrides.Balance, "balance", "", "name of running balance field")
+	flag.StringVar(&overrides.Pending, "pending", "", "name of pending field")
+	flag.BoolVar(&overrides.AssertBalances, "assert", false, "add a balance assertion to each transaction")
 	flag.StringVar(&accountFrom, "from", "Account:From", "positive amounts take money from this account")
 	flag.StringVar(&accountTo, "to", "Account:To", "positive amounts add money to this account")
+	flag.StringVar(&accountEquity, "equity", "Equity:Balance Error", "balance differences go to this account")
+	flag.StringVar(&matchFile, "match", "", "match file used to pick accounts")
+	flag.Func("ids", "how to make new transaction IDs", func(arg string) (err error) {
+		ledger.DefaultIDs, err = ledger.ParseIDGenerator(arg)
+		return
+	})
 	flag.BoolVar(&help, "help", false, "show this help")
 	flag.BoolVar(&help, "h", false, "show this help")
 	flag.Func("desc", "name of description field", func(arg string) error {
-		descField[arg] = true
+		descField = append(descField, arg)
 		return nil
 	})
 	flag.Parse()
 	if help {
-		fmt.Print(usage)
+		fmt.Print(strings.Replace(usage, "PROFILES", profileNames(), 1))
 		os.Exit(0)
 	}
 
+	if profileName != "" {
+		p, ok := ledger.CSVProfiles[profileName]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown profile: %s\n", profileName)
+			os.Exit(2)
+		}
+		profile = p
+		profile.Status = ledger.StatusClear
+	} else {
+		profile.Description = []string{"desc"}
+	}
+
+	// Explicitly set flags override the profile. Debit and credit columns replace the amount column unless it
+	// was also given.
+	amountSet := false
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "delimiter":
+			profile.Comma = overrides.Comma
+		case "lazyquotes":
+			profile.LazyQuotes = overrides.LazyQuotes
+		case "skip":
+			profile.SkipRows = overrides.SkipRows
+		case "skipfooter":
+			profile.SkipFooter = overrides.SkipFooter
+		case "encoding":
+			profile.Encoding = overrides.Encoding
+		case "noheader":
+			profile.NoHeader = overrides.NoHeader
+		case "datefmt":
+			profile.DateFormat = overrides.DateFormat
+		case "date":
+			profile.Date = overrides.Date
+		case "amount":
+			profile.Amount = overrides.Amount
+			amountSet = true
+		case "debit":
+			profile.Debit = overrides.Debit
+			if !amountSet {
+				profile.Amount = ""
+			}
+		case "credit":
+			profile.Credit = overrides.Credit
+			if !amountSet {
+				profile.Amount = ""
+			}
+		case "negate":
+			profile.Negate = overrides.Negate
+		case "decimal":
+			profile.Decimal = overrides.Decimal
+		case "balance":
+			profile.Balance = overrides.Balance
+		case "pending":
+			profile.Pending = overrides.Pending
+		case "assert":
+			profile.AssertBalances = overrides.AssertBalances
+		case "desc":
+			profile.Description = descField
+		}
+	})
+
 	input := flag.Arg(0)
 	var inFile, outFile *os.File
 	var err error
@@ -128,170 +280,38 @@ func main() {
 		}
 	}
 
-	reader := csv.NewReader(inFile)
-
-	if !noHeader {
-		header, err := reader.Read()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to read header: %v\n", err)
-			os.Exit(1)
-		}
-
-		for i, field := range header {
-			if field == dateField {
-				dateFieldIx = i
-			}
-
-			if field == amountField {
-				amountFieldIx = i
-			}
-
-			if descField[field] {
-				descFieldIx[i] = true
-			}
-		}
-	} else {
-		dateFieldIx, err = strconv.Atoi(dateField)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "-date argument is not a number")
-			os.Exit(2)
-		}
-
-		amountFieldIx, err = strconv.Atoi(amountField)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "-amount argument is not a number")
-			os.Exit(2)
-		}
-
-		for desc, has := range descField {
-			if !has {
-				continue
-			}
-
-			descIx, err := strconv.Atoi(desc)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, "-desc argument is not a number")
-				os.Exit(2)
-			}
-
-			descFieldIx[descIx] = true
-		}
-
-	}
-
-	if dateFieldIx == -1 {
-		fmt.Fprintln(os.Stderr, "date field not found or specified")
-		os.Exit(2)
-	}
-
-	if amountFieldIx == -1 {
-		fmt.Fprintln(os.Stderr, "amount field not found or specified")
-		os.Exit(2)
-	}
-
-	hasDesc := false
-	for _, has := range descFieldIx {
-		hasDesc = hasDesc || has
-	}
-
-	if !hasDesc {
-		fmt.Fprintln(os.Stderr, "desc field not found or specified")
-		os.Exit(2)
-	}
-
-	minLen := dateFieldIx
-	if amountFieldIx > minLen {
-		minLen = amountFieldIx
-	}
-	for desc, has := range descFieldIx {
-		if !has {
-			continue
-		}
-
-		if desc > minLen {
-			minLen = desc
-		}
+	journal := &ledger.File{T: []ledger.Transaction{}, D: nil}
+	err = journal.ImportCSV(inFile, profile, accountTo, accountFrom, accountEquity)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to import csv: %v\n", err)
+		os.Exit(3)
 	}
-	minLen++
 
-	trs := []ledger.Transaction{}
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
+	if matchFile != "" {
+		mr, err := os.Open(matchFile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to read input record: %v\n", err)
+			fmt.Fprintf(os.Stderr, "failed to open match file: %v\n", err)
 			os.Exit(1)
 		}
+		matchers := tools.LoadMatchFile(mr)
+		mr.Close()
 
-		if len(record) < minLen {
-			fmt.Fprintln(os.Stderr, "found input record with too few fields")
-			os.Exit(3)
-		}
-
-		date, err := time.Parse(dateFmt, record[dateFieldIx])
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to parse date: %s\n", record[dateFieldIx])
-			os.Exit(3)
-		}
-
-		amountStr := record[amountFieldIx]
-		amountClean := strings.Builder{}
-		negate := false
-		for _, chr := range amountStr {
-			switch chr {
-			case '$':
-				// eat all $
-			case '(':
-				negate = true
-			case ')':
-				// eat all )
-			case ',':
-				// eat all ,
-			default:
-				amountClean.WriteRune(chr)
-			}
-		}
-		amount, err := ledger.ParseValueNumber(amountClean.String())
-		if negate {
-			amount = -amount
-		}
-
-		desc := make([]string, 0, len(descFieldIx))
-		for descIx, has := range descFieldIx {
-			if !has {
-				continue
-			}
-
-			desc = append(desc, record[descIx])
-		}
-
-		tr := ledger.Transaction{
-			Description: strings.Join(desc, " "),
-			Date:        date,
-			Status:      ledger.StatusClear,
-			KVPairs: map[string]string{
-				"ID":  <-ledger.IDService,
-				"RID": <-ledger.IDService,
-			},
-			Postings: []ledger.Posting{
-				{
-					Account: accountTo,
-					Value:   amount,
-				},
-				{
-					Account: accountFrom,
-					Null:    true,
-				},
-			},
-		}
-		trs = append(trs, tr)
+		journal.T = append(journal.T, journal.Matched(accountFrom, matchers)...)
+		journal.StripHistory()
 	}
 
-	err = (&ledger.File{T: trs, D: nil}).Format(outFile)
+	err = journal.Format(outFile)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to write ledger data: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+func profileNames() string {
+	names := make([]string, 0, len(ledger.CSVProfiles))
+	for name := range ledger.CSVProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -33,19 +33,37 @@ var defaultAccount string = "Unknown:Account"
 // FromOFX pulls transaction data from an OFX file and converts it to a File. On error os.Exit is called and
 // the error is logged to standard error.
 //
-// This function makes a lot of assumptions about the structure of the input OFX file, and will error out if
-// they are not met.
-func FromOFX(file io.Reader, mainAccount string, descSrc ledger.OFXDescSrc, matchers []ledger.Matcher) *ledger.File {
+// Every account in the OFX file is imported, booked to the ledger account it maps to.
+func FromOFX(file io.Reader, accounts ledger.OFXAccounts, descSrc ledger.OFXDescSrc, matchers []ledger.Matcher) *ledger.File {
 	journal := &ledger.File{T: []ledger.Transaction{}, D: nil}
 
-	HandleErr(journal.ImportOFX(file, descSrc, mainAccount, defaultAccount, "Equity:Balance Error"))
-	journal.T = append(journal.T, journal.Matched(mainAccount, matchers)...)
+	_, err := journal.ImportOFXAccounts(file, accounts, ledger.OFXImportOptions{
+		DescSrc:     descSrc,
+		DefaultAcct: defaultAccount,
+		EquityAcct:  "Equity:Balance Error",
+	})
+	HandleErr(err)
+	journal.T = append(journal.T, journal.Matched(defaultAccount, matchers)...)
 	journal.StripHistory()
 
 	return journal
 }
 
-func MergeOFX(journal *ledger.File, file io.Reader, mainAccount string, descSrc ledger.OFXDescSrc, matchers []ledger.Matcher) {
-	HandleErr(journal.ImportOFX(file, descSrc, mainAccount, defaultAccount, "Equity:Balance Error"))
-	journal.T = append(journal.T, journal.Matched(mainAccount, matchers)...)
+// MergeOFX imports an OFX file into an existing File, returning a summary of the import. The default and equity
+// accounts in the options are filled in. On a dry run the journal is left alone and the result holds the
+// transactions that would have been added, with the matchers applied.
+func MergeOFX(journal *ledger.File, file io.Reader, accounts ledger.OFXAccounts, opts ledger.OFXImportOptions, matchers []ledger.Matcher) *ledger.ImportResult {
+	opts.DefaultAcct = defaultAccount
+	opts.EquityAcct = "Equity:Balance Error"
+	result, err := journal.ImportOFXAccounts(file, accounts, opts)
+	HandleErr(err)
+	if opts.DryRun {
+		added := &ledger.File{T: result.Transactions}
+		added.T = append(added.T, added.Matched(defaultAccount, matchers)...)
+		added.StripHistory()
+		result.Transactions = added.T
+		return result
+	}
+	journal.T = append(journal.T, journal.Matched(defaultAccount, matchers)...)
+	return result
 }
@@ -30,7 +30,7 @@ import (
 )
 
 func main() {
-	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile|tools.FlagAccountName|tools.FlagMatchFile, usage)
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile|tools.FlagAccountName|tools.FlagMatchFile|tools.FlagIDGenerator|tools.FlagOFXAccounts, usage)
 	var descSrc ledger.OFXDescSrc
 	fs.Flags.Func("desc", "Where to get the `description` from. \"name\", \"memo\", or \"name+memo\". (default \"name\")", func(s string) error {
 		switch s {
@@ -47,13 +47,15 @@ func main() {
 	})
 	fs.Parse()
 
+	accounts := ledger.OFXAccounts{Accounts: fs.OFXAccounts, Default: fs.AccountName}
+
 	matchers := []ledger.Matcher{}
 	if fs.MatchFile != nil {
 		matchers = tools.LoadMatchFile(fs.MatchFile)
 	}
 
 	// Load OFX file
-	f := tools.FromOFX(fs.SourceFile, fs.AccountName, descSrc, matchers)
+	f := tools.FromOFX(fs.SourceFile, accounts, descSrc, matchers)
 
 	tools.WriteLedgerFile(fs.DestFile, f)
 }
@@ -61,4 +63,9 @@ func main() {
 var usage = `Usage:
 
 This program takes an OFX file and converts it to a ledger file.
+
+Files with more than one account (checking, savings, and a card in one
+download) are supported: use -map to book each OFX account to its own ledger
+account. Accounts without a mapping go to -account, or are an error if
+-account is empty.
 `
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/client"
+	"github.com/samuellwn/ledger/tools"
+	"golang.org/x/exp/slices"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile, usage)
+	journal := fs.Flags.String("journal", client.DefaultConfig.Journal, "The journal `path`, in a git repository.")
+	id := fs.Flags.String("id", "", "Only list commits that changed the transaction with this `ID`.")
+	sync := fs.Flags.String("sync", "", "Fetch this `remote` and merge its copy of the journal.")
+	branch := fs.Flags.String("branch", "", "The remote `branch` to sync with. (default the current branch)")
+	push := fs.Flags.Bool("push", false, "Push to the remote after syncing.")
+	onConflict := fs.Flags.String("on-conflict", tools.OnConflictFail, "What to do when both sides edited the same transaction: \"fail\" or \"ours\" (keep our edit as the latest revision).")
+	fs.Parse()
+
+	if *sync != "" {
+		tools.HandleErrS(*onConflict != tools.OnConflictFail && *onConflict != tools.OnConflictOurs,
+			fmt.Sprintf("Unknown conflict strategy: %q", *onConflict))
+
+		ids := tools.HandleErrV(client.GitSync(*journal, *sync, *branch, func(base, ours, theirs *ledger.File) (*ledger.File, error) {
+			merged, report := tools.MergeWithBase(base, ours, theirs)
+			if report != nil && *onConflict == tools.OnConflictFail {
+				return nil, report
+			}
+			return merged, nil
+		}))
+		fmt.Fprintf(os.Stderr, "Merged changes to %v transactions.\n", len(ids))
+
+		if *push {
+			tools.HandleErr(client.GitPush(*journal, *sync, *branch))
+		}
+		return
+	}
+
+	for _, c := range tools.HandleErrV(client.GitHistory(*journal)) {
+		if *id != "" && !slices.Contains(c.IDs, *id) {
+			continue
+		}
+		what := c.Subject
+		if c.Op != "" {
+			what = c.Op + " " + strings.Join(c.IDs, " ")
+		}
+		_, err := fmt.Fprintf(fs.Output(), "%.10v %v %v\n", c.Hash, c.Date.Format("2006/01/02 15:04"), strings.TrimSpace(what))
+		tools.HandleErr(err)
+	}
+}
+
+var usage = `Usage:
+
+This program works with a journal kept in a git repository by a client with
+the Git option set, which commits every change with the IDs of the
+transactions it touched.
+
+By default it lists the commits that changed the journal, newest first, with
+the kind of change and the IDs involved. Use -id to see only the commits that
+touched one transaction.
+
+With -sync it fetches the remote's copy of the journal and merges it in. The
+merge works on transactions rather than lines: the copy from the last common
+commit is used to tell which side added, edited, or removed each transaction,
+so edits on both sides combine cleanly. If both sides edited the same
+transaction the sync fails, unless -on-conflict is "ours", in which case our
+edit becomes the latest revision. The merge is committed as a git merge, and
+-push sends it back to the remote.
+`
@@ -0,0 +1,146 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile|tools.FlagQuery|tools.FlagExchange|tools.FlagAliases, usage)
+	depth := fs.Flags.Int("depth", 0, "Collapse accounts nested deeper than `n` levels into their parents.")
+	format := fs.Flags.String("format", "text", "Output `format`, one of \"text\", \"csv\", or \"json\".")
+	fs.Parse()
+
+	f := tools.LoadLedgerFile(fs.SourceFile)
+
+	accounts := tools.HandleErrV(f.BalanceReport(fs.Query, *depth))
+	af := tools.HandleErrV(f.ExchangeFormat(fs.Query))
+
+	switch *format {
+	case "text":
+		tools.HandleErr(writeText(fs.Output(), accounts, af))
+	case "csv":
+		tools.HandleErr(writeCSV(fs.Output(), accounts, af))
+	case "json":
+		tools.HandleErr(writeJSON(fs.Output(), accounts, af))
+	default:
+		tools.HandleErrS(true, fmt.Sprintf("Unknown output format: %q", *format))
+	}
+}
+
+func sortedAccounts(accounts map[string]int64) []string {
+	names := make([]string, 0, len(accounts))
+	for name := range accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeText(w io.Writer, accounts map[string]int64, af ledger.AmountFormat) error {
+	rows := ledger.FormatSumsWith(accounts, "  ", af)
+
+	total := int64(0)
+	for _, v := range accounts {
+		total += v
+	}
+
+	width := 0
+	for _, row := range rows {
+		if len(row[1]) > width {
+			width = len(row[1])
+		}
+	}
+	totalText := af.Format(total)
+	if len(totalText) > width {
+		width = len(totalText)
+	}
+
+	for _, row := range rows {
+		_, err := fmt.Fprintf(w, "%*v  %v\n", width, row[1], row[0])
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%v\n%*v\n", strings.Repeat("-", width), width, totalText)
+	return err
+}
+
+func writeCSV(w io.Writer, accounts map[string]int64, af ledger.AmountFormat) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"account", "amount", "commodity"})
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedAccounts(accounts) {
+		err := cw.Write([]string{name, ledger.FormatValueNumber(accounts[name]), af.Symbol})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type jsonBalance struct {
+	Account    string `json:"account"`
+	Amount     int64  `json:"amount"`
+	AmountText string `json:"amountText"`
+}
+
+func writeJSON(w io.Writer, accounts map[string]int64, af ledger.AmountFormat) error {
+	balances := []jsonBalance{}
+	for _, name := range sortedAccounts(accounts) {
+		balances = append(balances, jsonBalance{
+			Account:    name,
+			Amount:     accounts[name],
+			AmountText: af.Format(accounts[name]),
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(balances)
+}
+
+var usage = `Usage:
+
+This program takes a ledger file and prints the balance of each account, same
+as "ledger balance". The text output is an indented tree of accounts with the
+total of everything at the bottom, csv and json output have one row per
+account with no tree or total. Amounts use the same units as the json format
+of ledger files (thousandths of a cent) in the json output.
+
+With -X (or -exchange) all amounts are valued in the given commodity using the
+prices from the P directives in the file, at the date of each transaction or
+the latest prices with -latest. Postings that hold units of a commodity, with
+a note like "10 AAPL @ $150.00", are valued at the price of that commodity.
+`
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile, usage)
+	format := fs.Flags.String("format", "text", "Output `format`, either \"text\" or \"json\".")
+	date := time.Now()
+	fs.Flags.Func("date", "Report on the period containing this `date`. (default today)", func(s string) (err error) {
+		date, err = tools.ParseDate(s)
+		return
+	})
+	interval := ledger.IntervalMonthly
+	fs.Flags.Func("interval", "The length of the period: weekly, monthly, quarterly, or yearly. (default monthly)", func(s string) error {
+		iv, ok := ledger.ParseInterval(s)
+		if !ok {
+			return fmt.Errorf("Unknown interval: %q", s)
+		}
+		interval = iv
+		return nil
+	})
+	fs.Parse()
+
+	f := tools.LoadLedgerFile(fs.SourceFile)
+
+	rows := tools.HandleErrV(f.BudgetReport(date, interval))
+
+	switch *format {
+	case "text":
+		tools.HandleErr(writeText(fs.Output(), rows))
+	case "json":
+		tools.HandleErr(writeJSON(fs.Output(), rows))
+	default:
+		tools.HandleErrS(true, fmt.Sprintf("Unknown output format: %q", *format))
+	}
+}
+
+func writeText(w io.Writer, rows []ledger.BudgetRow) error {
+	width := len("Remaining")
+	for _, row := range rows {
+		for _, v := range []int64{row.Budgeted, row.Rollover, row.Actual, row.Remaining} {
+			if l := len(ledger.FormatValue(v)); l > width {
+				width = l
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%*v %*v %*v %*v  %v\n", width, "Budgeted", width, "Rollover", width, "Actual", width, "Remaining", "Account")
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		_, err := fmt.Fprintf(w, "%*v %*v %*v %*v  %v\n",
+			width, ledger.FormatValue(row.Budgeted),
+			width, ledger.FormatValue(row.Rollover),
+			width, ledger.FormatValue(row.Actual),
+			width, ledger.FormatValue(row.Remaining),
+			row.Account)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jsonBudgetRow struct {
+	Account   string `json:"account"`
+	Budgeted  int64  `json:"budgeted"`
+	Rollover  int64  `json:"rollover"`
+	Actual    int64  `json:"actual"`
+	Remaining int64  `json:"remaining"`
+}
+
+func writeJSON(w io.Writer, rows []ledger.BudgetRow) error {
+	out := []jsonBudgetRow{}
+	for _, row := range rows {
+		out = append(out, jsonBudgetRow{
+			Account:   row.Account,
+			Budgeted:  row.Budgeted,
+			Rollover:  row.Rollover,
+			Actual:    row.Actual,
+			Remaining: row.Remaining,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(out)
+}
+
+var usage = `Usage:
+
+This program takes a ledger file and compares the budgets defined by its
+periodic transactions to the actual amounts for one period, like "ledger
+budget". Budgets for other intervals are scaled to the report's interval.
+
+	~ Monthly
+		Expenses:Food       $300.00  ; :rollover:
+		Expenses:Rent      $1200.00
+		Assets
+
+Budgets tagged :rollover: carry what was left (or overspent) in earlier
+periods forward. Amounts use the same units as the json format of ledger
+files in the json output.
+`
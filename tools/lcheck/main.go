@@ -0,0 +1,187 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+	"github.com/samuellwn/ledger/parse/lex"
+	"github.com/samuellwn/ledger/tools"
+)
+
+// problem is a single thing lcheck found wrong with the file, in the form used for json output.
+type problem struct {
+	File        string `json:"file"`
+	Line        uint64 `json:"line"`
+	Column      uint16 `json:"column"`
+	Transaction int    `json:"transaction"` // -1 if the problem isn't with a transaction.
+	Kind        string `json:"kind"`
+	Severity    string `json:"severity"` // Either "error" or "warning".
+	Message     string `json:"message"`
+}
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile, usage)
+	strict := fs.Flags.Bool("strict", false, "Require all accounts, payees, commodities, and tags to be declared.")
+	jsonOut := fs.Flags.Bool("json", false, "Write the problems as json, for editors and other tools.")
+	fs.Parse()
+
+	problems := check(fs.SourceFile, ledger.ValidateOptions{Strict: *strict})
+
+	if *jsonOut {
+		enc := json.NewEncoder(fs.Output())
+		enc.SetIndent("", "\t")
+		tools.HandleErr(enc.Encode(problems))
+	} else {
+		tools.HandleErr(writeText(fs.Output(), problems))
+	}
+
+	for _, p := range problems {
+		if p.Severity == "error" {
+			os.Exit(1)
+		}
+	}
+}
+
+// check parses the file and runs every check on it, returning the problems in line order. The parser stops at the first syntax error, so if there is one
+// that is the only problem reported.
+func check(src *os.File, opts ledger.ValidateOptions) []problem {
+	problems := []problem{}
+
+	// The file name is already part of each problem.
+	f, err := parse.Read(src, "", parse.Options{})
+	if err != nil {
+		return append(problems, newProblem(src.Name(), err))
+	}
+
+	// Validate and CheckAssertions both report transactions that don't balance.
+	seen := map[string]bool{}
+	errs := f.Validate(opts)
+	errs = append(errs, f.CheckAssertions()...)
+	errs = append(errs, f.CheckMetadata()...)
+	for _, err := range errs {
+		if seen[err.Error()] {
+			continue
+		}
+		seen[err.Error()] = true
+		problems = append(problems, newProblem(src.Name(), err))
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Column < problems[j].Column
+	})
+	return problems
+}
+
+func newProblem(file string, err error) problem {
+	p := problem{File: file, Transaction: -1, Severity: "error", Message: err.Error()}
+
+	var l lex.Location
+	switch err := err.(type) {
+	case parse.ErrBadDate:
+		p.Kind, l = "syntax", lex.Location(err)
+	case parse.ErrBadAmount:
+		p.Kind, l = "syntax", lex.Location(err)
+	case parse.ErrUnexpectedEnd:
+		p.Kind, l = "syntax", lex.Location(err)
+	case parse.ErrMalformed:
+		p.Kind, l = "syntax", lex.Location(err)
+	case parse.ErrMalformedTagLine:
+		p.Kind, l = "syntax", lex.Location(err)
+	case ledger.BalanceError:
+		p.Kind, l, p.Transaction = "balance", err.L.Location, err.T
+	case ledger.MultipleNullError:
+		p.Kind, l, p.Transaction = "null", err.L.Location, err.T
+	case ledger.AssertionError:
+		p.Kind, l, p.Transaction = "assertion", err.L.Location, err.T
+		if err.PL.Line() != 0 {
+			l = err.PL.Location
+		}
+	case ledger.UndeclaredError:
+		p.Kind, l, p.Transaction = "undeclared", err.L.Location, err.T
+		if err.PL.Line() != 0 {
+			l = err.PL.Location
+		}
+	case ledger.DuplicateIDError:
+		p.Kind, l, p.Transaction = "duplicate", err.L.Location, err.T
+	case ledger.IDCollisionError:
+		p.Kind, l, p.Transaction = "duplicate", err.L.Location, err.T
+	case ledger.TagError:
+		p.Kind, l, p.Transaction = "tag", err.L.Location, err.T
+		if !err.Assert {
+			p.Severity = "warning"
+		}
+	case ledger.DateOrderError:
+		p.Kind, l, p.Transaction = "order", err.L.Location, err.T
+		p.Severity = "warning"
+	case ledger.MetadataError:
+		p.Kind, l, p.Transaction = "metadata", err.L.Location, err.T
+	case ledger.ErrMalformedAccountName:
+		p.Kind, l = "directive", err.Location.Location
+	default:
+		p.Kind = "other"
+	}
+	p.Line, p.Column = l.Line(), l.Column()
+	return p
+}
+
+func writeText(w io.Writer, problems []problem) error {
+	for _, p := range problems {
+		_, err := fmt.Fprintf(w, "%v:%v:%v: %v: %v\n", p.File, p.Line, p.Column, p.Severity, p.Message)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var usage = `Usage:
+
+This program checks a ledger file and reports every problem it finds, instead
+of stopping at the first one. Transactions must balance, have at most one null
+posting, and pass their balance assertions. Transaction IDs must be well formed
+and unique, and transactions should be in date order (this is only a warning).
+With -strict every account, payee, commodity, and :tag: must also be declared,
+and tag values (including key/value pairs) are checked against the check and
+assert lines of their tag directives:
+
+	tag Trip
+		check value =~ /^[A-Z]/
+		assert value != "TBD"
+
+Failed checks are warnings and failed asserts are errors, same as ledger. Only
+=~, ==, and != comparisons of the value are supported.
+
+Problems are printed one per line as "file:line:column: severity: message",
+or as a json list with -json. The exit code is 1 if any errors (not warnings)
+were found. A syntax error stops the parser, so it will be the only problem
+reported.
+`
@@ -0,0 +1,181 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(0, usage)
+	write := fs.Flags.Bool("w", false, "Write the result back to the source file instead of standard output.")
+	diff := fs.Flags.Bool("d", false, "Print a diff of the changes instead of the formatted file.")
+	list := fs.Flags.Bool("l", false, "List the files that are not formatted instead of printing them.")
+	fs.Flags.BoolVar(&parseOpts.ExpandAliases, "resolve-aliases", false, "Replace account aliases with the full account names.")
+	indent := fs.Flags.String("indent", "tab", "Indent postings with \"tab\" or this `number` of spaces.")
+	opts := ledger.FormatOptions{}
+	fs.Flags.IntVar(&opts.AccountWidth, "width", 62, "Pad the account column to `n` characters.")
+	fs.Flags.BoolVar(&opts.LeftAlign, "leftalign", false, "Line up amounts on their first character instead of on the decimal point.")
+	fs.Flags.StringVar(&opts.DateFormat, "datefmt", "2006/01/02", "Write dates using this example `date` for Jan 2, 2006. Only year, month, day orders can be read back.")
+	fs.Flags.Func("amountfmt", "Write amounts like this `example`, such as \"1.000,00 €\". (default the file's format, or \"$1000.00\")", func(s string) (err error) {
+		opts.Amount, err = ledger.ParseAmountFormat(s)
+		return
+	})
+	fs.Parse()
+
+	if *indent != "tab" {
+		n, err := strconv.Atoi(*indent)
+		tools.HandleErrS(err != nil || n < 1, fmt.Sprintf("Invalid indent: %q", *indent))
+		opts.Indent = fmt.Sprintf("%*v", n, "")
+	}
+
+	if fs.Flags.NArg() == 0 {
+		tools.HandleErrS(*write, "Cannot use -w with standard input.")
+		src := tools.HandleErrV(io.ReadAll(os.Stdin))
+		tools.HandleErr(format("<standard input>", src, opts, *diff, *list))
+		return
+	}
+
+	for _, path := range fs.Flags.Args() {
+		src := tools.HandleErrV(os.ReadFile(path))
+		if *write {
+			out := tools.HandleErrV(formatFile(src, opts))
+			if !bytes.Equal(src, out) {
+				tools.HandleErr(os.WriteFile(path, out, 0666))
+			}
+			// -w with -l or -d lists or diffs the files it changed, same as gofmt.
+			if !*list && !*diff {
+				continue
+			}
+		}
+		tools.HandleErr(format(path, src, opts, *diff, *list))
+	}
+}
+
+// format formats one file, writing the result (or the diff or name, if asked) to standard output.
+func format(name string, src []byte, opts ledger.FormatOptions, diff, list bool) error {
+	out, err := formatFile(src, opts)
+	if err != nil {
+		return fmt.Errorf("%v: %w", name, err)
+	}
+
+	switch {
+	case list:
+		if !bytes.Equal(src, out) {
+			fmt.Println(name)
+		}
+	case diff:
+		if !bytes.Equal(src, out) {
+			return printDiff(name, src, out)
+		}
+	default:
+		_, err = os.Stdout.Write(out)
+	}
+	return err
+}
+
+// parseOpts are the options files are read with. Source text isn't kept, since everything is formatted again.
+var parseOpts = parse.Options{KeepComments: true}
+
+// formatFile parses the file and writes it back out with every transaction and directive in canonical form.
+// Comments between transactions are kept as they are.
+func formatFile(src []byte, opts ledger.FormatOptions) ([]byte, error) {
+	f, err := parse.Read(bytes.NewReader(src), "", parseOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	err = f.FormatWith(buf, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Everything is written with a blank line before it, which isn't wanted at the top of the file.
+	return bytes.TrimPrefix(buf.Bytes(), []byte("\n")), nil
+}
+
+// printDiff uses the system diff command to show the changes, like gofmt used to.
+func printDiff(name string, src, out []byte) error {
+	a, err := writeTemp(src)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(a)
+	b, err := writeTemp(out)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(b)
+
+	cmd := exec.Command("diff", "-u", "--label", name+".orig", "--label", name, a, b)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	// diff exits with 1 when the files differ, which they always do here.
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return nil
+	}
+	return err
+}
+
+func writeTemp(data []byte) (string, error) {
+	f, err := os.CreateTemp("", "lfmt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	return f.Name(), err
+}
+
+var usage = `Usage:
+
+    lfmt [flags] [path ...]
+
+This program formats ledger files, like gofmt does for go code. Every
+transaction and directive is parsed and written back out in canonical form:
+postings indented, amounts lined up, and comments, tags, and key/value pairs
+before the postings. Without any paths standard input is formatted.
+
+By default the formatted files are written to standard output. With -w each
+file is rewritten in place instead, -d prints a diff of the changes, and -l
+only lists the files that would change.
+
+Amounts are written in the format declared by the file's commodity
+directives, if there is one:
+
+	commodity €
+		format 1.000,00 €
+
+Account aliases (alias CC=Liabilities:CreditCard) are left as they are, use
+-resolve-aliases to write out the full account names instead.
+`
@@ -0,0 +1,159 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile, usage)
+	opts := ledger.ForecastOptions{Start: time.Now()}
+	fs.Flags.Func("start", "Project from the day after this `date`. (default today)", func(s string) (err error) {
+		opts.Start, err = tools.ParseDate(s)
+		return
+	})
+	fs.Flags.IntVar(&opts.Months, "months", 3, "Project this many `months` forward.")
+	fs.Flags.IntVar(&opts.MinCount, "mincount", 3, "A transaction must occur at least `n` times to be recurring.")
+	fs.Flags.Float64Var(&opts.Tolerance, "tolerance", 0.1, "How much the amounts of a recurring transaction may vary, as a `fraction` of the typical amount.")
+	fs.Flags.Func("accounts", "Project the balances of accounts matching this `regexp`. (default ^(Assets|Liabilities))", func(s string) (err error) {
+		opts.Account, err = regexp.Compile(s)
+		return
+	})
+	asLedger := fs.Flags.Bool("ledger", false, "Write the projected transactions as a ledger file instead.")
+	fs.Parse()
+
+	f := tools.LoadLedgerFile(fs.SourceFile)
+
+	fc := tools.HandleErrV(f.Forecast(opts))
+
+	if *asLedger {
+		out := &ledger.File{T: fc.Transactions}
+		tools.HandleErr(out.Format(fs.Output()))
+		return
+	}
+	tools.HandleErr(writeText(fs.Output(), fc, opts))
+}
+
+func schedule(r *ledger.Recurring) string {
+	switch {
+	case r.Months == 1:
+		return "monthly"
+	case r.Months == 3:
+		return "quarterly"
+	case r.Months == 12:
+		return "yearly"
+	case r.Days == 14:
+		return "biweekly"
+	default:
+		return "weekly"
+	}
+}
+
+func writeText(w io.Writer, fc *ledger.Forecast, opts ledger.ForecastOptions) error {
+	_, err := fmt.Fprintln(w, "Recurring transactions:")
+	if err != nil {
+		return err
+	}
+	for _, r := range fc.Recurring {
+		_, err := fmt.Fprintf(w, "  %-9v next %v %12v  %v\n", schedule(&r), r.After(r.Last).Format("2006/01/02"),
+			ledger.FormatValue(r.Template.Postings[0].Value), r.Payee)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Each balance series has a point for every projected posting to its account, in the same order as the
+	// transactions, so walking the transactions gives the matching points.
+	series := map[string]*ledger.Series{}
+	next := map[string]int{}
+	low := map[string]ledger.SeriesPoint{}
+	for i := range fc.Balances {
+		s := &fc.Balances[i]
+		series[s.Name] = s
+		next[s.Name] = 1
+		low[s.Name] = s.Points[0]
+	}
+
+	_, err = fmt.Fprintln(w, "\nProjected balances:")
+	if err != nil {
+		return err
+	}
+	for _, s := range fc.Balances {
+		_, err := fmt.Fprintf(w, "%v %-30v %-34v %12v %12v\n", opts.Start.Format("2006/01/02"), "Balance", s.Name, "",
+			ledger.FormatValue(s.Points[0].Value))
+		if err != nil {
+			return err
+		}
+	}
+	for _, tr := range fc.Transactions {
+		for _, p := range tr.Postings {
+			s, ok := series[p.Account]
+			if !ok {
+				continue
+			}
+			point := s.Points[next[p.Account]]
+			next[p.Account]++
+			if point.Value < low[p.Account].Value {
+				low[p.Account] = point
+			}
+
+			_, err := fmt.Fprintf(w, "%v %-30v %-34v %12v %12v\n", tr.Date.Format("2006/01/02"), tr.Description,
+				p.Account, ledger.FormatValue(p.Value), ledger.FormatValue(point.Value))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = fmt.Fprintln(w, "\nLowest balances:")
+	if err != nil {
+		return err
+	}
+	for _, s := range fc.Balances {
+		l := low[s.Name]
+		_, err := fmt.Fprintf(w, "  %-34v %12v on %v\n", s.Name, ledger.FormatValue(l.Value), l.Date.Format("2006/01/02"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var usage = `Usage:
+
+This program takes a ledger file, finds the transactions that repeat on a
+regular schedule (weekly, biweekly, monthly, quarterly, or yearly, with about
+the same amount each time), and projects them forward to show what the
+balances of your accounts will be, and how low they get. This is useful for
+questions like "will I overdraft before payday?".
+
+Use -ledger to get the projected transactions as a ledger file, to check
+them or to add to a copy of the journal for other reports.
+`
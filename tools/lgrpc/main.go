@@ -0,0 +1,129 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/samuellwn/ledger/client"
+	"github.com/samuellwn/ledger/rpc"
+	"github.com/samuellwn/ledger/tools"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagIDGenerator, usage)
+	config := client.DefaultConfig
+	fs.Flags.StringVar(&config.Journal, "journal", config.Journal, "The ledger `file` to serve.")
+	fs.Flags.StringVar(&config.Attachments, "attachments", config.Attachments, "The `directory` attachments are stored in.")
+	fs.Flags.BoolVar(&config.ReadOnly, "readonly", false, "Only allow reading, never change the journal.")
+	addr := "localhost:2481"
+	fs.Flags.StringVar(&addr, "addr", addr, "The ip:port `address` to listen on.")
+	token := ""
+	fs.Flags.StringVar(&token, "token", os.Getenv("LEDGER_API_TOKEN"), "Shared secret `token` clients must send. Defaults to $LEDGER_API_TOKEN.")
+	cert, key := "", ""
+	fs.Flags.StringVar(&cert, "cert", "", "TLS certificate `file`.")
+	fs.Flags.StringVar(&key, "key", "", "TLS private key `file` for -cert.")
+	fs.Parse()
+
+	if key != "" && cert == "" {
+		tools.HandleErrS(true, "A key was given without a certificate.")
+	}
+
+	c := tools.HandleErrV(client.NewClientWithConfig(config))
+	defer c.Close()
+
+	opts := []grpc.ServerOption{}
+	if cert != "" {
+		creds := tools.HandleErrV(credentials.NewServerTLSFromFile(cert, key))
+		opts = append(opts, grpc.Creds(creds))
+	}
+	if token != "" {
+		a := authorizer("Bearer " + token)
+		opts = append(opts, grpc.UnaryInterceptor(a.unary), grpc.StreamInterceptor(a.stream))
+	}
+	if cert == "" && token == "" {
+		fmt.Fprintln(os.Stderr, "Warning: Running without TLS or a token, anyone who can connect can read and change the journal.")
+	}
+
+	gs := grpc.NewServer(opts...)
+	rpc.RegisterLedgerServer(gs, rpc.NewServer(c))
+
+	l := tools.HandleErrV(net.Listen("tcp", addr))
+	tools.HandleErr(gs.Serve(l))
+}
+
+// authorizer turns away calls that don't have the right "authorization" metadata.
+type authorizer string
+
+func (a authorizer) check(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(v), []byte(a)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "Bad or missing token.")
+}
+
+func (a authorizer) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, h grpc.UnaryHandler) (interface{}, error) {
+	err := a.check(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h(ctx, req)
+}
+
+func (a authorizer) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, h grpc.StreamHandler) error {
+	err := a.check(ss.Context())
+	if err != nil {
+		return err
+	}
+	return h(srv, ss)
+}
+
+var usage = `Usage:
+
+This program serves a ledger journal as a gRPC service, for integrations that
+would rather not use the JSON API served by lserve. Both go through the same
+client, so transactions are given IDs and revision IDs, edits and voids are
+appended as new revisions, and changes made to the journal by anything else
+are picked up automatically.
+
+The service is defined in rpc/ledger.proto. Besides listing, adding, editing,
+and voiding transactions and the account, balance, and register reports,
+WatchEvents streams a message for every change to the journal, so a frontend
+can stay up to date without polling.
+
+By default anyone who can connect can read and change the journal. Give a
+-token (or set LEDGER_API_TOKEN) to require "authorization: Bearer <token>"
+metadata on every call, and -cert and -key to serve over TLS.
+`
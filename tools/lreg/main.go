@@ -0,0 +1,105 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile|tools.FlagQuery|tools.FlagExchange|tools.FlagAliases, usage)
+	payeeWidth := fs.Flags.Int("payeewidth", 30, "Truncate payees to `n` characters.")
+	accountWidth := fs.Flags.Int("accountwidth", 34, "Truncate accounts to `n` characters.")
+	fs.Parse()
+
+	f := tools.LoadLedgerFile(fs.SourceFile)
+
+	rows := tools.HandleErrV(f.Register(fs.Query))
+	af := tools.HandleErrV(f.ExchangeFormat(fs.Query))
+
+	tools.HandleErr(writeRegister(fs.Output(), rows, af, *payeeWidth, *accountWidth))
+}
+
+func writeRegister(w io.Writer, rows []ledger.RegisterRow, af ledger.AmountFormat, payeeWidth, accountWidth int) error {
+	amountWidth := 0
+	for _, row := range rows {
+		for _, v := range []int64{row.Amount, row.Total} {
+			if l := utf8.RuneCountInString(af.Format(v)); l > amountWidth {
+				amountWidth = l
+			}
+		}
+	}
+
+	for i, row := range rows {
+		date, payee := "", ""
+		// Like ledger, only the first row of each transaction gets the date and payee.
+		if i == 0 || rows[i-1].T != row.T {
+			date = row.Date.Format("2006/01/02")
+			payee = row.Payee
+		}
+
+		_, err := fmt.Fprintf(w, "%-10v %-*v %-*v %*v %*v\n",
+			date,
+			payeeWidth, truncate(payee, payeeWidth),
+			accountWidth, truncate(row.Account, accountWidth),
+			amountWidth, af.Format(row.Amount),
+			amountWidth, af.Format(row.Total))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate shortens s to at most n characters, marking the cut with "..".
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n <= 2 {
+		return string(r[:n])
+	}
+	return string(r[:n-2]) + ".."
+}
+
+var usage = `Usage:
+
+This program takes a ledger file and prints a register report, same as
+"ledger register": one line for each selected posting with the date, payee,
+account, amount, and a running total. With -related the other side of each
+transaction is shown instead, so "-accounts Checking -related" shows where the
+money in checking came from and went to.
+
+With -X (or -exchange) amounts are valued in the given commodity using the
+prices from the P directives in the file, see lbal.
+
+Postings with their own date ("; [2024/01/05]" after the amount) are listed
+on that date. With -effective the effective dates are used instead, "[=date]"
+on postings or "=date" after the transaction date, same as ledger --effective.
+`
@@ -0,0 +1,70 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile|tools.FlagQuery|tools.FlagAliases, usage)
+	opts := ledger.HTMLReportOptions{}
+	fs.Flags.StringVar(&opts.Title, "title", "", "The report `title`. (default \"Ledger Report\")")
+	fs.Flags.IntVar(&opts.Depth, "depth", 0, "Collapse accounts nested deeper than `n` levels into their parents in the balance report.")
+	fs.Flags.BoolVar(&opts.NoBalance, "nobalance", false, "Leave out the balance report.")
+	fs.Flags.BoolVar(&opts.NoRegister, "noregister", false, "Leave out the register report.")
+	month := ""
+	fs.Flags.StringVar(&month, "month", "", "Report on a single `month`, yyyy/mm or yyyy-mm. Overrides -begin and -end.")
+	fs.Parse()
+
+	opts.Query = fs.Query
+	if month != "" {
+		begin, err := time.Parse("2006/01", month)
+		if err != nil {
+			begin = tools.HandleErrV(time.Parse("2006-01", month))
+		}
+		opts.Query.Begin, opts.Query.End = begin, begin.AddDate(0, 1, 0)
+		if opts.Title == "" {
+			opts.Title = "Statement for " + begin.Format("January 2006")
+		}
+	}
+
+	f := tools.LoadLedgerFile(fs.SourceFile)
+
+	tools.HandleErr(f.WriteHTMLReport(fs.Output(), opts))
+}
+
+var usage = `Usage:
+
+This program takes a ledger file and writes a standalone HTML report, with
+the balance of each account as an expandable tree and a register of every
+selected posting as a table that can be sorted by clicking its headings. The
+page has no outside dependencies, so it can be emailed or archived as is.
+
+For a monthly statement of a few accounts:
+
+	lreport -source books.ledger -month 2026/01 -accounts '^Assets' -dest jan.html
+`
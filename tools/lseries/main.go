@@ -0,0 +1,87 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile|tools.FlagQuery, usage)
+	kind := fs.Flags.String("kind", "networth", "The `series` to compute, one of \"networth\", \"cashflow\", or \"balance\".")
+	depth := fs.Flags.Int("depth", 0, "Collapse accounts nested deeper than `n` levels into their parents for -kind balance.")
+	format := fs.Flags.String("format", "csv", "Output `format`, either \"csv\" or \"json\".")
+	interval := ledger.IntervalMonthly
+	fs.Flags.Func("interval", "The length of each period: weekly, monthly, quarterly, or yearly. (default monthly)", func(s string) error {
+		iv, ok := ledger.ParseInterval(s)
+		if !ok {
+			return fmt.Errorf("Unknown interval: %q", s)
+		}
+		interval = iv
+		return nil
+	})
+	fs.Parse()
+
+	f := tools.LoadLedgerFile(fs.SourceFile)
+
+	var series []ledger.Series
+	switch *kind {
+	case "networth":
+		s := tools.HandleErrV(f.NetWorth(fs.Query, interval))
+		series = []ledger.Series{*s}
+	case "cashflow":
+		series = tools.HandleErrV(f.CashFlow(fs.Query, interval))
+	case "balance":
+		series = tools.HandleErrV(f.BalanceHistory(fs.Query, interval, *depth))
+	default:
+		tools.HandleErrS(true, fmt.Sprintf("Unknown series: %q", *kind))
+	}
+
+	switch *format {
+	case "csv":
+		tools.HandleErr(ledger.WriteSeriesCSV(fs.Output(), series...))
+	case "json":
+		enc := json.NewEncoder(fs.Output())
+		enc.SetIndent("", "\t")
+		tools.HandleErr(enc.Encode(series))
+	default:
+		tools.HandleErrS(true, fmt.Sprintf("Unknown output format: %q", *format))
+	}
+}
+
+var usage = `Usage:
+
+This program takes a ledger file and writes time series for charts and
+dashboards. The networth series is the balance of Assets and Liabilities at
+the end of each period, cashflow gives income, expenses, and their difference
+for each period, and balance gives the balance of every selected account at
+the end of each period. Balances include transactions before -begin.
+
+The csv output has a date column (the start of each period) and a column for
+each series. The json output is a list of series, each with a name and a list
+of points, with amounts in the same units as the json format of ledger files.
+`
@@ -0,0 +1,407 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/client"
+	"github.com/samuellwn/ledger/tools"
+)
+
+// maxUpload is the largest attachment that can be uploaded.
+const maxUpload = 32 << 20
+
+// api serves the JSON API for a client.
+type api struct {
+	c     *client.Client
+	token string
+}
+
+func newAPI(c *client.Client, token string) *api {
+	return &api{c: c, token: token}
+}
+
+// routes returns a handler for the whole API.
+func (a *api) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/transactions", a.handleTransactions)
+	mux.HandleFunc("/transactions/", a.handleTransaction)
+	mux.HandleFunc("/attachments/", a.handleAttachment)
+	mux.HandleFunc("/accounts", a.handleAccounts)
+	mux.HandleFunc("/balances", a.handleBalances)
+	mux.HandleFunc("/register", a.handleRegister)
+	return a.authorize(mux)
+}
+
+// authorize wraps a handler so that requests without the right token are turned away. If no token is set every
+// request is let through.
+func (a *api) authorize(h http.Handler) http.Handler {
+	if a.token == "" {
+		return h
+	}
+	want := []byte("Bearer " + a.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("Bad or missing token."))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON sends v as the response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// writeError sends an error as the response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// writeClientError sends an error from the client, with a status that fits it.
+func writeClientError(w http.ResponseWriter, err error) {
+	var berr ledger.BalanceError
+	var nerr ledger.MultipleNullError
+	switch {
+	case errors.Is(err, client.TransactionNotFoundError), errors.Is(err, client.MissingParentError),
+		errors.Is(err, client.AttachmentNotFoundError):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, client.ReadOnlyError):
+		writeError(w, http.StatusForbidden, err)
+	case errors.Is(err, client.MissingIDError), errors.As(err, &berr), errors.As(err, &nerr):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		fmt.Fprintln(os.Stderr, err)
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed."))
+}
+
+// readTransaction reads a transaction sent as the request body. The client sets the revision ID, so any sent along
+// is dropped.
+func readTransaction(r *http.Request) (ledger.Transaction, error) {
+	tr := ledger.Transaction{}
+	err := json.NewDecoder(r.Body).Decode(&tr)
+	if err != nil {
+		return tr, err
+	}
+	delete(tr.KVPairs, "RID")
+	return tr, nil
+}
+
+// dateFilter converts the date parameter to one of the client date filters.
+func dateFilter(r *http.Request) (int, error) {
+	switch v := r.URL.Query().Get("date"); v {
+	case "", "all":
+		return client.FilterAllDates, nil
+	case "this-month":
+		return client.FilterThisMonth, nil
+	case "last-month":
+		return client.FilterLastMonth, nil
+	case "this-year":
+		return client.FilterThisYear, nil
+	case "last-year":
+		return client.FilterLastYear, nil
+	default:
+		return 0, fmt.Errorf("Unknown date filter: %q", v)
+	}
+}
+
+// handleTransactions lists transactions (GET) or adds a new one (POST).
+func (a *api) handleTransactions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		dfilter, err := dateFilter(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		sfilter := client.FilterAllStatus
+		switch v := r.URL.Query().Get("status"); v {
+		case "", "all":
+		case "cleared":
+			sfilter = client.FilterClearStatus
+		case "pending":
+			sfilter = client.FilterPendingStatus
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Unknown status filter: %q", v))
+			return
+		}
+
+		tfilter := map[string]bool{}
+		for _, tag := range r.URL.Query()["tag"] {
+			tfilter[tag] = true
+		}
+
+		writeJSON(w, http.StatusOK, a.c.GetTransactions(dfilter, sfilter, tfilter))
+
+	case http.MethodPost:
+		tr, err := readTransaction(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		delete(tr.KVPairs, "ID")
+
+		err = a.c.AddTransaction(tr)
+		if err != nil {
+			writeClientError(w, err)
+			return
+		}
+		// AddTransaction fills in the IDs on our copy of the maps.
+		writeJSON(w, http.StatusCreated, tr)
+
+	default:
+		methodNotAllowed(w, "GET, POST")
+	}
+}
+
+// handleTransaction handles everything under /transactions/<id>.
+func (a *api) handleTransaction(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/transactions/")
+	id, sub, _ := strings.Cut(rest, "/")
+	if id == "" {
+		writeError(w, http.StatusNotFound, client.TransactionNotFoundError)
+		return
+	}
+	if sub == "attachments" {
+		a.handleUpload(w, r, id)
+		return
+	}
+	if sub != "" {
+		writeError(w, http.StatusNotFound, errors.New("Not found."))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		trs := a.c.GetTransactionWithHistory(id)
+		if len(trs) == 0 {
+			writeError(w, http.StatusNotFound, client.TransactionNotFoundError)
+			return
+		}
+		writeJSON(w, http.StatusOK, trs)
+
+	case http.MethodPut:
+		tr, err := readTransaction(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		tr.KVPairs["ID"] = id
+
+		err = a.c.AddTransactionEdit(tr)
+		if err != nil {
+			writeClientError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tr)
+
+	case http.MethodDelete:
+		err := a.c.VoidTransaction(id)
+		if err != nil {
+			writeClientError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, "GET, PUT, DELETE")
+	}
+}
+
+// handleUpload attaches the uploaded file to a transaction.
+func (a *api) handleUpload(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, "POST")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUpload)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer file.Close()
+
+	// The client copies attachments in from a path, and keeps the extension.
+	tmp, err := os.CreateTemp("", "lserve-*"+filepath.Ext(filepath.Base(header.Filename)))
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, file)
+	cerr := tmp.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	err = a.c.AddAttachment(id, tmp.Name())
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	trs := a.c.GetTransactionWithHistory(id)
+	writeJSON(w, http.StatusCreated, trs[len(trs)-1])
+}
+
+// handleAttachment sends an attachment.
+func (a *api) handleAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, "GET, HEAD")
+		return
+	}
+
+	path, err := a.c.GetAttachment(strings.TrimPrefix(r.URL.Path, "/attachments/"))
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	http.ServeFile(w, r, path)
+}
+
+// handleAccounts lists all the accounts.
+func (a *api) handleAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, "GET")
+		return
+	}
+	writeJSON(w, http.StatusOK, a.c.GetAccountList())
+}
+
+// handleBalances sends the account balances, as display rows.
+func (a *api) handleBalances(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, "GET")
+		return
+	}
+
+	dfilter, err := dateFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var rows [][]string
+	if exchange := r.URL.Query().Get("exchange"); exchange != "" {
+		rows, err = a.c.GetExchangeBalances(dfilter, exchange, r.URL.Query().Get("latest") == "true")
+	} else {
+		rows, err = a.c.GetBalances(dfilter)
+	}
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	res := make([]jsonBalance, len(rows))
+	for i, row := range rows {
+		res[i] = jsonBalance{Name: row[0], AmountText: row[1]}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleRegister sends a register report.
+func (a *api) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, "GET")
+		return
+	}
+
+	q, err := parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	rows, err := a.c.GetRegister(q)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, registerToJSON(rows))
+}
+
+// parseQuery reads a report query from the request parameters, same as the -accounts, -begin, etc flags.
+func parseQuery(r *http.Request) (ledger.ReportQuery, error) {
+	q := ledger.ReportQuery{}
+	params := r.URL.Query()
+
+	var err error
+	if v := params.Get("accounts"); v != "" {
+		q.Account, err = regexp.Compile(v)
+		if err != nil {
+			return q, err
+		}
+	}
+	if v := params.Get("begin"); v != "" {
+		q.Begin, err = tools.ParseDate(v)
+		if err != nil {
+			return q, err
+		}
+	}
+	if v := params.Get("end"); v != "" {
+		q.End, err = tools.ParseDate(v)
+		if err != nil {
+			return q, err
+		}
+	}
+
+	flags := map[string]*bool{"cleared": &q.Cleared, "pending": &q.Pending, "uncleared": &q.Uncleared, "related": &q.Related}
+	for name, dst := range flags {
+		if v := params.Get(name); v != "" {
+			*dst, err = strconv.ParseBool(v)
+			if err != nil {
+				return q, fmt.Errorf("Bad value for %v: %q", name, v)
+			}
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/client"
+)
+
+// Transactions use the JSON form from the ledger package, this is everything else the API sends.
+
+// jsonRegisterRow is a single row of a register report. Amounts work the same as for postings.
+type jsonRegisterRow struct {
+	ID         string `json:"id"`
+	Date       string `json:"date"`
+	Payee      string `json:"payee"`
+	Account    string `json:"account"`
+	Amount     int64  `json:"amount"`
+	AmountText string `json:"amountText"`
+	Total      int64  `json:"total"`
+	TotalText  string `json:"totalText"`
+}
+
+// jsonBalance is a display row from client.GetBalances.
+type jsonBalance struct {
+	Name       string `json:"name"`
+	AmountText string `json:"amountText"`
+}
+
+func registerToJSON(rows []client.RegisterRow) []jsonRegisterRow {
+	res := make([]jsonRegisterRow, len(rows))
+	for i, row := range rows {
+		res[i] = jsonRegisterRow{
+			ID:         row.ID,
+			Date:       row.Date.Format("2006-01-02"),
+			Payee:      row.Payee,
+			Account:    row.Account,
+			Amount:     row.Amount,
+			AmountText: ledger.FormatValue(row.Amount),
+			Total:      row.Total,
+			TotalText:  ledger.FormatValue(row.Total),
+		}
+	}
+	return res
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/samuellwn/ledger/client"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagIDGenerator, usage)
+	config := client.DefaultConfig
+	config.Encryption = tools.Encryption
+	config.Cache = tools.Cache.Dir
+	fs.Flags.StringVar(&config.Journal, "journal", config.Journal, "The ledger `file` to serve.")
+	fs.Flags.StringVar(&config.Attachments, "attachments", config.Attachments, "The `directory` attachments are stored in.")
+	fs.Flags.BoolVar(&config.ReadOnly, "readonly", false, "Only allow reading, never change the journal.")
+	fs.Flags.BoolVar(&config.Git, "git", false, "Commit every change to the git repository the journal is in, see ghistory.")
+	addr := "localhost:2480"
+	fs.Flags.StringVar(&addr, "addr", addr, "The ip:port `address` to listen on.")
+	token := ""
+	fs.Flags.StringVar(&token, "token", os.Getenv("LEDGER_API_TOKEN"), "Shared secret `token` clients must send. Defaults to $LEDGER_API_TOKEN.")
+	cert, key := "", ""
+	fs.Flags.StringVar(&cert, "cert", "", "TLS certificate `file`.")
+	fs.Flags.StringVar(&key, "key", "", "TLS private key `file` for -cert.")
+	fs.Parse()
+
+	if key != "" && cert == "" {
+		tools.HandleErrS(true, "A key was given without a certificate.")
+	}
+
+	c := tools.HandleErrV(client.NewClientWithConfig(config))
+	defer c.Close()
+
+	if cert == "" && token == "" {
+		fmt.Fprintln(os.Stderr, "Warning: Running without TLS or a token, anyone who can connect can read and change the journal.")
+	}
+	hs := &http.Server{Addr: addr, Handler: newAPI(c, token).routes()}
+	if cert != "" {
+		hs.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		tools.HandleErr(hs.ListenAndServeTLS(cert, key))
+	}
+	tools.HandleErr(hs.ListenAndServe())
+}
+
+var usage = `Usage:
+
+This program serves a ledger journal over a JSON REST API, so frontends can be
+built on top of the client package without linking Go. Everything the API does
+goes through the same client a Go program would use, so transactions are given
+IDs and revision IDs, edits and voids are appended as new revisions, and
+changes made to the journal by anything else are picked up automatically.
+
+The API:
+
+	GET    /transactions                   List transactions.
+	POST   /transactions                   Add a transaction.
+	GET    /transactions/<id>              Every revision of a transaction.
+	PUT    /transactions/<id>              Edit a transaction.
+	DELETE /transactions/<id>              Void a transaction.
+	POST   /transactions/<id>/attachments  Attach the uploaded "file" to a transaction.
+	GET    /attachments/<aid>              Download an attachment.
+	GET    /accounts                       List accounts.
+	GET    /balances                       Account balances, ready to display.
+	GET    /register                       A register report.
+
+/transactions and /balances take a "date" parameter: "all" (the default),
+"this-month", "last-month", "this-year", or "last-year". /transactions also
+takes "status" ("all", "cleared", or "pending") and any number of "tag"
+parameters. /register takes "accounts" (a regexp), "begin" and "end"
+(yyyy-mm-dd), and "cleared", "pending", "uncleared", and "related" (true or
+false), same as the lreg tool. /balances also takes "exchange" (a commodity)
+and "latest" (true or false), same as the -X and -latest options of lbal.
+
+Transactions are sent and received in the same JSON form as everywhere else in
+the ledger package, for example:
+
+	{
+		"date": "2024-01-02",
+		"status": "cleared",
+		"description": "Groceries",
+		"postings": [
+			{"account": "Expenses:Food", "amount": 123400},
+			{"account": "Assets:Checking", "null": true}
+		],
+		"tags": ["food"]
+	}
+
+Amounts are in ten-thousandths of a dollar, so 123400 is $12.34 (or send
+"amountText": "$12.34" instead). The transaction ID is the "ID" entry of "kv".
+Errors are sent as {"error": "message"} with a matching HTTP status.
+
+By default anyone who can connect can read and change the journal. Give a
+-token (or set LEDGER_API_TOKEN) to require "Authorization: Bearer <token>" on
+every request, and -cert and -key to serve over TLS.
+
+Encrypted journals are decrypted with gpg or age when they are loaded, and
+encrypted again on every change. Set LEDGER_ENCRYPT to "gpg" or "age" to
+encrypt a plain text journal, LEDGER_RECIPIENTS to a comma separated list of
+gpg key IDs or age recipients to encrypt to, LEDGER_IDENTITY to an age identity
+file, and LEDGER_PASSPHRASE_FILE to a file with the passphrase for symmetric
+gpg encryption. Files included by the journal can't be encrypted.
+
+Set LEDGER_CACHE to a directory to keep a parsed copy of the journal there, so
+lserve starts faster when the journal hasn't changed.
+`
@@ -0,0 +1,210 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+type stats struct {
+	Transactions int       `json:"transactions"` // Latest revisions only.
+	Revisions    int       `json:"revisions"`    // Every transaction in the file.
+	Directives   int       `json:"directives"`
+	First        time.Time `json:"first"`
+	Last         time.Time `json:"last"`
+	Accounts     []string  `json:"accounts"`
+	Payees       int       `json:"payees"`
+	Commodities  []string  `json:"commodities"`
+	Uncleared    int       `json:"uncleared"`
+	Pending      int       `json:"pending"`
+	Imports      []imports `json:"imports"`
+
+	// File health, from the same checks lcheck does.
+	Unbalanced int `json:"unbalanced"`
+	Assertions int `json:"assertions"` // Failed balance assertions.
+	Metadata   int `json:"metadata"`   // Bad or duplicate IDs.
+	OutOfOrder int `json:"outOfOrder"`
+}
+
+// imports describes the transactions imported from a bank for one account, found by their FITIDs.
+type imports struct {
+	Account      string    `json:"account"`
+	Transactions int       `json:"transactions"`
+	Last         time.Time `json:"last"`
+}
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile, usage)
+	jsonOut := fs.Flags.Bool("json", false, "Write the statistics as json.")
+	fs.Parse()
+
+	f := tools.LoadLedgerFile(fs.SourceFile)
+	s := collect(f)
+
+	if *jsonOut {
+		enc := json.NewEncoder(fs.Output())
+		enc.SetIndent("", "\t")
+		tools.HandleErr(enc.Encode(s))
+		return
+	}
+	tools.HandleErr(writeText(fs.Output(), s))
+}
+
+func collect(f *ledger.File) *stats {
+	s := &stats{Revisions: len(f.T), Directives: len(f.D), Accounts: []string{}, Imports: []imports{}}
+
+	for _, err := range append(f.CheckAssertions(), f.CheckMetadata()...) {
+		switch err.(type) {
+		case ledger.BalanceError, ledger.MultipleNullError:
+			s.Unbalanced++
+		case ledger.AssertionError:
+			s.Assertions++
+		case ledger.DateOrderError:
+			s.OutOfOrder++
+		default:
+			s.Metadata++
+		}
+	}
+
+	latest := f.CleanCopy()
+	latest.StripHistory()
+	s.Transactions = len(latest.T)
+
+	accounts := map[string]bool{}
+	payees := map[string]bool{}
+	commodities := map[string]bool{}
+	banks := map[string]*imports{}
+	for _, tr := range latest.T {
+		if s.First.IsZero() || tr.Date.Before(s.First) {
+			s.First = tr.Date
+		}
+		if tr.Date.After(s.Last) {
+			s.Last = tr.Date
+		}
+
+		payees[tr.Description] = true
+		switch tr.Status {
+		case ledger.StatusPending:
+			s.Pending++
+		case ledger.StatusUndefined:
+			s.Uncleared++
+		}
+
+		for _, p := range tr.Postings {
+			accounts[p.Account] = true
+			if !p.Null || p.HasAssert {
+				// Only dollars are supported.
+				commodities["$"] = true
+			}
+		}
+
+		if tr.KVPairs["FITID"] != "" {
+			bank := tr.KVPairs["Account"]
+			if banks[bank] == nil {
+				banks[bank] = &imports{Account: bank}
+			}
+			banks[bank].Transactions++
+			if tr.Date.After(banks[bank].Last) {
+				banks[bank].Last = tr.Date
+			}
+		}
+	}
+	for i := range f.D {
+		v, _ := f.D[i].Parse()
+		if c, ok := v.(*ledger.CommodityDirective); ok {
+			commodities[c.Symbol] = true
+		}
+	}
+
+	for name := range accounts {
+		s.Accounts = append(s.Accounts, name)
+	}
+	sort.Strings(s.Accounts)
+	s.Payees = len(payees)
+	for name := range commodities {
+		s.Commodities = append(s.Commodities, name)
+	}
+	sort.Strings(s.Commodities)
+	for _, bank := range banks {
+		s.Imports = append(s.Imports, *bank)
+	}
+	sort.Slice(s.Imports, func(i, j int) bool {
+		return s.Imports[i].Account < s.Imports[j].Account
+	})
+	return s
+}
+
+func writeText(w io.Writer, s *stats) error {
+	date := func(t time.Time) string {
+		if t.IsZero() {
+			return "none"
+		}
+		return t.Format("2006/01/02")
+	}
+
+	lines := []string{
+		fmt.Sprintf("Transactions:  %v (%v with history)", s.Transactions, s.Revisions),
+		fmt.Sprintf("Directives:    %v", s.Directives),
+		fmt.Sprintf("Dates:         %v to %v", date(s.First), date(s.Last)),
+		fmt.Sprintf("Accounts:      %v", len(s.Accounts)),
+		fmt.Sprintf("Payees:        %v", s.Payees),
+		fmt.Sprintf("Commodities:   %v", strings.Join(s.Commodities, ", ")),
+		fmt.Sprintf("Uncleared:     %v (%v pending)", s.Uncleared+s.Pending, s.Pending),
+	}
+
+	if len(s.Imports) > 0 {
+		lines = append(lines, "", "Last import:")
+		for _, bank := range s.Imports {
+			lines = append(lines, fmt.Sprintf("  %v  %v (%v transactions)", date(bank.Last), bank.Account, bank.Transactions))
+		}
+	}
+
+	health := "OK"
+	if s.Unbalanced+s.Assertions+s.Metadata+s.OutOfOrder > 0 {
+		health = fmt.Sprintf("%v unbalanced, %v failed assertions, %v bad IDs, %v out of order (run lcheck for details)",
+			s.Unbalanced, s.Assertions, s.Metadata, s.OutOfOrder)
+	}
+	lines = append(lines, "", "Health:        "+health)
+
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+var usage = `Usage:
+
+This program prints a summary of a ledger file: how many transactions it has
+and the dates they cover, how many accounts and payees are used, how many
+transactions have not cleared yet, the date of the last imported transaction
+for each bank account (found by the FITID KV pair importers add), and a count
+of any problems with the file. Handy for checking a file before and after a
+merge. Transaction counts only include the latest revision of each
+transaction, except for the "with history" count.
+`
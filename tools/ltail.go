@@ -26,39 +26,60 @@ import "github.com/samuellwn/ledger"
 
 // LTail tails a ledger file based on a ID and RID. There are no error cases (if the ID doesn't exist you just get an empty file)
 func LTail(f *ledger.File, id, rid string) *ledger.File {
-	// Go through the transactions *in reverse* looking for the ID (and also the revision ID if specified)
-	i := len(f.T) - 1
-	for ; i >= 0; i-- {
-		if fid, ok := f.T[i].KVPairs["ID"]; ok && fid == id {
-			if rid != "" {
-				if frid, ok := f.T[i].KVPairs["RID"]; ok && frid == rid {
-					break
-				}
-				continue
-			}
-			break
-		}
+	i := findRevision(f, id, rid)
+	if i < 0 {
+		return &ledger.File{}
 	}
+	return sliceFile(f, i, len(f.T))
+}
 
-	// slice the transaction list to remove everything before that point.
-	rtrs := f.T[i:]
+// LHead is the counterpart to LTail, it returns everything before the transaction with the given ID and RID, so
+// LHead and LTail together split a file in two. As with LTail, if the ID doesn't exist you get an empty file.
+func LHead(f *ledger.File, id, rid string) *ledger.File {
+	i := findRevision(f, id, rid)
+	if i < 0 {
+		return &ledger.File{}
+	}
+	return sliceFile(f, 0, i)
+}
 
-	// Now drop all the directives that come before the selected transaction
-	rdrs := f.D
-	if len(f.D) > 0 {
-		j := 0
-		for ; j < len(f.D); j++ {
-			if f.D[j].FoundBefore > i {
-				break
-			}
-		}
-		rdrs = f.D[j:]
+// LSlice returns everything from the transaction with the first ID and RID up to (but not including) the one with
+// the second. If the first ID is empty the slice starts at the beginning of the file, and if the second is empty
+// it runs to the end. If either ID doesn't exist, or the second comes before the first, you get an empty file.
+func LSlice(f *ledger.File, fromID, fromRID, toID, toRID string) *ledger.File {
+	from, to := 0, len(f.T)
+	if fromID != "" {
+		from = findRevision(f, fromID, fromRID)
+	}
+	if toID != "" {
+		to = findRevision(f, toID, toRID)
+	}
+	if from < 0 || to < from {
+		return &ledger.File{}
+	}
+	return sliceFile(f, from, to)
+}
+
+// findRevision returns the index of the last transaction with the given ID (and revision ID if it isn't empty), or
+// -1 if there isn't one.
+func findRevision(f *ledger.File, id, rid string) int {
+	i, _ := f.Index().FindRevision(id, rid)
+	return i
+}
 
-		// Adjust FoundBefore values
-		for k := range rdrs {
-			rdrs[k].FoundBefore -= i
+// sliceFile returns the transactions from index from up to index to, along with the directives between them. A
+// directive goes with the transaction it precedes, so splitting a file at any point puts every directive in exactly
+// one of the parts. The transactions are shared with f, but the directives are copied so their FoundBefore values
+// can be adjusted.
+func sliceFile(f *ledger.File, from, to int) *ledger.File {
+	rdrs := []ledger.Directive{}
+	for _, d := range f.D {
+		if d.FoundBefore < from || d.FoundBefore > to || d.FoundBefore == to && to < len(f.T) {
+			continue
 		}
+		d.FoundBefore -= from
+		rdrs = append(rdrs, d)
 	}
 
-	return &ledger.File{T: rtrs, D: rdrs}
+	return &ledger.File{T: f.T[from:to:to], D: rdrs}
 }
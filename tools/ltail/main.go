@@ -28,11 +28,26 @@ import (
 
 func main() {
 	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagMasterFile|tools.FlagID|tools.FlagRID, usage)
+	before, beforeRID := "", ""
+	fs.Flags.StringVar(&before, "before", before, "Stop at the transaction with this `ID`, leaving it and everything after it out.")
+	fs.Flags.StringVar(&beforeRID, "before-rid", beforeRID, "The revision `ID` of the -before transaction.")
 	fs.Parse()
 
 	f := tools.LoadLedgerFile(fs.MasterFile)
 
+	// Without a -rid any revision of the transaction will do.
+	if fs.RID == "NIL" {
+		fs.RID = ""
+	}
 	rf := tools.LTail(f, fs.ID, fs.RID)
+	if before != "" {
+		// Without an -id the range starts at the beginning of the file.
+		id := fs.ID
+		if id == "NIL" {
+			id = ""
+		}
+		rf = tools.LSlice(f, id, fs.RID, before, beforeRID)
+	}
 
 	tools.WriteLedgerFile(fs.DestFile, rf)
 }
@@ -46,4 +61,8 @@ For this to work properly, each transaction needs the "code" field to be a
 unique transaction ID, otherwise it is not possible. Additionally, to ensure
 proper operation on a file containing revision history, you may need to provide
 the revision ID of the transaction to split upon.
+
+With -before only the transactions from the given ID up to (but not including)
+the -before ID are kept, to pull a range out of the middle of a file. See also
+lhead, which keeps everything before a transaction instead.
 `
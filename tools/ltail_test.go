@@ -0,0 +1,68 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package tools_test
+
+import (
+	"testing"
+
+	"github.com/samuellwn/ledger/tools"
+)
+
+func TestLHeadTail(t *testing.T) {
+	f := zipFile(t, "account Assets:Cash\n\n", zipTransaction(1, "a", "1"), zipTransaction(2, "b", "1"),
+		"account Expenses:Test\n\n", zipTransaction(3, "c", "1"), zipTransaction(4, "d", "1"), "payee Test\n")
+
+	head, tail := tools.LHead(f, "c", ""), tools.LTail(f, "c", "")
+	if ids := zipIDs(head); ids != "a1 b1" {
+		t.Errorf("Incorrect head: %v", ids)
+	}
+	if ids := zipIDs(tail); ids != "c1 d1" {
+		t.Errorf("Incorrect tail: %v", ids)
+	}
+
+	// The directive before c goes with it, and the FoundBefore values match the new files.
+	if len(head.D) != 1 || head.D[0].FoundBefore != 0 {
+		t.Errorf("Incorrect head directives: %v", head.D)
+	}
+	if len(tail.D) != 2 || tail.D[0].FoundBefore != 0 || tail.D[1].FoundBefore != 2 {
+		t.Errorf("Incorrect tail directives: %v", tail.D)
+	}
+	if f.D[1].FoundBefore != 2 {
+		t.Errorf("Original directives changed: %v", f.D)
+	}
+
+	slice := tools.LSlice(f, "b", "1", "d", "1")
+	if ids := zipIDs(slice); ids != "b1 c1" {
+		t.Errorf("Incorrect slice: %v", ids)
+	}
+	if len(slice.D) != 1 || slice.D[0].FoundBefore != 1 {
+		t.Errorf("Incorrect slice directives: %v", slice.D)
+	}
+
+	if s := tools.LSlice(f, "d", "", "b", ""); len(s.T) != 0 {
+		t.Errorf("Backwards slice not empty: %v", zipIDs(s))
+	}
+	if h := tools.LHead(f, "x", ""); len(h.T) != 0 {
+		t.Errorf("Head of missing ID not empty: %v", zipIDs(h))
+	}
+}
@@ -23,23 +23,48 @@ misrepresented as being the original software.
 package main
 
 import (
+	"fmt"
+	"os"
+
+	"github.com/samuellwn/ledger"
 	"github.com/samuellwn/ledger/tools"
 )
 
 var usage string = `Usage:
 
 Replace accounts in postings using rules from a matcher file.
+
+With -i, any transactions still posting to the account after the rules are
+applied are shown one at a time so you can pick an account for them by hand.
+Suggestions come from the rules and from recently used accounts, and account
+names can be abbreviated (exp:gro for Expenses:Groceries). New rules can be
+saved to the match file as you go.
 `
 
 func main() {
-	fs := tools.CommonFlagSet(tools.FlagMasterFile|tools.FlagMatchFile|tools.FlagAccountName, usage)
+	fs := tools.CommonFlagSet(tools.FlagMasterFile|tools.FlagMatchFile|tools.FlagAccountName|tools.FlagIDGenerator, usage)
+	interactive := fs.Flags.Bool("i", false, "Interactively pick accounts for anything the rules don't match.")
 	fs.Parse()
 
 	f := tools.LoadLedgerFile(fs.MasterFile)
 
-	matchers := tools.LoadMatchFile(fs.MatchFile)
+	matchers := []ledger.Matcher{}
+	if fs.MatchFile != nil {
+		matchers = tools.LoadMatchFile(fs.MatchFile)
+	} else {
+		tools.HandleErrS(!*interactive, "A match file is required unless -i is given.")
+	}
 
 	f.T = append(f.T, f.Matched(fs.AccountName, matchers)...)
 
+	if *interactive {
+		ruleFile := ""
+		if fs.MatchFile != nil && fs.MatchFile != os.Stdin {
+			ruleFile = fs.MatchFile.Name()
+		}
+		n := tools.NewCategorizer(f, fs.AccountName, matchers, ruleFile).Run()
+		fmt.Printf("%v transactions changed.\n", n)
+	}
+
 	tools.WriteLedgerFile(fs.MasterFile, f)
 }
@@ -0,0 +1,135 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package tools_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+	"golang.org/x/exp/slices"
+)
+
+func amount(t *testing.T, s string) int64 {
+	t.Helper()
+
+	v, err := ledger.ParseValueNumber(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func date(y, m, d int) time.Time {
+	return time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestReadMatchFile(t *testing.T) {
+	cases := []struct {
+		line      string
+		sign      int
+		min, max  string // Empty if not set.
+		begin     time.Time
+		end       time.Time
+		splits    []ledger.MatchSplit
+		wantSplit bool
+	}{
+		{line: "VENDOR,Expenses:Subscriptions,"},
+		{line: "VENDOR,Expenses:Subscriptions,,9.99", min: "9.99", max: "9.99"},
+		{line: "VENDOR,Expenses:Hardware,,200..", min: "200"},
+		{line: `VENDOR,Expenses:Hardware,,"..$1,000.00"`, max: "1000"},
+		{line: "VENDOR,Expenses:Hardware,, 10 .. 20 ", min: "10", max: "20"},
+		{line: "VENDOR,Expenses:Hardware,,+", sign: 1},
+		{line: "PAYROLL,Income:Salary,Payroll,-..", sign: -1},
+		{line: "PAYROLL,Income:Salary,Payroll,-5..10", sign: -1, min: "5", max: "10"},
+		{line: "PAYROLL,Income:Salary,Payroll,,2026/01/01..2026-12-31", begin: date(2026, 1, 1), end: date(2027, 1, 1)},
+		{line: "PAYROLL,Income:Salary,Payroll,,2026/03/01..", begin: date(2026, 3, 1)},
+		{line: "PAYROLL,Income:Salary,Payroll,,..2026/03/01", end: date(2026, 3, 2)},
+		{line: "PAYROLL,Income:Salary,Payroll,,2026/03/01", begin: date(2026, 3, 1), end: date(2026, 3, 2)},
+		{
+			line:      "PAYROLL,Income:Salary,Payroll,,,Expenses:Taxes=400.00; Assets:401k = 150.00 ;",
+			splits:    []ledger.MatchSplit{{Account: "Expenses:Taxes", Value: 4000000}, {Account: "Assets:401k", Value: 1500000}},
+			wantSplit: true,
+		},
+		{
+			line:      "COSTCO,Expenses:Household,,,,Expenses:Groceries=60%;Expenses:Pharmacy=12.5%",
+			splits:    []ledger.MatchSplit{{Account: "Expenses:Groceries", Percent: 60}, {Account: "Expenses:Pharmacy", Percent: 12.5}},
+			wantSplit: true,
+		},
+	}
+	for _, c := range cases {
+		matchers, err := tools.ReadMatchFile(strings.NewReader("# A comment.\n" + c.line + "\n"))
+		if err != nil {
+			t.Errorf("%v: %v", c.line, err)
+			continue
+		}
+		if len(matchers) != 1 {
+			t.Errorf("%v: expected one matcher, got %v", c.line, len(matchers))
+			continue
+		}
+		m := matchers[0]
+
+		if m.Sign != c.sign {
+			t.Errorf("%v: expected sign %v, got %v", c.line, c.sign, m.Sign)
+		}
+		if m.HasMinAmount != (c.min != "") || c.min != "" && m.MinAmount != amount(t, c.min) {
+			t.Errorf("%v: expected min %q, got %v %v", c.line, c.min, m.HasMinAmount, m.MinAmount)
+		}
+		if m.HasMaxAmount != (c.max != "") || c.max != "" && m.MaxAmount != amount(t, c.max) {
+			t.Errorf("%v: expected max %q, got %v %v", c.line, c.max, m.HasMaxAmount, m.MaxAmount)
+		}
+		if !m.Begin.Equal(c.begin) || !m.End.Equal(c.end) {
+			t.Errorf("%v: expected dates %v to %v, got %v to %v", c.line, c.begin, c.end, m.Begin, m.End)
+		}
+		if c.wantSplit && !slices.Equal(m.Splits, c.splits) || !c.wantSplit && len(m.Splits) != 0 {
+			t.Errorf("%v: expected splits %v, got %v", c.line, c.splits, m.Splits)
+		}
+	}
+}
+
+func TestReadMatchFileErrors(t *testing.T) {
+	cases := []string{
+		"VENDOR,Expenses:Hardware",
+		"VENDOR,Expenses:Hardware,,,,,",
+		"VEN(DOR,Expenses:Hardware,",
+		"VENDOR,Expenses:Hardware,,ten",
+		"VENDOR,Expenses:Hardware,,10..twenty",
+		"VENDOR,Expenses:Hardware,,--10",
+		"VENDOR,Expenses:Hardware,,(5)..",
+		"VENDOR,Expenses:Hardware,,,2026/13/01",
+		"VENDOR,Expenses:Hardware,,,2026/01/01..soon",
+		"VENDOR,Expenses:Hardware,,,,Expenses:Taxes",
+		"VENDOR,Expenses:Hardware,,,,Expenses:Taxes=lots",
+		"VENDOR,Expenses:Hardware,,,,Expenses:Taxes=half%",
+	}
+	for _, c := range cases {
+		_, err := tools.ReadMatchFile(strings.NewReader("VENDOR,Expenses:Hardware,\n" + c + "\n"))
+		if err == nil {
+			t.Errorf("%v: expected an error", c)
+		} else if !strings.HasPrefix(err.Error(), "Match file line 2: ") {
+			t.Errorf("%v: expected the error to give the line, got %q", c, err)
+		}
+	}
+}
@@ -24,29 +24,39 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"sort"
 
 	"github.com/samuellwn/ledger"
 	"github.com/samuellwn/ledger/tools"
+	"golang.org/x/exp/maps"
 )
 
 func main() {
-	fs := tools.CommonFlagSet(tools.FlagMasterFile|tools.FlagSourceFile|tools.FlagAccountName|tools.FlagMatchFile, usage)
-	var descSrc ledger.OFXDescSrc
+	fs := tools.CommonFlagSet(tools.FlagMasterFile|tools.FlagSourceFile|tools.FlagAccountName|tools.FlagMatchFile|tools.FlagIDGenerator|tools.FlagOFXAccounts, usage)
+	opts := ledger.OFXImportOptions{}
 	fs.Flags.Func("desc", "Where to get the `description` from. \"name\", \"memo\", or \"name+memo\". (default \"name\")", func(s string) error {
 		switch s {
 		case "name":
-			descSrc = ledger.OFXDescName
+			opts.DescSrc = ledger.OFXDescName
 		case "memo":
-			descSrc = ledger.OFXDescMemo
+			opts.DescSrc = ledger.OFXDescMemo
 		case "name+memo":
-			descSrc = ledger.OFXDescNameMemo
+			opts.DescSrc = ledger.OFXDescNameMemo
 		default:
 			return fmt.Errorf("Unknown description source: %q", s)
 		}
 		return nil
 	})
+	fs.Flags.BoolVar(&opts.DryRun, "n", false, "Dry run. Print a summary and the transactions that would be added instead of changing the master file.")
+	fs.Flags.BoolVar(&opts.Fuzzy, "fuzzy", false, "Flag new transactions with the same amount as an existing one with a different FITID, a similar description, and a nearby date.")
+	fs.Flags.IntVar(&opts.Days, "days", 3, "For -fuzzy, how many `days` apart the transactions may be.")
+	fs.Flags.Float64Var(&opts.Similarity, "similarity", 0.5, "For -fuzzy, how alike the descriptions must be, from 0 to 1.")
+	fs.Flags.BoolVar(&opts.SkipFuzzy, "skip", false, "For -fuzzy, skip suspect duplicates instead of flagging them.")
 	fs.Parse()
 
+	accounts := ledger.OFXAccounts{Accounts: fs.OFXAccounts, Default: fs.AccountName}
+
 	matchers := []ledger.Matcher{}
 	if fs.MatchFile != nil {
 		matchers = tools.LoadMatchFile(fs.MatchFile)
@@ -54,12 +64,40 @@ func main() {
 
 	journal := tools.LoadLedgerFile(fs.MasterFile)
 
-	tools.MergeOFX(journal, fs.SourceFile, fs.AccountName, descSrc, matchers)
+	result := tools.MergeOFX(journal, fs.SourceFile, accounts, opts, matchers)
+	if !opts.DryRun {
+		tools.WriteLedgerFile(fs.MasterFile, journal)
+		return
+	}
 
-	tools.WriteLedgerFile(fs.MasterFile, journal)
+	fmt.Fprintf(os.Stderr, "%v new, %v already imported, %v suspect duplicates, from %v to %v.\n", result.New,
+		result.Seen, result.Suspect, result.Begin.Format("2006/01/02"), result.End.Format("2006/01/02"))
+	accts := maps.Keys(result.Delta)
+	sort.Strings(accts)
+	for _, acct := range accts {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", acct, ledger.FormatValue(result.Delta[acct]))
+	}
+	tools.WriteLedgerFile(os.Stdout, &ledger.File{T: result.Transactions})
 }
 
 var usage = `Usage:
 
 This program takes an OFX file and adds any unseen transactions to a ledger file.
+
+Files with more than one account (checking, savings, and a card in one
+download) are supported: use -map to book each OFX account to its own ledger
+account. Accounts without a mapping go to -account, or are an error if
+-account is empty.
+
+With -n nothing is changed. A summary of the import (how many transactions are
+new, how many were already imported, the dates covered, and the change to each
+account's balance) is printed to standard error, and the new transactions are
+printed to standard output.
+
+Some banks change the FITID of a transaction, for example when a pending
+transaction posts, so it gets imported again. With -fuzzy new transactions that
+move the same amount in the same account as an existing transaction with a
+different FITID, within a few days and with a similar description, are marked
+with a "Duplicate" KV pair naming the existing transaction (or with -skip, left
+out). Use dedupe to clean up the ones that really are duplicates.
 `
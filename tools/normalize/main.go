@@ -0,0 +1,79 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagMasterFile|tools.FlagMatchFile|tools.FlagIDGenerator, usage)
+	dryRun := fs.Flags.Bool("n", false, "Only list the changes, don't change the file.")
+	fs.Parse()
+
+	tools.HandleErrS(fs.MasterFile == nil, "A master file is required.")
+
+	f := tools.LoadLedgerFile(fs.MasterFile)
+
+	matchers := []ledger.Matcher{}
+	if fs.MatchFile != nil {
+		matchers = tools.LoadMatchFile(fs.MatchFile)
+	}
+
+	var changes []ledger.PayeeChange
+	if *dryRun {
+		changes = tools.HandleErrV(f.PayeeChanges(matchers))
+	} else {
+		changes = tools.HandleErrV(f.NormalizePayees(matchers))
+	}
+	for _, c := range changes {
+		fmt.Fprintf(os.Stderr, "%v: %q -> %q\n", f.T[c.T].Date.Format("2006/01/02"), c.From, c.To)
+	}
+
+	if !*dryRun && len(changes) > 0 {
+		tools.WriteLedgerFile(fs.MasterFile, f)
+	}
+}
+
+var usage = `Usage:
+
+This program replaces the descriptions of transactions in a ledger file with
+normalized payee names, so that "AMZN Mktp US*1234" and "Amazon.com" both
+become "Amazon". The names come from payee directives:
+
+	payee Amazon
+		alias ^AMZN
+		alias (?i)amazon\.com
+		uuid 2a2e21d434356f886c84371eebac6e44f1337fda
+
+A transaction with a UUID k/v pair matching a uuid line gets that payee,
+otherwise the alias regexps are tried against the description. Any rules in
+the -match file that set a payee are tried after the directives.
+
+Transactions with an ID get a new revision, so the change syncs like any
+other edit. Use -n to list the changes without making them.
+`
@@ -0,0 +1,123 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/samuellwn/ledger"
+)
+
+// A rule file is a TOML file with a list of rules. Everything but match is optional:
+//
+//	[[rule]]
+//	match = "(?i)netflix"            # Regexp matched against the description.
+//	account = "Expenses:Streaming"   # Replaces the matched account.
+//	payee = "Netflix"                # Replaces the description.
+//	amount = "..20"                  # An amount range, the same as in match files.
+//	date = "2026/01/01.."            # A date range, the same as in match files.
+//	tags = ["Subscription"]
+//	kv = { Category = "Fun" }
+//	priority = 10                    # Higher priority rules are tried first, rules with the same priority keep
+//	                                 # their order in the file.
+//	continue = true                  # Keep trying rules after this one matches.
+//
+//	[[rule]]
+//	match = "PAYROLL"
+//	account = "Income:Salary"
+//	splits = [
+//		{ account = "Expenses:Taxes", amount = "400.00" },
+//		{ account = "Assets:401k", percent = -10 },
+//	]
+
+type ruleFile struct {
+	Rules []rule `toml:"rule"`
+}
+
+type rule struct {
+	Match    string            `toml:"match"`
+	Account  string            `toml:"account"`
+	Payee    string            `toml:"payee"`
+	Amount   string            `toml:"amount"`
+	Date     string            `toml:"date"`
+	Splits   []ruleSplit       `toml:"splits"`
+	Tags     []string          `toml:"tags"`
+	KV       map[string]string `toml:"kv"`
+	Priority int               `toml:"priority"`
+	Continue bool              `toml:"continue"`
+}
+
+type ruleSplit struct {
+	Account string  `toml:"account"`
+	Amount  string  `toml:"amount"`
+	Percent float64 `toml:"percent"`
+}
+
+// LoadMatchRules loads a TOML rule file and parses it into a list of Matchers, sorted by priority. Rules can do
+// everything the lines of a match file can, plus add tags and KV pairs and continue on to later rules. On any error
+// the message is logged to standard error and the program exits with code 1.
+func LoadMatchRules(mr *os.File) []ledger.Matcher {
+	rf := ruleFile{}
+	md, err := toml.NewDecoder(mr).Decode(&rf)
+	HandleErr(err)
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		HandleErr(fmt.Errorf("Unknown key in rule file: %v", undecoded[0]))
+	}
+
+	sort.SliceStable(rf.Rules, func(i, j int) bool {
+		return rf.Rules[i].Priority > rf.Rules[j].Priority
+	})
+
+	matchers := make([]ledger.Matcher, 0, len(rf.Rules))
+	for i, r := range rf.Rules {
+		HandleErrS(r.Match == "", fmt.Sprintf("Rule %v has no match regexp.", i+1))
+
+		m := ledger.Matcher{
+			R:        HandleErrV(regexp.Compile(r.Match)),
+			Account:  r.Account,
+			Payee:    r.Payee,
+			Tags:     r.Tags,
+			KVPairs:  r.KV,
+			Continue: r.Continue,
+		}
+		if r.Amount != "" {
+			HandleErr(parseAmountRange(&m, r.Amount))
+		}
+		if r.Date != "" {
+			HandleErr(parseDateRange(&m, r.Date))
+		}
+		for _, s := range r.Splits {
+			split := ledger.MatchSplit{Account: s.Account, Percent: s.Percent}
+			if s.Amount != "" {
+				split.Value = HandleErrV(ledger.ParseCSVAmount(s.Amount))
+			}
+			m.Splits = append(m.Splits, split)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// security holds the TLS and authentication settings shared by the client and server.
+type security struct {
+	Cert  string // Certificate and key files. The server's own certificate, or the client's for mutual TLS.
+	Key   string
+	CA    string // CA certificate file. Clients trust servers signed by it, servers require clients signed by it.
+	Token string // Shared secret sent by the client as a bearer token.
+	PSK   []byte // Pre-shared key used to encrypt the ledger data itself (optional).
+}
+
+// tlsConfig builds the TLS configuration for the server or client, or returns nil if TLS isn't used at all.
+func (s *security) tlsConfig(server bool) (*tls.Config, error) {
+	if s.Cert == "" && s.CA == "" {
+		if server && s.Key != "" {
+			return nil, errors.New("A key was given without a certificate.")
+		}
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(s.Cert, s.Key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	} else if server {
+		return nil, errors.New("The server needs a certificate to use TLS.")
+	}
+
+	if s.CA != "" {
+		pem, err := os.ReadFile(s.CA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %v.", s.CA)
+		}
+		if server {
+			cfg.ClientCAs = pool
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			cfg.RootCAs = pool
+		}
+	}
+	return cfg, nil
+}
+
+// authorize wraps a handler so that requests without the right token are turned away. If no token is set every
+// request is let through (TLS client certificates, if used, are checked before the handler is ever reached).
+func (s *security) authorize(h http.HandlerFunc) http.HandlerFunc {
+	if s.Token == "" {
+		return h
+	}
+	want := []byte("Bearer " + s.Token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			fmt.Fprintln(os.Stderr, "Rejected sync from", r.RemoteAddr, "with a bad or missing token.")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// client returns an HTTP client using the TLS settings.
+func (s *security) client() (*http.Client, error) {
+	cfg, err := s.tlsConfig(false)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return http.DefaultClient, nil
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}, nil
+}
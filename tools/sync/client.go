@@ -0,0 +1,102 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+	"github.com/samuellwn/ledger/tools"
+)
+
+// syncClient holds everything needed to sync with a server.
+type syncClient struct {
+	dial func() (transport, error)
+	sec  *security
+	name string
+
+	onConflict string // One of the tools.OnConflict strategies.
+}
+
+// sync sends everything in mf from the given transaction on (or from where the last sync left off, if id is empty)
+// to the server, and returns mf merged with what the server sent back.
+func (sc *syncClient) sync(mf *ledger.File, id, rid string) (*ledger.File, error) {
+	t, err := sc.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer t.close()
+
+	// Unless we were told where to start, ask the server where our last sync left off.
+	if id == "" {
+		cur, err := t.cursor(sc.name)
+		if err != nil {
+			return nil, err
+		}
+		id, rid = cur.ID, cur.RID
+	}
+
+	// Tail the file. If we never synced (or the server's cursor isn't in our file) send everything.
+	tf := mf
+	if id != "" {
+		tf = tools.LTail(mf, id, rid)
+	}
+	if len(tf.T) == 0 {
+		tf = mf
+	}
+
+	body := new(bytes.Buffer)
+	err = tf.Format(body)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := sc.sec.sealPayload(body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	// Send the tailed file through and receive the result.
+	payload, err = t.send(sc.name, payload)
+	if err != nil {
+		return nil, err
+	}
+	payload, err = sc.sec.openPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	sf, err := parse.Read(bytes.NewReader(payload), "", parse.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Zipper our data with their data.
+	rf, report, err := tools.ZipResolve(sc.onConflict, mf, sf)
+	if err == nil && report != nil {
+		fmt.Fprintf(os.Stderr, "Resolved conflicts (%v):\n%v\n", sc.onConflict, report)
+	}
+	return rf, err
+}
@@ -23,110 +23,106 @@ misrepresented as being the original software.
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"time"
 
-	"github.com/samuellwn/ledger"
-	"github.com/samuellwn/ledger/parse"
 	"github.com/samuellwn/ledger/tools"
 )
 
 func main() {
-	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile|tools.FlagID|tools.FlagRID, usage)
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagMasterFile|tools.FlagID|tools.FlagRID, usage)
 	server := false
 	fs.Flags.BoolVar(&server, "server", server, "Act as a server and listen for incoming connections.")
+	serveStdio := false
+	fs.Flags.BoolVar(&serveStdio, "serve-stdio", serveStdio, "Act as a server for a single client talking over stdin and stdout. Used by ssh:// addresses.")
 	addr := "http://localhost:2443"
-	fs.Flags.StringVar(&addr, "addr", addr, "Address to connect or listen to.")
+	fs.Flags.StringVar(&addr, "addr", addr, "Address to connect or listen to. An ssh://[user@]host[:port]/path address syncs with the file at path on that host over ssh.")
+	ssh := "ssh"
+	fs.Flags.StringVar(&ssh, "ssh", ssh, "The `command` used to connect to ssh:// addresses.")
+	remote := "sync"
+	fs.Flags.StringVar(&remote, "remote-cmd", remote, "The `command` run on the remote host for ssh:// addresses, with any extra flags for it.")
+	store := "."
+	fs.Flags.StringVar(&store, "store", store, "The `directory` received syncs are written to in server mode.")
+	sec := &security{}
+	fs.Flags.StringVar(&sec.Cert, "cert", "", "TLS certificate `file`. The server's certificate, or the client's for mutual TLS.")
+	fs.Flags.StringVar(&sec.Key, "key", "", "TLS private key `file` for -cert.")
+	fs.Flags.StringVar(&sec.CA, "ca", "", "CA certificate `file`. Clients trust servers signed by it, servers require client certificates signed by it.")
+	fs.Flags.StringVar(&sec.Token, "token", os.Getenv("LEDGER_SYNC_TOKEN"), "Shared secret `token` the client must send. Defaults to $LEDGER_SYNC_TOKEN.")
+	fs.Flags.Func("psk", "Pre-shared key `file` used to encrypt the ledger data sent between client and server.", func(s string) (err error) {
+		sec.PSK, err = loadPSK(s)
+		return
+	})
+	name, _ := os.Hostname()
+	fs.Flags.StringVar(&name, "client", name, "The `name` the server knows this client by, used to keep track of what it last synced.")
+	watch := fs.Flags.Bool("watch", false, "Keep running, syncing whenever the master file changes and every -interval.")
+	interval := fs.Flags.Duration("interval", time.Minute, "How often to check the server for changes with -watch.")
+	onConflict := fs.Flags.String("on-conflict", tools.OnConflictFail, "What to do when the files can't be merged cleanly: \"fail\", \"ours\", \"theirs\", or \"duplicate-flag\".")
 	fs.Parse()
 
+	switch *onConflict {
+	case tools.OnConflictFail, tools.OnConflictOurs, tools.OnConflictTheirs, tools.OnConflictDuplicate:
+	default:
+		tools.HandleErrS(true, fmt.Sprintf("Unknown conflict strategy: %q", *onConflict))
+	}
+
 	// Read master file and setup internal state.
 	mf := tools.LoadLedgerFile(fs.MasterFile)
 
-	if !server {
-		// Tail the file
-		tf := tools.LTail(mf, fs.ID, fs.RID)
-
-		body := new(bytes.Buffer)
-		tools.HandleErr(tf.Format(body))
-
-		// Open connection to the server and send the tailed file through.
-		r := tools.HandleErrV(http.Post(addr, "text/x-ledger-cli", body))
-		tools.HandleErrS(r.StatusCode != http.StatusOK, "Response from server not OK: "+r.Status)
-
-		// Receive result
-		sf, err := parse.ParseLedger(parse.NewRawCharReader(bufio.NewReader(r.Body), 1))
-		r.Body.Close()
-		tools.HandleErr(err)
-
-		// Zipper our data with their data.
-		rf := tools.Zipper(tf, sf)
-
-		// Write the result out.
-		tools.WriteLedgerFile(fs.DestFile, rf)
+	if serveStdio {
+		srv := tools.HandleErrV(newServer(mf, fs.MasterFile, store, sec, *onConflict))
+		tools.HandleErr(srv.serveStdio(os.Stdin, os.Stdout))
 		return
 	}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// Read incoming transactions
-		cf, err := parse.ParseLedger(parse.NewRawCharReader(bufio.NewReader(r.Body), 1))
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-
-		// Find the ID/RID of the first transaction
-		tf := &ledger.File{}
-		if len(cf.T) > 0 {
-			cid, ok := cf.T[0].KVPairs["ID"]
-			if !ok {
-				fmt.Fprintln(os.Stderr, "Missing ID on first transaction of sent data.")
-				w.WriteHeader(http.StatusBadRequest)
-				return
+	if !server {
+		sc := &syncClient{sec: sec, name: name, onConflict: *onConflict}
+		if u, err := url.Parse(addr); err == nil && u.Scheme == "ssh" {
+			sc.dial = func() (transport, error) {
+				return dialSSH(ssh, remote, u, name)
 			}
-
-			crid, ok := cf.T[0].KVPairs["RID"]
-			if !ok {
-				fmt.Fprintln(os.Stderr, "Missing RID on first transaction of sent data.")
-				w.WriteHeader(http.StatusBadRequest)
-				return
+		} else {
+			t := &httpTransport{c: tools.HandleErrV(sec.client()), sec: sec, addr: addr}
+			sc.dial = func() (transport, error) {
+				return t, nil
 			}
-
-			// Tail our file with this information
-			tf = tools.LTail(mf, cid, crid)
 		}
 
-		// Zipper their data with our data (do it now so we can send back an error if needed).
-		xf, err := tools.ZipperHTTP(mf, cf)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			w.WriteHeader(http.StatusBadRequest)
+		if *watch {
+			tools.HandleErr(sc.watch(fs.MasterFile.Name(), *interval))
 			return
 		}
 
-		// Store our new file
-		f, err := os.Create(fs.DestFile + "/" + time.Now().UTC().Format("m01-d02-t150405.00") + ".ledger")
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		id, rid := fs.ID, fs.RID
+		if id == "NIL" {
+			id, rid = "", ""
 		}
-		defer f.Close()
-		xf.Format(f)
+		rf := tools.HandleErrV(sc.sync(mf, id, rid))
 
-		// Send back the tailed data from earlier (or an error)
-		err = tf.Format(w)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
-	})
+		// Write the result out.
+		tools.WriteLedgerFile(fs.DestFile, rf)
+		return
+	}
 
-	tools.HandleErr(http.ListenAndServe(addr, nil))
+	srv := tools.HandleErrV(newServer(mf, fs.MasterFile, store, sec, *onConflict))
+	http.HandleFunc("/", sec.authorize(srv.handleSync))
+	http.HandleFunc("/cursor", sec.authorize(srv.handleCursor))
+
+	// The address may be given as a URL, same as for the client.
+	if u, err := url.Parse(addr); err == nil && u.Host != "" {
+		addr = u.Host
+	}
+	cfg := tools.HandleErrV(sec.tlsConfig(true))
+	if cfg == nil && sec.Token == "" {
+		fmt.Fprintln(os.Stderr, "Warning: Running without TLS or a token, anyone who can connect can read and change the file.")
+	}
+	hs := &http.Server{Addr: addr, TLSConfig: cfg}
+	if cfg != nil {
+		tools.HandleErr(hs.ListenAndServeTLS("", ""))
+	}
+	tools.HandleErr(hs.ListenAndServe())
 }
 
 var usage = `Usage:
@@ -137,13 +133,54 @@ listening.
 
 For this to work properly, each transaction needs an "ID" K/V to be set to a
 unique transaction ID, otherwise it is not possible to sync partial files
-and syncing full files is not deterministic. Any non-deterministic result is
-an error.
+and syncing full files is not deterministic. By default any non-deterministic
+result is an error. With -on-conflict set to "ours" or "theirs" the local or
+remote version of each conflicted transaction wins instead, and with
+"duplicate-flag" both versions of a changed transaction are kept. Either way
+conflicted transactions get a new revision with a "Conflict" K/V pair so they
+can be found and reviewed later. On the server "ours" is the server's copy.
 
 The "master" file is used to set the initial state of the program.
 
-"dest" should be a directory used to write the result of each received sync
-when in "server" mode, or the path to the output file for the normal send mode.
+"dest" is the path to the output file for the normal send mode. In "server"
+mode the master file is updated with the result of each received sync, and a
+copy is also written to a new file in the "store" directory.
+
+The server keeps track of the last transaction each client synced (by the
+-client name, the host name by default) in "clients.json" in the store
+directory, so clients only need to send and receive what changed since their
+last sync. The -id and -rid flags can be used to start from somewhere else.
 
 For "server" mode the address is the ip:port to listen on.
+
+With -watch the client keeps running and syncs the master file in place: once
+at startup, whenever the file changes, and every -interval to pick up changes
+from other clients. Errors are logged and the next sync is tried as usual.
+
+By default everything is sent as plain HTTP with no authentication. To secure
+a sync, give the server a certificate with -cert and -key and use an https://
+address on the client (with -ca if the server's certificate isn't signed by a
+CA the system trusts). Clients can then be authenticated with a shared -token
+(or the LEDGER_SYNC_TOKEN environment variable, which keeps it off the command
+line), or with mutual TLS by giving the server a -ca to check client
+certificates against and each client its own -cert and -key.
+
+Instead of running a server, a client can also sync with a file on another
+host over ssh, the same way git does, by using an address like
+"ssh://user@host/path/to/master.ledger" (a path starting with /~ is relative
+to the home directory). This runs "sync -serve-stdio" on that host, which
+merges the client's changes into the file there and sends back the result,
+just like a server would. Use -remote-cmd if the program has another name or
+isn't in the remote path, and to give it flags such as -store or -on-conflict
+(the remote side defaults to the directory ssh starts in). Each connection
+runs its own copy of the program, so two clients syncing with the same file at
+exactly the same time can step on each other.
+
+The ledger data itself can also be encrypted end to end with -psk, which takes
+a file holding a pre-shared key or passphrase that the server and all clients
+share. Everything the client sends and receives is then encrypted and
+authenticated with that key (NaCl secretbox, with the key derived using
+scrypt), so a proxy that terminates TLS, or anything else in between, never
+sees the transactions. A server with a key rejects unencrypted syncs. Only the
+cursor lookup, which holds nothing but a transaction ID, stays unencrypted.
 `
@@ -0,0 +1,137 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// sealMagic starts every encrypted payload, so a peer without the key gets a clear error instead of a parse error.
+const sealMagic = "LSB1"
+
+// sealedType is the content type used for encrypted payloads.
+const sealedType = "application/x-ledger-sealed"
+
+const (
+	saltSize  = 16
+	nonceSize = 24
+)
+
+// loadPSK reads a pre-shared key from a file. Leading and trailing white space is ignored, so the file can be
+// written with any editor.
+func loadPSK(path string) ([]byte, error) {
+	psk, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	psk = bytes.TrimSpace(psk)
+	if len(psk) == 0 {
+		return nil, errors.New("The pre-shared key file is empty.")
+	}
+	return psk, nil
+}
+
+// sealKey derives the actual encryption key from the pre-shared key, so a passphrase can be used directly.
+func sealKey(psk, salt []byte) (*[32]byte, error) {
+	k, err := scrypt.Key(psk, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	key := new([32]byte)
+	copy(key[:], k)
+	return key, nil
+}
+
+// seal encrypts and authenticates a payload with the pre-shared key. Every payload gets a fresh salt and nonce.
+func seal(psk, plain []byte) ([]byte, error) {
+	out := make([]byte, len(sealMagic)+saltSize+nonceSize, len(sealMagic)+saltSize+nonceSize+len(plain)+secretbox.Overhead)
+	copy(out, sealMagic)
+	salt := out[len(sealMagic) : len(sealMagic)+saltSize]
+	nonce := new([nonceSize]byte)
+	_, err := io.ReadFull(rand.Reader, out[len(sealMagic):])
+	if err != nil {
+		return nil, err
+	}
+	copy(nonce[:], out[len(sealMagic)+saltSize:])
+
+	key, err := sealKey(psk, salt)
+	if err != nil {
+		return nil, err
+	}
+	return secretbox.Seal(out, plain, nonce, key), nil
+}
+
+// isSealed returns true if the payload looks like it came from seal.
+func isSealed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(sealMagic))
+}
+
+// open decrypts a payload made by seal, failing if it was made with a different key or was tampered with.
+func open(psk, data []byte) ([]byte, error) {
+	if !isSealed(data) {
+		return nil, errors.New("Payload is not encrypted, but a pre-shared key is set.")
+	}
+	data = data[len(sealMagic):]
+	if len(data) < saltSize+nonceSize+secretbox.Overhead {
+		return nil, errors.New("Encrypted payload is truncated.")
+	}
+	nonce := new([nonceSize]byte)
+	copy(nonce[:], data[saltSize:])
+
+	key, err := sealKey(psk, data[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	plain, ok := secretbox.Open(nil, data[saltSize+nonceSize:], nonce, key)
+	if !ok {
+		return nil, errors.New("Could not decrypt payload, the pre-shared keys probably don't match.")
+	}
+	return plain, nil
+}
+
+// sealPayload encrypts a payload if a pre-shared key is set, otherwise it is returned as is.
+func (s *security) sealPayload(plain []byte) ([]byte, error) {
+	if s.PSK == nil {
+		return plain, nil
+	}
+	return seal(s.PSK, plain)
+}
+
+// openPayload decrypts a payload if a pre-shared key is set. Plain text payloads are rejected when there is a key,
+// and encrypted ones when there isn't.
+func (s *security) openPayload(data []byte) ([]byte, error) {
+	if s.PSK == nil {
+		if isSealed(data) {
+			return nil, errors.New("Payload is encrypted, but no pre-shared key is set.")
+		}
+		return data, nil
+	}
+	return open(s.PSK, data)
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+	"github.com/samuellwn/ledger/tools"
+)
+
+// cursor is the last transaction a client and the server both had after a sync.
+type cursor struct {
+	ID     string    `json:"id"`
+	RID    string    `json:"rid"`
+	Synced time.Time `json:"synced"`
+}
+
+// server holds the state of a sync server. Only one sync is handled at a time.
+type server struct {
+	lock    sync.Mutex
+	mf      *ledger.File
+	master  *os.File
+	store   string
+	clients map[string]cursor // Client name to the last transaction it synced.
+	sec     *security
+
+	onConflict string // One of the tools.OnConflict strategies.
+}
+
+func newServer(mf *ledger.File, master *os.File, store string, sec *security, onConflict string) (*server, error) {
+	s := &server{mf: mf, master: master, store: store, clients: map[string]cursor{}, sec: sec, onConflict: onConflict}
+	data, err := os.ReadFile(s.statePath())
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, json.Unmarshal(data, &s.clients)
+}
+
+func (s *server) statePath() string {
+	return filepath.Join(s.store, "clients.json")
+}
+
+func (s *server) saveState() error {
+	data, err := json.MarshalIndent(s.clients, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.statePath(), data, 0666)
+}
+
+// cursorFor returns the last transaction a client synced. Clients that never synced get an empty cursor.
+func (s *server) cursorFor(client string) cursor {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.clients[client]
+}
+
+// handleCursor sends a client the last transaction it synced, as json.
+func (s *server) handleCursor(w http.ResponseWriter, r *http.Request) {
+	c := s.cursorFor(r.URL.Query().Get("client"))
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// syncError is an error from merge along with the HTTP status it should be reported with.
+type syncError struct {
+	status int
+	err    error
+}
+
+func (e *syncError) Error() string {
+	return e.err.Error()
+}
+
+// handleSync merges the transactions a client sent into the master file, and sends back everything the server
+// has from the first of those transactions on.
+func (s *server) handleSync(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	payload, err = s.merge(r.Header.Get("X-Ledger-Client"), payload)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		serr := err.(*syncError)
+		w.WriteHeader(serr.status)
+		if serr.status == http.StatusConflict {
+			fmt.Fprintln(w, err)
+		}
+		return
+	}
+
+	if s.sec.PSK != nil {
+		w.Header().Set("Content-Type", sealedType)
+	}
+	_, err = w.Write(payload)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// merge merges the (possibly encrypted) ledger file a client sent into the master file, and returns everything the
+// server has from the first of those transactions on. Any error returned is a *syncError.
+func (s *server) merge(client string, payload []byte) ([]byte, error) {
+	// Read incoming transactions
+	payload, err := s.sec.openPayload(payload)
+	if err != nil {
+		return nil, &syncError{http.StatusBadRequest, err}
+	}
+	cf, err := parse.Read(bytes.NewReader(payload), "", parse.Options{})
+	if err != nil {
+		return nil, &syncError{http.StatusBadRequest, err}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Find the ID/RID of the first transaction. If the client sent nothing it only wants our changes since its
+	// last sync.
+	var tf *ledger.File
+	cid, crid := s.clients[client].ID, s.clients[client].RID
+	if len(cf.T) > 0 {
+		var ok bool
+		cid, ok = cf.T[0].KVPairs["ID"]
+		if !ok {
+			return nil, &syncError{http.StatusBadRequest, errors.New("Missing ID on first transaction of sent data.")}
+		}
+
+		crid, ok = cf.T[0].KVPairs["RID"]
+		if !ok {
+			return nil, &syncError{http.StatusBadRequest, errors.New("Missing RID on first transaction of sent data.")}
+		}
+	}
+	// Tail our file with this information. If we don't have that transaction, the client gets everything.
+	if cid != "" {
+		tf = tools.LTail(s.mf, cid, crid)
+	}
+	if tf == nil || len(tf.T) == 0 {
+		tf = s.mf
+	}
+
+	// Zipper their data with our data (do it now so we can send back an error if needed).
+	xf, report, err := tools.ZipResolve(s.onConflict, s.mf, cf)
+	if err == nil && report != nil {
+		fmt.Fprintf(os.Stderr, "Resolved conflicts with %v (%v):\n%v\n", client, s.onConflict, report)
+	}
+	if err != nil {
+		return nil, &syncError{http.StatusConflict, err}
+	}
+
+	// Store our new file, both as the master and as a snapshot. Both are encrypted the same way as the master.
+	buf := &bytes.Buffer{}
+	err = xf.Format(buf)
+	var data []byte
+	if err == nil {
+		data, err = tools.EncryptionFor(s.master.Name()).Encrypt(buf.Bytes())
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(s.store, time.Now().UTC().Format("m01-d02-t150405.00")+".ledger"), data, 0666)
+	}
+	if err == nil {
+		// The master is replaced atomically (keeping a backup), so a crash can't leave it empty or cut short.
+		err = tools.WriteLedgerFileHTTP(s.master, xf)
+	}
+	if err != nil {
+		return nil, &syncError{http.StatusInternalServerError, err}
+	}
+	s.mf = xf
+
+	// Once the client merges what we send back it will have everything we have, so next time it can start from
+	// our last transaction.
+	if client != "" && len(xf.T) > 0 {
+		last := xf.T[len(xf.T)-1]
+		s.clients[client] = cursor{last.KVPairs["ID"], last.KVPairs["RID"], time.Now().UTC()}
+		err = s.saveState()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	// Send back the tailed data from earlier.
+	body := new(bytes.Buffer)
+	err = tf.Format(body)
+	if err == nil {
+		payload, err = s.sec.sealPayload(body.Bytes())
+	}
+	if err != nil {
+		return nil, &syncError{http.StatusInternalServerError, err}
+	}
+	return payload, nil
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// The stdio protocol is a series of frames, each a line with a kind and a length followed by that many bytes of
+// data. The client sends a "client" frame with its name, then any number of "cursor" (no data) and "sync" (a
+// ledger file) frames. The server answers each one with an "ok" frame holding the result or an "error" frame
+// holding the message.
+
+// writeFrame writes a single frame.
+func writeFrame(w io.Writer, kind string, data []byte) error {
+	_, err := fmt.Fprintf(w, "%v %v\n", kind, len(data))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readFrame reads a single frame. io.EOF is returned as is if there are no more frames.
+func readFrame(r *bufio.Reader) (string, []byte, error) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", nil, io.EOF
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	kind, size := "", 0
+	_, err = fmt.Sscanf(line, "%s %d\n", &kind, &size)
+	if err != nil || size < 0 {
+		return "", nil, fmt.Errorf("Malformed frame header: %q", line)
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return "", nil, err
+	}
+	return kind, data, nil
+}
+
+// stdioTransport talks to a server running as a child process (usually over ssh), using its stdin and stdout.
+type stdioTransport struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+// dialSSH starts a server on the host in an ssh:// URL. The URL's path is the master file on the remote host. The
+// ssh command and the remote command (the sync program, with any other flags it should get) may include arguments.
+func dialSSH(ssh, remote string, u *url.URL, name string) (transport, error) {
+	args := strings.Fields(ssh)
+	if len(args) == 0 {
+		return nil, errors.New("No ssh command given.")
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	host := u.Hostname()
+	if u.User != nil {
+		host = u.User.Username() + "@" + host
+	}
+
+	// Same as git, a path starting with /~ is relative to the home directory.
+	path := strings.TrimPrefix(u.Path, "/")
+	if !strings.HasPrefix(path, "~") {
+		path = "/" + path
+	}
+	args = append(args, host, remote+" -serve-stdio -master "+shellQuote(path))
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &stdioTransport{cmd: cmd, in: in, out: bufio.NewReader(out)}
+	_, err = t.call("client", []byte(name))
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// shellQuote quotes a path for the remote shell, leaving a leading ~/ alone so it still gets expanded.
+func shellQuote(path string) string {
+	prefix := ""
+	if strings.HasPrefix(path, "~/") {
+		prefix, path = "~/", path[2:]
+	}
+	return prefix + "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
+
+// call sends a frame and waits for the answer.
+func (t *stdioTransport) call(kind string, data []byte) ([]byte, error) {
+	err := writeFrame(t.in, kind, data)
+	if err != nil {
+		return nil, err
+	}
+	kind, data, err = readFrame(t.out)
+	if err == io.EOF {
+		return nil, errors.New("The server closed the connection.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if kind != "ok" {
+		return nil, fmt.Errorf("Error from server: %s", data)
+	}
+	return data, nil
+}
+
+func (t *stdioTransport) cursor(name string) (cursor, error) {
+	cur := cursor{}
+	data, err := t.call("cursor", nil)
+	if err != nil {
+		return cur, err
+	}
+	return cur, json.Unmarshal(data, &cur)
+}
+
+func (t *stdioTransport) send(name string, payload []byte) ([]byte, error) {
+	return t.call("sync", payload)
+}
+
+func (t *stdioTransport) close() error {
+	t.in.Close()
+	return t.cmd.Wait()
+}
+
+// serveStdio answers requests from a single client on r and w until the client is done.
+func (s *server) serveStdio(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	client := ""
+	for {
+		kind, data, err := readFrame(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var result []byte
+		switch kind {
+		case "client":
+			client = string(data)
+		case "cursor":
+			result, err = json.Marshal(s.cursorFor(client))
+		case "sync":
+			result, err = s.merge(client, data)
+		default:
+			err = fmt.Errorf("Unknown request: %q", kind)
+		}
+
+		// Our stderr usually goes back to the client as well, so errors are only sent in the answer.
+		if err != nil {
+			err = writeFrame(w, "error", []byte(err.Error()))
+		} else {
+			err = writeFrame(w, "ok", result)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// transport is a connection to a sync server. The merge logic is the same no matter how the data gets there.
+type transport interface {
+	// cursor asks the server for the last transaction the named client synced.
+	cursor(name string) (cursor, error)
+
+	// send sends a (possibly encrypted) ledger file to the server, and returns what it sent back.
+	send(name string, payload []byte) ([]byte, error)
+
+	close() error
+}
+
+// httpTransport talks to a server listening for HTTP(S) connections.
+type httpTransport struct {
+	c    *http.Client
+	sec  *security
+	addr string
+}
+
+// newRequest makes a request to the server with the client name and token (if there is one) set.
+func (t *httpTransport) newRequest(method, addr, name string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, addr, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Ledger-Client", name)
+	if t.sec.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.sec.Token)
+	}
+	return req, nil
+}
+
+func (t *httpTransport) cursor(name string) (cursor, error) {
+	cur := cursor{}
+	req, err := t.newRequest(http.MethodGet, strings.TrimSuffix(t.addr, "/")+"/cursor?client="+url.QueryEscape(name), name, nil)
+	if err != nil {
+		return cur, err
+	}
+	r, err := t.c.Do(req)
+	if err != nil {
+		return cur, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return cur, fmt.Errorf("Response from server not OK: %v", r.Status)
+	}
+	return cur, json.NewDecoder(r.Body).Decode(&cur)
+}
+
+func (t *httpTransport) send(name string, payload []byte) ([]byte, error) {
+	req, err := t.newRequest(http.MethodPost, t.addr, name, payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/x-ledger-cli")
+	if t.sec.PSK != nil {
+		req.Header.Set("Content-Type", sealedType)
+	}
+
+	r, err := t.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Response from server not OK: %v", r.Status)
+	}
+	return io.ReadAll(r.Body)
+}
+
+func (t *httpTransport) close() error {
+	return nil
+}
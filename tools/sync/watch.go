@@ -0,0 +1,178 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+	"github.com/samuellwn/ledger/tools"
+)
+
+// settle is how long the file has to go without changing before it is synced, so a sync doesn't happen halfway
+// through an editor saving it.
+const settle = time.Second
+
+// watch syncs the file at path whenever it changes and every interval, until something goes badly wrong. Sync errors
+// are only logged.
+func (sc *syncClient) watch(path string, interval time.Duration) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// Editors often save by writing a new file and renaming it over the old one, so watch the directory instead of
+	// the file itself.
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	err = w.Add(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	// The contents last written or synced, so our own writes don't trigger another sync.
+	last := []byte(nil)
+	syncNow := func() {
+		out, err := sc.syncFile(path, last)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, time.Now().Format(time.RFC3339), err)
+			return
+		}
+		last = out
+	}
+
+	syncNow()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var changed <-chan time.Time
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(ev.Name) == path && ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				changed = time.After(settle)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintln(os.Stderr, time.Now().Format(time.RFC3339), err)
+		case <-changed:
+			changed = nil
+			if data, err := os.ReadFile(path); err == nil && bytes.Equal(data, last) {
+				// This is just our own write.
+				continue
+			}
+			syncNow()
+		case <-ticker.C:
+			syncNow()
+		}
+	}
+}
+
+// syncFile syncs the file at path and writes the result back if anything changed. Returns the new contents of the
+// file, or last if there was an error.
+func (sc *syncClient) syncFile(path string, last []byte) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return last, err
+	}
+
+	plain, method, err := tools.Encryption.Decrypt(data)
+	if err != nil {
+		return last, err
+	}
+	mf, err := parse.Read(bytes.NewReader(plain), path, parse.Options{KeepRaw: true})
+	if err != nil {
+		return last, err
+	}
+
+	rf, err := sc.sync(mf, "", "")
+	if err != nil {
+		return last, err
+	}
+
+	out := new(bytes.Buffer)
+	err = rf.Format(out)
+	if err != nil {
+		return last, err
+	}
+	if bytes.Equal(out.Bytes(), plain) {
+		return data, nil
+	}
+
+	// An encrypted file stays encrypted the same way.
+	e := *tools.Encryption
+	if e.Method == ledger.EncryptNone {
+		e.Method = method
+	}
+	enc, err := e.Encrypt(out.Bytes())
+	if err != nil {
+		return last, err
+	}
+
+	// Write to a new file and rename it into place, so nothing ever sees a half written file.
+	info, err := os.Stat(path)
+	if err != nil {
+		return last, err
+	}
+	tmp := path + ".sync"
+	err = writeSynced(tmp, enc, info.Mode().Perm())
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return last, err
+	}
+	tools.SyncDir(filepath.Dir(path))
+	return enc, nil
+}
+
+// writeSynced writes data to a new file at path and makes sure it is on the disk before returning.
+func writeSynced(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile, usage)
+	fs.Parse()
+
+	f := tools.LoadLedgerFile(fs.SourceFile)
+
+	tools.HandleErr(f.ExportBeancount(fs.Output()))
+}
+
+var usage = `Usage:
+
+This program takes a ledger file and writes it out in beancount syntax, for
+use with fava and other beancount tools. Only the latest revision of each
+transaction is written.
+
+Account names are changed to fit beancount's rules (accounts outside of Assets,
+Liabilities, Equity, Income, and Expenses are moved under Equity), with the
+original names kept as metadata so frombeancount can change them back.
+`
@@ -0,0 +1,54 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagDestFile|tools.FlagSourceFile|tools.FlagQuery, usage)
+	opts := ledger.CSVOptions{}
+	fs.Flags.BoolVar(&opts.NoHeader, "noheader", false, "Do not write a header row.")
+	fs.Flags.BoolVar(&opts.Total, "total", false, "Add a running total column.")
+	tab := false
+	fs.Flags.BoolVar(&tab, "tab", false, "Separate fields with tabs instead of commas.")
+	fs.Parse()
+
+	opts.Query = fs.Query
+	if tab {
+		opts.Comma = '\t'
+	}
+
+	f := tools.LoadLedgerFile(fs.SourceFile)
+
+	tools.HandleErr(f.ExportCSV(fs.Output(), opts))
+}
+
+var usage = `Usage:
+
+This program takes a ledger file and writes it out as CSV, one row for each
+posting. The columns are date, status, code, description, account, amount,
+commodity, tags, and k/v pairs.
+`
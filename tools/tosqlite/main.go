@@ -0,0 +1,58 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/samuellwn/ledger/sqlite"
+	"github.com/samuellwn/ledger/tools"
+)
+
+func main() {
+	fs := tools.CommonFlagSet(tools.FlagSourceFile, usage)
+	db := ""
+	fs.Flags.StringVar(&db, "db", "", "The SQLite database `path`.")
+	fs.Parse()
+
+	tools.HandleErrS(db == "", "A database path is required (-db).")
+
+	f := tools.LoadLedgerFile(fs.SourceFile)
+
+	tools.HandleErr(sqlite.Export(f, db))
+}
+
+var usage = `Usage:
+
+This program takes a ledger file and writes it to a SQLite database, so it can
+be queried with SQL. Any journal tables already in the database are replaced.
+
+The tables are transactions, postings, tags, kv, comments, directives, and
+directive_lines, joined on the seq (transaction) and dseq (directive) columns.
+Every revision of every transaction is included; use "WHERE latest" for just
+the current ones. Amounts are integers in ten thousandths of a dollar. The
+register view has the postings of the current transactions with amounts in
+dollars:
+
+	SELECT account, SUM(amount) FROM register
+	WHERE date >= '2026-01-01' GROUP BY account;
+`
@@ -23,161 +23,481 @@ misrepresented as being the original software.
 package tools
 
 import (
-	"errors"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/samuellwn/ledger"
 )
 
-// Zipper takes two ledger flies and zips them together in a deterministic manner. On error os.Exit is called and
-// the error is logged to standard error.
+// Kinds of Conflict.
+const (
+	ConflictOrder   = "order"   // Two new transactions could not be put in a deterministic order.
+	ConflictMoved   = "moved"   // Transactions that several files have are in a different order in each file.
+	ConflictContent = "content" // Several files have a transaction with the same ID and RID, but it is different.
+	ConflictEdited  = "edited"  // Both files added revisions to the same transaction, see MergeWithBase.
+	ConflictDeleted = "deleted" // One file removed a transaction the other one added revisions to.
+)
+
+// Conflict is a single problem found by Zip.
+type Conflict struct {
+	Kind  string // One of ConflictOrder, ConflictMoved, ConflictContent, ConflictEdited, or ConflictDeleted.
+	ID    string // The ID and RID of the (first) transaction involved.
+	RID   string
+	Files []int // The files involved, as indexes into the list of files given to Zip.
+	T     []int // The index of the transaction in each of those files.
+
+	// For ConflictContent and ConflictEdited, what the other version of the transaction changed compared to the
+	// one in the first file listed.
+	Diff *ledger.TransactionDiff
+}
+
+func (c Conflict) String() string {
+	if c.Diff != nil && !c.Diff.Empty() {
+		diff := strings.ReplaceAll(c.Diff.String(), "\n", "\n\t")
+		return c.summary() + "\n\t" + diff
+	}
+	return c.summary()
+}
+
+func (c Conflict) summary() string {
+	switch c.Kind {
+	case ConflictOrder:
+		return fmt.Sprintf("Transaction %v of file %v (ID: %q, RID: %q) could not be ordered against transaction %v of file %v.",
+			c.T[0], c.Files[0], c.ID, c.RID, c.T[1], c.Files[1])
+	case ConflictMoved:
+		return fmt.Sprintf("Transaction %v of file %v (ID: %q, RID: %q) is in a different order in files %v.",
+			c.T[0], c.Files[0], c.ID, c.RID, c.Files)
+	case ConflictEdited:
+		return fmt.Sprintf("Transaction %v of file %v (ID: %q, RID: %q) was edited in files %v.",
+			c.T[0], c.Files[0], c.ID, c.RID, c.Files)
+	case ConflictDeleted:
+		return fmt.Sprintf("Transaction %v of file %v (ID: %q, RID: %q) was edited in one file but removed from the other.",
+			c.T[0], c.Files[0], c.ID, c.RID)
+	default:
+		return fmt.Sprintf("Transaction %v of file %v (ID: %q, RID: %q) has different contents in files %v.",
+			c.T[0], c.Files[0], c.ID, c.RID, c.Files)
+	}
+}
+
+// Error makes a single conflict usable as an error, for code that handles conflicts one at a time.
+func (c Conflict) Error() string {
+	return c.String()
+}
+
+// ConflictReport lists everything that kept Zip from merging files deterministically.
+type ConflictReport struct {
+	Conflicts []Conflict
+}
+
+func (r *ConflictReport) Error() string {
+	lines := []string{fmt.Sprintf("Could not merge the files, %v conflicts found.", len(r.Conflicts))}
+	for _, c := range r.Conflicts {
+		lines = append(lines, c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Zipper takes any number of ledger flies and zips them together in a deterministic manner. On error os.Exit is
+// called and the error is logged to standard error.
 // All directives are deduplicated and moved to the top of the file.
-func Zipper(a *ledger.File, b *ledger.File) *ledger.File {
-	return HandleErrV(ZipperHTTP(a, b))
+func Zipper(files ...*ledger.File) *ledger.File {
+	return HandleErrV(ZipperHTTP(files...))
 }
 
 // ZipperHTTP is like Zipper, but intended for use in HTTPhandlers and the like where the standard command
-// error handling is not desirable.
-func ZipperHTTP(a *ledger.File, b *ledger.File) (*ledger.File, error) {
+// error handling is not desirable. If there are any conflicts the error is a *ConflictReport.
+func ZipperHTTP(files ...*ledger.File) (*ledger.File, error) {
+	f, report := Zip(files...)
+	if report != nil {
+		return nil, report
+	}
+	return f, nil
+}
+
+// Zip merges any number of ledger files. Transactions are matched up by their ID and RID (or by their contents if
+// they don't have an ID), so every transaction found in any of the files is in the result exactly once. All the
+// files are merged at once, so the result doesn't depend on the order they are given in (unlike merging them two
+// at a time), unless there are conflicts.
+//
+// Transactions that several files have keep their order, and the transactions only some files have are merged in
+// between them by date, ID, RID, and FITID. Anything that makes the result depend on the order of the files is a
+// conflict: new transactions that can't be told apart by those keys, transactions that are in a different order
+// in different files, or transactions with the same ID and RID but different contents. In each case the earliest
+// file wins, and the conflicts are listed in the returned report (which is nil if there were none).
+//
+// A void revision always stays the latest revision of its transaction, so a transaction voided in any of the files
+// is voided in the result. All directives are deduplicated and moved to the top of the file.
+func Zip(files ...*ledger.File) (*ledger.File, *ConflictReport) {
 	drs := []ledger.Directive{}
-	drs = append(drs, a.D...)
-outer:
-	for _, d2 := range b.D {
-		for _, d1 := range a.D {
-			if d2.Compare(d1) {
-				continue outer
+	seenDrs := map[string]bool{}
+	for _, f := range files {
+		for _, d := range f.D {
+			if seenDrs[d.String()] {
+				continue
+			}
+			seenDrs[d.String()] = true
+			d.FoundBefore = 0
+			drs = append(drs, d)
+		}
+	}
+
+	// The number of files each transaction is in, and where it is in each file.
+	keys := make([][]string, len(files))
+	count := map[string]int{}
+	where := map[string]map[int]int{}
+	for i, f := range files {
+		keys[i] = zipKeys(f)
+		for j, k := range keys[i] {
+			if where[k] == nil {
+				where[k] = map[int]int{}
+			}
+			if _, ok := where[k][i]; !ok {
+				where[k][i] = j
+				count[k]++
 			}
 		}
-		drs = append(drs, d2)
 	}
-	for _, d := range drs {
-		d.FoundBefore = 0
+
+	report := &ConflictReport{}
+	conflict := func(kind string, tr *ledger.Transaction, fs, ts []int) {
+		report.Conflicts = append(report.Conflicts, Conflict{kind, tr.KVPairs["ID"], tr.KVPairs["RID"], fs, ts, nil})
 	}
 
-	// Merge transactions.
 	trs := []ledger.Transaction{}
-
-	// First, zoom through the master file until we find the sync point.
-	syncPoint := len(a.T) - 1
-	for ; syncPoint >= 0; syncPoint-- {
-		if a.T[syncPoint].Code == b.T[0].Code {
+	done := map[string]bool{} // Transactions already added.
+	pos := make([]int, len(files))
+	for {
+		// Skip anything that was already added, either because it was out of order or because it is in the same
+		// file twice. Then see which transactions are at the front of every file that has them.
+		heads := []int{} // Files with transactions left.
+		atHead := map[string]int{}
+		for i := range files {
+			for pos[i] < len(keys[i]) && done[keys[i][pos[i]]] {
+				pos[i]++
+			}
+			if pos[i] < len(keys[i]) {
+				heads = append(heads, i)
+				atHead[keys[i][pos[i]]]++
+			}
+		}
+		if len(heads) == 0 {
 			break
 		}
-	}
-	if syncPoint == len(a.T) {
-		return nil, errors.New("No sync point found!")
+
+		// Of the transactions that are ready, the earliest (by date, then time of day if the transactions have one)
+		// goes next. If the dates are the same, try to order lexically by ID to preserve determinism. Failing that
+		// try the revision ID (only present in edits), and if all else fails use the financial institution ID (only
+		// present in imported data).
+		next := -1
+		for _, i := range heads {
+			k := keys[i][pos[i]]
+			if atHead[k] != count[k] {
+				continue
+			}
+			if next == -1 {
+				next = i
+				continue
+			}
+			nk := keys[next][pos[next]]
+			if k == nk {
+				continue
+			}
+			a, b := &files[next].T[pos[next]], &files[i].T[pos[i]]
+			dir := ledger.CompareTransactions(a, b, ledger.SortDate, ledger.SortID, ledger.SortRID, ledger.SortFITID)
+			if dir == 0 {
+				conflict(ConflictOrder, a, []int{next, i}, []int{pos[next], pos[i]})
+			}
+			if dir > 0 {
+				next = i
+			}
+		}
+
+		if next == -1 {
+			// Every file is waiting on another one, so some shared transactions are in a different order in
+			// different files. Go with the first file.
+			next = heads[0]
+		}
+
+		k := keys[next][pos[next]]
+		tr := &files[next].T[pos[next]]
+		fs, ts := []int{}, []int{}
+		for i := range files {
+			if j, ok := where[k][i]; ok {
+				fs, ts = append(fs, i), append(ts, j)
+			}
+		}
+		if atHead[k] != count[k] {
+			conflict(ConflictMoved, tr, fs, ts)
+		} else {
+			for n, i := range fs {
+				if files[i].T[ts[n]].String() != tr.String() {
+					conflict(ConflictContent, tr, fs, ts)
+					report.Conflicts[len(report.Conflicts)-1].Diff = ledger.DiffTransactions(tr, &files[i].T[ts[n]])
+					break
+				}
+			}
+		}
+
+		done[k] = true
+		trs = append(trs, *tr)
 	}
 
-	// Add transactions from the master up to the sync point
-	for i := 0; i <= syncPoint; i++ {
-		trs = append(trs, a.T[i])
+	if len(report.Conflicts) == 0 {
+		report = nil
 	}
+	return &ledger.File{T: voidsLast(trs), D: drs}, report
+}
 
-	// Now continue adding files from the master up until the last transaction that matches.
-	i1, i2 := syncPoint+1, 1
-	for i1 < len(a.T) || i2 < len(b.T) {
-		if a.T[i1].Code != b.T[i2].Code {
-			break
+// voidsLast moves any void revision that isn't the latest revision of its transaction to just after the latest one,
+// so that a void is never undone by a merge putting another file's edit after it.
+func voidsLast(trs []ledger.Transaction) []ledger.Transaction {
+	last := map[string]int{}
+	for i, tr := range trs {
+		if id := tr.KVPairs["ID"]; id != "" {
+			last[id] = i
 		}
-		trs = append(trs, a.T[i1])
-		i1++
-		i2++
 	}
 
-	// Now zipper the differences together from the last sync point
-	for i1 < len(a.T) || i2 < len(b.T) {
-		// If only one side is left, just append it and bail.
-		if i1 >= len(a.T) {
-			trs = append(trs, b.T[i2])
-			i2++
-			continue
-		}
-		if i2 >= len(b.T) {
-			trs = append(trs, a.T[i1])
-			i1++
+	out := make([]ledger.Transaction, 0, len(trs))
+	moved := map[int][]ledger.Transaction{} // Void revisions to put after the transaction at each index.
+	for i, tr := range trs {
+		id := tr.KVPairs["ID"]
+		if id != "" && tr.Voided() && !trs[last[id]].Voided() {
+			moved[last[id]] = append(moved[last[id]], tr)
 			continue
 		}
+		out = append(out, tr)
+		out = append(out, moved[i]...)
+	}
+	return out
+}
 
-		// If there is a clear difference between the times, the earlier one goes first.
-		if a.T[i1].Date.Before(b.T[i2].Date) {
-			trs = append(trs, a.T[i1])
-			i1++
-			continue
+// Strategies for ZipResolve.
+const (
+	OnConflictFail      = "fail"           // Return the conflicts as an error.
+	OnConflictOurs      = "ours"           // Our version of each conflicted transaction wins.
+	OnConflictTheirs    = "theirs"         // Their version of each conflicted transaction wins.
+	OnConflictDuplicate = "duplicate-flag" // Like ours, but their version of a changed transaction is kept as well.
+)
+
+// ErrUnknownStrategy is returned by ZipResolve for a strategy that isn't one of the above.
+type ErrUnknownStrategy string
+
+func (err ErrUnknownStrategy) Error() string {
+	return fmt.Sprintf("Unknown conflict strategy: %q", string(err))
+}
+
+// ZipResolve merges two files like Zip, but handles any conflicts with the given strategy instead of failing (unless
+// the strategy is OnConflictFail). Whichever file wins goes first, so it also decides the order of transactions
+// that could not be ordered otherwise.
+//
+// Conflicted transactions get a new revision with a "Conflict" KV pair set to the kind of conflict, so they can be
+// found and reviewed later. With OnConflictDuplicate their version of a transaction with different contents is
+// added as that new revision instead of ours. Transactions without an ID have the KV pair set directly.
+//
+// The conflicts are returned along with the merged file, so they can be logged.
+func ZipResolve(strategy string, ours, theirs *ledger.File) (*ledger.File, *ConflictReport, error) {
+	files := []*ledger.File{ours, theirs}
+	switch strategy {
+	case OnConflictFail, OnConflictOurs, OnConflictDuplicate:
+	case OnConflictTheirs:
+		files = []*ledger.File{theirs, ours}
+	default:
+		return nil, nil, ErrUnknownStrategy(strategy)
+	}
+
+	f, report := Zip(files...)
+	if report == nil {
+		return f, nil, nil
+	}
+	if strategy == OnConflictFail {
+		return nil, report, report
+	}
+
+	keys := zipKeys(f)
+	flagged := map[string]bool{}
+	flag := func(kind string, tr *ledger.Transaction) {
+		k := zipKeys(&ledger.File{T: []ledger.Transaction{*tr}})[0]
+		if flagged[k] {
+			return
 		}
-		if a.T[i1].Date.After(b.T[i2].Date) {
-			trs = append(trs, b.T[i2])
-			i2++
-			continue
+		flagged[k] = true
+
+		if tr.KVPairs["ID"] == "" {
+			for i := range f.T {
+				if keys[i] == k {
+					f.T[i].KVPairs["Conflict"] = kind
+				}
+			}
+			return
 		}
+		rev := tr.CleanCopy()
+		rev.KVPairs["Conflict"] = kind
+		ledger.AssignIDs(ours.IDs, rev)
+		f.T = append(f.T, *rev)
+	}
 
-		// if the times are the same, try to order lexically by ID to preserve determinism.
-		dir := chooseAB(a.T[i1].KVPairs, b.T[i2].KVPairs, "ID")
-		if dir < 0 {
-			trs = append(trs, a.T[i1])
-			i1++
-			continue
+	for _, c := range report.Conflicts {
+		// The first file listed is the one that won.
+		n := 0
+		if c.Kind == ConflictContent && strategy == OnConflictDuplicate {
+			n = 1
 		}
-		if dir > 0 {
-			trs = append(trs, b.T[i2])
-			i2++
-			continue
+		flag(c.Kind, &files[c.Files[n]].T[c.T[n]])
+		if c.Kind == ConflictOrder {
+			flag(c.Kind, &files[c.Files[1]].T[c.T[1]])
+		}
+	}
+	return f, report, nil
+}
+
+// MergeWithBase merges two files that were both changed from a common ancestor, base. The ancestor is used to tell
+// what each side did: transactions (and revisions) that are not in base were added by whichever side has them, and
+// anything in base that one side no longer has was removed by that side, so it is left out of the result. If one
+// side removed a transaction the other side added revisions to, it is kept and a ConflictDeleted is reported.
+//
+// When both sides added revisions to the same transaction, the RIDs are used to decide which edit wins: if one side
+// already has all of the other side's new revisions it is simply newer, otherwise the edits really are concurrent.
+// In that case the revisions from b are put first and the ones from a after them, so a's edit becomes the latest
+// revision, and a ConflictEdited is reported. A void from either side still wins. Everything else is merged the
+// same way Zip does it.
+//
+// In the returned report file 0 is a and file 1 is b.
+func MergeWithBase(base, a, b *ledger.File) (*ledger.File, *ConflictReport) {
+	inBase, inA, inB := keySet(base), keySet(a), keySet(b)
+	newA, newB := newRevisions(a, inBase), newRevisions(b, inBase)
+
+	report := &ConflictReport{}
+	deleted := map[string]bool{} // IDs already reported as deleted.
+
+	// keep returns the transactions from f that were not removed by the other side, along with the original index
+	// of each.
+	keep := func(fi int, f *ledger.File, inOther map[string]bool, newThis map[string][]string) (*ledger.File, []int) {
+		kf := &ledger.File{D: f.D}
+		ixs := []int{}
+		for i, k := range zipKeys(f) {
+			tr := &f.T[i]
+			id := tr.KVPairs["ID"]
+			if inBase[k] && !inOther[k] {
+				if id == "" || len(newThis[id]) == 0 {
+					continue
+				}
+				if !deleted[id] {
+					deleted[id] = true
+					report.Conflicts = append(report.Conflicts, Conflict{ConflictDeleted, id, tr.KVPairs["RID"], []int{fi}, []int{i}, nil})
+				}
+			}
+			kf.T = append(kf.T, *tr)
+			ixs = append(ixs, i)
 		}
+		return kf, ixs
+	}
+	ka, ixsA := keep(0, a, inB, newA)
+	kb, ixsB := keep(1, b, inA, newB)
 
-		// Well, we can't order by ID for some reason. Try to order by the revision ID (only present in edits)
-		dir = chooseAB(a.T[i1].KVPairs, b.T[i2].KVPairs, "RID")
-		if dir < 0 {
-			trs = append(trs, a.T[i1])
-			i1++
-			continue
+	merged, zipReport := Zip(ka, kb)
+	if zipReport != nil {
+		// The indexes in the report need to point at the original files.
+		for _, c := range zipReport.Conflicts {
+			for n, fi := range c.Files {
+				c.T[n] = [][]int{ixsA, ixsB}[fi][c.T[n]]
+			}
+			report.Conflicts = append(report.Conflicts, c)
 		}
-		if dir > 0 {
-			trs = append(trs, b.T[i2])
-			i2++
+	}
+
+	// Find the transactions both sides edited without knowing about the other's edit.
+	keysM := zipKeys(merged)
+	ixA, ixB, ixM := a.Index(), b.Index(), merged.Index()
+	for id, revsA := range newA {
+		revsB := newB[id]
+		if len(revsB) == 0 || containsAll(inA, revsB) || containsAll(inB, revsA) {
 			continue
 		}
+		latestA, _ := ixA.FindByID(id)
+		latestB, _ := ixB.FindByID(id)
+		report.Conflicts = append(report.Conflicts, Conflict{
+			ConflictEdited, id, a.T[latestA].KVPairs["RID"], []int{0, 1}, []int{latestA, latestB},
+			ledger.DiffTransactions(&a.T[latestA], &b.T[latestB]),
+		})
 
-		// If all else fails, try to use a financial institution ID (only present in imported data)
-		dir = chooseAB(a.T[i1].KVPairs, b.T[i2].KVPairs, "FITID")
-		if dir < 0 {
-			trs = append(trs, a.T[i1])
-			i1++
-			continue
+		// Put the revisions in lineage order in the places the revisions of this transaction already take up:
+		// everything both sides have, then b's edits, then a's.
+		slots := ixM.FindRevisions(id)
+		shared, onlyB, onlyA := []ledger.Transaction{}, []ledger.Transaction{}, []ledger.Transaction{}
+		for _, i := range slots {
+			tr := merged.T[i]
+			switch {
+			case inA[keysM[i]] && inB[keysM[i]]:
+				shared = append(shared, tr)
+			case inB[keysM[i]]:
+				onlyB = append(onlyB, tr)
+			default:
+				onlyA = append(onlyA, tr)
+			}
 		}
-		if dir > 0 {
-			trs = append(trs, b.T[i2])
-			i2++
-			continue
+		for n, tr := range append(append(shared, onlyB...), onlyA...) {
+			merged.T[slots[n]] = tr
 		}
-		return nil, errors.New("Error: Could not order some transactions. Ensure all transactions have ID and RID keys as appropriate.")
 	}
-	return &ledger.File{T: trs, D: drs}, nil
-}
-
-// -1 == a, 0 == neither, 1 == b
-func chooseAB(a, b map[string]string, key string) int {
-	id1, ok1 := a[key]
-	id2, ok2 := b[key]
+	merged.T = voidsLast(merged.T)
 
-	// If only one has an ID, the ID goes first.
-	if ok1 && !ok2 {
-		return -1
+	if len(report.Conflicts) == 0 {
+		report = nil
+	} else {
+		// Map iteration order is random, so keep the report in a stable order.
+		sort.SliceStable(report.Conflicts, func(i, j int) bool {
+			return report.Conflicts[i].T[0] < report.Conflicts[j].T[0]
+		})
 	}
-	if !ok1 && ok2 {
-		return 1
+	return merged, report
+}
+
+// keySet returns the set of zipKeys of every transaction in the file.
+func keySet(f *ledger.File) map[string]bool {
+	set := map[string]bool{}
+	for _, k := range zipKeys(f) {
+		set[k] = true
 	}
+	return set
+}
 
-	// If neither has an ID
-	if !ok1 && !ok2 {
-		return 0
+// newRevisions returns the keys of the revisions in f that are not in base, by transaction ID.
+func newRevisions(f *ledger.File, inBase map[string]bool) map[string][]string {
+	revs := map[string][]string{}
+	for i, k := range zipKeys(f) {
+		id := f.T[i].KVPairs["ID"]
+		if id != "" && !inBase[k] {
+			revs[id] = append(revs[id], k)
+		}
 	}
+	return revs
+}
 
-	// If both have identical IDs
-	if id1 == id2 {
-		return 0
+func containsAll(set map[string]bool, keys []string) bool {
+	for _, k := range keys {
+		if !set[k] {
+			return false
+		}
 	}
+	return true
+}
 
-	// If both have an ID then order by ID lexically.
-	if id1 < id2 {
-		return -1
+// zipKeys returns the key used to match up each transaction in the file. Transactions with an ID use their ID and
+// RID, anything else uses its contents along with a count of how many times the same contents were already seen,
+// so that identical transactions each match up with one copy in the other files.
+func zipKeys(f *ledger.File) []string {
+	keys := make([]string, len(f.T))
+	seen := map[string]int{}
+	for i, tr := range f.T {
+		if id := tr.KVPairs["ID"]; id != "" {
+			keys[i] = "id\x00" + id + "\x00" + tr.KVPairs["RID"]
+			continue
+		}
+		text := tr.String()
+		keys[i] = fmt.Sprintf("text\x00%v\x00%v", seen[text], text)
+		seen[text]++
 	}
-	return 1
+	return keys
 }
@@ -22,24 +22,31 @@ misrepresented as being the original software.
 
 package main
 
-import "github.com/samuellwn/ledger/tools"
+import (
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/tools"
+)
 
 func main() {
 	fs := tools.CommonFlagSet(tools.FlagDestFile | tools.FlagMasterFile | tools.FlagSourceFile, usage)
 	fs.Parse()
 
-	a := tools.LoadLedgerFile(fs.MasterFile)
-	b := tools.LoadLedgerFile(fs.SourceFile)
+	files := []*ledger.File{tools.LoadLedgerFile(fs.MasterFile), tools.LoadLedgerFile(fs.SourceFile)}
+	for _, path := range fs.Flags.Args() {
+		files = append(files, tools.LoadLedgerPath(path))
+	}
 
-	f := tools.Zipper(a, b)
+	f := tools.Zipper(files...)
 
 	tools.WriteLedgerFile(fs.DestFile, f)
 }
 
 var usage = `Usage:
 
-This program takes two ledger files and "zips" them together to make a single
-file. All directives will be moved to the beginning of the file!
+This program takes two or more ledger files and "zips" them together to make a
+single file. Any files after the flags are merged in along with the master and
+source files. All directives will be moved to the beginning of the file!
 
 For this to work properly, each transaction needs an "ID" K/V to be set to a
 unique transaction ID, otherwise it is not possible to sync partial files
@@ -0,0 +1,180 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package tools_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/samuellwn/ledger"
+	"github.com/samuellwn/ledger/parse"
+	"github.com/samuellwn/ledger/tools"
+)
+
+// zipTransaction returns a transaction for the zipper tests, with the given ID and RID on the given day of
+// January 2022.
+func zipTransaction(day int, id, rid string) string {
+	return fmt.Sprintf("2022/01/%02d Test\n\t; ID: %v\n\t; RID: %v\n\tExpenses:Test  $1.00\n\tAssets:Cash\n\n", day, id, rid)
+}
+
+func zipFile(t *testing.T, trs ...string) *ledger.File {
+	f, err := parse.ParseLedgerString(strings.Join(trs, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func zipIDs(f *ledger.File) string {
+	ids := []string{}
+	for _, tr := range f.T {
+		ids = append(ids, tr.KVPairs["ID"]+tr.KVPairs["RID"])
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestZip(t *testing.T) {
+	a := zipFile(t, zipTransaction(1, "a", "1"), zipTransaction(2, "b", "1"), zipTransaction(4, "d", "1"))
+	b := zipFile(t, zipTransaction(2, "b", "1"), zipTransaction(3, "c", "1"), zipTransaction(4, "b", "2"))
+
+	f, report := tools.Zip(a, b)
+	if report != nil {
+		t.Fatal(report)
+	}
+	if ids := zipIDs(f); ids != "a1 b1 c1 b2 d1" {
+		t.Errorf("Incorrect merge order: %v", ids)
+	}
+
+	// The same ID and RID with different contents.
+	c := zipFile(t, strings.Replace(zipTransaction(2, "b", "1"), "$1.00", "$2.00", 1))
+	_, report = tools.Zip(a, c)
+	if report == nil || len(report.Conflicts) != 1 || report.Conflicts[0].Kind != tools.ConflictContent {
+		t.Errorf("Content conflict not reported: %v", report)
+	}
+
+	// Two new transactions without IDs on the same day can't be ordered.
+	noID := "2022/01/05 Test\n\tExpenses:Test  $1.00\n\tAssets:Cash\n\n"
+	_, report = tools.Zip(zipFile(t, noID), zipFile(t, strings.Replace(noID, "Test\n", "Other\n", 1)))
+	if report == nil || report.Conflicts[0].Kind != tools.ConflictOrder {
+		t.Errorf("Order conflict not reported: %v", report)
+	}
+
+	// Shared transactions in a different order.
+	_, report = tools.Zip(a, zipFile(t, zipTransaction(4, "d", "1"), zipTransaction(1, "a", "1")))
+	if report == nil || report.Conflicts[0].Kind != tools.ConflictMoved {
+		t.Errorf("Moved conflict not reported: %v", report)
+	}
+
+	// Merging three files at once doesn't depend on their order.
+	c = zipFile(t, zipTransaction(1, "a", "1"), zipTransaction(3, "e", "1"))
+	want := ""
+	for n, files := range [][]*ledger.File{{a, b, c}, {c, a, b}, {b, c, a}} {
+		f, report := tools.Zip(files...)
+		if report != nil {
+			t.Fatal(report)
+		}
+		if n == 0 {
+			want = zipIDs(f)
+		} else if ids := zipIDs(f); ids != want {
+			t.Errorf("Merge order depends on file order: %v, %v", want, ids)
+		}
+	}
+	if want != "a1 b1 c1 e1 b2 d1" {
+		t.Errorf("Incorrect three way merge order: %v", want)
+	}
+
+	// A void stays the latest revision, even if the other file has an edit that would be merged after it.
+	void := strings.Replace(zipTransaction(2, "b", "v"), "\tExpenses", "\t; Void: true\n\tExpenses", 1)
+	f, report = tools.Zip(zipFile(t, zipTransaction(2, "b", "1"), void), zipFile(t, zipTransaction(2, "b", "1"), zipTransaction(5, "b", "2")))
+	if report != nil {
+		t.Fatal(report)
+	}
+	if ids := zipIDs(f); ids != "b1 b2 bv" {
+		t.Errorf("Void not kept last: %v", ids)
+	}
+	f.StripHistory()
+	if len(f.T) != 0 {
+		t.Errorf("Voided transaction not stripped: %v", zipIDs(f))
+	}
+}
+
+func TestMergeWithBase(t *testing.T) {
+	base := zipFile(t, zipTransaction(1, "a", "1"), zipTransaction(2, "b", "1"), zipTransaction(3, "d", "1"))
+	// a edits d and adds c, b edits d and removes b.
+	a := zipFile(t, zipTransaction(1, "a", "1"), zipTransaction(2, "b", "1"), zipTransaction(3, "d", "1"),
+		zipTransaction(3, "c", "1"), zipTransaction(3, "d", "3"))
+	b := zipFile(t, zipTransaction(1, "a", "1"), zipTransaction(3, "d", "1"), zipTransaction(3, "d", "2"))
+
+	f, report := tools.MergeWithBase(base, a, b)
+	if ids := zipIDs(f); ids != "a1 d1 c1 d2 d3" {
+		t.Errorf("Incorrect merge: %v", ids)
+	}
+	if report == nil || len(report.Conflicts) != 1 || report.Conflicts[0].Kind != tools.ConflictEdited {
+		t.Fatalf("Edit conflict not reported: %v", report)
+	}
+
+	// Once b has a's edit as well, b is just newer.
+	b = zipFile(t, zipTransaction(1, "a", "1"), zipTransaction(3, "d", "1"), zipTransaction(3, "d", "3"), zipTransaction(4, "d", "4"))
+	f, report = tools.MergeWithBase(base, a, b)
+	if report != nil {
+		t.Fatal(report)
+	}
+	if ids := zipIDs(f); ids != "a1 d1 c1 d3 d4" {
+		t.Errorf("Incorrect merge: %v", ids)
+	}
+
+	// Removing a transaction the other side edited.
+	f, report = tools.MergeWithBase(base, a, zipFile(t, zipTransaction(1, "a", "1"), zipTransaction(2, "b", "1")))
+	if report == nil || report.Conflicts[0].Kind != tools.ConflictDeleted {
+		t.Errorf("Delete conflict not reported: %v", report)
+	}
+	if ids := zipIDs(f); ids != "a1 b1 d1 c1 d3" {
+		t.Errorf("Incorrect merge: %v", ids)
+	}
+}
+
+func TestZipResolve(t *testing.T) {
+	ours := zipFile(t, zipTransaction(1, "a", "1"), zipTransaction(2, "b", "1"))
+	theirs := zipFile(t, zipTransaction(1, "a", "1"), strings.Replace(zipTransaction(2, "b", "1"), "$1.00", "$2.00", 1))
+
+	_, _, err := tools.ZipResolve(tools.OnConflictFail, ours, theirs)
+	if err == nil {
+		t.Error("Conflict not returned as an error.")
+	}
+
+	for strategy, want := range map[string]int64{
+		tools.OnConflictOurs:      10000,
+		tools.OnConflictTheirs:    20000,
+		tools.OnConflictDuplicate: 20000,
+	} {
+		f, report, err := tools.ZipResolve(strategy, ours, theirs)
+		if err != nil || report == nil {
+			t.Fatalf("%v: %v, %v", strategy, err, report)
+		}
+		f.StripHistory()
+		if len(f.T) != 2 || f.T[1].KVPairs["Conflict"] != tools.ConflictContent || f.T[1].Postings[0].Value != want {
+			t.Errorf("%v: Conflict not resolved correctly: %v", strategy, f.T)
+		}
+	}
+}
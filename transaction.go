@@ -38,13 +38,13 @@ package ledger
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
-	"github.com/samuellwn/ledger/parse/lex"
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 )
@@ -61,6 +61,7 @@ const (
 // Transaction is a single transaction from a ledger file.
 type Transaction struct {
 	Date        time.Time // 2020/10/10
+	HasTime     bool      // 13:45:00 (optional) Date includes a time of day, for ordering transactions on the same day.
 	ClearDate   time.Time // =2020/10/10 (optional)
 	Status      status    //   | ! | * (optional)
 	Code        string    // ( Stuff ) (optional)
@@ -73,18 +74,34 @@ type Transaction struct {
 	Tags    map[string]bool   // ; :tag:tag:tag:
 	KVPairs map[string]string // ; Key: Value
 
-	Location lex.Location // The line number where the transaction starts.
+	Location Position // Where the transaction starts.
+
+	// The source text of the transaction, only set if the parser was asked to keep it. File.Format writes this
+	// out as-is instead of formatting the transaction again, unless the transaction was changed after parsing.
+	Raw   string
+	rawOf string // The canonical text of the transaction at the time Raw was set.
 }
 
 // Posting is a single line item in a Transaction.
 type Posting struct {
-	Status    status //   | ! | *  (optional)
-	Account   string // Account:Name
-	Value     int64  // $20.00 (currently only supporting USD, in thousandths of a cent)
-	Null      bool   // True if the Value is implied. Value may or may not contain a valid amount.
-	Assert    int64  // = $20.00
+	Status  status //   | ! | *  (optional)
+	Account string // Account:Name
+	Value   int64  // $20.00 (currently only supporting USD, in thousandths of a cent)
+	Null    bool   // True if the Value is implied. Value may or may not contain a valid amount.
+
+	// The exact value, for amounts in a commodity declared with more decimal places than Value has (see
+	// AmountFormat.Precision), along with the symbol of that commodity. Value is Amount rounded to ten thousandths
+	// of a dollar. Both are zero for other amounts, and Amount is ignored if Value no longer matches it.
+	Amount    Amount
+	Commodity string
+
+	Assert    int64 // = $20.00
 	HasAssert bool
-	Note      string // ; Stuff
+	Note      string    // ; Stuff
+	Date      time.Time // ; [2020/10/10] (optional) Overrides the transaction date for this posting.
+	AuxDate   time.Time // ; [=2020/10/10] (optional) The effective date of this posting, see ReportQuery.Effective.
+
+	Location Position // Where the posting starts.
 }
 
 // CleanCopy takes a perfect copy of the transaction object, safe for editing without making any changes to the parent.
@@ -97,6 +114,49 @@ func (t *Transaction) CleanCopy() *Transaction {
 	return &nt
 }
 
+// SetRaw sets the source text of this transaction. The raw text will only be used until the next time the
+// transaction is modified.
+func (t *Transaction) SetRaw(raw string) {
+	if raw != "" && !strings.HasSuffix(raw, "\n") {
+		raw += "\n"
+	}
+	t.Raw = raw
+	t.rawOf = t.String()
+}
+
+// Unmodified returns true if the transaction has raw source text that still matches its contents.
+func (t *Transaction) Unmodified() bool {
+	return t.Raw != "" && t.String() == t.rawOf
+}
+
+// TagValue returns the value of a tag. Tags can be written as :tag: (which have an empty value) or as key/value
+// pairs (Trip: Hawaii), same as ledger. Returns false if the transaction doesn't have the tag.
+func (t *Transaction) TagValue(name string) (string, bool) {
+	if v, ok := t.KVPairs[name]; ok {
+		return v, true
+	}
+	return "", t.Tags[name]
+}
+
+// TagNames returns the names of every tag on the transaction, both :tag: tags and key/value pairs, sorted.
+func (t *Transaction) TagNames() []string {
+	names := maps.Keys(t.Tags)
+	for k := range t.KVPairs {
+		if !t.Tags[k] {
+			names = append(names, k)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Voided returns true if this is a void revision (a "Void" KV pair set to "true"), meaning the transaction it is a
+// revision of has been deleted. Void revisions keep the postings of the revision they replace, but they are left
+// out of reports, and StripHistory removes the whole transaction.
+func (t *Transaction) Voided() bool {
+	return t.KVPairs["Void"] == "true"
+}
+
 // Balance ensures that all postings in the transaction add up to 0 or there is a single null posting.
 // Returns false, nil if there is more than one null posting, otherwise returns the ending balances of
 // all accounts with postings and true if the transaction balances to 0 or there was a null posting.
@@ -132,7 +192,7 @@ func (t *Transaction) Canonicalize() error {
 
 	for i, p := range t.Postings {
 		if p.Null && null != -1 {
-			return MultipleNullError{-1, t.Location}
+			return MultipleNullError{-1, t.Location, t.KVPairs["ID"]}
 		}
 		if p.Null {
 			null = i
@@ -145,7 +205,7 @@ func (t *Transaction) Canonicalize() error {
 		return nil
 	}
 	if bal != 0 {
-		return BalanceError{-1, t.Location}
+		return BalanceError{-1, t.Location, t.KVPairs["ID"]}
 	}
 	return nil
 }
@@ -157,7 +217,7 @@ func SumTransactions(ts []Transaction) (map[string]int64, error) {
 	for i, t := range ts {
 		ok, ac := t.Balance()
 		if !ok {
-			return nil, BalanceError{i, t.Location}
+			return nil, BalanceError{i, t.Location, t.KVPairs["ID"]}
 		}
 
 		for k, v := range ac {
@@ -173,18 +233,18 @@ type sumTree struct {
 	value    int64
 }
 
-func (st *sumTree) render(name, lvl, pad string, res [][]string) [][]string {
+func (st *sumTree) render(name, lvl, pad string, af AmountFormat, res [][]string) [][]string {
 	if len(st.children) == 1 {
 		// Maybe I'm being an idiot, but there isn't a way to get an unknown key from a map that isn't a loop.
 		for key, child := range st.children {
-			return child.render(name+":"+key, lvl, pad, res)
+			return child.render(name+":"+key, lvl, pad, af, res)
 		}
 	}
 
 	padding := ""
 	if name != "" {
 		padding = pad
-		res = append(res, []string{lvl + name, FormatValue(st.value)})
+		res = append(res, []string{lvl + name, af.Format(st.value)})
 	}
 
 	keys := make([]string, 0, len(st.children))
@@ -194,7 +254,7 @@ func (st *sumTree) render(name, lvl, pad string, res [][]string) [][]string {
 	sort.Strings(keys)
 
 	for _, key := range keys {
-		res = st.children[key].render(key, lvl+padding, pad, res)
+		res = st.children[key].render(key, lvl+padding, pad, af, res)
 	}
 	return res
 }
@@ -202,6 +262,11 @@ func (st *sumTree) render(name, lvl, pad string, res [][]string) [][]string {
 // FormatSums takes a map of accounts to sums and turns it into a list of name/value pairs
 // with indentation applied to the names.
 func FormatSums(accounts map[string]int64, pad string) [][]string {
+	return FormatSumsWith(accounts, pad, DefaultAmountFormat)
+}
+
+// FormatSumsWith is the same as FormatSums, but writes the values in the given format.
+func FormatSumsWith(accounts map[string]int64, pad string, af AmountFormat) [][]string {
 	// Generate an accounts tree
 	root := &sumTree{children: map[string]*sumTree{}}
 
@@ -221,11 +286,13 @@ func FormatSums(accounts map[string]int64, pad string) [][]string {
 		}
 	}
 
-	return root.render("", "", pad, nil)
+	return root.render("", "", pad, af, nil)
 }
 
 // Match replaces the given account in the postings with the first matcher that succeeds.
 // If that matcher has a payee, that payee will replace this transaction's description.
+// If that matcher is marked Continue, later matchers are tried as well. They may change the payee and add tags and
+// KV pairs, but only the first matcher with an account changes the postings.
 // Returns true if any matcher succeeded, or false otherwise
 func (t *Transaction) Match(account string, matchers []Matcher) bool {
 	postingIxs := []int{}
@@ -239,36 +306,205 @@ func (t *Transaction) Match(account string, matchers []Matcher) bool {
 		return false
 	}
 
+	_, amounts := t.Balance()
+	amount := amounts[account]
+
+	// Later matchers still see the original description.
+	desc := t.Description
+	matched, replaced := false, false
 	for _, matcher := range matchers {
-		if matcher.R.MatchString(t.Description) {
+		if !matcher.matches(desc, t.KVPairs) || !matcher.matchConditions(t.Date, amount) {
+			continue
+		}
+		matched = true
 
-			if matcher.Payee != "" {
-				t.Description = matcher.Payee
-			}
-			for _, ix := range postingIxs {
-				t.Postings[ix].Account = matcher.Account
+		if matcher.Payee != "" {
+			t.Description = matcher.Payee
+		}
+		if len(matcher.Tags) > 0 && t.Tags == nil {
+			t.Tags = map[string]bool{}
+		}
+		for _, tag := range matcher.Tags {
+			t.Tags[tag] = true
+		}
+		if len(matcher.KVPairs) > 0 && t.KVPairs == nil {
+			t.KVPairs = map[string]string{}
+		}
+		for k, v := range matcher.KVPairs {
+			t.KVPairs[k] = v
+		}
+
+		if matcher.Account != "" && !replaced {
+			replaced = true
+			if len(matcher.Splits) > 0 {
+				t.split(postingIxs, amount, &matcher)
+			} else {
+				for _, ix := range postingIxs {
+					t.Postings[ix].Account = matcher.Account
+				}
 			}
+		}
 
-			return true
+		if !matcher.Continue {
+			break
 		}
 	}
 
-	return false
+	return matched
 }
 
 // Matcher associates an account or a payee with a regexp to match against a transaction description.
+//
+// A matcher may also have conditions on the amount and date of the transaction. The amount is the amount posted to
+// the account being replaced (for an imported purchase this is positive), and the amount range is compared against
+// its absolute value.
 type Matcher struct {
 	R       *regexp.Regexp
 	Account string
 	Payee   string
+
+	// If set, the matcher matches transactions with this "UUID" KV pair instead of using R, same as the uuid
+	// subdirective of a ledger payee directive.
+	UUID string
+
+	MinAmount    int64 // The smallest allowed amount, inclusive.
+	HasMinAmount bool
+	MaxAmount    int64 // The largest allowed amount, inclusive.
+	HasMaxAmount bool
+	Sign         int       // If positive only positive amounts match, if negative only negative amounts match.
+	Begin        time.Time // If not zero, only transactions on or after this date match.
+	End          time.Time // If not zero, only transactions before this date match.
+
+	// If there are splits, the matched postings are replaced by a posting for each split, and a posting to
+	// Account for what is left.
+	Splits []MatchSplit
+
+	Tags     []string          // Tags to add to the transaction.
+	KVPairs  map[string]string // KV pairs to add to the transaction.
+	Continue bool              // Keep trying later matchers after this one succeeds.
+}
+
+// MatchSplit is an extra posting added by a Matcher. Value is used as is, so for example a tax withholding on a
+// paycheck is a positive value. If Percent is not zero, the value is that percentage of the matched amount instead.
+type MatchSplit struct {
+	Account string
+	Value   int64
+	Percent float64
+}
+
+// split replaces the given postings with the matcher's splits, plus a posting to the matcher's account for
+// whatever is left over. The left over posting is null if any of the replaced postings were.
+func (t *Transaction) split(postingIxs []int, amount int64, m *Matcher) {
+	null := false
+	for _, ix := range postingIxs {
+		null = null || t.Postings[ix].Null
+	}
+
+	splits := make([]Posting, 0, len(m.Splits)+1)
+	rest := amount
+	for _, s := range m.Splits {
+		v := s.Value
+		if s.Percent != 0 {
+			v = int64(math.Round(float64(amount) * s.Percent / 100))
+		}
+		rest -= v
+		splits = append(splits, Posting{Account: s.Account, Value: v})
+	}
+	splits = append(splits, Posting{Account: m.Account, Value: rest, Null: null})
+
+	postings := make([]Posting, 0, len(t.Postings)+len(splits))
+	for i, p := range t.Postings {
+		if i == postingIxs[0] {
+			postings = append(postings, splits...)
+		} else if !slices.Contains(postingIxs, i) {
+			postings = append(postings, p)
+		}
+	}
+	t.Postings = postings
+}
+
+// Matches returns true if the matcher's regexp matches the description of the transaction, or if the matcher has a
+// UUID, if the transaction has the same UUID. The amount and date conditions are not checked.
+func (m *Matcher) Matches(t *Transaction) bool {
+	return m.matches(t.Description, t.KVPairs)
+}
+
+func (m *Matcher) matches(desc string, kvs map[string]string) bool {
+	if m.UUID != "" {
+		return kvs["UUID"] == m.UUID
+	}
+	return m.R.MatchString(desc)
+}
+
+func (m *Matcher) matchConditions(date time.Time, amount int64) bool {
+	switch {
+	case m.Sign > 0 && amount <= 0, m.Sign < 0 && amount >= 0:
+		return false
+	case !m.Begin.IsZero() && date.Before(m.Begin):
+		return false
+	case !m.End.IsZero() && !date.Before(m.End):
+		return false
+	}
+
+	if amount < 0 {
+		amount = -amount
+	}
+	if m.HasMinAmount && amount < m.MinAmount {
+		return false
+	}
+	if m.HasMaxAmount && amount > m.MaxAmount {
+		return false
+	}
+	return true
+}
+
+// FormatOptions controls how transactions and postings are written out. The zero value gives the default format.
+type FormatOptions struct {
+	Indent       string // Written before each posting and comment line. Defaults to a tab.
+	AccountWidth int    // The account column is padded to this many characters. Values less than 1 mean 62.
+	LeftAlign    bool   // Line up amounts on their first character instead of on the decimal point.
+	DateFormat   string // A time package layout for dates. Defaults to "2006/01/02". The parser only reads y/m/d.
+
+	// How to write amounts. The zero value means DefaultAmountFormat, except for File.FormatWith where it means
+	// the file's default.
+	Amount AmountFormat
+
+	// The declared formats, for writing exact amounts in their own commodity (see Posting.Amount). If this is nil
+	// those amounts are rounded and written with Amount like any other. File.FormatWith fills this in.
+	Formats *AmountFormats
+}
+
+func (o FormatOptions) withDefaults() FormatOptions {
+	if o.Indent == "" {
+		o.Indent = "\t"
+	}
+	if o.AccountWidth < 1 {
+		o.AccountWidth = 62
+	}
+	if o.DateFormat == "" {
+		o.DateFormat = "2006/01/02"
+	}
+	if o.Amount.Decimal == 0 {
+		o.Amount = DefaultAmountFormat
+	}
+	return o
 }
 
 func (t *Transaction) String() string {
+	return t.Format(FormatOptions{})
+}
+
+// Format writes the transaction out as text using the given options.
+func (t *Transaction) Format(opts FormatOptions) string {
+	opts = opts.withDefaults()
 	buf := new(bytes.Buffer)
 
-	buf.WriteString(t.Date.Format("2006/01/02"))
+	buf.WriteString(t.Date.Format(opts.DateFormat))
 	if !t.ClearDate.IsZero() {
-		fmt.Fprintf(buf, "=%v", t.ClearDate.Format("2006/01/02"))
+		fmt.Fprintf(buf, "=%v", t.ClearDate.Format(opts.DateFormat))
+	}
+	if t.HasTime {
+		fmt.Fprintf(buf, " %v", formatTimeOfDay(t.Date))
 	}
 
 	switch t.Status {
@@ -289,27 +525,38 @@ func (t *Transaction) String() string {
 	// We don't know if the comments and postings were interleaved in any way,
 	// so canonically we will just do the comments and metadata first.
 	for _, line := range t.Comments {
-		fmt.Fprintf(buf, "\t; %v\n", line)
+		fmt.Fprintf(buf, "%v; %v\n", opts.Indent, line)
 	}
+	// Tags and k/v pairs are sorted so that writing the same transaction always gives the same text.
 	if len(t.Tags) != 0 {
-		fmt.Fprint(buf, "\t; ")
-		for tag := range t.Tags {
+		tags := maps.Keys(t.Tags)
+		slices.Sort(tags)
+		fmt.Fprintf(buf, "%v; ", opts.Indent)
+		for _, tag := range tags {
 			fmt.Fprintf(buf, ":%v", tag)
 		}
 		fmt.Fprint(buf, ":\n")
 	}
-	for k, v := range t.KVPairs {
-		fmt.Fprintf(buf, "\t; %v: %v\n", k, v)
+	keys := maps.Keys(t.KVPairs)
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "%v; %v: %v\n", opts.Indent, k, t.KVPairs[k])
 	}
 
 	for _, p := range t.Postings {
-		fmt.Fprintf(buf, "\t%v\n", p.String())
+		fmt.Fprintf(buf, "%v%v\n", opts.Indent, p.Format(opts))
 	}
 
 	return buf.String()
 }
 
 func (p *Posting) String() string {
+	return p.Format(FormatOptions{})
+}
+
+// Format writes the posting out as text using the given options. The indent is not included.
+func (p *Posting) Format(opts FormatOptions) string {
+	opts = opts.withDefaults()
 	buf := new(bytes.Buffer)
 
 	switch p.Status {
@@ -326,16 +573,22 @@ func (p *Posting) String() string {
 	if !p.Null {
 		// In order to align on the decimal point instead of the first digit, we need to figure out how much value is
 		// before the decimal point so we can reduce the account padding to match.
-		value := FormatValue(p.Value)
+		value, decimal := opts.Amount.Format(p.Value), opts.Amount.Decimal
+		if af, ok := p.exactFormat(opts); ok {
+			value, decimal = af.FormatAmount(p.Amount), af.Decimal
+		}
 
 		// Measure forward offset
-		prefixlen := strings.Index(value, ".")
-		if prefixlen == -1 {
-			prefixlen = len(value)
+		prefixlen := utf8.RuneCountInString(value)
+		if i := strings.IndexRune(value, decimal); i != -1 {
+			prefixlen = utf8.RuneCountInString(value[:i])
+		}
+		if opts.LeftAlign {
+			prefixlen = 0
 		}
 
 		// Calculate padding
-		pad := 62 - prefixlen
+		pad := opts.AccountWidth - prefixlen
 		if pad < 0 {
 			pad = 0
 		}
@@ -347,83 +600,111 @@ func (p *Posting) String() string {
 
 		if p.HasAssert {
 			buf.WriteString(" = ")
-			buf.WriteString(FormatValue(p.Assert))
+			buf.WriteString(opts.Amount.Format(p.Assert))
 		}
 	} else {
 		if p.HasAssert {
-			fmt.Fprintf(buf, "%-62s      = %s", p.Account, FormatValue(p.Assert))
+			fmt.Fprintf(buf, "%-*s      = %s", opts.AccountWidth, p.Account, opts.Amount.Format(p.Assert))
 		} else {
 			buf.WriteString(p.Account)
 		}
 	}
 
-	if p.Note != "" {
+	dates := ""
+	if !p.Date.IsZero() {
+		dates = p.Date.Format(opts.DateFormat)
+	}
+	if !p.AuxDate.IsZero() {
+		dates += "=" + p.AuxDate.Format(opts.DateFormat)
+	}
+	switch {
+	case dates != "" && p.Note != "":
+		fmt.Fprintf(buf, " ; [%v] %v", dates, p.Note)
+	case dates != "":
+		fmt.Fprintf(buf, " ; [%v]", dates)
+	case p.Note != "":
 		fmt.Fprintf(buf, " ; %v", p.Note)
 	}
 
 	return buf.String()
 }
 
+// PostingDate returns the date the posting happened on: its own date if it has one, otherwise the date of its
+// transaction. If effective is set the effective (auxiliary) dates are used first, the posting's and then the
+// transaction's clear date, same as the ledger --effective option.
+func (p *Posting) PostingDate(tr *Transaction, effective bool) time.Time {
+	switch {
+	case effective && !p.AuxDate.IsZero():
+		return p.AuxDate
+	case effective && !tr.ClearDate.IsZero():
+		return tr.ClearDate
+	case !p.Date.IsZero():
+		return p.Date
+	}
+	return tr.Date
+}
+
+// exactFormat returns the format to write the exact amount of the posting with, if it has one that still matches
+// the value and the commodity was declared.
+func (p *Posting) exactFormat(opts FormatOptions) (AmountFormat, bool) {
+	if opts.Formats == nil || p.Amount.Scale() <= ValueScale {
+		return AmountFormat{}, false
+	}
+	if v, ok := p.Amount.Value(); !ok || v != p.Value {
+		return AmountFormat{}, false
+	}
+	af, ok := opts.Formats.Commodities[p.Commodity]
+	return af, ok
+}
+
 // ParseValueNumber takes a decimal number and converts it to a integer with a precision of .
 // Rounding is done via the round to even method.
+// The number is parsed exactly, so large values don't pick up floating point error.
 func ParseValueNumber(v string) (int64, error) {
-	f, err := strconv.ParseFloat(v, 64)
+	a, err := ParseAmount(v)
 	if err != nil {
 		return 0, err
 	}
 
-	ip := int64(f)
-	fp := f - float64(ip)
-	return ip*10000 + int64(fp*10000), nil
+	value, ok := a.Value()
+	if !ok {
+		return 0, ErrMalformedAmount{v}
+	}
+	return value, nil
 }
 
 // FormatValue takes a amount of money in thousandths of a cent and formats it for display.
 // Rounding is done via the round to even method.
 func FormatValue(v int64) string {
-	ms, ls1, ls2 := formatHelper(v)
-	return fmt.Sprintf("$%v.%v%v", ms, ls1, ls2)
+	return "$" + FormatValueNumber(v)
 }
 
 // FormatValueNumber is exactly the same as FormatValue, but it does not add any currency indicators.
 func FormatValueNumber(v int64) string {
-	ms, ls1, ls2 := formatHelper(v)
-	return fmt.Sprintf("%v.%v%v", ms, ls1, ls2)
-}
-
-func formatHelper(v int64) (ms, ls1, ls2 int64) {
-	// This is a little complicated because I not only need to separate the parts, but I also
-	// want to round the result to even. There is probably a better way to do this.
-	ms = v / 10000
-	ls := v % 10000 / 100
-	if ls < 0 {
-		ls = -ls
-	}
-	ls = roundToEven(ls, v%100/10)
-	if ls > 99 {
-		ls = 0
-		ms++
-	} else if ls < 0 {
-		ls = 0
-		ms--
+	neg := v < 0
+	if neg {
+		v = -v
 	}
 
-	ls1 = ls / 10
-	ls2 = ls % 10
+	// Round to the nearest cent, ties go to even.
+	cents, rest := v/100, v%100
+	if rest > 50 || (rest == 50 && cents%2 != 0) {
+		cents++
+	}
 
-	return
+	s := fmt.Sprintf("%d.%02d", cents/100, cents%100)
+	if neg && cents != 0 {
+		s = "-" + s
+	}
+	return s
 }
 
-// Loosely based on the standard library math function.
-// ls must be a value between 0 and 9 (a single decimal digit)
-func roundToEven(ms, ls int64) int64 {
-	odd := (ms % 2) != 0
-	if ls > 5 || (ls == 5 && odd) {
-		if ms > 0 {
-			return ms + 1
-		}
-		return ms - 1
+// formatTimeOfDay writes the time of day of t as 13:45, or 13:45:30 if there are seconds.
+func formatTimeOfDay(t time.Time) string {
+	if t.Second() == 0 {
+		return t.Format("15:04")
 	}
-	return ms
+	return t.Format("15:04:05")
 }
 
 // TransactionDateSorter is a helper for sorting a list of transactions by date.
@@ -445,27 +726,29 @@ func (tds TransactionDateSorter) Swap(i, j int) {
 
 // BalanceError is returned by functions that validate transactions in some way when the transaction isn't balanced.
 type BalanceError struct {
-	T int
-	L lex.Location
+	T  int
+	L  Position
+	ID string // The ID of the transaction, if it has one.
 }
 
 func (err BalanceError) Error() string {
 	if err.T < 0 {
-		return fmt.Sprintf("Transaction (defined on line %v) does not balance.", err.L)
+		return fmt.Sprintf("Transaction (defined at %v) does not balance.", err.L)
 	}
-	return fmt.Sprintf("Transaction %v (defined on line %v) does not balance.", err.T, err.L)
+	return fmt.Sprintf("Transaction %v (defined at %v) does not balance.", err.T, err.L)
 }
 
 // MultipleNullError is returned by functions that validate transactions in some way when the transaction has more
 // than one null posting.
 type MultipleNullError struct {
-	T int
-	L lex.Location
+	T  int
+	L  Position
+	ID string // The ID of the transaction, if it has one.
 }
 
 func (err MultipleNullError) Error() string {
 	if err.T < 0 {
-		return fmt.Sprintf("Transaction (defined on line %v) has multiple null postings.", err.L)
+		return fmt.Sprintf("Transaction (defined at %v) has multiple null postings.", err.L)
 	}
-	return fmt.Sprintf("Transaction %v (defined on line %v) has multiple null postings.", err.T, err.L)
+	return fmt.Sprintf("Transaction %v (defined at %v) has multiple null postings.", err.T, err.L)
 }
@@ -0,0 +1,377 @@
+/*
+Copyright 2021 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ValidateOptions controls which checks File.Validate runs.
+type ValidateOptions struct {
+	// Strict requires every account, payee, commodity, and tag used by a transaction to be declared with a
+	// directive, and checks tag values against their tag directives (see TagError). This is the same thing ledger's
+	// --strict and --pedantic flags do.
+	Strict bool
+}
+
+// Kinds of names reported by UndeclaredError.
+const (
+	UndeclaredAccount   = "account"
+	UndeclaredPayee     = "payee"
+	UndeclaredCommodity = "commodity"
+	UndeclaredTag       = "tag"
+)
+
+// UndeclaredError is returned by File.Validate in strict mode when a transaction uses an account, payee, commodity,
+// or tag that does not have a matching directive. Only :tag: style tags need to be declared, key/value pairs are
+// also used for the IDs and other metadata the tools keep.
+type UndeclaredError struct {
+	Kind string // One of UndeclaredAccount, UndeclaredPayee, UndeclaredCommodity, or UndeclaredTag.
+	Name string
+	T    int
+	L    Position
+	PL   Position // The position of the posting that uses the account or commodity, zero for payees and tags.
+}
+
+func (err UndeclaredError) Error() string {
+	return fmt.Sprintf("Transaction %v (defined at %v) uses undeclared %v %q.", err.T, err.L, err.Kind, err.Name)
+}
+
+// Validate checks every transaction in the file and returns all the problems found, rather than stopping at the
+// first one. Every transaction must balance. In strict mode all accounts (or account aliases), payees, commodities,
+// and tags must also be declared, and tag values must pass the checks of their tag directives. A nil result means
+// the file is valid.
+func (f *File) Validate(opts ValidateOptions) []error {
+	errs := []error{}
+
+	for i, tr := range f.T {
+		errs = append(errs, validateBalance(i, &tr)...)
+	}
+
+	if !opts.Strict {
+		if len(errs) == 0 {
+			return nil
+		}
+		return errs
+	}
+
+	accounts, payees, err := f.declaredNames()
+	if err != nil {
+		return append(errs, err)
+	}
+
+	formats, err := f.AmountFormats()
+	if err != nil {
+		return append(errs, err)
+	}
+	commodities := map[string]bool{}
+	for i := range f.D {
+		v, _ := f.D[i].Parse()
+		if c, ok := v.(*CommodityDirective); ok {
+			commodities[c.Symbol] = true
+		}
+	}
+	for symbol := range formats.Commodities {
+		commodities[symbol] = true
+	}
+	symbol := formats.Default.Symbol
+
+	tags := map[string]*TagDirective{}
+	for i := range f.D {
+		v, _ := f.D[i].Parse()
+		if tag, ok := v.(*TagDirective); ok {
+			tags[tag.Name] = tag
+		}
+	}
+
+	for i, tr := range f.T {
+		if !payees.match(tr.Description) {
+			errs = append(errs, UndeclaredError{UndeclaredPayee, tr.Description, i, tr.Location, Position{}})
+		}
+
+		seen := map[string]bool{}
+		for _, p := range tr.Postings {
+			if !accounts.match(p.Account) && !seen[p.Account] {
+				seen[p.Account] = true
+				errs = append(errs, UndeclaredError{UndeclaredAccount, p.Account, i, tr.Location, p.Location})
+			}
+
+			// Only one currency is supported, so every posting with an amount uses the default commodity.
+			if (!p.Null || p.HasAssert) && !commodities[symbol] && !seen[symbol] {
+				seen[symbol] = true
+				errs = append(errs, UndeclaredError{UndeclaredCommodity, symbol, i, tr.Location, p.Location})
+			}
+		}
+
+		for _, name := range tr.TagNames() {
+			tag, ok := tags[name]
+			if !ok {
+				if tr.Tags[name] {
+					errs = append(errs, UndeclaredError{UndeclaredTag, name, i, tr.Location, Position{}})
+				}
+				continue
+			}
+			if value, ok := tr.TagValue(name); ok && value != "" {
+				errs = append(errs, checkTag(i, &tr, tag, value)...)
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// TagError is returned by File.Validate in strict mode when the value of a tag fails one of the check or assert
+// lines of its tag directive. Ledger only warns about failed checks, but failed asserts are errors.
+type TagError struct {
+	T      int
+	L      Position
+	Tag    string
+	Value  string
+	Expr   string // The check or assert expression that failed.
+	Assert bool
+}
+
+func (err TagError) Error() string {
+	return fmt.Sprintf("Transaction %v (defined at %v) has tag %v with the value %q, which fails %q.", err.T, err.L, err.Tag, err.Value, err.Expr)
+}
+
+// tagCheckExpr matches the value expressions supported in tag check and assert lines: comparing the value to a
+// regexp (value =~ /regexp/) or a string (value == "string", value != "string").
+var tagCheckExpr = regexp.MustCompile(`^value\s*(=~|==|!=)\s*(/.*/|".*")$`)
+
+// checkTag checks a tag value against the check and assert lines of its directive. Expressions that aren't
+// supported (see tagCheckExpr) are skipped.
+func checkTag(i int, tr *Transaction, tag *TagDirective, value string) []error {
+	errs := []error{}
+	check := func(expr string, assert bool) {
+		m := tagCheckExpr.FindStringSubmatch(strings.TrimSpace(expr))
+		if m == nil {
+			return
+		}
+		operand := m[2][1 : len(m[2])-1]
+		ok := true
+		switch m[1] {
+		case "=~":
+			re, err := regexp.Compile(operand)
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			ok = re.MatchString(value)
+		case "==":
+			ok = value == operand
+		case "!=":
+			ok = value != operand
+		}
+		if !ok {
+			errs = append(errs, TagError{i, tr.Location, tag.Name, value, expr, assert})
+		}
+	}
+	for _, expr := range tag.Checks {
+		check(expr, false)
+	}
+	for _, expr := range tag.Asserts {
+		check(expr, true)
+	}
+	return errs
+}
+
+func validateBalance(i int, tr *Transaction) []error {
+	ok, accounts := tr.Balance()
+	if ok {
+		return nil
+	}
+	if accounts == nil {
+		return []error{MultipleNullError{i, tr.Location, tr.KVPairs["ID"]}}
+	}
+	return []error{BalanceError{i, tr.Location, tr.KVPairs["ID"]}}
+}
+
+// nameSet is a set of declared names, plus a list of regexps that also count as declared.
+type nameSet struct {
+	names map[string]bool
+	res   []*regexp.Regexp
+}
+
+func (ns *nameSet) match(name string) bool {
+	if ns.names[name] {
+		return true
+	}
+	for _, re := range ns.res {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// declaredNames collects the account and payee names declared by the directives in this file.
+func (f *File) declaredNames() (accounts, payees *nameSet, err error) {
+	accounts = &nameSet{names: map[string]bool{}}
+	payees = &nameSet{names: map[string]bool{}}
+
+	accts, err := f.Accounts()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, acct := range accts {
+		accounts.names[acct.Name] = true
+		for _, alias := range acct.Aliases {
+			accounts.names[alias] = true
+		}
+	}
+
+	// Top level `alias NAME=ACCOUNT` directives.
+	for i := range f.D {
+		v, _ := f.D[i].Parse()
+		if alias, ok := v.(*AliasDirective); ok {
+			accounts.names[alias.Name] = true
+		}
+	}
+
+	ps, err := f.Payees()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, payee := range ps {
+		payees.names[payee.Name] = true
+		for _, alias := range payee.Aliases {
+			re, err := regexp.Compile(alias)
+			if err != nil {
+				return nil, nil, err
+			}
+			payees.res = append(payees.res, re)
+		}
+	}
+
+	return accounts, payees, nil
+}
+
+// DuplicateIDError is returned by File.ValidateHistory (and so File.CheckMetadata) when two transactions have the
+// same ID and revision ID.
+type DuplicateIDError struct {
+	ID  string
+	RID string
+	T   int // The later of the two transactions.
+	L   Position
+	Of  int // The earlier transaction.
+}
+
+func (err DuplicateIDError) Error() string {
+	if err.RID == "" {
+		return fmt.Sprintf("Transaction %v (defined at %v) has the same ID (%v) as transaction %v.", err.T, err.L, err.ID, err.Of)
+	}
+	return fmt.Sprintf("Transaction %v (defined at %v) has the same ID (%v) and RID (%v) as transaction %v.", err.T, err.L, err.ID, err.RID, err.Of)
+}
+
+// IDCollisionError is returned by File.ValidateHistory (and so File.CheckMetadata) when two transactions have the
+// same ID but don't look like revisions of the same transaction, usually because an ID was made twice on different
+// machines. Left alone, the later one silently replaces the earlier one.
+type IDCollisionError struct {
+	ID     string
+	T      int // The later of the two transactions.
+	L      Position
+	Of     int // The earlier transaction.
+	OfL    Position
+	Reason string
+}
+
+func (err IDCollisionError) Error() string {
+	return fmt.Sprintf("Transaction %v (defined at %v) has the same ID (%v) as transaction %v (defined at %v), but isn't a revision of it: %v.", err.T, err.L, err.ID, err.Of, err.OfL, err.Reason)
+}
+
+// DateOrderError is returned by File.CheckMetadata when a transaction is dated before the one above it.
+type DateOrderError struct {
+	T    int
+	L    Position
+	Prev int // The transaction above it.
+}
+
+func (err DateOrderError) Error() string {
+	return fmt.Sprintf("Transaction %v (defined at %v) is dated before transaction %v.", err.T, err.L, err.Prev)
+}
+
+// MetadataError is returned by File.CheckMetadata when a transaction has a malformed key/value pair.
+type MetadataError struct {
+	T       int
+	L       Position
+	Key     string
+	Problem string
+}
+
+func (err MetadataError) Error() string {
+	return fmt.Sprintf("Transaction %v (defined at %v) has a malformed %v value: %v.", err.T, err.L, err.Key, err.Problem)
+}
+
+// CheckMetadata checks the bookkeeping data of every transaction and returns all the problems found. The ID and
+// RID values must not be empty or contain spaces, a transaction with a RID must also have an ID, and no two
+// transactions may have the same ID and RID (along with the rest of the rules checked by ValidateHistory).
+// Transactions should also be in date order, but later revisions of a transaction are skipped for this, since they
+// are appended to the end of the file no matter their date. A nil result means no problems were found.
+func (f *File) CheckMetadata() []error {
+	errs := []error{}
+
+	ids := map[string]bool{}
+	last := -1
+	for i, tr := range f.T {
+		id, hasID := tr.KVPairs["ID"]
+		_, hasRID := tr.KVPairs["RID"]
+
+		for _, key := range []string{"ID", "RID"} {
+			v, ok := tr.KVPairs[key]
+			switch {
+			case !ok:
+			case v == "":
+				errs = append(errs, MetadataError{i, tr.Location, key, "it is empty"})
+			case strings.ContainsAny(v, " \t"):
+				errs = append(errs, MetadataError{i, tr.Location, key, "it contains spaces"})
+			}
+		}
+		if hasRID && !hasID {
+			errs = append(errs, MetadataError{i, tr.Location, "RID", "the transaction does not have an ID"})
+		}
+
+		if hasID {
+			if ids[id] {
+				continue
+			}
+			ids[id] = true
+		}
+
+		if last != -1 && tr.Date.Before(f.T[last].Date) {
+			errs = append(errs, DateOrderError{i, tr.Location, last})
+		}
+		last = i
+	}
+	errs = append(errs, f.ValidateHistory()...)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}